@@ -1,6 +1,9 @@
 // Агент для сбора рантайм-метрик и их последующей отправки на сервер по протоколу HTTP.
-// Метрики собираются из пакетов runtime и gopsutil
+// Метрики собираются коллекторами [collector.Collector], по умолчанию - из пакетов runtime, gopsutil и /proc,
+// а также из сервисов, отдающих метрики в формате Prometheus [scrape.Collector]
 // Полученые метрики сохраняются в хранилище [storage]
+// Приложения хоста могут передать метрики агенту через локальный прием [push.Server]
+// Значения counter отправляются приростом с последнего подтвержденного сервером значения.
 // Данные перед отправкой на сервер:
 // - подписываются
 // - сжимаются gzip
@@ -11,18 +14,28 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/agent/collector/host"
+	"github.com/AndreyVLZ/metrics/agent/collector/process"
+	"github.com/AndreyVLZ/metrics/agent/collector/scrape"
+	"github.com/AndreyVLZ/metrics/agent/collector/statsd"
 	"github.com/AndreyVLZ/metrics/agent/config"
+	"github.com/AndreyVLZ/metrics/agent/pkg/retry"
 	"github.com/AndreyVLZ/metrics/agent/pkg/task"
+	"github.com/AndreyVLZ/metrics/agent/push"
+	"github.com/AndreyVLZ/metrics/agent/queue"
 	"github.com/AndreyVLZ/metrics/agent/stats"
 	"github.com/AndreyVLZ/metrics/internal/model"
 	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
@@ -31,20 +44,19 @@ import (
 )
 
 const (
-	urlFormat             = "http://%s/updates/" // Эндпоинт для отправки метрик.
-	countTask             = 3                    // Кол-во задач для Агента.
-	attemptConst          = 3                    // Кол-во повторов отправки при ошибки.
-	durationTaskConst     = 2                    // Таймаут опроса метрик из пакета goutils.
-	retryTimeoutStepConst = 2                    // Шаг увелечения таймаута для повторной отправки.
+	urlFormat            = "http://%s/updates/" // Эндпоинт для отправки метрик.
+	durationTaskConst    = 2                    // Таймаут опроса метрик из пакета goutils.
+	backoffBaseConst     = time.Second          // Задержка перед первым повтором отправки.
+	backoffMaxConst      = 30 * time.Second     // Наибольшая задержка перед повтором отправки.
+	breakerFailuresConst = 5                    // Кол-во ошибок передачи подряд, после которых отправка приостанавливается.
+	breakerCooldownConst = 30 * time.Second     // Время, на которое приостанавливается отправка.
+	idempotencyKeyHeader = "Idempotency-Key"    // Заголовок с ключом идемпотентности пакета.
+	agentIDHeader        = "X-Agent-ID"         // Заголовок с идентификатором агента.
+	idempotencyKeyLen    = 16                   // Кол-во случайных байт ключа идемпотентности.
+	queueCollectorName   = "queue"              // Имя коллектора метрик очереди.
+	sendCollectorName    = "send"               // Имя коллектора метрик отправки.
 )
 
-// iStats Интерфейс статистики.
-type iStats interface {
-	Init() error
-	RuntimeList() []model.Metric
-	UtilList() []model.Metric
-}
-
 // storage Интерфейс хранилища.
 type storage interface {
 	Start(ctx context.Context) error
@@ -54,25 +66,96 @@ type storage interface {
 }
 
 // Агент.
+// Метрики собираются зарегистрированными коллекторами collectors.
 type Agent struct {
-	stats     iStats
-	store     storage
-	cfg       *config.Config
-	client    *http.Client
-	log       *slog.Logger
-	chErr     chan error
-	urlToSend string
+	collectors *collector.Registry
+	store      storage
+	push       *push.Server // локальный прием метрик приложений, nil если не задан
+	queue      *queue.Queue // очередь неотправленных пакетов, в памяти если каталог не задан
+	queueMu    sync.Mutex   // добавление в очередь и ее чтение с учетом резервов deltas
+	breaker    *retry.Breaker
+	stats      *sendStats
+	deltas     *deltaTracker
+	backoff    retry.Backoff
+	cfg        *config.Config
+	client     *http.Client
+	log        *slog.Logger
+	chErr      chan error
+	urlToSend  string
+	head       queueHead // ответы 5xx на первый пакет очереди, см. [Agent.drain]
+	// ошибка регистрации коллекторов в New, возвращается из Start
+	errRegister error
 }
 
 // Новый Агент.
+// Зарегистрированы коллекторы метрик пакета runtime (опрос раз в PollInterval),
+// пакета gopsutil и хоста из /proc (опрос раз в половину ReportInterval),
+// а также процессов cfg.ProcessTargets, прием метрик StatsD и опрос
+// целей Prometheus cfg.ScrapeTargets, если они заданы.
 func New(cfg *config.Config, log *slog.Logger) *Agent {
 	store := inmemory.New()
+	st := stats.New()
+	collectors := collector.NewRegistry()
+	errs := make([]error, 0)
+
+	// ошибка регистрации (интервал опроса меньше 1нс) возвращается из Start
+	register := func(cols ...collector.Collector) {
+		if err := collectors.Register(cols...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	register(
+		st.RuntimeCollector(cfg.PollInterval),
+		st.UtilCollector(cfg.ReportInterval/durationTaskConst),
+		host.New(host.Config{Interval: cfg.ReportInterval / durationTaskConst}),
+	)
+
+	if len(cfg.ProcessTargets) > 0 {
+		register(process.New(process.Config{
+			Targets:  cfg.ProcessTargets,
+			Interval: cfg.ReportInterval / durationTaskConst,
+		}))
+	}
+
+	if cfg.StatsDAddr != "" || cfg.StatsDSocket != "" {
+		register(statsd.New(statsd.Config{
+			Addr:     cfg.StatsDAddr,
+			Socket:   cfg.StatsDSocket,
+			Interval: cfg.ReportInterval / durationTaskConst,
+		}))
+	}
+
+	// интервал опроса цели без своего интервала - половина ReportInterval
+	for _, target := range cfg.ScrapeTargets {
+		register(scrape.New(scrape.Config{
+			Target:   target,
+			Interval: cfg.ReportInterval / durationTaskConst,
+		}))
+	}
+
+	var pushSrv *push.Server
+	if cfg.PushAddr != "" {
+		pushSrv = push.New(push.Config{Addr: cfg.PushAddr}, store, log)
+	}
+
+	breaker := retry.NewBreaker(breakerFailuresConst, breakerCooldownConst)
+	sendStats := &sendStats{}
+
+	register(sendStats.collector(cfg.ReportInterval/durationTaskConst, breaker))
 
 	return &Agent{
-		cfg:       cfg,
-		stats:     stats.New(),
-		store:     store,
-		urlToSend: fmt.Sprintf(urlFormat, cfg.Addr),
+		errRegister: errors.Join(errs...),
+		cfg:         cfg,
+		collectors:  collectors,
+		store:       store,
+		push:        pushSrv,
+		queue:       queue.NewMemory(cfg.QueueSize),
+		breaker:     breaker,
+		stats:       sendStats,
+		deltas:      newDeltaTracker(),
+		backoff:     retry.NewBackoff(backoffBaseConst, backoffMaxConst),
+		urlToSend:   fmt.Sprintf(urlFormat, cfg.Addr),
 		client: &http.Client{
 			Transport: &loggingRoundTripper{
 				log:  log,
@@ -84,12 +167,27 @@ func New(cfg *config.Config, log *slog.Logger) *Agent {
 	}
 }
 
-// Err Возвращает канал с ошибками, которые могут возникнуть при работе агента.
+// Register Добавляет коллекторы метрик. Вызывается до Start.
+// Ошибка, если имя коллектора уже занято.
+func (a *Agent) Register(collectors ...collector.Collector) error {
+	return a.collectors.Register(collectors...)
+}
+
+// Err Возвращает канал с фатальными ошибками, которые могут возникнуть при работе агента.
+// Ошибки передачи на сервер не останавливают агента: они учитываются в метриках
+// SendErrors, SendRetries и SendDropped, а пакет сохраняется в очередь.
 func (a *Agent) Err() <-chan error { return a.chErr }
 
-// Stop Остановка агента.
+// Stop Остановка агента. Очередь неотправленных пакетов закрывается
+// после остановки всех задач, в т.ч. последней отправки из очереди.
 func (a *Agent) Stop(ctx context.Context) error {
-	arrErr := make([]error, 0, countTask+a.cfg.RateLimit+1)
+	arrErr := make([]error, 0, len(a.collectors.List())+a.cfg.RateLimit+4)
+
+	if a.push != nil {
+		if err := a.push.Stop(ctx); err != nil {
+			arrErr = append(arrErr, err)
+		}
+	}
 
 	if err := a.store.Stop(ctx); err != nil {
 		arrErr = append(arrErr, err)
@@ -99,12 +197,20 @@ func (a *Agent) Stop(ctx context.Context) error {
 		arrErr = append(arrErr, err)
 	}
 
+	// задачи, в т.ч. drain, остановлены: очередь больше не изменяется
+	if err := a.queue.Close(); err != nil {
+		arrErr = append(arrErr, fmt.Errorf("close queue: %w", err))
+	}
+
 	return errors.Join(arrErr...)
 }
 
 // Start Запускает агента. Возможные ошибки:
-// при инициализации статистики,
-// при иниицализации хранилища.
+// при регистрации коллекторов по умолчанию в New,
+// при инициализации коллекторов,
+// при иниицализации хранилища,
+// при открытии очереди неотправленных пакетов,
+// при открытии сокета локального приема метрик.
 func (a *Agent) Start(ctx context.Context) error {
 	a.log.DebugContext(ctx, "start agent",
 		slog.String("addr", a.cfg.Addr),
@@ -119,7 +225,11 @@ func (a *Agent) Start(ctx context.Context) error {
 		),
 	)
 
-	if err := a.stats.Init(); err != nil {
+	if a.errRegister != nil {
+		return fmt.Errorf("register collectors: %w", a.errRegister)
+	}
+
+	if err := a.collectors.Init(ctx); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
@@ -127,11 +237,59 @@ func (a *Agent) Start(ctx context.Context) error {
 		return fmt.Errorf("%w", err)
 	}
 
+	if err := a.openQueue(); err != nil {
+		return err
+	}
+
+	if a.push != nil {
+		if err := a.push.Start(ctx); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
 	go a.start(ctx)
 
 	return nil
 }
 
+// openQueue Открывает очередь неотправленных пакетов в каталоге QueueDir,
+// если он задан (иначе остается очередь в памяти), и добавляет коллектор ее метрик:
+// SendQueueDepth - кол-во пакетов в очереди,
+// SendQueueDropped - кол-во пакетов, удаленных при переполнении.
+func (a *Agent) openQueue() error {
+	que := a.queue
+
+	if a.cfg.QueueDir != "" {
+		var err error
+
+		que, err = queue.Open(a.cfg.QueueDir, a.cfg.QueueSize)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	var dropped int64
+
+	col := collector.New(queueCollectorName, a.cfg.ReportInterval/durationTaskConst,
+		func(context.Context) []model.Metric {
+			total := que.Dropped()
+			depth := model.NewGaugeMetric("SendQueueDepth", float64(que.Len()))
+			drop := model.NewCounterMetric("SendQueueDropped", total-dropped)
+			dropped = total
+
+			return []model.Metric{depth, drop}
+		},
+	)
+
+	if err := a.collectors.Register(col); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	a.queue = que
+
+	return nil
+}
+
 // start Запуск task'ов и worker'ов Агента.
 func (a *Agent) start(ctx context.Context) {
 	ctxCan, cancel := context.WithCancel(ctx)
@@ -154,19 +312,142 @@ func (a *Agent) start(ctx context.Context) {
 	close(a.chErr)
 }
 
-// sendBatch Отправка метрик.
+// sendBatch Отправка метрик пакетами не больше BatchSize метрик:
+// сервер отклоняет пакеты больше своего лимита.
+// Возвращает только фатальные ошибки, см. [Agent.handleSendErr].
 func (a *Agent) sendBatch(ctx context.Context, arr []model.Metric) error {
+	for len(arr) > 0 {
+		size := len(arr)
+		if a.cfg.BatchSize > 0 && size > a.cfg.BatchSize {
+			size = a.cfg.BatchSize
+		}
+
+		if err := a.sendPart(ctx, arr[:size]); err != nil {
+			return err
+		}
+
+		arr = arr[size:]
+	}
+
+	return nil
+}
+
+// sendPart Отправка пакета метрик.
+// Значения counter передаются приростом с последнего
+// подтвержденного значения, см. [deltaTracker].
+// Пакет, который не удалось отправить, сохраняется в очередь и отправляется
+// позже задачей drain с тем же ключом идемпотентности. Пока очередь
+// не пуста, новые пакеты добавляются в ее конец: порядок пакетов сохраняется.
+func (a *Agent) sendPart(ctx context.Context, arr []model.Metric) error {
+	// ключ один на все повторы пакета: сервер применит пакет один раз
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return fmt.Errorf("%w: idempotency key: %w", errFatal, err)
+	}
+
+	arr, res := a.deltas.reserve(arr)
+	batch := queue.Batch{Key: key, Metrics: model.BuildArrMetricJSON(arr)}
+
+	if a.queue.Len() > 0 {
+		return a.enqueue(batch, res)
+	}
+
+	return a.handleSendErr(ctx, batch, res, a.send(ctx, batch))
+}
+
+// drain Отправляет пакеты из очереди по порядку до первой ошибки передачи:
+// пакет останется в очереди. Отклоненный сервером пакет удаляется,
+// как и пакет, на который сервер ответил 5xx QueueRetries раз: иначе пакет,
+// который сервер не может сохранить, навсегда задержит следующие.
+// Прирост counter пакета подтверждается ответом 2xx, прирост удаленных
+// без отправки пакетов будет отправлен следующим пакетом, см. [deltaTracker.settle].
+func (a *Agent) drain(ctx context.Context) error {
+	for ctx.Err() == nil {
+		batch, seq, ok, err := a.peek()
+		if err != nil {
+			return fmt.Errorf("%w: queue peek: %w", errFatal, err)
+		}
+
+		if !ok {
+			return nil
+		}
+
+		err = a.send(ctx, batch)
+
+		switch {
+		case err == nil:
+			a.deltas.settle(batch.Key, true)
+		case errors.Is(err, errRejected) || a.head.exhausted(seq, err, a.cfg.QueueRetries):
+			a.deltas.settle(batch.Key, false)
+			a.stats.dropped.Add(1)
+			a.log.WarnContext(ctx, "drain queue, dropped", slog.String("error", err.Error()))
+		case errors.Is(err, errFatal):
+			return err
+		default:
+			a.log.WarnContext(ctx, "drain queue", slog.String("error", err.Error()))
+
+			return nil
+		}
+
+		if err := a.queue.Remove(seq); err != nil {
+			return fmt.Errorf("%w: queue remove: %w", errFatal, err)
+		}
+	}
+
+	return nil
+}
+
+// queueHead учет ответов 5xx на первый пакет очереди.
+type queueHead struct {
+	seq   uint64
+	fails int
+}
+
+// exhausted учитывает ошибку err отправки пакета seq из начала очереди
+// и возвращает true, если сервер ответил 5xx на пакет limit раз.
+// Ошибки соединения и разомкнутый автомат защиты не учитываются:
+// сервер недоступен, а не отвергает пакет. limit 0 - без ограничения.
+func (h *queueHead) exhausted(seq uint64, err error, limit int) bool {
+	if h.seq != seq {
+		h.seq, h.fails = seq, 0
+	}
+
+	if limit == 0 || !errors.Is(err, errServer) {
+		return false
+	}
+
+	h.fails++
+
+	return h.fails >= limit
+}
+
+// peek Возвращает первый пакет очереди.
+// Если очередь пуста, снимает резервы пакетов, удаленных без отправки.
+func (a *Agent) peek() (queue.Batch, uint64, bool, error) {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+
+	batch, seq, ok, err := a.queue.Peek()
+	if err == nil && !ok {
+		a.deltas.releaseQueued()
+	}
+
+	return batch, seq, ok, err
+}
+
+// send Отправка пакета метрик.
+func (a *Agent) send(ctx context.Context, batch queue.Batch) error {
 	var header http.Header = make(map[string][]string)
 
-	data, err := json.Marshal(model.BuildArrMetricJSON(arr))
+	data, err := json.Marshal(batch.Metrics)
 	if err != nil {
-		return fmt.Errorf("%w", err)
+		return fmt.Errorf("%w: %w", errFatal, err)
 	}
 
 	// хeшируем данные
 	sum, err := hashed(a.cfg.Key, data)
 	if err != nil {
-		return fmt.Errorf("req hashed: %w", err)
+		return fmt.Errorf("%w: req hashed: %w", errFatal, err)
 	}
 
 	header.Set("HashSHA256", hex.EncodeToString(sum))
@@ -174,22 +455,27 @@ func (a *Agent) sendBatch(ctx context.Context, arr []model.Metric) error {
 	// сжимаем данные
 	dataCompress, err := gzipCompres(data)
 	if err != nil {
-		return fmt.Errorf("req compress: %w", err)
+		return fmt.Errorf("%w: req compress: %w", errFatal, err)
 	}
 
 	header.Set("Content-Encoding", "gzip")
+	header.Set(idempotencyKeyHeader, batch.Key)
+
+	if a.cfg.AgentID != "" {
+		header.Set(agentIDHeader, a.cfg.AgentID)
+	}
 
 	// шифруем данные
 	dataEncrypt, err := encrypt(a.cfg.PublicKey, dataCompress)
 	if err != nil {
-		return fmt.Errorf("req crypto: %w", err)
+		return fmt.Errorf("%w: req crypto: %w", errFatal, err)
 	}
 
-	return retry(ctx, attemptConst, time.Second, a.log, func() error {
+	return a.retry(ctx, func() error {
 		// собираем запрос
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.urlToSend, bytes.NewReader(dataEncrypt))
 		if err != nil {
-			return fmt.Errorf("build request: %w", err)
+			return fmt.Errorf("%w: build request: %w", errFatal, err)
 		}
 
 		header.Set("Content-Type", "application/json")
@@ -199,35 +485,14 @@ func (a *Agent) sendBatch(ctx context.Context, arr []model.Metric) error {
 	})
 }
 
-// Повторный вызов функции fnSend attempts раз.
-// Возвращает ошибку с кол-вом вызовов функции и самой ошибкой fnSend.
-func retry(ctx context.Context, attempts int, sleep time.Duration, log *slog.Logger, fnSend func() error) error {
-	var err error
-
-	for i := 0; i <= attempts; i++ {
-		if i > 0 {
-			log.DebugContext(ctx, "send",
-				slog.Group("send",
-					slog.Int("retry", i),
-					slog.String("error", err.Error()),
-				),
-			)
-
-			select {
-			case <-ctx.Done():
-				return nil
-			case <-time.After(sleep):
-				sleep += retryTimeoutStepConst * time.Second
-			}
-		}
-
-		err = fnSend()
-		if err == nil {
-			return nil
-		}
+// newIdempotencyKey Возвращает случайный ключ идемпотентности.
+func newIdempotencyKey() (string, error) {
+	buf := make([]byte, idempotencyKeyLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("%w", err)
 	}
 
-	return fmt.Errorf("попыток %d, error: %w", attempts, err)
+	return hex.EncodeToString(buf), nil
 }
 
 // hashed Возвращает хеш.
@@ -275,19 +540,35 @@ func encrypt(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
 }
 
 // do Выполняет запрос.
+// Ошибка передачи и ответы 5xx, 408 - errTransport: запрос можно повторить,
+// в том числе при недоступности хранилища сервера.
+// Прочие ответы кроме 2xx - errRejected: сервер отклонил пакет (неверная метрика,
+// устаревшее значение, 413 и 429 при превышении лимитов), повтор не поможет.
 func (a *Agent) do(req *http.Request) error {
 	// выполняем запрос
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("err to send request: %w", err)
+		return fmt.Errorf("%w: send request: %w", errTransport, err)
 	}
 
+	// дочитываем тело для повторного использования соединения
+	_, _ = io.Copy(io.Discard, resp.Body)
+
 	// закрывает тело ответа
 	if err = resp.Body.Close(); err != nil {
-		return fmt.Errorf("err body close: %w", err)
+		return fmt.Errorf("%w: body close: %w", errTransport, err)
 	}
 
-	return nil
+	switch code := resp.StatusCode; {
+	case code >= http.StatusOK && code < http.StatusMultipleChoices:
+		return nil
+	case code >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: %w: status %d", errTransport, errServer, code)
+	case code == http.StatusRequestTimeout:
+		return fmt.Errorf("%w: status %d", errTransport, code)
+	default:
+		return fmt.Errorf("%w: status %d", errRejected, code)
+	}
 }
 
 // runTaskPoll Запуск пула задач Агента.
@@ -295,17 +576,21 @@ func (a *Agent) runTaskPoll(ctx context.Context) <-chan []model.Metric {
 	ctxCan, cancel := context.WithCancel(ctx)
 	chList := make(chan []model.Metric)
 
-	taskPoll := task.NewPoll(countTask, a.log)
-	// определяем задачи для Агента
+	collectors := a.collectors.List()
+	taskPoll := task.NewPoll(len(collectors)+2, a.log)
+
+	// сбор метрик: по задаче на коллектор
+	for _, col := range collectors {
+		col := col
+		taskPoll.Add(
+			task.New("collect "+col.Name(),
+				col.Interval(),
+				func() error { return a.store.AddBatch(ctxCan, col.Collect(ctxCan)) },
+			),
+		)
+	}
+
 	taskPoll.Add(
-		task.New("update runtime", // сбор метрик (опрос runtime)
-			a.cfg.PollInterval,
-			func() error { return a.store.AddBatch(ctxCan, a.stats.RuntimeList()) },
-		),
-		task.New("update gopsutil", // сбор метрики из пакета gopsutil
-			a.cfg.ReportInterval/durationTaskConst,
-			func() error { return a.store.AddBatch(ctxCan, a.stats.UtilList()) },
-		),
 		task.New("read from store", // чтение метрик из store
 			a.cfg.ReportInterval,
 			func() error {
@@ -320,6 +605,13 @@ func (a *Agent) runTaskPoll(ctx context.Context) <-chan []model.Metric {
 		),
 	)
 
+	taskPoll.Add(
+		task.New("drain queue", // отправка пакетов из очереди
+			a.cfg.ReportInterval,
+			func() error { return a.drain(ctxCan) },
+		),
+	)
+
 	// запускаем пул задач
 	chErrTask := taskPoll.Run(ctxCan)
 
@@ -1,17 +1,25 @@
 package agent_test
 
 import (
+	"compress/gzip"
 	"context"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/AndreyVLZ/metrics/agent"
+	"github.com/AndreyVLZ/metrics/agent/collector"
 	"github.com/AndreyVLZ/metrics/agent/config"
+	"github.com/AndreyVLZ/metrics/agent/queue"
+	"github.com/AndreyVLZ/metrics/agent/stats"
+	"github.com/AndreyVLZ/metrics/internal/model"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,6 +43,7 @@ func TestStartStop(t *testing.T) {
 			exit <- struct{}{}
 		}()
 		assert.Equal(t, wantEndpoint, req.URL.String())
+		assert.Len(t, req.Header.Get("Idempotency-Key"), 32)
 
 		body := req.Body
 		defer body.Close()
@@ -83,3 +92,227 @@ func TestStartStop(t *testing.T) {
 		t.Logf("agent stop err: %v\n", err)
 	}
 }
+
+// newReceiver возвращает тестовый сервер, передающий тела запросов в канал.
+func newReceiver(t *testing.T) (*httptest.Server, <-chan string) {
+	received := make(chan string, 10)
+
+	tsrv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+
+		gzr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Errorf("gzip reader: %v\n", err)
+
+			return
+		}
+
+		data, err := io.ReadAll(gzr)
+		if err != nil {
+			t.Errorf("read body: %v\n", err)
+		}
+
+		received <- string(data)
+	}))
+
+	return tsrv, received
+}
+
+// Ошибка регистрации коллекторов по умолчанию возвращается из Start.
+func TestStartRegisterErr(t *testing.T) {
+	// половина ReportInterval - 0
+	cfg, err := config.New(config.SetReportInterval(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	err = agent.New(cfg, slog.Default()).Start(context.Background())
+	assert.ErrorContains(t, err, "register collectors")
+}
+
+func TestRegister(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+
+	tsrv, received := newReceiver(t)
+	defer tsrv.Close()
+
+	cfg, err := config.New(
+		config.SetAddr(strings.TrimPrefix(tsrv.URL, "http://")),
+		config.SetReportInterval(1*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	agent := agent.New(cfg, slog.Default())
+
+	custom := collector.New("custom", 100*time.Millisecond, func(context.Context) []model.Metric {
+		return []model.Metric{model.NewGaugeMetric("CustomGauge", 1)}
+	})
+
+	assert.NoError(t, agent.Register(custom))
+	assert.ErrorIs(t, agent.Register(collector.New(stats.RuntimeCollectorName, time.Second, nil)), collector.ErrDuplicate)
+
+	ctxStart, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
+
+	if err := agent.Start(ctxStart); err != nil {
+		t.Fatalf("start agent err: %v\n", err)
+	}
+
+	select {
+	case <-time.After(3 * time.Second):
+		t.Error("batch not received")
+	case body := <-received:
+		assert.Contains(t, body, `"id":"CustomGauge"`)
+	}
+
+	cancelStart()
+
+	ctxStop, cancelStop := context.WithTimeout(ctx, time.Second)
+	defer cancelStop()
+
+	if err := agent.Stop(ctxStop); err != nil {
+		t.Logf("agent stop err: %v\n", err)
+	}
+}
+
+func TestPush(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+
+	tsrv, received := newReceiver(t)
+	defer tsrv.Close()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+
+	cfg, err := config.New(
+		config.SetAddr(strings.TrimPrefix(tsrv.URL, "http://")),
+		config.SetReportInterval(1*time.Second),
+		config.SetPushAddr("unix:"+socket),
+	)
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	agent := agent.New(cfg, slog.Default())
+
+	ctxStart, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
+
+	if err := agent.Start(ctxStart); err != nil {
+		t.Fatalf("start agent err: %v\n", err)
+	}
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	resp, err := client.Post("http://agent/updates/", "application/json",
+		strings.NewReader(`[{"id":"AppGauge","type":"gauge","value":7}]`))
+	if err != nil {
+		t.Fatalf("push: %v\n", err)
+	}
+
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	select {
+	case <-time.After(3 * time.Second):
+		t.Error("batch not received")
+	case body := <-received:
+		assert.Contains(t, body, `"id":"AppGauge"`)
+	}
+
+	cancelStart()
+
+	ctxStop, cancelStop := context.WithTimeout(ctx, time.Second)
+	defer cancelStop()
+
+	if err := agent.Stop(ctxStop); err != nil {
+		t.Logf("agent stop err: %v\n", err)
+	}
+}
+
+func TestQueueDrain(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+
+	tsrv, received := newReceiver(t)
+	defer tsrv.Close()
+
+	// пакет, не отправленный прошлым запуском
+	dir := t.TempDir()
+
+	que, err := queue.Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = que.Push(queue.Batch{
+		Key:     "key",
+		Metrics: model.BuildArrMetricJSON([]model.Metric{model.NewGaugeMetric("QueuedGauge", 1)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.New(
+		config.SetAddr(strings.TrimPrefix(tsrv.URL, "http://")),
+		config.SetReportInterval(1*time.Second),
+		config.SetQueueDir(dir),
+	)
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	agent := agent.New(cfg, slog.Default())
+
+	ctxStart, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
+
+	if err := agent.Start(ctxStart); err != nil {
+		t.Fatalf("start agent err: %v\n", err)
+	}
+
+	bodies := make([]string, 0)
+	timeout := time.After(3 * time.Second)
+
+	for !strings.Contains(strings.Join(bodies, ""), `"id":"QueuedGauge"`) {
+		select {
+		case <-timeout:
+			t.Fatal("queued batch not received")
+		case body := <-received:
+			bodies = append(bodies, body)
+		}
+	}
+
+	// отправленный пакет удаляется из очереди,
+	// в ней могут остаться новые пакеты
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "00000000000000000000.json"))
+
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+
+	cancelStart()
+
+	ctxStop, cancelStop := context.WithTimeout(ctx, time.Second)
+	defer cancelStop()
+
+	if err := agent.Stop(ctxStop); err != nil {
+		t.Logf("agent stop err: %v\n", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Источники метрик агента.
+// Агент опрашивает каждый зарегистрированный Collector раз в его Interval
+// и сохраняет собранные метрики до отправки на сервер.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+var (
+	errNameEmpty     = errors.New("collector name is empty")
+	errIntervalEmpty = errors.New("collector interval not valid")
+	// ErrDuplicate коллектор с таким именем уже зарегистрирован.
+	ErrDuplicate = errors.New("collector already registered")
+)
+
+// Collector источник метрик.
+type Collector interface {
+	Name() string            // уникальное имя
+	Interval() time.Duration // интервал опроса
+	Collect(ctx context.Context) []model.Metric
+}
+
+// Initer коллектор, которому нужна инициализация перед первым опросом.
+type Initer interface {
+	Init(ctx context.Context) error
+}
+
+// Func коллектор из функции.
+type Func struct {
+	fnCollect func(ctx context.Context) []model.Metric
+	fnInit    func(ctx context.Context) error
+	name      string
+	interval  time.Duration
+}
+
+// FuncOpt опции коллектора из функции.
+type FuncOpt func(*Func)
+
+// SetInit устанавливает функцию инициализации коллектора.
+func SetInit(fnInit func(ctx context.Context) error) FuncOpt {
+	return func(f *Func) {
+		f.fnInit = fnInit
+	}
+}
+
+// New возвращает коллектор name, опрашивающий fnCollect раз в interval.
+func New(name string, interval time.Duration, fnCollect func(ctx context.Context) []model.Metric, opts ...FuncOpt) *Func {
+	f := &Func{
+		fnCollect: fnCollect,
+		name:      name,
+		interval:  interval,
+	}
+
+	for i := range opts {
+		opts[i](f)
+	}
+
+	return f
+}
+
+func (f *Func) Name() string                               { return f.name }
+func (f *Func) Interval() time.Duration                    { return f.interval }
+func (f *Func) Collect(ctx context.Context) []model.Metric { return f.fnCollect(ctx) }
+
+// Init вызывает функцию инициализации, если она задана.
+func (f *Func) Init(ctx context.Context) error {
+	if f.fnInit == nil {
+		return nil
+	}
+
+	return f.fnInit(ctx)
+}
+
+// Registry список коллекторов агента в порядке регистрации.
+type Registry struct {
+	list []Collector
+	mu   sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{list: make([]Collector, 0)}
+}
+
+// Register добавляет коллекторы.
+// Ошибка, если имя пустое, интервал не положительный или имя уже занято.
+// Коллекторы добавляются все или ни одного.
+func (r *Registry) Register(collectors ...Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make(map[string]struct{}, len(r.list)+len(collectors))
+	for i := range r.list {
+		names[r.list[i].Name()] = struct{}{}
+	}
+
+	for _, col := range collectors {
+		name := col.Name()
+
+		switch {
+		case name == "":
+			return errNameEmpty
+		case col.Interval() <= 0:
+			return fmt.Errorf("%w: [%s] %s", errIntervalEmpty, name, col.Interval())
+		}
+
+		if _, dup := names[name]; dup {
+			return fmt.Errorf("%w: [%s]", ErrDuplicate, name)
+		}
+
+		names[name] = struct{}{}
+	}
+
+	r.list = append(r.list, collectors...)
+
+	return nil
+}
+
+// List возвращает зарегистрированные коллекторы.
+func (r *Registry) List() []Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Collector, len(r.list))
+	copy(list, r.list)
+
+	return list
+}
+
+// Init инициализирует коллекторы, которым это нужно.
+func (r *Registry) Init(ctx context.Context) error {
+	for _, col := range r.List() {
+		initer, ok := col.(Initer)
+		if !ok {
+			continue
+		}
+
+		if err := initer.Init(ctx); err != nil {
+			return fmt.Errorf("init [%s]: %w", col.Name(), err)
+		}
+	}
+
+	return nil
+}
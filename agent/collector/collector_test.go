@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGauge(name string) *Func {
+	return New(name, time.Second, func(context.Context) []model.Metric {
+		return []model.Metric{model.NewGaugeMetric(name, 1)}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("register", func(t *testing.T) {
+		reg := NewRegistry()
+
+		assert.NoError(t, reg.Register(newGauge("a"), newGauge("b")))
+		assert.ErrorIs(t, reg.Register(newGauge("c"), newGauge("a")), ErrDuplicate)
+		assert.ErrorIs(t, reg.Register(newGauge("c"), newGauge("c")), ErrDuplicate)
+
+		// при ошибке не добавляется ни один коллектор
+		list := reg.List()
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, "a", list[0].Name())
+			assert.Equal(t, "b", list[1].Name())
+		}
+	})
+
+	t.Run("not valid", func(t *testing.T) {
+		reg := NewRegistry()
+
+		assert.ErrorIs(t, reg.Register(newGauge("")), errNameEmpty)
+		assert.ErrorIs(t, reg.Register(New("a", 0, nil)), errIntervalEmpty)
+		assert.Empty(t, reg.List())
+	})
+
+	t.Run("init", func(t *testing.T) {
+		ctx := context.Background()
+		errInit := errors.New("init err")
+		inited := false
+
+		reg := NewRegistry()
+		err := reg.Register(
+			newGauge("a"),
+			New("b", time.Second, nil, SetInit(func(context.Context) error { inited = true; return nil })),
+		)
+		assert.NoError(t, err)
+		assert.NoError(t, reg.Init(ctx))
+		assert.True(t, inited)
+
+		assert.NoError(t, reg.Register(New("c", time.Second, nil, SetInit(func(context.Context) error { return errInit }))))
+		assert.ErrorIs(t, reg.Init(ctx), errInit)
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		col := newGauge("a")
+
+		assert.Equal(t, time.Second, col.Interval())
+		assert.Equal(t, []model.Metric{model.NewGaugeMetric("a", 1)}, col.Collect(context.Background()))
+	})
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "Alloc", SanitizeName("Alloc"))
+	assert.Equal(t, "bucket_le__Inf", SanitizeName("bucket_le_+Inf"))
+	assert.Equal(t, "ScrapeUp_localhost_9100", SanitizeName("ScrapeUp_localhost:9100"))
+	assert.Equal(t, "err_file__C__DIR_", SanitizeName("err_file:\"C:\\DIR\n"))
+
+	long := strings.Repeat("a", MaxNameLen) + "_le_0.005"
+	short := SanitizeName(long)
+	assert.Len(t, short, MaxNameLen)
+	assert.True(t, strings.HasPrefix(short, strings.Repeat("a", 41)+"_"))
+	assert.NotEqual(t, short, SanitizeName(strings.Repeat("a", MaxNameLen)+"_le_0.01"))
+	assert.Equal(t, short, SanitizeName(long))
+}
@@ -0,0 +1,283 @@
+// Коллектор метрик хоста, читаемых из /proc (Linux):
+// загрузка каждого ядра CPU, средняя загрузка, swap,
+// заполненность и ввод-вывод дисков, трафик сетевых интерфейсов.
+// На других системах /proc отсутствует и коллектор не возвращает метрик.
+//
+// Накопительные счетчики /proc (байты, пакеты, операции) передаются как counter
+// с приращением с предыдущего опроса: counter на сервере складывает приращения.
+// При первом опросе приращение 0: значение с загрузки системы могло быть
+// передано прежним запуском агента.
+//
+// Имена устройств и точек монтирования приводятся к виду, который принимает
+// сервер, см. [collector.SanitizeName].
+package host
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	NameConst        = "host"  // Имя коллектора.
+	RootDefault      = "/proc" // Каталог /proc по умолчанию.
+	sectorSizeConst  = 512     // Размер сектора в /proc/diskstats.
+	unitBytes        = "bytes"
+	unitPercent      = "%"
+	mountRootName    = "root" // Имя точки монтирования '/' в имени метрики.
+	nameSepConst     = "_"    // Разделитель имени метрики и устройства.
+	devicePrefixDisk = "/dev/"
+)
+
+// Config конфигурация коллектора.
+type Config struct {
+	Root     string        // каталог /proc
+	Interval time.Duration // интервал опроса
+}
+
+// fsStat размер и доступное место файловой системы в байтах.
+type fsStat struct {
+	total uint64
+	free  uint64
+}
+
+// Collector коллектор метрик хоста.
+// Загрузка CPU считается по изменению счетчиков /proc/stat
+// с предыдущего опроса, при первом опросе - с загрузки системы.
+type Collector struct {
+	statfs    func(path string) (fsStat, error)
+	prevCPU   map[string]cpuTimes
+	prevCount map[string]uint64 // значения накопительных счетчиков по именам метрик
+	cfg       Config
+	mu        sync.Mutex
+}
+
+func New(cfg Config) *Collector {
+	if cfg.Root == "" {
+		cfg.Root = RootDefault
+	}
+
+	return &Collector{
+		statfs:    statfs,
+		prevCPU:   make(map[string]cpuTimes),
+		prevCount: make(map[string]uint64),
+		cfg:       cfg,
+	}
+}
+
+func (c *Collector) Name() string            { return NameConst }
+func (c *Collector) Interval() time.Duration { return c.cfg.Interval }
+
+// Collect возвращает метрики хоста.
+// Источники, которые не удалось прочитать, пропускаются.
+func (c *Collector) Collect(_ context.Context) []model.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]model.Metric, 0)
+
+	for _, read := range []func() ([]model.Metric, error){
+		c.cpu,
+		c.load,
+		c.swap,
+		c.diskUsage,
+		c.diskIO,
+		c.net,
+	} {
+		arr, err := read()
+		if err != nil {
+			continue
+		}
+
+		list = append(list, arr...)
+	}
+
+	now := time.Now().UTC()
+	for i := range list {
+		list[i].TS = now
+	}
+
+	return list
+}
+
+// cpu загрузка каждого ядра в процентах: CPUutilization1..N.
+func (c *Collector) cpu() ([]model.Metric, error) {
+	times, err := readCPUTimes(c.path("stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.Metric, 0, len(times))
+
+	for i, cur := range times {
+		util := cur.utilization(c.prevCPU[cur.name])
+		c.prevCPU[cur.name] = cur
+
+		list = append(list, gauge("CPUutilization"+strconv.Itoa(i+1), util, unitPercent, "загрузка ядра "+cur.name))
+	}
+
+	return list, nil
+}
+
+// load средняя загрузка за 1, 5 и 15 минут.
+func (c *Collector) load() ([]model.Metric, error) {
+	avg, err := readLoadAvg(c.path("loadavg"))
+	if err != nil {
+		return nil, err
+	}
+
+	return []model.Metric{
+		gauge("LoadAverage1", avg[0], "", "средняя загрузка за 1 минуту"),
+		gauge("LoadAverage5", avg[1], "", "средняя загрузка за 5 минут"),
+		gauge("LoadAverage15", avg[2], "", "средняя загрузка за 15 минут"),
+	}, nil
+}
+
+// swap размер, свободное и занятое место swap.
+func (c *Collector) swap() ([]model.Metric, error) {
+	info, err := readMemInfo(c.path("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+
+	total, free := info["SwapTotal"], info["SwapFree"]
+
+	return []model.Metric{
+		gauge("SwapTotal", float64(total), unitBytes, "размер swap"),
+		gauge("SwapFree", float64(free), unitBytes, "свободно в swap"),
+		gauge("SwapUsed", float64(total-free), unitBytes, "занято в swap"),
+	}, nil
+}
+
+// diskUsage заполненность файловых систем блочных устройств по точкам монтирования.
+func (c *Collector) diskUsage() ([]model.Metric, error) {
+	mounts, err := readMounts(c.path("self", "mounts"))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.Metric, 0, len(mounts)*4)
+
+	for _, mnt := range mounts {
+		stat, err := c.statfs(mnt)
+		if err != nil || stat.total == 0 {
+			continue
+		}
+
+		name := mountName(mnt)
+		used := stat.total - stat.free
+
+		list = append(list,
+			gauge(deviceName("DiskTotal", name), float64(stat.total), unitBytes, "размер "+mnt),
+			gauge(deviceName("DiskFree", name), float64(stat.free), unitBytes, "свободно на "+mnt),
+			gauge(deviceName("DiskUsed", name), float64(used), unitBytes, "занято на "+mnt),
+			gauge(deviceName("DiskUsedPercent", name), 100*float64(used)/float64(stat.total), unitPercent, "занято на "+mnt),
+		)
+	}
+
+	return list, nil
+}
+
+// diskIO прочитано и записано байт и операций по устройствам.
+func (c *Collector) diskIO() ([]model.Metric, error) {
+	stats, err := readDiskStats(c.path("diskstats"))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.Metric, 0, len(stats)*4)
+
+	for _, st := range stats {
+		list = append(list,
+			c.counter(deviceName("DiskReads", st.name), st.reads, "", "операций чтения "+st.name),
+			c.counter(deviceName("DiskWrites", st.name), st.writes, "", "операций записи "+st.name),
+			c.counter(deviceName("DiskReadBytes", st.name), st.readSectors*sectorSizeConst, unitBytes, "прочитано с "+st.name),
+			c.counter(deviceName("DiskWriteBytes", st.name), st.writeSectors*sectorSizeConst, unitBytes, "записано на "+st.name),
+		)
+	}
+
+	return list, nil
+}
+
+// net принято и передано байт, пакетов и ошибок по сетевым интерфейсам.
+func (c *Collector) net() ([]model.Metric, error) {
+	stats, err := readNetDev(c.path("net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.Metric, 0, len(stats)*6)
+
+	for _, st := range stats {
+		list = append(list,
+			c.counter(deviceName("NetRxBytes", st.name), st.rxBytes, unitBytes, "принято "+st.name),
+			c.counter(deviceName("NetTxBytes", st.name), st.txBytes, unitBytes, "передано "+st.name),
+			c.counter(deviceName("NetRxPackets", st.name), st.rxPackets, "", "принято пакетов "+st.name),
+			c.counter(deviceName("NetTxPackets", st.name), st.txPackets, "", "передано пакетов "+st.name),
+			c.counter(deviceName("NetRxErrors", st.name), st.rxErrors, "", "ошибок приема "+st.name),
+			c.counter(deviceName("NetTxErrors", st.name), st.txErrors, "", "ошибок передачи "+st.name),
+		)
+	}
+
+	return list, nil
+}
+
+// path возвращает путь к файлу внутри каталога /proc.
+func (c *Collector) path(elem ...string) string {
+	return strings.Join(append([]string{c.cfg.Root}, elem...), "/")
+}
+
+// counter возвращает counter с приращением накопительного счетчика cur
+// с предыдущего опроса. При первом опросе приращение 0, при сбросе счетчика
+// (cur меньше прежнего значения) - cur.
+func (c *Collector) counter(name string, cur uint64, unit, help string) model.Metric {
+	prev, ok := c.prevCount[name]
+	c.prevCount[name] = cur
+
+	var delta uint64
+
+	switch {
+	case !ok:
+	case cur < prev:
+		delta = cur
+	default:
+		delta = cur - prev
+	}
+
+	met := model.NewCounterMetric(name, int64(min(delta, math.MaxInt64)))
+	met.Unit = unit
+	met.Help = help
+
+	return met
+}
+
+// deviceName возвращает имя метрики устройства или точки монтирования.
+func deviceName(prefix, device string) string {
+	return collector.SanitizeName(prefix + nameSepConst + device)
+}
+
+// gauge возвращает gauge со сведениями.
+func gauge(name string, val float64, unit, help string) model.Metric {
+	met := model.NewGaugeMetric(name, val)
+	met.Unit = unit
+	met.Help = help
+
+	return met
+}
+
+// mountName возвращает имя точки монтирования для имени метрики:
+// '/' - root, '/var/lib' - var_lib.
+func mountName(path string) string {
+	name := strings.Trim(path, "/")
+	if name == "" {
+		return mountRootName
+	}
+
+	return strings.ReplaceAll(name, "/", nameSepConst)
+}
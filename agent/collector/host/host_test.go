@@ -0,0 +1,165 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// values возвращает значения метрик по именам.
+func values(list []model.Metric) map[string]float64 {
+	vals := make(map[string]float64, len(list))
+	for _, met := range list {
+		if met.MType == model.TypeCountConst {
+			vals[met.MName] = float64(*met.Delta)
+
+			continue
+		}
+
+		vals[met.MName] = *met.Val
+	}
+
+	return vals
+}
+
+// types возвращает типы метрик по именам.
+func types(list []model.Metric) map[string]model.Type {
+	res := make(map[string]model.Type, len(list))
+	for _, met := range list {
+		res[met.MName] = met.MType
+	}
+
+	return res
+}
+
+func newTestCollector(root string) *Collector {
+	col := New(Config{Root: root, Interval: time.Second})
+	col.statfs = func(path string) (fsStat, error) {
+		switch path {
+		case "/":
+			return fsStat{total: 1000, free: 250}, nil
+		case "/var/lib/my data":
+			return fsStat{total: 200, free: 200}, nil
+		default:
+			return fsStat{}, errors.New("not mounted")
+		}
+	}
+
+	return col
+}
+
+func TestCollect(t *testing.T) {
+	col := newTestCollector("testdata/proc")
+
+	assert.Equal(t, NameConst, col.Name())
+	assert.Equal(t, time.Second, col.Interval())
+
+	list := col.Collect(context.Background())
+	vals := values(list)
+
+	for _, met := range list {
+		assert.False(t, met.TS.IsZero(), met.MName)
+	}
+
+	// первый опрос - загрузка с момента запуска системы
+	assert.InDelta(t, 100*2410.0/3910.0, vals["CPUutilization1"], 1e-9)
+	assert.Contains(t, vals, "CPUutilization2")
+	assert.NotContains(t, vals, "CPUutilization3")
+
+	assert.Equal(t, 0.52, vals["LoadAverage1"])
+	assert.Equal(t, 0.58, vals["LoadAverage5"])
+	assert.Equal(t, 0.59, vals["LoadAverage15"])
+
+	assert.Equal(t, float64(2097148*1024), vals["SwapTotal"])
+	assert.Equal(t, float64(1048574*1024), vals["SwapFree"])
+	assert.Equal(t, float64((2097148-1048574)*1024), vals["SwapUsed"])
+
+	assert.Equal(t, float64(1000), vals["DiskTotal_root"])
+	assert.Equal(t, float64(750), vals["DiskUsed_root"])
+	assert.Equal(t, float64(75), vals["DiskUsedPercent_root"])
+	assert.Equal(t, float64(0), vals["DiskUsedPercent_var_lib_my_data"])
+	assert.NotContains(t, vals, "DiskTotal_run")
+	assert.Equal(t, model.TypeGaugeConst, types(list)["DiskTotal_root"])
+
+	// накопительные счетчики: при первом опросе приращение 0
+	assert.Equal(t, float64(0), vals["DiskReads_sda"])
+	assert.Equal(t, model.TypeCountConst, types(list)["DiskReads_sda"])
+	assert.Contains(t, vals, "DiskReadBytes_sda")
+	assert.Contains(t, vals, "DiskWriteBytes_sda")
+	assert.Contains(t, vals, "DiskReads_sda1")
+	assert.NotContains(t, vals, "DiskReads_loop0")
+
+	assert.Equal(t, float64(0), vals["NetRxBytes_eth0"])
+	assert.Equal(t, model.TypeCountConst, types(list)["NetRxBytes_eth0"])
+	assert.Contains(t, vals, "NetTxBytes_eth0")
+	assert.Contains(t, vals, "NetRxPackets_eth0")
+	assert.Contains(t, vals, "NetRxErrors_eth0")
+	assert.Contains(t, vals, "NetTxErrors_eth0")
+	assert.Contains(t, vals, "NetRxBytes_lo")
+}
+
+func TestCollectCounterDelta(t *testing.T) {
+	root := t.TempDir()
+	dev := filepath.Join(root, "net", "dev")
+
+	if err := os.Mkdir(filepath.Dir(dev), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(rxBytes string) {
+		line := "eth0 0:" + rxBytes + " 2000 3 0 0 0 0 0 765432 1500 1 0 0 0 0 0\n"
+		if err := os.WriteFile(dev, []byte(line), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	col := newTestCollector(root)
+
+	write("1000")
+	assert.Equal(t, float64(0), values(col.Collect(context.Background()))["NetRxBytes_eth0_0"])
+
+	write("1500")
+	vals := values(col.Collect(context.Background()))
+	assert.Equal(t, float64(500), vals["NetRxBytes_eth0_0"])
+	assert.Equal(t, float64(0), vals["NetTxBytes_eth0_0"])
+
+	// счетчик сброшен
+	write("200")
+	assert.Equal(t, float64(200), values(col.Collect(context.Background()))["NetRxBytes_eth0_0"])
+}
+
+func TestCollectCPUDelta(t *testing.T) {
+	root := t.TempDir()
+	stat := filepath.Join(root, "stat")
+
+	write := func(data string) {
+		if err := os.WriteFile(stat, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	col := newTestCollector(root)
+
+	write("cpu0 100 0 100 800 0 0 0 0 0 0\n")
+	col.Collect(context.Background())
+
+	// за интервал: 300 занято, 100 простой
+	write("cpu0 300 0 200 850 50 0 0 0 0 0\n")
+	vals := values(col.Collect(context.Background()))
+
+	assert.Equal(t, float64(75), vals["CPUutilization1"])
+	assert.Len(t, vals, 1)
+}
+
+func TestCollectNoProc(t *testing.T) {
+	col := New(Config{Root: filepath.Join(t.TempDir(), "proc")})
+
+	assert.Equal(t, RootDefault, New(Config{}).cfg.Root)
+	assert.Empty(t, col.Collect(context.Background()))
+}
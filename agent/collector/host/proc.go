@@ -0,0 +1,297 @@
+package host
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var errFormat = errors.New("proc format not valid")
+
+// cpuTimes счетчики времени ядра из /proc/stat.
+type cpuTimes struct {
+	name  string
+	total uint64
+	idle  uint64 // idle + iowait
+}
+
+// utilization возвращает загрузку в процентах с момента prev.
+func (cur cpuTimes) utilization(prev cpuTimes) float64 {
+	total := cur.total - prev.total
+	if cur.total < prev.total || total == 0 {
+		return 0
+	}
+
+	idle := cur.idle - prev.idle
+	if cur.idle < prev.idle || idle > total {
+		return 0
+	}
+
+	return 100 * float64(total-idle) / float64(total)
+}
+
+// diskStat счетчики устройства из /proc/diskstats.
+type diskStat struct {
+	name         string
+	reads        uint64
+	readSectors  uint64
+	writes       uint64
+	writeSectors uint64
+}
+
+// netStat счетчики интерфейса из /proc/net/dev.
+type netStat struct {
+	name      string
+	rxBytes   uint64
+	rxPackets uint64
+	rxErrors  uint64
+	txBytes   uint64
+	txPackets uint64
+	txErrors  uint64
+}
+
+// readCPUTimes читает счетчики каждого ядра (строки cpuN) в порядке номеров.
+func readCPUTimes(path string) ([]cpuTimes, error) {
+	list := make([]cpuTimes, 0)
+
+	err := readLines(path, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] == "cpu" || !strings.HasPrefix(fields[0], "cpu") {
+			return nil
+		}
+
+		vals, err := parseUints(fields[1:])
+		if err != nil {
+			return err
+		}
+
+		times := cpuTimes{name: fields[0], idle: vals[3]}
+		if len(vals) > 4 {
+			times.idle += vals[4]
+		}
+
+		// guest и guest_nice уже учтены в user и nice
+		for i := 0; i < len(vals) && i < 8; i++ {
+			times.total += vals[i]
+		}
+
+		list = append(list, times)
+
+		return nil
+	})
+
+	return list, err
+}
+
+// readLoadAvg читает среднюю загрузку за 1, 5 и 15 минут.
+func readLoadAvg(path string) ([3]float64, error) {
+	var avg [3]float64
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return avg, fmt.Errorf("%w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < len(avg) {
+		return avg, fmt.Errorf("%w: %s", errFormat, path)
+	}
+
+	for i := range avg {
+		if avg[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return avg, fmt.Errorf("%w: %s: %w", errFormat, path, err)
+		}
+	}
+
+	return avg, nil
+}
+
+// readMemInfo читает значения /proc/meminfo в байтах.
+func readMemInfo(path string) (map[string]uint64, error) {
+	info := make(map[string]uint64)
+
+	err := readLines(path, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil
+		}
+
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errFormat, err)
+		}
+
+		if len(fields) > 2 && fields[2] == "kB" {
+			val *= 1024
+		}
+
+		info[strings.TrimSuffix(fields[0], ":")] = val
+
+		return nil
+	})
+
+	return info, err
+}
+
+// readMounts читает пути точек монтирования блочных устройств.
+func readMounts(path string) ([]string, error) {
+	list := make([]string, 0)
+	seen := make(map[string]struct{})
+
+	err := readLines(path, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], devicePrefixDisk) {
+			return nil
+		}
+
+		mnt := unescapeMount(fields[1])
+		if _, ok := seen[mnt]; ok {
+			return nil
+		}
+
+		seen[mnt] = struct{}{}
+		list = append(list, mnt)
+
+		return nil
+	})
+
+	return list, err
+}
+
+// unescapeMount заменяет восьмеричные последовательности (\040 - пробел) в пути.
+func unescapeMount(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var buf strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if code, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				buf.WriteByte(byte(code))
+				i += 3
+
+				continue
+			}
+		}
+
+		buf.WriteByte(path[i])
+	}
+
+	return buf.String()
+}
+
+// readDiskStats читает счетчики устройств, кроме loop и ram.
+func readDiskStats(path string) ([]diskStat, error) {
+	list := make([]diskStat, 0)
+
+	err := readLines(path, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			return nil
+		}
+
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			return nil
+		}
+
+		vals, err := parseUints(fields[3:10])
+		if err != nil {
+			return err
+		}
+
+		list = append(list, diskStat{
+			name:         name,
+			reads:        vals[0],
+			readSectors:  vals[2],
+			writes:       vals[4],
+			writeSectors: vals[6],
+		})
+
+		return nil
+	})
+
+	return list, err
+}
+
+// readNetDev читает счетчики сетевых интерфейсов.
+func readNetDev(path string) ([]netStat, error) {
+	list := make([]netStat, 0)
+
+	err := readLines(path, func(line string) error {
+		// строки заголовков без ':', имя интерфейса может быть слитно со значением: 'eth0:123'
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil
+		}
+
+		name = strings.TrimSpace(name)
+
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			return fmt.Errorf("%w: %s", errFormat, name)
+		}
+
+		vals, err := parseUints(fields[:16])
+		if err != nil {
+			return err
+		}
+
+		list = append(list, netStat{
+			name:      name,
+			rxBytes:   vals[0],
+			rxPackets: vals[1],
+			rxErrors:  vals[2],
+			txBytes:   vals[8],
+			txPackets: vals[9],
+			txErrors:  vals[10],
+		})
+
+		return nil
+	})
+
+	return list, err
+}
+
+// readLines вызывает fn для каждой строки файла.
+func readLines(path string, fn func(line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if err := fn(scanner.Text()); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// parseUints разбирает поля как беззнаковые числа.
+func parseUints(fields []string) ([]uint64, error) {
+	vals := make([]uint64, len(fields))
+
+	for i := range fields {
+		val, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errFormat, err)
+		}
+
+		vals[i] = val
+	}
+
+	return vals, nil
+}
@@ -0,0 +1,56 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUtilization(t *testing.T) {
+	prev := cpuTimes{total: 1000, idle: 800}
+
+	assert.Equal(t, float64(50), cpuTimes{total: 1200, idle: 900}.utilization(prev))
+	// счетчики не изменились или сброшены
+	assert.Equal(t, float64(0), prev.utilization(prev))
+	assert.Equal(t, float64(0), cpuTimes{total: 10, idle: 5}.utilization(prev))
+}
+
+func TestUnescapeMount(t *testing.T) {
+	assert.Equal(t, "/mnt/my data", unescapeMount(`/mnt/my\040data`))
+	assert.Equal(t, "/mnt/a\tb", unescapeMount(`/mnt/a\011b`))
+	assert.Equal(t, `/mnt/x\9`, unescapeMount(`/mnt/x\9`))
+	assert.Equal(t, "/", unescapeMount("/"))
+}
+
+func TestMountName(t *testing.T) {
+	assert.Equal(t, "root", mountName("/"))
+	assert.Equal(t, "home", mountName("/home"))
+	assert.Equal(t, "var_lib", mountName("/var/lib/"))
+}
+
+func TestReadErr(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	_, err := readNetDev(write("dev", "eth0: 1 2 3\n"))
+	assert.ErrorIs(t, err, errFormat)
+
+	_, err = readLoadAvg(write("loadavg", "0.1 x 0.3\n"))
+	assert.ErrorIs(t, err, errFormat)
+
+	_, err = readCPUTimes(write("stat", "cpu0 1 2 x 4 5\n"))
+	assert.ErrorIs(t, err, errFormat)
+
+	_, err = readMemInfo(filepath.Join(dir, "meminfo"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
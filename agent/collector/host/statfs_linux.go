@@ -0,0 +1,19 @@
+package host
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// statfs возвращает размер и доступное место файловой системы по пути path.
+func statfs(path string) (fsStat, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return fsStat{}, fmt.Errorf("statfs [%s]: %w", path, err)
+	}
+
+	bsize := uint64(stat.Bsize)
+
+	return fsStat{total: stat.Blocks * bsize, free: stat.Bavail * bsize}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package host
+
+import "errors"
+
+// statfs на других системах не поддерживается.
+func statfs(_ string) (fsStat, error) { return fsStat{}, errors.ErrUnsupported }
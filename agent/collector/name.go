@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+// MaxNameLen наибольшая длина имени метрики, которую принимают хранилища сервера.
+const MaxNameLen = model.MaxNameLen
+
+const nameHashLen = 8 // Кол-во символов хеша в сокращенном имени.
+
+// SanitizeName возвращает имя метрики из символов [A-Za-z0-9_]:
+// прочие символы заменяются на '_'. Имя длиннее MaxNameLen сокращается
+// до начала имени и хеша полного имени, чтобы сокращенные имена не совпадали.
+func SanitizeName(name string) string {
+	res := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+
+	if len(res) <= MaxNameLen {
+		return res
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+
+	return res[:MaxNameLen-nameHashLen-1] + "_" + fmt.Sprintf("%0*x", nameHashLen, hash.Sum32())
+}
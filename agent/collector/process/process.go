@@ -0,0 +1,378 @@
+// Коллектор метрик процессов хоста, читаемых пакетом gopsutil/process.
+// Каталог /proc задается переменной окружения HOST_PROC, как во всем gopsutil.
+// Процессы задаются именем, PID или pid-файлом. Для каждой цели
+// передаются метрики с префиксом Process_<метка>_: суммарные по всем
+// найденным процессам RSS, время CPU, открытые файлы и потоки,
+// время работы самого старого процесса и кол-во найденных процессов.
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/process"
+)
+
+const (
+	NameConst     = "process" // Имя коллектора.
+	prefixConst   = "Process_"
+	targetSep     = ","
+	labelSep      = "="
+	kindSep       = ":"
+	pidFileSuffix = ".pid"
+	unitBytes     = "bytes"
+	unitSeconds   = "seconds"
+)
+
+var (
+	errTargetEmpty = errors.New("process target is empty")
+	errTargetKind  = errors.New("process target kind not support")
+	errTargetDup   = errors.New("process target label duplicate")
+)
+
+// Kind способ поиска процесса.
+type Kind string
+
+const (
+	KindName    Kind = "name"    // по имени (comm или имени исполняемого файла)
+	KindPID     Kind = "pid"     // по PID
+	KindPIDFile Kind = "pidfile" // по PID из файла
+)
+
+// Target процесс для наблюдения.
+type Target struct {
+	Kind  Kind
+	Value string // имя, PID или путь до pid-файла
+	Label string // метка в имени метрик
+}
+
+// ParseTargets разбирает список целей через запятую.
+// Цель задается как [метка=][name:|pid:|pidfile:]значение,
+// без способа - по имени. Метка по умолчанию: имя процесса,
+// 'pid<PID>' или имя pid-файла без '.pid'. Символы метки вне [A-Za-z0-9_]
+// заменяются на '_', метки целей не должны совпадать.
+// Например: 'nginx,pid:1,db=pidfile:/run/postgresql.pid'.
+func ParseTargets(str string) ([]Target, error) {
+	list := make([]Target, 0)
+	labels := make(map[string]struct{})
+
+	for _, item := range strings.Split(str, targetSep) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		target, err := parseTarget(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := labels[target.Label]; ok {
+			return nil, fmt.Errorf("%w: [%s]", errTargetDup, target.Label)
+		}
+
+		labels[target.Label] = struct{}{}
+		list = append(list, target)
+	}
+
+	return list, nil
+}
+
+func parseTarget(item string) (Target, error) {
+	var target Target
+
+	if label, spec, ok := strings.Cut(item, labelSep); ok {
+		target.Label, item = label, spec
+	}
+
+	target.Kind, target.Value = KindName, item
+
+	if kind, val, ok := strings.Cut(item, kindSep); ok {
+		target.Kind, target.Value = Kind(kind), val
+	}
+
+	if target.Value == "" {
+		return Target{}, fmt.Errorf("%w: [%s]", errTargetEmpty, item)
+	}
+
+	switch target.Kind {
+	case KindName:
+	case KindPID:
+		if _, err := strconv.Atoi(target.Value); err != nil {
+			return Target{}, fmt.Errorf("pid [%s]: %w", target.Value, err)
+		}
+	case KindPIDFile:
+	default:
+		return Target{}, fmt.Errorf("%w: [%s]", errTargetKind, target.Kind)
+	}
+
+	if target.Label == "" {
+		target.Label = defaultLabel(target)
+	}
+
+	target.Label = collector.SanitizeName(target.Label)
+
+	return target, nil
+}
+
+// defaultLabel возвращает метку цели по умолчанию.
+func defaultLabel(target Target) string {
+	switch target.Kind {
+	case KindPID:
+		return string(KindPID) + target.Value
+	case KindPIDFile:
+		return strings.TrimSuffix(filepath.Base(target.Value), pidFileSuffix)
+	default:
+		return target.Value
+	}
+}
+
+// Config конфигурация коллектора.
+type Config struct {
+	Targets  []Target      // наблюдаемые процессы
+	Interval time.Duration // интервал опроса
+}
+
+// proc сведения о процессе, реализуется [process.Process].
+type proc interface {
+	NameWithContext(ctx context.Context) (string, error)
+	CmdlineSliceWithContext(ctx context.Context) ([]string, error)
+	MemoryInfoWithContext(ctx context.Context) (*process.MemoryInfoStat, error)
+	TimesWithContext(ctx context.Context) (*cpu.TimesStat, error)
+	NumFDsWithContext(ctx context.Context) (int32, error)
+	NumThreadsWithContext(ctx context.Context) (int32, error)
+	CreateTimeWithContext(ctx context.Context) (int64, error)
+}
+
+// Collector коллектор метрик процессов.
+type Collector struct {
+	now  func() time.Time
+	pids func(ctx context.Context) ([]int32, error)
+	open func(ctx context.Context, pid int32) (proc, error)
+	cfg  Config
+	mu   sync.Mutex
+}
+
+func New(cfg Config) *Collector {
+	return &Collector{
+		now:  time.Now,
+		pids: process.PidsWithContext,
+		open: openProc,
+		cfg:  cfg,
+	}
+}
+
+func (c *Collector) Name() string            { return NameConst }
+func (c *Collector) Interval() time.Duration { return c.cfg.Interval }
+
+// Collect возвращает метрики каждой цели.
+// Для цели без найденных процессов передается только кол-во процессов 0.
+func (c *Collector) Collect(ctx context.Context) []model.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UTC()
+	list := make([]model.Metric, 0, len(c.cfg.Targets)*6)
+	// все процессы читаются один раз за опрос и только для целей по имени
+	var all []proc
+
+	for _, target := range c.cfg.Targets {
+		var (
+			sum     procStat
+			count   int
+			started time.Time
+		)
+
+		if target.Kind == KindName && all == nil {
+			all = c.all(ctx)
+		}
+
+		for _, p := range c.find(ctx, target, all) {
+			stat, err := readProc(ctx, p)
+			if err != nil {
+				// процесс мог завершиться между поиском и чтением
+				continue
+			}
+
+			count++
+			sum.rss += stat.rss
+			sum.cpu += stat.cpu
+			sum.fds += stat.fds
+			sum.threads += stat.threads
+
+			if !stat.started.IsZero() && (started.IsZero() || stat.started.Before(started)) {
+				started = stat.started
+			}
+		}
+
+		prefix := prefixConst + target.Label + "_"
+		list = append(list, gauge(prefix+"Count", float64(count), "", "кол-во процессов "+target.Label))
+
+		if count == 0 {
+			continue
+		}
+
+		list = append(list,
+			gauge(prefix+"RSS", float64(sum.rss), unitBytes, "резидентная память "+target.Label),
+			gauge(prefix+"CPUSeconds", sum.cpu, unitSeconds, "время CPU "+target.Label),
+			gauge(prefix+"OpenFDs", float64(sum.fds), "", "открытые файлы "+target.Label),
+			gauge(prefix+"Threads", float64(sum.threads), "", "потоки "+target.Label),
+		)
+
+		if !started.IsZero() {
+			list = append(list, gauge(prefix+"Uptime", now.Sub(started).Seconds(), unitSeconds, "время работы "+target.Label))
+		}
+	}
+
+	for i := range list {
+		list[i].TS = now
+	}
+
+	return list
+}
+
+// find возвращает процессы цели.
+func (c *Collector) find(ctx context.Context, target Target, all []proc) []proc {
+	switch target.Kind {
+	case KindPID:
+		pid, _ := strconv.ParseInt(target.Value, 10, 32)
+
+		return c.openPID(ctx, int32(pid))
+	case KindPIDFile:
+		data, err := os.ReadFile(target.Value)
+		if err != nil {
+			return nil
+		}
+
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil
+		}
+
+		return c.openPID(ctx, int32(pid))
+	default:
+		return findByName(ctx, all, target.Value)
+	}
+}
+
+// openPID возвращает процесс pid или nil, если процесса нет.
+func (c *Collector) openPID(ctx context.Context, pid int32) []proc {
+	p, err := c.open(ctx, pid)
+	if err != nil {
+		return nil
+	}
+
+	return []proc{p}
+}
+
+// all возвращает все процессы хоста.
+func (c *Collector) all(ctx context.Context) []proc {
+	pids, err := c.pids(ctx)
+	if err != nil {
+		return []proc{}
+	}
+
+	list := make([]proc, 0, len(pids))
+
+	for _, pid := range pids {
+		if p, err := c.open(ctx, pid); err == nil {
+			list = append(list, p)
+		}
+	}
+
+	return list
+}
+
+// findByName возвращает процессы, у которых имя (comm)
+// или имя исполняемого файла из cmdline равны name.
+func findByName(ctx context.Context, all []proc, name string) []proc {
+	list := make([]proc, 0)
+
+	for _, p := range all {
+		if comm, err := p.NameWithContext(ctx); err == nil && comm == name {
+			list = append(list, p)
+
+			continue
+		}
+
+		if argv, err := p.CmdlineSliceWithContext(ctx); err == nil && len(argv) > 0 && filepath.Base(argv[0]) == name {
+			list = append(list, p)
+		}
+	}
+
+	return list
+}
+
+// procStat показатели процесса.
+type procStat struct {
+	started time.Time // время запуска, нулевое если неизвестно
+	rss     uint64    // байт
+	cpu     float64   // user + system, секунд
+	fds     int
+	threads int
+}
+
+// readProc читает показатели процесса.
+func readProc(ctx context.Context, p proc) (procStat, error) {
+	var stat procStat
+
+	mem, err := p.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return stat, fmt.Errorf("memory: %w", err)
+	}
+
+	times, err := p.TimesWithContext(ctx)
+	if err != nil {
+		return stat, fmt.Errorf("times: %w", err)
+	}
+
+	threads, err := p.NumThreadsWithContext(ctx)
+	if err != nil {
+		return stat, fmt.Errorf("threads: %w", err)
+	}
+
+	stat.rss = mem.RSS
+	stat.cpu = times.User + times.System
+	stat.threads = int(threads)
+
+	// открытые файлы другого пользователя недоступны, считаются 0
+	if fds, err := p.NumFDsWithContext(ctx); err == nil {
+		stat.fds = int(fds)
+	}
+
+	if ms, err := p.CreateTimeWithContext(ctx); err == nil && ms > 0 {
+		stat.started = time.UnixMilli(ms)
+	}
+
+	return stat, nil
+}
+
+// openProc возвращает процесс pid из gopsutil.
+func openProc(ctx context.Context, pid int32) (proc, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return nil, fmt.Errorf("process [%d]: %w", pid, err)
+	}
+
+	return p, nil
+}
+
+// gauge возвращает gauge со сведениями.
+// Имя из префикса, метки и показателя сокращается до [collector.MaxNameLen].
+func gauge(name string, val float64, unit, help string) model.Metric {
+	met := model.NewGaugeMetric(collector.SanitizeName(name), val)
+	met.Unit = unit
+	met.Help = help
+
+	return met
+}
@@ -0,0 +1,208 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNoProc = errors.New("no process")
+
+// fakeProc процесс с заданными показателями.
+type fakeProc struct {
+	name    string
+	cmdline []string
+	rss     uint64
+	user    float64
+	system  float64
+	fds     int32
+	threads int32
+	created int64 // мс
+	gone    bool  // процесс завершился после поиска
+}
+
+func (p *fakeProc) NameWithContext(_ context.Context) (string, error) { return p.name, nil }
+
+func (p *fakeProc) CmdlineSliceWithContext(_ context.Context) ([]string, error) {
+	return p.cmdline, nil
+}
+
+func (p *fakeProc) MemoryInfoWithContext(_ context.Context) (*process.MemoryInfoStat, error) {
+	if p.gone {
+		return nil, errNoProc
+	}
+
+	return &process.MemoryInfoStat{RSS: p.rss}, nil
+}
+
+func (p *fakeProc) TimesWithContext(_ context.Context) (*cpu.TimesStat, error) {
+	return &cpu.TimesStat{User: p.user, System: p.system}, nil
+}
+
+func (p *fakeProc) NumFDsWithContext(_ context.Context) (int32, error) {
+	if p.fds < 0 {
+		return 0, os.ErrPermission
+	}
+
+	return p.fds, nil
+}
+
+func (p *fakeProc) NumThreadsWithContext(_ context.Context) (int32, error) { return p.threads, nil }
+func (p *fakeProc) CreateTimeWithContext(_ context.Context) (int64, error) { return p.created, nil }
+
+// fakeProcs подменяет в коллекторе процессы хоста.
+func fakeProcs(col *Collector, procs map[int32]*fakeProc) {
+	col.pids = func(_ context.Context) ([]int32, error) {
+		pids := make([]int32, 0, len(procs))
+		for pid := range procs {
+			pids = append(pids, pid)
+		}
+
+		return pids, nil
+	}
+
+	col.open = func(_ context.Context, pid int32) (proc, error) {
+		p, ok := procs[pid]
+		if !ok {
+			return nil, errNoProc
+		}
+
+		return p, nil
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	list, err := ParseTargets(" nginx, pid:1,db=pidfile:/run/postgresql.pid,,web=name:nginx")
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{
+		{Kind: KindName, Value: "nginx", Label: "nginx"},
+		{Kind: KindPID, Value: "1", Label: "pid1"},
+		{Kind: KindPIDFile, Value: "/run/postgresql.pid", Label: "db"},
+		{Kind: KindName, Value: "nginx", Label: "web"},
+	}, list)
+
+	list, err = ParseTargets("pidfile:/run/nginx.pid")
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx", list[0].Label)
+
+	list, err = ParseTargets("")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	_, err = ParseTargets("pid:abc")
+	assert.Error(t, err)
+
+	_, err = ParseTargets("port:80")
+	assert.ErrorIs(t, err, errTargetKind)
+
+	_, err = ParseTargets("db=pid:")
+	assert.ErrorIs(t, err, errTargetEmpty)
+}
+
+func TestParseTargetsLabel(t *testing.T) {
+	list, err := ParseTargets("php-fpm,web.1=pid:1,pidfile:/run/my app.pid")
+	assert.NoError(t, err)
+	assert.Equal(t, "php_fpm", list[0].Label)
+	assert.Equal(t, "web_1", list[1].Label)
+	assert.Equal(t, "my_app", list[2].Label)
+
+	_, err = ParseTargets("nginx,nginx=pid:1")
+	assert.ErrorIs(t, err, errTargetDup)
+
+	// метки совпадают после замены символов
+	_, err = ParseTargets("php-fpm,php_fpm")
+	assert.ErrorIs(t, err, errTargetDup)
+}
+
+func TestCollect(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "postgres.pid")
+	if err := os.WriteFile(pidFile, []byte("300\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	targets, err := ParseTargets("nginx,db=pidfile:" + pidFile + ",pid:999,pid:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col := New(Config{Targets: targets, Interval: time.Second})
+	col.now = func() time.Time { return time.Unix(1700000100, 0) }
+	fakeProcs(col, map[int32]*fakeProc{
+		100: {
+			name: "nginx", cmdline: []string{"nginx: master"}, rss: 250 * 4096,
+			user: 1.5, system: 0.5, fds: 3, threads: 1, created: 1700000010000,
+		},
+		200: {
+			name: "worker", cmdline: []string{"/usr/sbin/nginx", "worker"}, rss: 150 * 4096,
+			user: 0.5, fds: 2, threads: 3, created: 1700000050000,
+		},
+		300: {
+			name: "postgres", cmdline: []string{"postgres"}, rss: 400 * 4096,
+			user: 4, system: 1, fds: -1, threads: 5, created: 1700000005000,
+		},
+		400: {name: "nginx", gone: true},
+	})
+
+	assert.Equal(t, NameConst, col.Name())
+	assert.Equal(t, time.Second, col.Interval())
+
+	list := col.Collect(context.Background())
+	vals := make(map[string]float64, len(list))
+
+	for _, met := range list {
+		assert.Equal(t, model.TypeGaugeConst, met.MType, met.MName)
+		assert.Equal(t, time.Unix(1700000100, 0).UTC(), met.TS, met.MName)
+		vals[met.MName] = *met.Val
+	}
+
+	// nginx: 100 по имени и 200 по имени исполняемого файла, 400 завершился
+	assert.Equal(t, 2.0, vals["Process_nginx_Count"])
+	assert.Equal(t, 400.0*4096, vals["Process_nginx_RSS"])
+	assert.Equal(t, 2.5, vals["Process_nginx_CPUSeconds"])
+	assert.Equal(t, 5.0, vals["Process_nginx_OpenFDs"])
+	assert.Equal(t, 4.0, vals["Process_nginx_Threads"])
+	assert.Equal(t, 90.0, vals["Process_nginx_Uptime"]) // самый старый
+
+	assert.Equal(t, 1.0, vals["Process_db_Count"])
+	assert.Equal(t, 5.0, vals["Process_db_CPUSeconds"])
+	assert.Equal(t, 0.0, vals["Process_db_OpenFDs"]) // нет доступа
+	assert.Equal(t, 95.0, vals["Process_db_Uptime"])
+
+	assert.Equal(t, 0.0, vals["Process_pid999_Count"])
+	assert.NotContains(t, vals, "Process_pid999_RSS")
+
+	assert.Equal(t, 1.0, vals["Process_pid100_Count"])
+	assert.Equal(t, 3.0, vals["Process_pid100_OpenFDs"])
+	assert.Len(t, list, 3*6+1)
+}
+
+func TestCollectLongLabel(t *testing.T) {
+	targets, err := ParseTargets(strings.Repeat("a", collector.MaxNameLen) + "=pid:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col := New(Config{Targets: targets})
+	fakeProcs(col, map[int32]*fakeProc{1: {name: "init", threads: 1}})
+
+	list := col.Collect(context.Background())
+	assert.Len(t, list, 5) // без Uptime: время запуска неизвестно
+
+	names := make(map[string]struct{}, len(list))
+	for _, met := range list {
+		assert.LessOrEqual(t, len(met.MName), collector.MaxNameLen, met.MName)
+		names[met.MName] = struct{}{}
+	}
+
+	assert.Len(t, names, len(list))
+}
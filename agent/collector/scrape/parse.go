@@ -0,0 +1,240 @@
+package scrape
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errFormat = errors.New("exposition format not valid")
+
+// Типы семейств метрик Prometheus.
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+	typeSummary   = "summary"
+	typeUntyped   = "untyped"
+)
+
+// label метка значения.
+type label struct {
+	name  string
+	value string
+}
+
+// sample значение из текстового формата Prometheus.
+type sample struct {
+	ts     time.Time // время из значения, нулевое если не задано
+	name   string
+	family string // имя семейства из # TYPE или имя значения
+	mType  string // тип семейства
+	help   string
+	unit   string
+	labels []label
+	value  float64
+}
+
+// family сведения семейства из комментариев # TYPE, # HELP, # UNIT.
+type family struct {
+	mType string
+	help  string
+	unit  string
+}
+
+// суффиксы значений гистограмм, summary и счетчиков OpenMetrics.
+var familySuffixes = [...]string{"_bucket", "_count", "_sum", "_total", "_created"}
+
+// parse разбирает текстовый формат Prometheus (и совместимый OpenMetrics).
+// Пустые строки, прочие комментарии и # EOF пропускаются.
+func parse(r io.Reader) ([]sample, error) {
+	families := make(map[string]*family)
+	list := make([]sample, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			parseComment(line, families)
+
+			continue
+		}
+
+		smp, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", num, err)
+		}
+
+		smp.family, smp.mType = smp.name, typeUntyped
+
+		if fam, name, ok := lookupFamily(families, smp.name); ok {
+			smp.family, smp.mType, smp.help, smp.unit = name, fam.mType, fam.help, fam.unit
+		}
+
+		list = append(list, smp)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	return list, nil
+}
+
+// parseComment сохраняет сведения семейства из комментария line.
+func parseComment(line string, families map[string]*family) {
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), " ", 3)
+	if len(fields) < 3 {
+		return
+	}
+
+	kind, name, text := fields[0], fields[1], strings.TrimSpace(fields[2])
+
+	fam, ok := families[name]
+	if !ok {
+		fam = &family{mType: typeUntyped}
+	}
+
+	switch kind {
+	case "TYPE":
+		fam.mType = strings.ToLower(text)
+	case "HELP":
+		fam.help = unescape(text)
+	case "UNIT":
+		fam.unit = text
+	default:
+		return
+	}
+
+	families[name] = fam
+}
+
+// lookupFamily возвращает семейство значения name:
+// по полному имени или имени без суффикса гистограммы, summary или счетчика.
+func lookupFamily(families map[string]*family, name string) (*family, string, bool) {
+	if fam, ok := families[name]; ok {
+		return fam, name, true
+	}
+
+	for _, suffix := range familySuffixes {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+
+		if fam, ok := families[base]; ok {
+			return fam, base, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// parseSample разбирает строку значения:
+// name[{label="value",...}] value [timestamp_ms].
+func parseSample(line string) (sample, error) {
+	var (
+		smp sample
+		err error
+	)
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return smp, fmt.Errorf("%w: [%s]", errFormat, line)
+	}
+
+	smp.name, line = line[:end], line[end:]
+
+	if strings.HasPrefix(line, "{") {
+		smp.labels, line, err = parseLabels(line[1:])
+		if err != nil {
+			return smp, err
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return smp, fmt.Errorf("%w: value [%s]", errFormat, line)
+	}
+
+	if smp.value, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return smp, fmt.Errorf("%w: value: %w", errFormat, err)
+	}
+
+	if len(fields) == 2 {
+		msec, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return smp, fmt.Errorf("%w: timestamp: %w", errFormat, err)
+		}
+
+		smp.ts = time.UnixMilli(int64(msec)).UTC()
+	}
+
+	return smp, nil
+}
+
+// parseLabels разбирает метки до '}' и возвращает остаток строки.
+func parseLabels(line string) ([]label, string, error) {
+	labels := make([]label, 0)
+
+	for {
+		line = strings.TrimLeft(line, " \t,")
+		if strings.HasPrefix(line, "}") {
+			return labels, line[1:], nil
+		}
+
+		name, rest, ok := strings.Cut(line, "=")
+		if !ok || !strings.HasPrefix(strings.TrimSpace(rest), `"`) {
+			return nil, "", fmt.Errorf("%w: labels [%s]", errFormat, line)
+		}
+
+		value, rest, err := parseQuoted(strings.TrimSpace(rest)[1:])
+		if err != nil {
+			return nil, "", err
+		}
+
+		labels = append(labels, label{name: strings.TrimSpace(name), value: value})
+		line = rest
+	}
+}
+
+// parseQuoted возвращает значение метки до закрывающей кавычки
+// с учетом экранирования \\, \" и \n и остаток строки.
+func parseQuoted(line string) (string, string, error) {
+	var value strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; ch {
+		case '"':
+			return value.String(), line[i+1:], nil
+		case '\\':
+			if i++; i == len(line) {
+				return "", "", fmt.Errorf("%w: escape [%s]", errFormat, line)
+			}
+
+			if line[i] == 'n' {
+				value.WriteByte('\n')
+			} else {
+				value.WriteByte(line[i])
+			}
+		default:
+			value.WriteByte(ch)
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: quote [%s]", errFormat, line)
+}
+
+// unescape снимает экранирование \\ и \n в тексте HELP.
+func unescape(text string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(text)
+}
@@ -0,0 +1,74 @@
+package scrape
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	file, err := os.Open("testdata/metrics.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	list, err := parse(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, list, 14)
+
+	assert.Equal(t, sample{
+		name:   "go_goroutines",
+		family: "go_goroutines",
+		mType:  typeGauge,
+		help:   "Number of goroutines that currently exist.",
+		unit:   "goroutines currently running in the process",
+		value:  12,
+	}, list[0])
+
+	assert.Equal(t, sample{
+		ts:     time.UnixMilli(1700000000000).UTC(),
+		name:   "http_requests_total",
+		family: "http_requests_total",
+		mType:  typeCounter,
+		help:   "Total HTTP requests.",
+		labels: []label{{name: "method", value: "post"}, {name: "code", value: "200"}},
+		value:  1027,
+	}, list[1])
+
+	assert.Equal(t, "http_request_duration_seconds", list[5].family)
+	assert.Equal(t, typeHistogram, list[5].mType)
+	assert.Equal(t, []label{{name: "le", value: "+Inf"}}, list[5].labels)
+	assert.Equal(t, "seconds", list[5].unit)
+
+	assert.Equal(t, "rpc_duration_seconds", list[10].family)
+	assert.Equal(t, typeSummary, list[10].mType)
+	assert.Equal(t, "RPC latency\nin seconds.", list[10].help)
+
+	assert.Equal(t, typeUntyped, list[12].mType)
+	assert.Equal(t, []label{
+		{name: "path", value: `C:\DIR\FILE.TXT`},
+		{name: "error", value: "Cannot find file:\n\"FILE.TXT\""},
+	}, list[12].labels)
+}
+
+func TestParseErr(t *testing.T) {
+	for _, text := range []string{
+		"{a=\"1\"} 1",
+		"metric",
+		"metric abc",
+		"metric 1 2 3",
+		"metric{a=1} 1",
+		"metric{a=\"1} 1",
+		"metric 1 ts",
+	} {
+		_, err := parse(strings.NewReader(text))
+		assert.ErrorIs(t, err, errFormat, text)
+	}
+}
@@ -0,0 +1,281 @@
+// Сбор метрик сервисов, отдающих /metrics в текстовом формате Prometheus.
+// Для каждой цели создается коллектор с опросом раз в ее интервал.
+// Метки значения добавляются к имени метрики вместе с меткой job=<метка цели>,
+// см. [metricName]. Типы сохраняются так:
+//   - counter, _bucket и _count гистограмм, _count summary: counter - прирост
+//     целой части с прошлого опроса (первый опрос - 0, при сбросе - новое значение);
+//   - gauge, untyped, _sum, квантили summary: gauge.
+//
+// Значения NaN и ±Inf пропускаются. Доступность цели передается gauge ScrapeUp_<метка>.
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	NamePrefix    = "scrape " // Префикс имени коллектора, за ним - метка цели.
+	upPrefix      = "ScrapeUp_"
+	jobLabel      = "job"
+	targetSep     = ","
+	labelSep      = "="
+	intervalSep   = "@"
+	acceptHeader  = "text/plain;version=0.0.4;q=0.9,*/*;q=0.1"
+	suffixBucket  = "_bucket"
+	suffixCount   = "_count"
+	suffixCreated = "_created"
+)
+
+var (
+	errTargetURL    = errors.New("scrape target url not valid")
+	errTargetDup    = errors.New("scrape target label already used")
+	errInterval     = errors.New("scrape interval not valid")
+	errScrapeStatus = errors.New("scrape status not ok")
+)
+
+// Target цель опроса.
+type Target struct {
+	URL      string
+	Label    string        // метка цели
+	Interval time.Duration // интервал опроса, 0 - интервал коллектора по умолчанию
+}
+
+// ParseTargets разбирает список целей через запятую.
+// Цель задается как [метка=]url[@интервал], метка по умолчанию - host:port url.
+// Например: 'http://localhost:9100/metrics,api=http://10.0.0.2:8080/metrics@15s'.
+func ParseTargets(str string) ([]Target, error) {
+	list := make([]Target, 0)
+	labels := make(map[string]struct{})
+
+	for _, item := range strings.Split(str, targetSep) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		target, err := parseTarget(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := labels[target.Label]; ok {
+			return nil, fmt.Errorf("%w: [%s]", errTargetDup, target.Label)
+		}
+
+		labels[target.Label] = struct{}{}
+		list = append(list, target)
+	}
+
+	return list, nil
+}
+
+func parseTarget(item string) (Target, error) {
+	var target Target
+
+	// '=' в url возможен только в запросе: до него есть ':' или '/'
+	if idx := strings.Index(item, labelSep); idx > 0 && !strings.ContainsAny(item[:idx], ":/?") {
+		target.Label, item = item[:idx], item[idx+1:]
+	}
+
+	// '@' в url возможен в userinfo: интервалом считается только длительность
+	if idx := strings.LastIndex(item, intervalSep); idx > 0 {
+		if interval, err := time.ParseDuration(item[idx+1:]); err == nil {
+			if interval <= 0 {
+				return Target{}, fmt.Errorf("%w: [%s]", errInterval, item)
+			}
+
+			target.Interval, item = interval, item[:idx]
+		}
+	}
+
+	addr, err := url.Parse(item)
+	if err != nil || (addr.Scheme != "http" && addr.Scheme != "https") || addr.Host == "" {
+		return Target{}, fmt.Errorf("%w: [%s]", errTargetURL, item)
+	}
+
+	target.URL = item
+
+	if target.Label == "" {
+		target.Label = addr.Host
+	}
+
+	return target, nil
+}
+
+// Config конфигурация коллектора.
+type Config struct {
+	Client   *http.Client  // клиент, по умолчанию с таймаутом в интервал опроса
+	Target   Target        // цель опроса
+	Interval time.Duration // интервал опроса, если не задан у цели
+}
+
+// Collector коллектор метрик цели.
+type Collector struct {
+	client *http.Client
+	prev   map[string]float64 // значения counter прошлого опроса
+	cfg    Config
+	mu     sync.Mutex
+}
+
+func New(cfg Config) *Collector {
+	if cfg.Target.Interval > 0 {
+		cfg.Interval = cfg.Target.Interval
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Interval}
+	}
+
+	return &Collector{
+		client: client,
+		prev:   make(map[string]float64),
+		cfg:    cfg,
+	}
+}
+
+func (c *Collector) Name() string            { return NamePrefix + c.cfg.Target.Label }
+func (c *Collector) Interval() time.Duration { return c.cfg.Interval }
+
+// Collect опрашивает цель и возвращает ее метрики.
+// При ошибке опроса возвращается только ScrapeUp_<метка> = 0.
+func (c *Collector) Collect(ctx context.Context) []model.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UTC()
+	up := model.NewGaugeMetric(collector.SanitizeName(upPrefix+c.cfg.Target.Label), 0)
+	up.Help = "доступность цели " + c.cfg.Target.URL
+	up.TS = now
+
+	list, err := c.scrape(ctx)
+	if err != nil {
+		return []model.Metric{up}
+	}
+
+	*up.Val = 1
+	arr := make([]model.Metric, 0, len(list)+1)
+
+	for _, smp := range list {
+		if math.IsNaN(smp.value) || math.IsInf(smp.value, 0) {
+			continue
+		}
+
+		met := c.buildMetric(smp)
+
+		met.TS = now
+		if !smp.ts.IsZero() {
+			met.TS = smp.ts
+		}
+
+		arr = append(arr, met)
+	}
+
+	return append(arr, up)
+}
+
+// scrape запрашивает и разбирает метрики цели.
+func (c *Collector) scrape(ctx context.Context) ([]sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.Target.URL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header.Set("Accept", acceptHeader)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scrape: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", errScrapeStatus, resp.StatusCode)
+	}
+
+	return parse(resp.Body)
+}
+
+// buildMetric возвращает метрику значения smp.
+// Для counter запоминает значение. Вызывается под c.mu.
+func (c *Collector) buildMetric(smp sample) model.Metric {
+	name := metricName(smp.name, append(smp.labels, label{name: jobLabel, value: c.cfg.Target.Label}))
+
+	var met model.Metric
+
+	if isCounter(smp) {
+		prev, ok := c.prev[name]
+		c.prev[name] = smp.value
+
+		var delta int64
+
+		switch {
+		case !ok: // первый опрос: отсчет с текущего значения
+		case smp.value < prev: // сброс счетчика
+			delta = int64(math.Floor(smp.value))
+		default:
+			delta = int64(math.Floor(smp.value) - math.Floor(prev))
+		}
+
+		met = model.NewCounterMetric(name, delta)
+	} else {
+		met = model.NewGaugeMetric(name, smp.value)
+	}
+
+	met.Help = smp.help
+
+	// слишком длинная единица измерения не передается:
+	// сервер отклонил бы метрику целиком
+	if utf8.RuneCountInString(smp.unit) <= model.MaxUnitLen {
+		met.Unit = smp.unit
+	}
+
+	return met
+}
+
+// isCounter возвращает true, если значение передается как counter.
+func isCounter(smp sample) bool {
+	switch smp.mType {
+	case typeCounter:
+		return !strings.HasSuffix(smp.name, suffixCreated)
+	case typeHistogram:
+		return smp.name == smp.family+suffixBucket || smp.name == smp.family+suffixCount
+	case typeSummary:
+		return smp.name == smp.family+suffixCount
+	default:
+		return false
+	}
+}
+
+// metricName возвращает имя метрики с метками, отсортированными по имени:
+// name{b="2",a="1"} -> name_a_1_b_2. Недопустимые символы заменяются,
+// длинное имя сокращается, см. [collector.SanitizeName].
+func metricName(name string, labels []label) string {
+	list := make([]label, len(labels))
+	copy(list, labels)
+
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	var res strings.Builder
+
+	res.WriteString(name)
+
+	for _, lbl := range list {
+		res.WriteString("_" + lbl.name + "_" + lbl.value)
+	}
+
+	return collector.SanitizeName(res.String())
+}
@@ -0,0 +1,107 @@
+package scrape
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTargets(t *testing.T) {
+	list, err := ParseTargets("http://localhost:9100/metrics, api=https://u:p@10.0.0.2:8080/metrics?x=1@15s,,http://h/m?a=b@c")
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{
+		{URL: "http://localhost:9100/metrics", Label: "localhost:9100"},
+		{URL: "https://u:p@10.0.0.2:8080/metrics?x=1", Label: "api", Interval: 15 * time.Second},
+		{URL: "http://h/m?a=b@c", Label: "h"},
+	}, list)
+
+	_, err = ParseTargets("localhost:9100/metrics")
+	assert.ErrorIs(t, err, errTargetURL)
+
+	_, err = ParseTargets("http://a/metrics,a=http://b/metrics")
+	assert.ErrorIs(t, err, errTargetDup)
+
+	_, err = ParseTargets("http://a/metrics@-1s")
+	assert.ErrorIs(t, err, errInterval)
+}
+
+func TestCollect(t *testing.T) {
+	ctx := context.Background()
+	validName := regexp.MustCompile(`^[A-Za-z0-9_]{1,50}$`)
+	files := []string{"testdata/metrics.txt", "testdata/metrics_next.txt"}
+	status := http.StatusOK
+
+	tsrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		if status != http.StatusOK {
+			rw.WriteHeader(status)
+
+			return
+		}
+
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Error(err)
+		}
+
+		files = files[1:]
+		_, _ = rw.Write(data)
+	}))
+	defer tsrv.Close()
+
+	col := New(Config{Target: Target{URL: tsrv.URL, Label: "app"}, Interval: time.Second})
+	assert.Equal(t, NamePrefix+"app", col.Name())
+	assert.Equal(t, time.Second, col.Interval())
+
+	collect := func() map[string]model.Metric {
+		mets := make(map[string]model.Metric)
+		for _, met := range col.Collect(ctx) {
+			assert.False(t, met.TS.IsZero(), met.MName)
+			assert.Regexp(t, validName, met.MName)
+			mets[met.MName] = met
+		}
+
+		return mets
+	}
+
+	mets := collect()
+	assert.Len(t, mets, 13) // без NaN и +Inf, с ScrapeUp
+
+	assert.Equal(t, 1.0, *mets["ScrapeUp_app"].Val)
+	assert.Equal(t, 12.0, *mets["go_goroutines_job_app"].Val)
+	assert.Equal(t, "Number of goroutines that currently exist.", mets["go_goroutines_job_app"].Help)
+
+	post := mets["http_requests_total_code_200_job_app_method_post"]
+	assert.Equal(t, model.TypeCountConst, post.MType)
+	assert.Equal(t, int64(0), *post.Delta) // первый опрос
+	assert.Equal(t, time.UnixMilli(1700000000000).UTC(), post.TS)
+
+	// длинное имя сокращается
+	assert.Equal(t, model.TypeCountConst,
+		mets[collector.SanitizeName("http_request_duration_seconds_bucket_job_app_le_+Inf")].MType)
+	assert.Equal(t, model.TypeCountConst, mets["http_request_duration_seconds_count_job_app"].MType)
+	assert.Equal(t, 53423.5, *mets["http_request_duration_seconds_sum_job_app"].Val)
+	assert.Equal(t, "seconds", mets["http_request_duration_seconds_sum_job_app"].Unit)
+	assert.Empty(t, mets["go_goroutines_job_app"].Unit) // длиннее model.MaxUnitLen
+	assert.Equal(t, 4773.0, *mets["rpc_duration_seconds_job_app_quantile_0_5"].Val)
+	assert.Equal(t, model.TypeCountConst, mets["rpc_duration_seconds_count_job_app"].MType)
+	assert.Contains(t, mets, collector.SanitizeName(
+		`msdos_file_access_time_seconds_error_Cannot find file:`+"\n"+`"FILE.TXT"_job_app_path_C:\DIR\FILE.TXT`))
+
+	mets = collect()
+	assert.Equal(t, 15.0, *mets["go_goroutines_job_app"].Val)
+	assert.Equal(t, int64(3), *mets["http_requests_total_code_200_job_app_method_post"].Delta)
+	assert.Equal(t, int64(1), *mets["http_requests_total_code_400_job_app_method_get"].Delta) // сброс
+
+	status = http.StatusInternalServerError
+	mets = collect()
+	assert.Len(t, mets, 1)
+	assert.Equal(t, 0.0, *mets["ScrapeUp_app"].Val)
+}
@@ -0,0 +1,111 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+)
+
+var errFormat = errors.New("statsd line format not valid")
+
+// Типы метрик StatsD.
+const (
+	typeCounter   = "c"
+	typeGauge     = "g"
+	typeTimer     = "ms"
+	typeHistogram = "h"
+)
+
+// sample значение из строки StatsD.
+type sample struct {
+	name     string // имя с тегами
+	mType    string
+	value    float64
+	rate     float64 // частота выборки, 0 < rate <= 1
+	relative bool    // gauge со знаком: изменение прежнего значения
+}
+
+// parseLine разбирает строку формата StatsD/DogStatsD:
+// name:value|type[|@rate][|#tag:val,tag]. Неизвестные
+// расширения DogStatsD (|c:..., |T...) пропускаются.
+// Значения NaN и ±Inf - ошибка.
+func parseLine(line string) (sample, error) {
+	smp := sample{rate: 1}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return smp, fmt.Errorf("%w: [%s]", errFormat, line)
+	}
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return smp, fmt.Errorf("%w: [%s]", errFormat, line)
+	}
+
+	smp.mType = parts[1]
+	switch smp.mType {
+	case typeCounter, typeGauge, typeTimer, typeHistogram:
+	default:
+		return smp, fmt.Errorf("%w: type [%s]", errFormat, smp.mType)
+	}
+
+	value := parts[0]
+	smp.relative = smp.mType == typeGauge && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-"))
+
+	var err error
+
+	if smp.value, err = strconv.ParseFloat(value, 64); err != nil {
+		return smp, fmt.Errorf("%w: value [%s]: %w", errFormat, value, err)
+	}
+
+	// NaN и ±Inf не передаются в JSON
+	if math.IsNaN(smp.value) || math.IsInf(smp.value, 0) {
+		return smp, fmt.Errorf("%w: value [%s]", errFormat, value)
+	}
+
+	var tags []string
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			smp.rate, err = strconv.ParseFloat(part[1:], 64)
+			if err != nil || smp.rate <= 0 || smp.rate > 1 {
+				return smp, fmt.Errorf("%w: rate [%s]", errFormat, part)
+			}
+		case strings.HasPrefix(part, "#"):
+			tags = strings.Split(part[1:], ",")
+		}
+	}
+
+	smp.name = metricName(name, tags)
+
+	return smp, nil
+}
+
+// metricName возвращает имя метрики с тегами:
+// теги сортируются и добавляются к имени через '_',
+// ':' в теге заменяется на '_': name{b:2,a} -> name_a_b_2.
+// Недопустимые символы заменяются, длинное имя сокращается,
+// см. [collector.SanitizeName].
+func metricName(name string, tags []string) string {
+	list := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, strings.ReplaceAll(tag, ":", "_"))
+		}
+	}
+
+	if len(list) == 0 {
+		return collector.SanitizeName(name)
+	}
+
+	sort.Strings(list)
+
+	return collector.SanitizeName(name + "_" + strings.Join(list, "_"))
+}
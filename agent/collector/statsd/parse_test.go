@@ -0,0 +1,64 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	type testCase struct {
+		name string
+		line string
+		want sample
+	}
+
+	tc := []testCase{
+		{
+			name: "counter",
+			line: "hits:3|c",
+			want: sample{name: "hits", mType: typeCounter, value: 3, rate: 1},
+		},
+		{
+			name: "counter rate tags",
+			line: "hits:1|c|@0.5|#route:/api,env:prod,canary",
+			want: sample{name: "hits_canary_env_prod_route__api", mType: typeCounter, value: 1, rate: 0.5},
+		},
+		{
+			name: "gauge relative",
+			line: "queue:-2|g",
+			want: sample{name: "queue", mType: typeGauge, value: -2, rate: 1, relative: true},
+		},
+		{
+			name: "timer dogstatsd ext",
+			line: "latency:12.5|ms|#env:prod|c:abc|T1700000000",
+			want: sample{name: "latency_env_prod", mType: typeTimer, value: 12.5, rate: 1},
+		},
+		{
+			name: "long name",
+			line: "service.requests.latency:1|h|#endpoint:/api/v1/users/profile,env:prod",
+			want: sample{name: "service_requests_latency_endpoint__api_v1_07084341", mType: typeHistogram, value: 1, rate: 1},
+		},
+		{
+			name: "histogram",
+			line: "size:100|h",
+			want: sample{name: "size", mType: typeHistogram, value: 100, rate: 1},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			smp, err := parseLine(test.line)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, smp)
+		})
+	}
+
+	for _, line := range []string{
+		"hits", ":1|c", "hits:1", "hits:x|c", "hits:1|s", "hits:1|c|@0", "hits:1|c|@2",
+		"x:NaN|g", "x:+Inf|g", "x:-inf|ms", "x:1e400|c",
+	} {
+		_, err := parseLine(line)
+		assert.ErrorIs(t, err, errFormat, line)
+	}
+}
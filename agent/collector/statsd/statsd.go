@@ -0,0 +1,331 @@
+// Прием метрик приложений по протоколу StatsD/DogStatsD.
+// Коллектор слушает UDP и/или unix datagram сокет, агрегирует
+// полученные значения и передает их агенту при каждом опросе:
+//   - c: counter - сумма значений с учетом частоты выборки;
+//   - g: gauge - последнее значение, '+'/'-' изменяют прежнее;
+//   - ms, h: <name>_Count (counter) и gauge <name>_Min, _Max, _Mean, _P50, _P90, _P99.
+//
+// Теги DogStatsD добавляются к имени метрики, см. [metricName].
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	NameConst        = "statsd" // Имя коллектора.
+	maxPacketDefault = 65535    // Наибольший размер датаграммы по умолчанию.
+	maxTimingValues  = 10_000   // Наибольшее кол-во хранимых значений ms/h за интервал.
+	networkUDP       = "udp"
+	networkUnix      = "unixgram"
+	unitMillis       = "milliseconds"
+	badLinesName     = "StatsDBadLines"
+	readBackoffMin   = 10 * time.Millisecond // Пауза после первой ошибки чтения сокета.
+	readBackoffMax   = time.Second           // Наибольшая пауза между ошибками чтения сокета.
+)
+
+var errAddrEmpty = errors.New("statsd address and socket are empty")
+
+// Config конфигурация коллектора.
+type Config struct {
+	Addr      string        // UDP адрес, например ':8125'
+	Socket    string        // путь до unix datagram сокета
+	Interval  time.Duration // интервал опроса (сброса агрегатов)
+	MaxPacket int           // наибольший размер датаграммы
+}
+
+// timing значения ms/h за интервал.
+type timing struct {
+	values []float64
+	count  float64 // кол-во значений с учетом частоты выборки
+	unit   string
+}
+
+// Collector коллектор метрик StatsD.
+type Collector struct {
+	counters map[string]float64
+	gauges   map[string]float64 // последние значения gauge, хранятся между опросами
+	updated  map[string]struct{}
+	timings  map[string]*timing
+	conns    []net.PacketConn
+	cfg      Config
+	badLines int64
+	mu       sync.Mutex
+}
+
+func New(cfg Config) *Collector {
+	if cfg.MaxPacket <= 0 {
+		cfg.MaxPacket = maxPacketDefault
+	}
+
+	return &Collector{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		updated:  make(map[string]struct{}),
+		timings:  make(map[string]*timing),
+		cfg:      cfg,
+	}
+}
+
+func (c *Collector) Name() string            { return NameConst }
+func (c *Collector) Interval() time.Duration { return c.cfg.Interval }
+
+// Init открывает сокеты и запускает прием метрик.
+// Сокеты закрываются по завершении ctx.
+func (c *Collector) Init(ctx context.Context) error {
+	if c.cfg.Addr == "" && c.cfg.Socket == "" {
+		return errAddrEmpty
+	}
+
+	if c.cfg.Addr != "" {
+		conn, err := net.ListenPacket(networkUDP, c.cfg.Addr)
+		if err != nil {
+			return fmt.Errorf("listen udp: %w", err)
+		}
+
+		c.conns = append(c.conns, conn)
+	}
+
+	if c.cfg.Socket != "" {
+		// сокет мог остаться от прошлого запуска
+		if err := os.Remove(c.cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.close()
+
+			return fmt.Errorf("remove socket: %w", err)
+		}
+
+		conn, err := net.ListenPacket(networkUnix, c.cfg.Socket)
+		if err != nil {
+			c.close()
+
+			return fmt.Errorf("listen unix: %w", err)
+		}
+
+		c.conns = append(c.conns, conn)
+	}
+
+	for _, conn := range c.conns {
+		go c.serve(conn)
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.close()
+	}()
+
+	return nil
+}
+
+// Addr возвращает адреса открытых сокетов.
+func (c *Collector) Addr() []net.Addr {
+	list := make([]net.Addr, len(c.conns))
+	for i := range c.conns {
+		list[i] = c.conns[i].LocalAddr()
+	}
+
+	return list
+}
+
+// close закрывает сокеты и удаляет файл unix сокета.
+func (c *Collector) close() {
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+
+	if c.cfg.Socket != "" {
+		_ = os.Remove(c.cfg.Socket)
+	}
+}
+
+// serve принимает датаграммы до закрытия conn.
+func (c *Collector) serve(conn net.PacketConn) {
+	buf := make([]byte, c.cfg.MaxPacket)
+
+	var backoff time.Duration
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if n > 0 {
+			c.handle(string(buf[:n]))
+		}
+
+		switch {
+		case err == nil:
+			backoff = 0
+		case errors.Is(err, net.ErrClosed):
+			return
+		default:
+			// повторяющаяся ошибка чтения не должна занимать CPU:
+			// пауза растет до readBackoffMax и сбрасывается после успешного чтения
+			backoff = min(max(2*backoff, readBackoffMin), readBackoffMax)
+			time.Sleep(backoff)
+		}
+	}
+}
+
+// handle разбирает строки датаграммы и агрегирует значения.
+// Неверные строки пропускаются и учитываются в StatsDBadLines.
+func (c *Collector) handle(packet string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, line := range strings.Split(packet, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		smp, err := parseLine(line)
+		if err != nil || !c.add(smp) {
+			c.badLines++
+		}
+	}
+}
+
+// add агрегирует значение smp. Вызывается под c.mu.
+// Возвращает false, если изменение gauge дает бесконечное значение:
+// значение не меняется.
+func (c *Collector) add(smp sample) bool {
+	switch smp.mType {
+	case typeCounter:
+		c.counters[smp.name] += smp.value / smp.rate
+	case typeGauge:
+		val := smp.value
+		if smp.relative {
+			val += c.gauges[smp.name]
+		}
+
+		if math.IsInf(val, 0) {
+			return false
+		}
+
+		c.gauges[smp.name] = val
+		c.updated[smp.name] = struct{}{}
+	default:
+		tm, ok := c.timings[smp.name]
+		if !ok {
+			tm = &timing{}
+			if smp.mType == typeTimer {
+				tm.unit = unitMillis
+			}
+
+			c.timings[smp.name] = tm
+		}
+
+		tm.count += 1 / smp.rate
+		if len(tm.values) < maxTimingValues {
+			tm.values = append(tm.values, smp.value)
+		}
+	}
+
+	return true
+}
+
+// Collect возвращает метрики, агрегированные с прошлого опроса.
+// Передаются только gauge, обновленные за интервал.
+func (c *Collector) Collect(_ context.Context) []model.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now().UTC()
+	list := make([]model.Metric, 0, len(c.counters)+len(c.updated)+len(c.timings)*7+1)
+
+	for name, sum := range c.counters {
+		list = append(list, model.NewCounterMetric(name, roundInt(sum)))
+	}
+
+	for name := range c.updated {
+		list = append(list, model.NewGaugeMetric(name, c.gauges[name]))
+	}
+
+	for name, tm := range c.timings {
+		list = append(list, tm.metrics(name)...)
+	}
+
+	if c.badLines > 0 {
+		list = append(list, model.NewCounterMetric(badLinesName, c.badLines))
+	}
+
+	c.counters = make(map[string]float64)
+	c.updated = make(map[string]struct{})
+	c.timings = make(map[string]*timing)
+	c.badLines = 0
+
+	for i := range list {
+		list[i].TS = now
+	}
+
+	return list
+}
+
+// metrics возвращает метрики значений ms/h name.
+func (tm *timing) metrics(name string) []model.Metric {
+	sort.Float64s(tm.values)
+
+	// слагаемые делятся заранее: сумма больших значений не переполняется
+	var mean float64
+	for _, val := range tm.values {
+		mean += val / float64(len(tm.values))
+	}
+
+	// имя с суффиксом не длиннее допустимого
+	list := []model.Metric{
+		model.NewCounterMetric(collector.SanitizeName(name+"_Count"), roundInt(tm.count)),
+	}
+
+	for _, item := range []struct {
+		suffix string
+		val    float64
+	}{
+		{suffix: "_Min", val: tm.values[0]},
+		{suffix: "_Max", val: tm.values[len(tm.values)-1]},
+		{suffix: "_Mean", val: mean},
+		{suffix: "_P50", val: percentile(tm.values, 0.5)},
+		{suffix: "_P90", val: percentile(tm.values, 0.9)},
+		{suffix: "_P99", val: percentile(tm.values, 0.99)},
+	} {
+		met := model.NewGaugeMetric(collector.SanitizeName(name+item.suffix), item.val)
+		met.Unit = tm.unit
+		list = append(list, met)
+	}
+
+	return list
+}
+
+// roundInt возвращает val, округленное до целого и ограниченное диапазоном int64:
+// сумма значений counter может выйти за диапазон, а преобразование
+// такого float64 в int64 не определено. NaN - 0.
+func roundInt(val float64) int64 {
+	switch {
+	case math.IsNaN(val):
+		return 0
+	case val >= math.MaxInt64:
+		return math.MaxInt64
+	case val <= math.MinInt64:
+		return math.MinInt64
+	default:
+		return int64(math.Round(val))
+	}
+}
+
+// percentile возвращает перцентиль q отсортированных значений
+// по ближайшему рангу.
+func percentile(sorted []float64, q float64) float64 {
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+
+	return sorted[idx]
+}
@@ -0,0 +1,143 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// collectWait опрашивает коллектор, пока не получит want метрик.
+func collectWait(t *testing.T, col *Collector, want int) map[string]model.Metric {
+	t.Helper()
+
+	mets := make(map[string]model.Metric)
+
+	assert.Eventually(t, func() bool {
+		for _, met := range col.Collect(context.Background()) {
+			mets[met.MName] = met
+		}
+
+		return len(mets) >= want
+	}, time.Second, 10*time.Millisecond)
+
+	return mets
+}
+
+func TestCollector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	socket := filepath.Join(t.TempDir(), "statsd.sock")
+	col := New(Config{Addr: "127.0.0.1:0", Socket: socket, Interval: time.Second})
+
+	assert.Equal(t, NameConst, col.Name())
+	assert.Equal(t, time.Second, col.Interval())
+
+	if err := col.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := col.Addr()
+	if !assert.Len(t, addrs, 2) {
+		return
+	}
+
+	udp, err := net.Dial("udp", addrs[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	packet := "hits:2|c\nhits:1|c|@0.5\nqueue:10|g\nqueue:-3|g\nbad line\nqueue:NaN|g\n" +
+		"big:1e308|g\nbig:+1e308|g\n" +
+		"latency:10|ms|#env:prod\nlatency:30|ms|#env:prod\nlatency:20|ms|@0.5|#env:prod\n"
+	if _, err := udp.Write([]byte(packet)); err != nil {
+		t.Fatal(err)
+	}
+
+	mets := collectWait(t, col, 11)
+
+	assert.Equal(t, int64(4), *mets["hits"].Delta)
+	assert.Equal(t, 7.0, *mets["queue"].Val)
+	assert.Equal(t, 1e308, *mets["big"].Val)
+	assert.Equal(t, int64(3), *mets[badLinesName].Delta)
+	assert.Equal(t, int64(4), *mets["latency_env_prod_Count"].Delta)
+	assert.Equal(t, 10.0, *mets["latency_env_prod_Min"].Val)
+	assert.Equal(t, 30.0, *mets["latency_env_prod_Max"].Val)
+	assert.Equal(t, 20.0, *mets["latency_env_prod_Mean"].Val)
+	assert.Equal(t, 20.0, *mets["latency_env_prod_P50"].Val)
+	assert.Equal(t, unitMillis, mets["latency_env_prod_P99"].Unit)
+	assert.False(t, mets["hits"].TS.IsZero())
+
+	// агрегаты сбрасываются, gauge хранит значение для изменений
+	assert.Empty(t, col.Collect(ctx))
+
+	unix, err := net.Dial("unixgram", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close()
+
+	if _, err := unix.Write([]byte("queue:+1|g")); err != nil {
+		t.Fatal(err)
+	}
+
+	mets = collectWait(t, col, 1)
+	assert.Equal(t, 8.0, *mets["queue"].Val)
+
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("unixgram", socket)
+
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCollectorInitErr(t *testing.T) {
+	assert.ErrorIs(t, New(Config{}).Init(context.Background()), errAddrEmpty)
+	assert.Error(t, New(Config{Addr: "bad:addr:1"}).Init(context.Background()))
+}
+
+func TestRoundInt(t *testing.T) {
+	assert.Equal(t, int64(3), roundInt(2.5))
+	assert.Equal(t, int64(-3), roundInt(-2.5))
+	assert.Equal(t, int64(math.MaxInt64), roundInt(1e300))
+	assert.Equal(t, int64(math.MaxInt64), roundInt(math.Inf(1)))
+	assert.Equal(t, int64(math.MinInt64), roundInt(-1e300))
+	assert.Equal(t, int64(0), roundInt(math.NaN()))
+}
+
+// errConn сокет, чтение которого возвращает ошибку errs раз, затем net.ErrClosed.
+type errConn struct {
+	net.PacketConn
+	errs  int
+	reads int
+}
+
+func (ec *errConn) ReadFrom(_ []byte) (int, net.Addr, error) {
+	ec.reads++
+	if ec.reads > ec.errs {
+		return 0, nil, net.ErrClosed
+	}
+
+	return 0, nil, errors.New("read error")
+}
+
+func TestServeReadErr(t *testing.T) {
+	conn := &errConn{errs: 3}
+	start := time.Now()
+
+	New(Config{}).serve(conn)
+
+	// после ошибок чтения - пауза 10+20+40 мс
+	assert.Equal(t, 4, conn.reads)
+	assert.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+}
@@ -2,9 +2,13 @@ package config
 
 import (
 	"crypto/rsa"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
+	"github.com/AndreyVLZ/metrics/agent/collector/process"
+	"github.com/AndreyVLZ/metrics/agent/collector/scrape"
 	"github.com/AndreyVLZ/metrics/pkg/crypto"
 	"github.com/AndreyVLZ/metrics/pkg/log"
 )
@@ -15,9 +19,16 @@ var (
 	RateLimitDefault      int           = 3                // Значение по умолчания для количества одновременно исходящих запросов на сервер.
 	PollIntervalDefault   time.Duration = 2 * time.Second  // Значение по умолчания для частоты опроса метрик из пакета runtime.
 	ReportIntervalDefault time.Duration = 10 * time.Second // Значение по умолчания для частоты отправки метрик на сервер.
+	QueueSizeDefault      int           = 1000             // Значение по умолчанию для наибольшего кол-ва пакетов в очереди.
+	BatchSizeDefault      int           = 500              // Значение по умолчанию для наибольшего кол-ва метрик в пакете.
+	RetriesDefault        int           = 3                // Значение по умолчанию для кол-ва повторов отправки при ошибке передачи.
+	QueueRetriesDefault   int           = 10               // Значение по умолчанию для кол-ва ответов 5xx на первый пакет очереди, после которых он удаляется.
 	// CryproKeyPathDefault  string        = "/tmp/public.pem" // Значение по умолчания для пути до файла с публичным ключом
 )
 
+// ErrConfig неверное значение параметра.
+var ErrConfig = errors.New("config not valid")
+
 // Config Структура кофигурации агента.
 type Config struct {
 	Addr           string
@@ -29,6 +40,19 @@ type Config struct {
 	Key            []byte
 	PublicKey      *rsa.PublicKey
 	LogLevel       string
+	Processes      string           // наблюдаемые процессы, см. [process.ParseTargets]
+	ProcessTargets []process.Target // разобранные Processes
+	StatsDAddr     string           // UDP адрес приема метрик StatsD
+	StatsDSocket   string           // путь до unix datagram сокета приема метрик StatsD
+	PushAddr       string           // адрес локального приема метрик приложений, 'unix:<путь>' для сокета
+	Scrape         string           // цели опроса метрик Prometheus, см. [scrape.ParseTargets]
+	ScrapeTargets  []scrape.Target  // разобранные Scrape
+	QueueDir       string           // каталог очереди неотправленных пакетов, "" - очередь в памяти
+	QueueSize      int              // наибольшее кол-во пакетов в очереди
+	BatchSize      int              // наибольшее кол-во метрик в пакете, 0 - все метрики одним пакетом
+	AgentID        string           // идентификатор агента для лимитов сервера, "" - имя хоста
+	Retries        int              // кол-во повторов отправки при ошибке передачи
+	QueueRetries   int              // кол-во ответов 5xx на первый пакет очереди, после которых он удаляется, 0 - без ограничения
 }
 
 func Default() *Config {
@@ -38,6 +62,10 @@ func Default() *Config {
 		ReportInterval: ReportIntervalDefault,
 		RateLimit:      RateLimitDefault,
 		LogLevel:       LogLevelDefault,
+		QueueSize:      QueueSizeDefault,
+		BatchSize:      BatchSizeDefault,
+		Retries:        RetriesDefault,
+		QueueRetries:   QueueRetriesDefault,
 		//CryptoKeyPath:  CryproKeyPathDefault,
 	}
 }
@@ -57,6 +85,33 @@ func New(opts ...FuncOpt) (*Config, error) {
 		opt(cfg)
 	}
 
+	cfg.ProcessTargets, err = process.ParseTargets(cfg.Processes)
+	if err != nil {
+		return nil, fmt.Errorf("processes: %w", err)
+	}
+
+	cfg.ScrapeTargets, err = scrape.ParseTargets(cfg.Scrape)
+	if err != nil {
+		return nil, fmt.Errorf("scrape: %w", err)
+	}
+
+	if cfg.PollInterval <= 0 || cfg.ReportInterval <= 0 {
+		return nil, fmt.Errorf("%w: poll interval %s, report interval %s", ErrConfig, cfg.PollInterval, cfg.ReportInterval)
+	}
+
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("%w: batch size %d", ErrConfig, cfg.BatchSize)
+	}
+
+	if cfg.Retries < 0 || cfg.QueueRetries < 0 {
+		return nil, fmt.Errorf("%w: retries %d, queue retries %d", ErrConfig, cfg.Retries, cfg.QueueRetries)
+	}
+
+	if cfg.AgentID == "" {
+		// без имени хоста сервер считает агента по адресу
+		cfg.AgentID, _ = os.Hostname()
+	}
+
 	// читаем публичный ключ из файла
 	if cfg.CryptoKeyPath == "" {
 		return cfg, nil
@@ -125,3 +180,80 @@ func SetConfigPath(configPath string) FuncOpt {
 		cfg.ConfigPath = configPath
 	}
 }
+
+// Установка наблюдаемых процессов.
+func SetProcesses(processes string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.Processes = processes
+	}
+}
+
+// Установка UDP адреса приема метрик StatsD.
+func SetStatsDAddr(addr string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StatsDAddr = addr
+	}
+}
+
+// Установка пути до unix сокета приема метрик StatsD.
+func SetStatsDSocket(socket string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StatsDSocket = socket
+	}
+}
+
+// Установка адреса локального приема метрик приложений.
+func SetPushAddr(addr string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.PushAddr = addr
+	}
+}
+
+// Установка целей опроса метрик Prometheus.
+func SetScrape(targets string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.Scrape = targets
+	}
+}
+
+// Установка каталога очереди неотправленных пакетов.
+func SetQueueDir(dir string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.QueueDir = dir
+	}
+}
+
+// Установка наибольшего кол-ва пакетов в очереди.
+func SetQueueSize(size int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.QueueSize = size
+	}
+}
+
+// Установка наибольшего кол-ва метрик в пакете.
+func SetBatchSize(size int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.BatchSize = size
+	}
+}
+
+// Установка идентификатора агента.
+func SetAgentID(id string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.AgentID = id
+	}
+}
+
+// Установка кол-ва повторов отправки при ошибке передачи.
+func SetRetries(retries int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.Retries = retries
+	}
+}
+
+// Установка кол-ва ответов 5xx на первый пакет очереди, после которых он удаляется.
+func SetQueueRetries(retries int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.QueueRetries = retries
+	}
+}
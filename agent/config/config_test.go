@@ -1,6 +1,10 @@
 package config
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestNewConfig(t *testing.T) {
 	type testCase struct {
@@ -59,6 +63,70 @@ func TestNewConfig(t *testing.T) {
 				return cfg.LogLevel == "logLevel"
 			},
 		},
+		{
+			name:  "setStatsDAddr",
+			fnOpt: SetStatsDAddr(":8125"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.StatsDAddr == ":8125"
+			},
+		},
+		{
+			name:  "setStatsDSocket",
+			fnOpt: SetStatsDSocket("/tmp/statsd.sock"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.StatsDSocket == "/tmp/statsd.sock"
+			},
+		},
+		{
+			name:  "setPushAddr",
+			fnOpt: SetPushAddr("unix:/tmp/agent.sock"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.PushAddr == "unix:/tmp/agent.sock"
+			},
+		},
+		{
+			name:  "setScrape",
+			fnOpt: SetScrape("api=http://localhost:9100/metrics@15s"),
+			fnCheck: func(cfg Config) bool {
+				return len(cfg.ScrapeTargets) == 1 && cfg.ScrapeTargets[0].Label == "api"
+			},
+		},
+		{
+			name:  "setQueueDir",
+			fnOpt: SetQueueDir("/var/lib/agent/queue"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.QueueDir == "/var/lib/agent/queue" && cfg.QueueSize == QueueSizeDefault
+			},
+		},
+		{
+			name:  "setQueueSize",
+			fnOpt: SetQueueSize(10),
+			fnCheck: func(cfg Config) bool {
+				return cfg.QueueSize == 10
+			},
+		},
+		{
+			name:  "setBatchSize",
+			fnOpt: SetBatchSize(10),
+			fnCheck: func(cfg Config) bool {
+				return cfg.BatchSize == 10
+			},
+		},
+		{
+			name:  "setAgentID",
+			fnOpt: SetAgentID("agent-1"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.AgentID == "agent-1"
+			},
+		},
+		{
+			name:  "setProcesses",
+			fnOpt: SetProcesses("nginx,db=pid:1"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.Processes == "nginx,db=pid:1" && len(cfg.ProcessTargets) == 2 &&
+					cfg.ProcessTargets[1].Label == "db"
+			},
+		},
 	}
 
 	for _, test := range tc {
@@ -74,3 +142,41 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestNewConfigProcessesErr(t *testing.T) {
+	if _, err := New(SetProcesses("port:80")); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestNewConfigScrapeErr(t *testing.T) {
+	if _, err := New(SetScrape("localhost:9100")); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestNewConfigBatchSizeErr(t *testing.T) {
+	if _, err := New(SetBatchSize(-1)); !errors.Is(err, ErrConfig) {
+		t.Fatalf("want ErrConfig, got %v", err)
+	}
+}
+
+func TestNewConfigIntervalErr(t *testing.T) {
+	if _, err := New(SetPollInterval(0)); !errors.Is(err, ErrConfig) {
+		t.Fatalf("want ErrConfig, got %v", err)
+	}
+
+	if _, err := New(SetReportInterval(-time.Second)); !errors.Is(err, ErrConfig) {
+		t.Fatalf("want ErrConfig, got %v", err)
+	}
+}
+
+func TestNewConfigRetriesErr(t *testing.T) {
+	if _, err := New(SetRetries(-1)); !errors.Is(err, ErrConfig) {
+		t.Fatalf("want ErrConfig, got %v", err)
+	}
+
+	if _, err := New(SetQueueRetries(-1)); !errors.Is(err, ErrConfig) {
+		t.Fatalf("want ErrConfig, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+// reservation приросты counter пакета, ожидающего подтверждения.
+type reservation map[string]int64
+
+// heldReservation резерв пакета, сохраненного в очередь.
+type heldReservation struct {
+	key string // ключ идемпотентности пакета
+	res reservation
+}
+
+// deltaTracker учет отправленных значений counter.
+// Хранилище агента накапливает counter, а сервер прибавляет
+// полученное значение к своему: отправляется только прирост
+// с последнего подтвержденного значения.
+// Прирост резервируется на время отправки, чтобы пакеты,
+// отправляемые одновременно, не передали его дважды.
+// Прирост подтверждается только ответом 2xx сервера: резерв пакета,
+// сохраненного в очередь, держится до его отправки из очереди.
+type deltaTracker struct {
+	acked   map[string]int64  // подтвержденное значение
+	pending map[string]int64  // прирост отправляемых пакетов
+	queued  []heldReservation // резервы пакетов в очереди, в порядке очереди
+	mu      sync.Mutex
+}
+
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{
+		acked:   make(map[string]int64),
+		pending: make(map[string]int64),
+	}
+}
+
+// reserve возвращает метрики arr, в которых значения counter
+// заменены приростом, и резерв этих приростов.
+// Резерв передается в done по результату отправки.
+func (d *deltaTracker) reserve(arr []model.Metric) ([]model.Metric, reservation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res := make(reservation)
+	list := make([]model.Metric, len(arr))
+
+	for i, met := range arr {
+		list[i] = met
+
+		if met.MType != model.TypeCountConst || met.Delta == nil {
+			continue
+		}
+
+		delta := *met.Delta - d.acked[met.MName] - d.pending[met.MName]
+		d.pending[met.MName] += delta
+		res[met.MName] += delta
+
+		list[i].Delta = &delta
+	}
+
+	return list, res
+}
+
+// done снимает резерв res. Если пакет доставлен (acked),
+// прирост считается подтвержденным, иначе будет отправлен следующим пакетом.
+func (d *deltaTracker) done(res reservation, acked bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.release(res, acked)
+}
+
+// hold держит резерв res пакета key, сохраненного в конец очереди,
+// до его отправки, см. [deltaTracker.settle].
+func (d *deltaTracker) hold(key string, res reservation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.queued = append(d.queued, heldReservation{key: key, res: res})
+}
+
+// settle снимает резерв пакета key, отправленного из начала очереди:
+// acked - пакет доставлен. Пакеты, сохраненные в очередь раньше key,
+// из нее уже удалены без отправки (переполнение, повреждение файла):
+// их прирост будет отправлен следующим пакетом.
+// Пакеты прошлого запуска агента резерва не имеют.
+func (d *deltaTracker) settle(key string, acked bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, held := range d.queued {
+		if held.key != key {
+			continue
+		}
+
+		for _, lost := range d.queued[:i] {
+			d.release(lost.res, false)
+		}
+
+		d.release(held.res, acked)
+		d.queued = d.queued[i+1:]
+
+		return
+	}
+}
+
+// releaseQueued снимает резервы всех пакетов очереди без подтверждения.
+// Вызывается, когда очередь пуста: оставшиеся пакеты удалены без отправки.
+func (d *deltaTracker) releaseQueued() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, lost := range d.queued {
+		d.release(lost.res, false)
+	}
+
+	d.queued = nil
+}
+
+// release снимает резерв res. Вызывается под d.mu.
+func (d *deltaTracker) release(res reservation, acked bool) {
+	for name, delta := range res {
+		if d.pending[name] -= delta; d.pending[name] == 0 {
+			delete(d.pending, name)
+		}
+
+		if acked {
+			d.acked[name] += delta
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/agent/config"
+	"github.com/AndreyVLZ/metrics/agent/stats"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func counter(total int64) []model.Metric {
+	return []model.Metric{model.NewCounterMetric("PollCount", total), model.NewGaugeMetric("Alloc", 1)}
+}
+
+func TestDeltaTracker(t *testing.T) {
+	d := newDeltaTracker()
+
+	arr, res1 := d.reserve(counter(5))
+	assert.Equal(t, int64(5), *arr[0].Delta)
+	assert.Equal(t, 1.0, *arr[1].Val)
+
+	// пакеты отправляются одновременно: прирост не повторяется
+	arr, res2 := d.reserve(counter(8))
+	assert.Equal(t, int64(3), *arr[0].Delta)
+
+	d.done(res1, true)
+	d.done(res2, false)
+
+	// неотправленный прирост передается следующим пакетом
+	arr, res3 := d.reserve(counter(10))
+	assert.Equal(t, int64(5), *arr[0].Delta)
+	d.done(res3, true)
+
+	arr, res4 := d.reserve(counter(10))
+	assert.Equal(t, int64(0), *arr[0].Delta)
+	d.done(res4, true)
+	assert.Empty(t, d.pending)
+}
+
+func TestDeltaTrackerQueued(t *testing.T) {
+	d := newDeltaTracker()
+
+	_, res := d.reserve(counter(5))
+	d.hold("a", res)
+
+	arr, res := d.reserve(counter(7))
+	assert.Equal(t, int64(2), *arr[0].Delta)
+	d.hold("b", res)
+
+	// пакет "a" удален из очереди без отправки
+	d.settle("b", true)
+
+	arr, res = d.reserve(counter(7))
+	assert.Equal(t, int64(5), *arr[0].Delta)
+	d.hold("c", res)
+
+	// очередь пуста: пакет "c" удален без отправки
+	d.releaseQueued()
+
+	arr, res = d.reserve(counter(7))
+	assert.Equal(t, int64(5), *arr[0].Delta)
+	d.done(res, true)
+	assert.Empty(t, d.pending)
+	assert.Empty(t, d.queued)
+}
+
+// sumServer тестовый сервер, суммирующий принятые приросты PollCount.
+// Отвечает status, пока он не 200. Пакет с уже примененным ключом
+// идемпотентности не применяется повторно. При lost пакет применяется,
+// но ответ теряется: сервер отвечает 503.
+type sumServer struct {
+	*httptest.Server
+	keys   sync.Map
+	status atomic.Int64
+	sum    atomic.Int64
+	lost   atomic.Bool
+}
+
+func newSumServer(t *testing.T) *sumServer {
+	t.Helper()
+
+	srv := &sumServer{}
+	srv.status.Store(http.StatusOK)
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if code := int(srv.status.Load()); code != http.StatusOK {
+			rw.WriteHeader(code)
+
+			return
+		}
+
+		gzr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Error(err)
+
+			return
+		}
+
+		var list []model.MetricJSON
+		if err := json.NewDecoder(gzr).Decode(&list); err != nil {
+			t.Error(err)
+		}
+
+		if _, seen := srv.keys.LoadOrStore(req.Header.Get(idempotencyKeyHeader), true); !seen {
+			for _, met := range list {
+				if met.ID == "PollCount" {
+					srv.sum.Add(*met.Delta)
+				}
+			}
+		}
+
+		if srv.lost.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	return srv
+}
+
+func TestSendBatchDelta(t *testing.T) {
+	ctx := context.Background()
+	srv := newSumServer(t)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+
+	assert.NoError(t, agent.sendBatch(ctx, counter(5)))
+	assert.NoError(t, agent.sendBatch(ctx, counter(8)))
+	assert.Equal(t, int64(8), srv.sum.Load())
+
+	// отклоненный пакет не подтверждает прирост
+	srv.status.Store(http.StatusBadRequest)
+	assert.NoError(t, agent.sendBatch(ctx, counter(12)))
+
+	srv.status.Store(http.StatusOK)
+	assert.NoError(t, agent.sendBatch(ctx, counter(15)))
+	assert.Equal(t, int64(15), srv.sum.Load())
+}
+
+// Опрос коллектора runtime n раз и отправка хранилища агента:
+// на сервере PollCount равен кол-ву опросов.
+func TestSendPollCount(t *testing.T) {
+	ctx := context.Background()
+	srv := newSumServer(t)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+
+	var runtimeCol collector.Collector
+
+	for _, col := range agent.collectors.List() {
+		if col.Name() == stats.RuntimeCollectorName {
+			runtimeCol = col
+		}
+	}
+
+	if runtimeCol == nil {
+		t.Fatal("runtime collector not registered")
+	}
+
+	pollAndSend := func(n int) {
+		for i := 0; i < n; i++ {
+			assert.NoError(t, agent.store.AddBatch(ctx, runtimeCol.Collect(ctx)))
+		}
+
+		list, err := agent.store.List(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, agent.sendBatch(ctx, list))
+	}
+
+	pollAndSend(5)
+	assert.Equal(t, int64(5), srv.sum.Load())
+
+	pollAndSend(3)
+	assert.Equal(t, int64(8), srv.sum.Load())
+}
+
+// Прирост пакетов, потерянных в очереди, отправляется следующим пакетом.
+func TestSendBatchDeltaQueue(t *testing.T) {
+	ctx := context.Background()
+	srv := newSumServer(t)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL, config.SetQueueDir(t.TempDir()), config.SetQueueSize(1))
+	if err := agent.openQueue(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.status.Store(http.StatusServiceUnavailable)
+
+	// переполнение очереди: первый пакет удален
+	assert.NoError(t, agent.sendBatch(ctx, counter(5)))
+	assert.NoError(t, agent.sendBatch(ctx, counter(7)))
+	assert.Equal(t, 1, agent.queue.Len())
+
+	srv.status.Store(http.StatusOK)
+	time.Sleep(150 * time.Millisecond) // автомат защиты замыкается
+
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, int64(2), srv.sum.Load())
+
+	assert.NoError(t, agent.sendBatch(ctx, counter(7)))
+	assert.Equal(t, int64(7), srv.sum.Load())
+
+	// пакет в очереди отклонен сервером
+	srv.status.Store(http.StatusServiceUnavailable)
+	assert.NoError(t, agent.sendBatch(ctx, counter(10)))
+	time.Sleep(150 * time.Millisecond)
+
+	srv.status.Store(http.StatusBadRequest)
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 0, agent.queue.Len())
+
+	srv.status.Store(http.StatusOK)
+	assert.NoError(t, agent.sendBatch(ctx, counter(10)))
+	assert.Equal(t, int64(10), srv.sum.Load())
+}
+
+// Пакет применен сервером, но ответ потерян: без каталога очереди
+// пакет повторяется из очереди в памяти с тем же ключом,
+// и прирост не учитывается дважды.
+func TestSendBatchDeltaLostResponse(t *testing.T) {
+	ctx := context.Background()
+	srv := newSumServer(t)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+
+	srv.lost.Store(true)
+	assert.NoError(t, agent.sendBatch(ctx, counter(5)))
+	assert.Equal(t, 1, agent.queue.Len())
+	assert.Equal(t, int64(5), srv.sum.Load())
+
+	srv.lost.Store(false)
+	time.Sleep(150 * time.Millisecond) // автомат защиты замыкается
+
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 0, agent.queue.Len())
+
+	assert.NoError(t, agent.sendBatch(ctx, counter(7)))
+	assert.Equal(t, int64(7), srv.sum.Load())
+}
@@ -0,0 +1,37 @@
+// Повтор отправки: задержка между попытками и автомат защиты (circuit breaker).
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff экспоненциальная задержка между попытками с ограничением Max
+// и случайным разбросом: задержка выбирается от половины до полной
+// величины, чтобы агенты не повторяли запросы одновременно.
+type Backoff struct {
+	rand func() float64 // случайное число [0, 1)
+	Base time.Duration  // задержка перед первым повтором
+	Max  time.Duration  // наибольшая задержка
+}
+
+func NewBackoff(base, maxDelay time.Duration) Backoff {
+	return Backoff{rand: rand.Float64, Base: base, Max: maxDelay}
+}
+
+// Delay возвращает задержку перед повтором attempt, начиная с 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Base
+
+	for i := 1; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+
+	if delay > b.Max {
+		delay = b.Max
+	}
+
+	half := delay / 2
+
+	return half + time.Duration(b.rand()*float64(delay-half))
+}
@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen автомат разомкнут: запрос не выполняется.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Breaker автомат защиты.
+// После threshold неудач подряд размыкается на cooldown: запросы сразу
+// завершаются ErrOpen и не нагружают недоступный сервер. По истечении
+// cooldown пропускается один пробный запрос: успех замыкает автомат,
+// неудача размыкает его снова. Результаты прочих запросов, начатых
+// до размыкания, состояние разомкнутого автомата не меняют.
+type Breaker struct {
+	now       func() time.Time
+	openUntil time.Time // время до которого автомат разомкнут
+	cooldown  time.Duration
+	threshold int
+	failures  int  // неудач подряд
+	trial     bool // пробный запрос выполняется
+	mu        sync.Mutex
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		now:       time.Now,
+		cooldown:  cooldown,
+		threshold: threshold,
+	}
+}
+
+// Allow возвращает ErrOpen, если запрос выполнять нельзя.
+// trial - разрешен пробный запрос разомкнутого автомата.
+// Результат разрешенного запроса передается в Done вместе с trial,
+// а если запрос не был выполнен - в Skip.
+func (b *Breaker) Allow() (trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false, nil
+	}
+
+	if b.trial || b.now().Before(b.openUntil) {
+		return false, ErrOpen
+	}
+
+	b.trial = true
+
+	return true, nil
+}
+
+// Done учитывает результат запроса: ok - запрос выполнен успешно.
+// Разомкнутый автомат замыкает или снова размыкает только пробный запрос.
+func (b *Breaker) Done(trial, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		b.trial = false
+	} else if b.failures >= b.threshold {
+		return
+	}
+
+	if ok {
+		b.failures = 0
+
+		return
+	}
+
+	if b.failures++; b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// Skip снимает разрешение запроса, который не был выполнен:
+// результат не учитывается, следующий запрос может стать пробным.
+func (b *Breaker) Skip(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial {
+		b.trial = false
+	}
+}
+
+// Open возвращает true, если автомат разомкнут.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures >= b.threshold && b.now().Before(b.openUntil)
+}
@@ -0,0 +1,95 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := NewBackoff(time.Second, 5*time.Second)
+
+	b.rand = func() float64 { return 0 }
+	assert.Equal(t, 500*time.Millisecond, b.Delay(1))
+	assert.Equal(t, time.Second, b.Delay(2))
+	assert.Equal(t, 2500*time.Millisecond, b.Delay(4)) // ограничено Max
+
+	b.rand = func() float64 { return 0.999999 }
+	assert.InDelta(t, float64(4*time.Second), float64(b.Delay(3)), float64(time.Millisecond))
+	assert.InDelta(t, float64(5*time.Second), float64(b.Delay(100)), float64(time.Millisecond))
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	allow := func() bool {
+		t.Helper()
+
+		trial, err := b.Allow()
+		assert.NoError(t, err)
+
+		return trial
+	}
+
+	b.Done(allow(), false)
+	assert.False(t, b.Open())
+	b.Done(allow(), false)
+
+	// разомкнут после 2 неудач
+	assert.True(t, b.Open())
+	_, err := b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	// пробный запрос после cooldown, остальные ждут
+	now = now.Add(time.Minute)
+	trial := allow()
+	assert.True(t, trial)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	b.Done(trial, false)
+	assert.True(t, b.Open())
+
+	now = now.Add(time.Minute)
+	b.Done(allow(), true)
+	assert.False(t, b.Open())
+	assert.False(t, allow())
+}
+
+// Результат запроса, начатого до размыкания, не замыкает автомат
+// и не снимает разрешение пробного запроса.
+func TestBreakerTrialOnly(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	late, err := b.Allow()
+	assert.NoError(t, err)
+
+	b.Done(false, false)
+	assert.True(t, b.Open())
+
+	b.Done(late, true)
+	assert.True(t, b.Open())
+
+	now = now.Add(time.Minute)
+	trial, err := b.Allow()
+	assert.True(t, trial)
+	assert.NoError(t, err)
+
+	b.Done(false, true)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen) // пробный запрос еще выполняется
+
+	// пробный запрос не выполнен: следующий запрос - пробный
+	b.Skip(trial)
+	trial, err = b.Allow()
+	assert.True(t, trial)
+	assert.NoError(t, err)
+
+	b.Done(trial, true)
+	assert.False(t, b.Open())
+}
@@ -0,0 +1,203 @@
+// Локальный прием метрик приложений хоста.
+// Приложения отправляют метрики агенту в формате /updates/ сервера
+// ([]model.MetricJSON, при необходимости со сжатием gzip) по HTTP
+// или через unix сокет. Метрики сохраняются в хранилище агента
+// и отправляются на сервер вместе с собранными: подпись, сжатие,
+// шифрование и повторы выполняет агент.
+package push
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	UpdatesPath  = "/updates/" // Путь приема метрик.
+	unixPrefix   = "unix:"     // Префикс адреса unix сокета.
+	maxBodyConst = 10 << 20    // Наибольший размер тела запроса, в том числе после распаковки.
+
+	readHeaderTimeoutConst = 5 * time.Second  // Время чтения заголовков запроса.
+	readTimeoutConst       = 30 * time.Second // Время чтения запроса вместе с телом.
+)
+
+var errValueNil = errors.New("metric value is empty")
+
+// storage хранилище метрик агента.
+type storage interface {
+	AddBatch(ctx context.Context, arr []model.Metric) error
+}
+
+// Config конфигурация приема.
+type Config struct {
+	// Addr адрес 'host:port' или путь до unix сокета с префиксом 'unix:'.
+	Addr string
+}
+
+// Server сервер приема метрик.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+	cfg      Config
+}
+
+func New(cfg Config, store storage, log *slog.Logger) *Server {
+	mux := http.NewServeMux()
+	mux.Handle(UpdatesPath, Handler(store, log))
+
+	return &Server{
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeoutConst,
+			ReadTimeout:       readTimeoutConst,
+		},
+		cfg: cfg,
+	}
+}
+
+// Start открывает сокет и запускает прием.
+func (s *Server) Start(_ context.Context) error {
+	network, addr := "tcp", s.cfg.Addr
+
+	if path, ok := strings.CutPrefix(s.cfg.Addr, unixPrefix); ok {
+		network, addr = "unix", path
+
+		// сокет мог остаться от прошлого запуска
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	s.listener = listener
+
+	go func() { _ = s.server.Serve(listener) }()
+
+	return nil
+}
+
+// Addr возвращает адрес открытого сокета.
+func (s *Server) Addr() net.Addr { return s.listener.Addr() }
+
+// Stop останавливает прием. Unix сокет удаляется при закрытии.
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("push shutdown: %w", err)
+	}
+
+	return nil
+}
+
+// Handler возвращает обработчик приема пакета метрик. [POST].
+// Неверный пакет не сохраняется, ответ 400.
+// Пакет больше maxBodyConst до или после распаковки - ответ 413.
+func Handler(store storage, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		var body io.Reader = http.MaxBytesReader(rw, req.Body, maxBodyConst)
+
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+			defer zr.Close()
+
+			// ограничение распакованных данных: небольшое тело может распаковаться в гигабайты
+			body = http.MaxBytesReader(rw, zr, maxBodyConst)
+		}
+
+		var list []model.MetricJSON
+
+		if err := json.NewDecoder(body).Decode(&list); err != nil {
+			log.Error("push", "decode error", err)
+
+			status := http.StatusBadRequest
+
+			var errMax *http.MaxBytesError
+			if errors.As(err, &errMax) {
+				status = http.StatusRequestEntityTooLarge
+			}
+
+			http.Error(rw, err.Error(), status)
+
+			return
+		}
+
+		arr, err := parseList(list)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		if err := store.AddBatch(req.Context(), arr); err != nil {
+			log.Error("push", "store error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// parseList возвращает метрики пакета list.
+// Имя приводится к виду, который принимает сервер, см. [collector.SanitizeName].
+// Ошибка, если имя пустое, тип не поддерживается, нет значения
+// или единица измерения либо источник длиннее, чем принимает сервер:
+// из-за такой метрики сервер отклонил бы весь пакет агента.
+func parseList(list []model.MetricJSON) ([]model.Metric, error) {
+	arr := make([]model.Metric, len(list))
+
+	for i, met := range list {
+		info, err := model.ParseInfo(met.ID, met.MType)
+		if err != nil {
+			return nil, fmt.Errorf("metric [%s]: %w", met.ID, err)
+		}
+
+		info.MName = collector.SanitizeName(info.MName)
+
+		val := model.Value{Delta: met.Delta, Val: met.Value}
+		if info.MType == model.TypeCountConst {
+			val.Val = nil
+		} else {
+			val.Delta = nil
+		}
+
+		if val.Delta == nil && val.Val == nil {
+			return nil, fmt.Errorf("metric [%s]: %w", met.ID, errValueNil)
+		}
+
+		meta := met.Meta()
+		// время сохранения задает сервер
+		meta.Created, meta.Updated = time.Time{}, time.Time{}
+
+		arr[i] = model.Metric{Info: info, Value: val, Meta: meta}
+
+		if err := model.CheckLen(arr[i]); err != nil {
+			return nil, fmt.Errorf("metric [%s]: %w", met.ID, err)
+		}
+	}
+
+	return arr, nil
+}
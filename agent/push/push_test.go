@@ -0,0 +1,112 @@
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.New()
+	handler := Handler(store, slog.Default())
+
+	post := func(body string, gz bool) int {
+		var buf bytes.Buffer
+
+		req := httptest.NewRequest(http.MethodPost, UpdatesPath, strings.NewReader(body))
+
+		if gz {
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write([]byte(body))
+			_ = zw.Close()
+
+			req = httptest.NewRequest(http.MethodPost, UpdatesPath, &buf)
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post(`[{"id":"Jobs","type":"counter","delta":2},{"id":"Queue","type":"gauge","value":1.5,"unit":"items"}]`, false))
+	assert.Equal(t, http.StatusOK, post(`[{"id":"Jobs","type":"counter","delta":3}]`, true))
+	assert.Equal(t, http.StatusOK, post(`[{"id":"queue depth","type":"gauge","value":2}]`, false))
+
+	list, err := store.List(ctx)
+	assert.NoError(t, err)
+
+	mets := make(map[string]model.Metric, len(list))
+	for _, met := range list {
+		mets[met.MName] = met
+	}
+
+	assert.Equal(t, int64(5), *mets["Jobs"].Delta)
+	assert.Equal(t, 2.0, *mets["queue_depth"].Val)
+	assert.Equal(t, 1.5, *mets["Queue"].Val)
+	assert.Equal(t, "items", mets["Queue"].Unit)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{`, false))
+	assert.Equal(t, http.StatusBadRequest, post(`[{"id":"","type":"gauge","value":1}]`, false))
+	assert.Equal(t, http.StatusBadRequest, post(`[{"id":"Jobs","type":"counter","value":1}]`, false))
+	assert.Equal(t, http.StatusBadRequest, post(`[{"id":"X","type":"summary","value":1}]`, false))
+	assert.Equal(t, http.StatusBadRequest, post(`[{"id":"X","type":"gauge","value":1,"unit":"`+strings.Repeat("u", model.MaxUnitLen+1)+`"}]`, false))
+	assert.Equal(t, http.StatusBadRequest, post(`[{"id":"X","type":"gauge","value":1,"source":"`+strings.Repeat("s", model.MaxSourceLen+1)+`"}]`, false))
+
+	// распакованное тело больше maxBodyConst: сжатое - несколько килобайт
+	bomb := "[" + strings.Repeat(" ", maxBodyConst) + "]"
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(bomb, true))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(bomb, false))
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, UpdatesPath, http.NoBody))
+	assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+}
+
+func TestServerUnix(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.New()
+	socket := filepath.Join(t.TempDir(), "push.sock")
+
+	srv := New(Config{Addr: unixPrefix + socket}, store, slog.Default())
+	if err := srv.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	resp, err := client.Post("http://agent"+UpdatesPath, "application/json",
+		strings.NewReader(`[{"id":"Queue","type":"gauge","value":3}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	list, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	assert.NoError(t, srv.Stop(ctx))
+
+	_, err = net.Dial("unix", socket)
+	assert.Error(t, err)
+}
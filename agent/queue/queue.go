@@ -0,0 +1,323 @@
+// Очередь неотправленных пакетов метрик на диске.
+// Каждый пакет хранится отдельным файлом <номер>.json в каталоге очереди,
+// поэтому очередь сохраняется между запусками агента и выдается по порядку.
+// Очередь ограничена: при переполнении удаляются самые старые пакеты.
+//
+// Очередь в памяти (NewMemory) хранит пакеты до остановки агента:
+// пакет, который не удалось отправить, повторяется с тем же ключом
+// идемпотентности и без каталога очереди.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	CapacityDefault = 1000 // Наибольшее кол-во пакетов в очереди по умолчанию.
+	fileExt         = ".json"
+	tmpExt          = ".tmp"
+	seqFormat       = "%020d"
+	dirPerm         = 0o700
+	filePerm        = 0o600
+)
+
+// ErrClosed очередь закрыта.
+var ErrClosed = errors.New("queue closed")
+
+// Batch пакет метрик.
+// Ключ идемпотентности сохраняется, чтобы сервер
+// не применил пакет повторно при повторной отправке.
+type Batch struct {
+	Key     string             `json:"key"`
+	Metrics []model.MetricJSON `json:"metrics"`
+}
+
+// Queue очередь пакетов.
+type Queue struct {
+	mem      map[uint64][]byte // пакеты очереди в памяти, nil - очередь на диске
+	dir      string
+	seqs     []uint64 // номера пакетов в очереди по порядку
+	next     uint64   // номер следующего пакета
+	capacity int
+	dropped  int64 // кол-во удаленных при переполнении или поврежденных пакетов
+	closed   bool
+	mu       sync.Mutex
+}
+
+// Open открывает очередь в каталоге dir, создавая его при необходимости.
+// Недописанные файлы прошлого запуска удаляются.
+func Open(dir string, capacity int) (*Queue, error) {
+	if capacity <= 0 {
+		capacity = CapacityDefault
+	}
+
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, fmt.Errorf("queue dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("queue dir: %w", err)
+	}
+
+	q := &Queue{dir: dir, seqs: make([]uint64, 0), capacity: capacity}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if strings.HasSuffix(name, tmpExt) {
+			_ = os.Remove(filepath.Join(dir, name))
+
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, fileExt), 10, 64)
+		if err != nil || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+
+		q.seqs = append(q.seqs, seq)
+	}
+
+	sort.Slice(q.seqs, func(i, j int) bool { return q.seqs[i] < q.seqs[j] })
+
+	if len(q.seqs) > 0 {
+		q.next = q.seqs[len(q.seqs)-1] + 1
+	}
+
+	return q, nil
+}
+
+// NewMemory возвращает очередь в памяти.
+func NewMemory(capacity int) *Queue {
+	if capacity <= 0 {
+		capacity = CapacityDefault
+	}
+
+	return &Queue{mem: make(map[uint64][]byte), seqs: make([]uint64, 0), capacity: capacity}
+}
+
+// Push добавляет пакет в конец очереди.
+// При переполнении удаляются самые старые пакеты.
+func (q *Queue) Push(batch Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	for len(q.seqs) >= q.capacity {
+		if err := q.remove(q.seqs[0]); err != nil {
+			return err
+		}
+
+		q.dropped++
+	}
+
+	seq := q.next
+
+	if err := q.write(seq, data); err != nil {
+		return err
+	}
+
+	q.seqs = append(q.seqs, seq)
+	q.next++
+
+	return nil
+}
+
+// Peek возвращает первый пакет очереди и его номер, не удаляя его.
+// ok - false, если очередь пуста. Поврежденные и пропавшие
+// из каталога пакеты удаляются из очереди.
+func (q *Queue) Peek() (batch Batch, seq uint64, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.seqs) > 0 {
+		seq = q.seqs[0]
+
+		data, err := q.read(seq)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Batch{}, 0, false, fmt.Errorf("read batch: %w", err)
+		}
+
+		if err == nil && json.Unmarshal(data, &batch) == nil {
+			return batch, seq, true, nil
+		}
+
+		if err := q.remove(seq); err != nil {
+			return Batch{}, 0, false, err
+		}
+
+		q.dropped++
+	}
+
+	return Batch{}, 0, false, nil
+}
+
+// Remove удаляет пакет с номером seq, например после успешной отправки.
+func (q *Queue) Remove(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.remove(seq)
+}
+
+// Len возвращает кол-во пакетов в очереди.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.seqs)
+}
+
+// Dropped возвращает кол-во пакетов, удаленных при переполнении
+// или поврежденных, с открытия очереди.
+func (q *Queue) Dropped() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.dropped
+}
+
+// Close закрывает очередь: каталог очереди на диске сбрасывается на диск,
+// чтобы удаление отправленных пакетов сохранилось до следующего запуска.
+// Push закрытой очереди возвращает ErrClosed. Пакеты очереди в памяти теряются.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+
+	if q.mem != nil {
+		return nil
+	}
+
+	if err := syncDir(q.dir); err != nil {
+		return fmt.Errorf("sync queue dir: %w", err)
+	}
+
+	return nil
+}
+
+// remove удаляет пакет seq. Вызывается под q.mu.
+func (q *Queue) remove(seq uint64) error {
+	idx := sort.Search(len(q.seqs), func(i int) bool { return q.seqs[i] >= seq })
+	if idx == len(q.seqs) || q.seqs[idx] != seq {
+		return nil
+	}
+
+	if q.mem != nil {
+		delete(q.mem, seq)
+	} else if err := os.Remove(q.path(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove batch: %w", err)
+	}
+
+	q.seqs = append(q.seqs[:idx], q.seqs[idx+1:]...)
+
+	return nil
+}
+
+// write сохраняет пакет seq. Вызывается под q.mu.
+// Пакет на диске записывается во временный файл и переименовывается:
+// в очереди не бывает недописанных пакетов, а сброс на диск файла
+// и каталога сохраняет пакет при сбое питания.
+func (q *Queue) write(seq uint64, data []byte) error {
+	if q.mem != nil {
+		q.mem[seq] = data
+
+		return nil
+	}
+
+	path := q.path(seq)
+
+	if err := writeFile(path+tmpExt, data); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+
+	if err := os.Rename(path+tmpExt, path); err != nil {
+		return fmt.Errorf("rename batch: %w", err)
+	}
+
+	if err := syncDir(q.dir); err != nil {
+		return fmt.Errorf("sync queue dir: %w", err)
+	}
+
+	return nil
+}
+
+// read возвращает сохраненный пакет seq. Вызывается под q.mu.
+func (q *Queue) read(seq uint64) ([]byte, error) {
+	if q.mem != nil {
+		data, ok := q.mem[seq]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+
+		return data, nil
+	}
+
+	data, err := os.ReadFile(q.path(seq))
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return data, nil
+}
+
+// writeFile записывает data в новый файл path и сбрасывает его на диск.
+func writeFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	return file.Close()
+}
+
+// syncDir сбрасывает на диск содержимое каталога.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("sync dir: %w", err), file.Close())
+	}
+
+	return file.Close()
+}
+
+// path возвращает путь до файла пакета seq.
+func (q *Queue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf(seqFormat, seq)+fileExt)
+}
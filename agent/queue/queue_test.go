@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func batch(key string) Batch {
+	return Batch{
+		Key:     key,
+		Metrics: model.BuildArrMetricJSON([]model.Metric{model.NewCounterMetric("PollCount", 1)}),
+	}
+}
+
+func TestQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "queue")
+
+	q, err := Open(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, ok, err := q.Peek()
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.Push(batch(key)))
+	}
+
+	// переполнение: самый старый пакет удален
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, int64(1), q.Dropped())
+
+	got, seq, ok, err := q.Peek()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, batch("b"), got)
+	assert.NoError(t, q.Remove(seq))
+
+	// очередь сохраняется между открытиями
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "x.tmp"), []byte("{"), filePerm))
+
+	q, err = Open(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, q.Len())
+	assert.NoFileExists(t, filepath.Join(dir, "x.tmp"))
+
+	assert.NoError(t, q.Push(batch("d")))
+
+	got, seq, ok, err = q.Peek()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, batch("c"), got)
+	assert.NoError(t, q.Remove(seq))
+
+	got, _, _, err = q.Peek()
+	assert.NoError(t, err)
+	assert.Equal(t, batch("d"), got)
+}
+
+func TestQueueClose(t *testing.T) {
+	for name, q := range map[string]func() (*Queue, error){
+		"dir":    func() (*Queue, error) { return Open(t.TempDir(), 0) },
+		"memory": func() (*Queue, error) { return NewMemory(0), nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			que, err := q()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.NoError(t, que.Push(batch("a")))
+			assert.NoError(t, que.Close())
+			assert.NoError(t, que.Close())
+			assert.ErrorIs(t, que.Push(batch("b")), ErrClosed)
+			assert.Equal(t, 1, que.Len())
+		})
+	}
+}
+
+func TestQueueCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, q.Push(batch("a")))
+	assert.NoError(t, q.Push(batch("b")))
+	assert.NoError(t, os.WriteFile(q.path(0), []byte("{"), filePerm))
+
+	got, _, ok, err := q.Peek()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, batch("b"), got)
+	assert.Equal(t, int64(1), q.Dropped())
+	assert.Equal(t, 1, q.Len())
+}
+
+// Пакет, удаленный из каталога извне, пропускается.
+func TestQueueMissing(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, q.Push(batch("a")))
+	assert.NoError(t, q.Push(batch("b")))
+	assert.NoError(t, os.Remove(q.path(0)))
+
+	got, _, ok, err := q.Peek()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, batch("b"), got)
+	assert.Equal(t, int64(1), q.Dropped())
+	assert.Equal(t, 1, q.Len())
+
+	// во временных файлах не остается пакетов
+	entries, err := os.ReadDir(dir)
+	if assert.NoError(t, err) {
+		assert.Len(t, entries, 1)
+	}
+}
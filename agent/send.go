@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/agent/pkg/retry"
+	"github.com/AndreyVLZ/metrics/agent/queue"
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+// Ошибки отправки.
+// Агента останавливают только фатальные ошибки: ошибки подготовки
+// пакета (ключ, подпись, шифрование) и очереди на диске.
+var (
+	errFatal     = errors.New("fatal")
+	errTransport = errors.New("transport error")
+	errServer    = errors.New("server error") // ответ 5xx, вместе с errTransport
+	errRejected  = errors.New("batch rejected")
+)
+
+// sendStats счетчики отправки.
+type sendStats struct {
+	errors  atomic.Int64 // ошибок передачи, включая повторы
+	retries atomic.Int64 // повторов отправки
+	dropped atomic.Int64 // потерянных пакетов
+}
+
+// collector возвращает коллектор метрик отправки:
+// SendErrors, SendRetries, SendDropped - прирост счетчиков с прошлого опроса,
+// SendCircuitOpen - 1, если отправка приостановлена автоматом защиты.
+func (st *sendStats) collector(interval time.Duration, breaker *retry.Breaker) collector.Collector {
+	var prevErrors, prevRetries, prevDropped int64
+
+	delta := func(name string, cnt *atomic.Int64, prev *int64) model.Metric {
+		total := cnt.Load()
+		met := model.NewCounterMetric(name, total-*prev)
+		*prev = total
+
+		return met
+	}
+
+	return collector.New(sendCollectorName, interval, func(context.Context) []model.Metric {
+		var open float64
+		if breaker.Open() {
+			open = 1
+		}
+
+		return []model.Metric{
+			delta("SendErrors", &st.errors, &prevErrors),
+			delta("SendRetries", &st.retries, &prevRetries),
+			delta("SendDropped", &st.dropped, &prevDropped),
+			model.NewGaugeMetric("SendCircuitOpen", open),
+		}
+	})
+}
+
+// handleSendErr обрабатывает результат отправки пакета batch с резервом res.
+// Фатальная ошибка возвращается. Пакет, отклоненный сервером, теряется:
+// прирост counter потерянного пакета будет отправлен следующим пакетом.
+// При ошибке передачи пакет сохраняется в очередь вместе с резервом
+// и ключом: сервер мог применить пакет, а ответ потеряться, поэтому
+// прирост повторяется только с исходным ключом идемпотентности.
+func (a *Agent) handleSendErr(ctx context.Context, batch queue.Batch, res reservation, err error) error {
+	switch {
+	case err == nil:
+		a.deltas.done(res, true)
+
+		return nil
+	case errors.Is(err, errFatal):
+		a.deltas.done(res, false)
+
+		return err
+	case errors.Is(err, errRejected):
+		a.deltas.done(res, false)
+		a.stats.dropped.Add(1)
+		a.log.WarnContext(ctx, "send batch, dropped", slog.String("error", err.Error()))
+
+		return nil
+	default:
+		a.log.WarnContext(ctx, "send batch, queued", slog.String("error", err.Error()))
+
+		return a.enqueue(batch, res)
+	}
+}
+
+// enqueue сохраняет пакет в очередь. Резерв res держится
+// до отправки пакета из очереди, см. [Agent.drain].
+func (a *Agent) enqueue(batch queue.Batch, res reservation) error {
+	// порядок резервов совпадает с порядком очереди
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+
+	if err := a.queue.Push(batch); err != nil {
+		a.deltas.done(res, false)
+
+		return fmt.Errorf("%w: queue push: %w", errFatal, err)
+	}
+
+	a.deltas.hold(batch.Key, res)
+
+	return nil
+}
+
+// retry Вызывает fnSend, повторяя при ошибке передачи до Retries раз
+// с экспоненциальной задержкой. Пока автомат защиты разомкнут,
+// возвращает retry.ErrOpen без вызова fnSend.
+func (a *Agent) retry(ctx context.Context, fnSend func() error) error {
+	var err error
+
+	for i := 0; i <= a.cfg.Retries; i++ {
+		if i > 0 {
+			a.stats.retries.Add(1)
+			a.log.DebugContext(ctx, "send",
+				slog.Group("send",
+					slog.Int("retry", i),
+					slog.String("error", err.Error()),
+				),
+			)
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %w: %w", errTransport, ctx.Err(), err)
+			case <-time.After(a.backoff.Delay(i)):
+			}
+		}
+
+		trial, errOpen := a.breaker.Allow()
+		if errOpen != nil {
+			return fmt.Errorf("%w: %w", errTransport, errOpen)
+		}
+
+		err = fnSend()
+
+		// фатальная ошибка возникает до запроса: результата нет
+		if errors.Is(err, errFatal) {
+			a.breaker.Skip(trial)
+
+			return err
+		}
+
+		// отклоненный пакет - сервер доступен
+		a.breaker.Done(trial, !errors.Is(err, errTransport))
+
+		if !errors.Is(err, errTransport) {
+			return err
+		}
+
+		a.stats.errors.Add(1)
+	}
+
+	return fmt.Errorf("попыток %d, error: %w", a.cfg.Retries, err)
+}
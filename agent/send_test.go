@@ -0,0 +1,285 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/agent/config"
+	"github.com/AndreyVLZ/metrics/agent/pkg/retry"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// flapServer тестовый сервер, отвечающий status, пока он не 200.
+type flapServer struct {
+	*httptest.Server
+	status   atomic.Int64
+	requests atomic.Int64 // всего запросов
+	accepted atomic.Int64 // запросов с ответом 200
+}
+
+func newFlapServer(status int) *flapServer {
+	srv := &flapServer{}
+	srv.status.Store(int64(status))
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		srv.requests.Add(1)
+
+		status := int(srv.status.Load())
+		if status == http.StatusOK {
+			srv.accepted.Add(1)
+		}
+
+		rw.WriteHeader(status)
+	}))
+
+	return srv
+}
+
+// newTestAgent возвращает агента с короткими задержками повторов.
+func newTestAgent(t *testing.T, addr string, opts ...config.FuncOpt) *Agent {
+	t.Helper()
+
+	cfg, err := config.New(append([]config.FuncOpt{
+		config.SetAddr(strings.TrimPrefix(addr, "http://")),
+		config.SetReportInterval(200 * time.Millisecond),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := New(cfg, slog.Default())
+	agent.backoff = retry.NewBackoff(time.Millisecond, 5*time.Millisecond)
+	agent.breaker = retry.NewBreaker(3, 100*time.Millisecond)
+
+	return agent
+}
+
+func metrics() []model.Metric {
+	return []model.Metric{model.NewGaugeMetric("Alloc", 1)}
+}
+
+func TestSendBatchRetry(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlapServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+
+	// сервер поднимается после 2 ошибок
+	go func() {
+		for srv.requests.Load() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		srv.status.Store(http.StatusOK)
+	}()
+
+	assert.NoError(t, agent.sendBatch(ctx, metrics()))
+	assert.Equal(t, int64(1), srv.accepted.Load())
+	assert.GreaterOrEqual(t, agent.stats.retries.Load(), int64(2))
+	assert.Equal(t, agent.stats.retries.Load(), agent.stats.errors.Load())
+	assert.Equal(t, int64(0), agent.stats.dropped.Load())
+}
+
+func TestSendBatchBreaker(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlapServer(http.StatusBadGateway)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+
+	// ошибка передачи не фатальна: пакет сохранен в очередь в памяти
+	assert.NoError(t, agent.sendBatch(ctx, metrics()))
+	assert.Equal(t, 1, agent.queue.Len())
+	assert.Equal(t, int64(3), srv.requests.Load()) // после 3 ошибок автомат разомкнут
+	assert.True(t, agent.breaker.Open())
+
+	// пока автомат разомкнут, запросы не выполняются
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 1, agent.queue.Len())
+	assert.Equal(t, int64(3), srv.requests.Load())
+
+	srv.status.Store(http.StatusOK)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 0, agent.queue.Len())
+	assert.Equal(t, int64(1), srv.accepted.Load())
+	assert.Equal(t, int64(0), agent.stats.dropped.Load())
+	assert.False(t, agent.breaker.Open())
+}
+
+func TestSendBatchRejected(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlapServer(http.StatusBadRequest)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL, config.SetQueueDir(t.TempDir()))
+	if err := agent.openQueue(); err != nil {
+		t.Fatal(err)
+	}
+
+	// отклоненный пакет не повторяется и не сохраняется в очередь
+	assert.NoError(t, agent.sendBatch(ctx, metrics()))
+	assert.Equal(t, int64(1), srv.requests.Load())
+	assert.Equal(t, int64(1), agent.stats.dropped.Load())
+	assert.Equal(t, 0, agent.queue.Len())
+	assert.False(t, agent.breaker.Open())
+}
+
+func TestSendBatchQueue(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlapServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	agent := newTestAgent(t, srv.URL, config.SetQueueDir(dir))
+	if err := agent.openQueue(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, agent.sendBatch(ctx, metrics()))
+	assert.NoError(t, agent.sendBatch(ctx, metrics()))
+	assert.Equal(t, 2, agent.queue.Len())
+	assert.Equal(t, int64(0), agent.stats.dropped.Load())
+
+	// сервер недоступен: пакеты остаются в очереди
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 2, agent.queue.Len())
+
+	srv.status.Store(http.StatusOK)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 0, agent.queue.Len())
+	assert.Equal(t, int64(2), srv.accepted.Load())
+
+	// ошибка очереди фатальна
+	srv.status.Store(http.StatusServiceUnavailable)
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.ErrorIs(t, agent.sendBatch(ctx, metrics()), errFatal)
+}
+
+// Пакет, на который сервер отвечает 5xx QueueRetries раз,
+// удаляется из очереди и не задерживает следующие.
+func TestDrainQueueRetries(t *testing.T) {
+	ctx := context.Background()
+	srv := newFlapServer(http.StatusInternalServerError)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL, config.SetRetries(0), config.SetQueueRetries(2))
+
+	assert.NoError(t, agent.sendBatch(ctx, metrics()))
+	assert.Equal(t, 1, agent.queue.Len())
+
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 1, agent.queue.Len())
+
+	assert.NoError(t, agent.drain(ctx))
+	assert.Equal(t, 0, agent.queue.Len())
+	assert.Equal(t, int64(1), agent.stats.dropped.Load())
+	assert.Equal(t, int64(3), srv.requests.Load())
+}
+
+func TestRunFlapping(t *testing.T) {
+	if testing.Short() {
+		t.Skip()
+	}
+
+	ctx := context.Background()
+	srv := newFlapServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL)
+
+	ctxStart, cancelStart := context.WithCancel(ctx)
+	defer cancelStart()
+
+	if err := agent.Start(ctxStart); err != nil {
+		t.Fatal(err)
+	}
+
+	// сервер недоступен несколько отправок, затем поднимается
+	timeout := time.After(3 * time.Second)
+
+	for srv.accepted.Load() == 0 {
+		if srv.requests.Load() >= 3 {
+			srv.status.Store(http.StatusOK)
+		}
+
+		select {
+		case err := <-agent.Err():
+			t.Fatalf("agent stopped: %v", err)
+		case <-timeout:
+			t.Fatal("batch not accepted")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	assert.Positive(t, agent.stats.errors.Load())
+
+	cancelStart()
+
+	ctxStop, cancelStop := context.WithTimeout(ctx, time.Second)
+	defer cancelStop()
+
+	assert.NoError(t, agent.Stop(ctxStop))
+}
+
+// Метрики отправляются пакетами не больше BatchSize с идентификатором агента.
+func TestSendBatchSplit(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		sizes  []int
+		agents []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		gzr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			t.Error(err)
+
+			return
+		}
+
+		var list []model.MetricJSON
+		if err := json.NewDecoder(gzr).Decode(&list); err != nil {
+			t.Error(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		sizes = append(sizes, len(list))
+		agents = append(agents, req.Header.Get(agentIDHeader))
+	}))
+	defer srv.Close()
+
+	agent := newTestAgent(t, srv.URL, config.SetBatchSize(2), config.SetAgentID("agent-1"))
+
+	arr := make([]model.Metric, 5)
+	for i := range arr {
+		arr[i] = model.NewGaugeMetric("Gauge"+strconv.Itoa(i), 1)
+	}
+
+	assert.NoError(t, agent.sendBatch(context.Background(), arr))
+	assert.Equal(t, []int{2, 2, 1}, sizes)
+	assert.Equal(t, []string{"agent-1", "agent-1", "agent-1"}, agents)
+}
@@ -0,0 +1,267 @@
+package stats
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"strings"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+// Имена метрик пакета runtime/metrics.
+const (
+	keyHeapAllocsBytes   = "/gc/heap/allocs:bytes"
+	keyHeapAllocsObjects = "/gc/heap/allocs:objects"
+	keyHeapFreesObjects  = "/gc/heap/frees:objects"
+	keyHeapTinyAllocs    = "/gc/heap/tiny/allocs:objects"
+	keyHeapObjects       = "/gc/heap/objects:objects"
+	keyHeapGoal          = "/gc/heap/goal:bytes"
+	keyCyclesTotal       = "/gc/cycles/total:gc-cycles"
+	keyCyclesForced      = "/gc/cycles/forced:gc-cycles"
+	keyGCPauses          = "/gc/pauses:seconds"
+	keyCPUGCTotal        = "/cpu/classes/gc/total:cpu-seconds"
+	keyCPUTotal          = "/cpu/classes/total:cpu-seconds"
+	keyGoroutines        = "/sched/goroutines:goroutines"
+	keySchedLatencies    = "/sched/latencies:seconds"
+
+	memClassesPrefix    = "/memory/classes/"
+	keyMemHeapFree      = memClassesPrefix + "heap/free:bytes"
+	keyMemHeapObjects   = memClassesPrefix + "heap/objects:bytes"
+	keyMemHeapReleased  = memClassesPrefix + "heap/released:bytes"
+	keyMemHeapStacks    = memClassesPrefix + "heap/stacks:bytes"
+	keyMemHeapUnused    = memClassesPrefix + "heap/unused:bytes"
+	keyMemMCacheFree    = memClassesPrefix + "metadata/mcache/free:bytes"
+	keyMemMCacheInuse   = memClassesPrefix + "metadata/mcache/inuse:bytes"
+	keyMemMSpanFree     = memClassesPrefix + "metadata/mspan/free:bytes"
+	keyMemMSpanInuse    = memClassesPrefix + "metadata/mspan/inuse:bytes"
+	keyMemMetadataOther = memClassesPrefix + "metadata/other:bytes"
+	keyMemOSStacks      = memClassesPrefix + "os-stacks:bytes"
+	keyMemOther         = memClassesPrefix + "other:bytes"
+	keyMemBuckets       = memClassesPrefix + "profiling/buckets:bytes"
+	keyMemTotal         = memClassesPrefix + "total:bytes"
+
+	unitBytes   = "bytes"
+	unitSeconds = "seconds"
+)
+
+// Гистограммы, передаваемые квантилями за интервал опроса.
+var runtimeHists = [...]struct {
+	key  string
+	name string
+	help string
+}{
+	{key: keySchedLatencies, name: "SchedLatency", help: "время ожидания горутины в очереди планировщика"},
+	{key: keyGCPauses, name: "GCPause", help: "пауза программы на сборку мусора"},
+}
+
+// Квантили гистограмм: суффикс имени метрики и квантиль.
+var histQuantiles = [...]struct {
+	suffix string
+	q      float64
+}{
+	{suffix: "P50", q: 0.5},
+	{suffix: "P90", q: 0.9},
+	{suffix: "P99", q: 0.99},
+	{suffix: "Max", q: 1},
+}
+
+// Статистика для runtime.
+// Все значения читаются одним вызовом metrics.Read за опрос,
+// в отличие от runtime.ReadMemStats он не останавливает программу.
+// LastGC и PauseTotalNs в runtime/metrics нет, они читаются
+// debug.ReadGCStats, который также не останавливает программу.
+type runtimeStats struct {
+	samples  []metrics.Sample
+	index    map[string]int      // индекс метрики в samples
+	prevHist map[string][]uint64 // значения гистограмм прошлого опроса
+	memKeys  []string            // классы памяти
+	gcStats  debug.GCStats
+}
+
+func newRuntimeStats() *runtimeStats {
+	keys := []string{
+		keyHeapAllocsBytes, keyHeapAllocsObjects, keyHeapFreesObjects, keyHeapTinyAllocs,
+		keyHeapObjects, keyHeapGoal, keyCyclesTotal, keyCyclesForced, keyGCPauses,
+		keyCPUGCTotal, keyCPUTotal, keyGoroutines, keySchedLatencies,
+	}
+
+	// классы памяти берутся из описаний: новые классы
+	// следующих версий Go передаются без изменения кода
+	memKeys := make([]string, 0)
+
+	for _, desc := range metrics.All() {
+		if strings.HasPrefix(desc.Name, memClassesPrefix) {
+			memKeys = append(memKeys, desc.Name)
+		}
+	}
+
+	s := &runtimeStats{
+		samples:  make([]metrics.Sample, 0, len(keys)+len(memKeys)),
+		index:    make(map[string]int, len(keys)+len(memKeys)),
+		prevHist: make(map[string][]uint64, len(runtimeHists)),
+		memKeys:  memKeys,
+	}
+
+	for _, key := range append(keys, memKeys...) {
+		if _, ok := s.index[key]; ok {
+			continue
+		}
+
+		s.index[key] = len(s.samples)
+		s.samples = append(s.samples, metrics.Sample{Name: key})
+	}
+
+	return s
+}
+
+// read читает значения метрик.
+func (s *runtimeStats) read() {
+	metrics.Read(s.samples)
+	debug.ReadGCStats(&s.gcStats)
+}
+
+// val возвращает целое или дробное значение метрики key.
+// Для неподдерживаемой метрики возвращает 0.
+func (s *runtimeStats) val(key string) float64 {
+	idx, ok := s.index[key]
+	if !ok {
+		return 0
+	}
+
+	switch val := s.samples[idx].Value; val.Kind() {
+	case metrics.KindUint64:
+		return float64(val.Uint64())
+	case metrics.KindFloat64:
+		return val.Float64()
+	default:
+		return 0
+	}
+}
+
+// sum возвращает сумму значений метрик keys.
+func (s *runtimeStats) sum(keys ...string) float64 {
+	var sum float64
+	for _, key := range keys {
+		sum += s.val(key)
+	}
+
+	return sum
+}
+
+// gcCPUFraction возвращает долю процессорного времени на сборку мусора с запуска программы.
+func (s *runtimeStats) gcCPUFraction() float64 {
+	total := s.val(keyCPUTotal)
+	if total == 0 {
+		return 0
+	}
+
+	return s.val(keyCPUGCTotal) / total
+}
+
+// extList возвращает метрики runtime/metrics, которых нет в runtime.MemStats:
+// кол-во горутин, квантили гистограмм за интервал опроса и классы памяти.
+func (s *runtimeStats) extList() []model.Metric {
+	list := make([]model.Metric, 0, 1+len(runtimeHists)*len(histQuantiles)+len(s.memKeys))
+	list = append(list, gauge("Goroutines", s.val(keyGoroutines), "", "кол-во горутин"))
+
+	for _, hist := range runtimeHists {
+		buckets, counts, total := s.histDelta(hist.key)
+		for _, quant := range histQuantiles {
+			list = append(list, gauge(
+				hist.name+quant.suffix,
+				quantile(buckets, counts, total, quant.q),
+				unitSeconds,
+				hist.help,
+			))
+		}
+	}
+
+	for _, key := range s.memKeys {
+		list = append(list, gauge(memClassName(key), s.val(key), unitBytes, "класс памяти "+key))
+	}
+
+	return list
+}
+
+// histDelta возвращает границы и значения гистограммы key
+// за время с прошлого опроса и их сумму.
+func (s *runtimeStats) histDelta(key string) ([]float64, []uint64, uint64) {
+	idx, ok := s.index[key]
+	if !ok || s.samples[idx].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil, nil, 0
+	}
+
+	hist := s.samples[idx].Value.Float64Histogram()
+	prev := s.prevHist[key]
+	counts := make([]uint64, len(hist.Counts))
+
+	var total uint64
+
+	for i, count := range hist.Counts {
+		if i < len(prev) {
+			count -= prev[i]
+		}
+
+		counts[i] = count
+		total += count
+	}
+
+	// metrics.Read может переиспользовать память гистограммы
+	s.prevHist[key] = append(prev[:0], hist.Counts...)
+
+	return hist.Buckets, counts, total
+}
+
+// quantile возвращает квантиль q гистограммы: верхнюю границу корзины,
+// в которую попадает квантиль, или нижнюю для корзины до +Inf.
+// Для пустой гистограммы возвращает 0.
+func quantile(buckets []float64, counts []uint64, total uint64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cum uint64
+
+	for i, count := range counts {
+		if cum += count; cum >= rank {
+			if upper := buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper
+			}
+
+			return buckets[i]
+		}
+	}
+
+	return 0
+}
+
+// memClassName возвращает имя метрики класса памяти:
+// /memory/classes/metadata/mcache/free:bytes -> MemMetadataMcacheFree.
+func memClassName(key string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(key, memClassesPrefix), ":")
+
+	var name strings.Builder
+
+	name.WriteString("Mem")
+
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' }) {
+		name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+
+	return name.String()
+}
+
+// gauge возвращает gauge со сведениями.
+func gauge(name string, val float64, unit, help string) model.Metric {
+	met := model.NewGaugeMetric(name, val)
+	met.Unit = unit
+	met.Help = help
+
+	return met
+}
@@ -1,11 +1,13 @@
 package stats
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
-	"runtime"
-	"sync/atomic"
+	"sync"
+	"time"
 
+	"github.com/AndreyVLZ/metrics/agent/collector"
 	"github.com/AndreyVLZ/metrics/internal/model"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
@@ -17,6 +19,9 @@ const totalRuntimeMetric = 29 // Кол-во метрик из пакета runt
 
 const (
 	TotalMetric int = 32 // Общее кол-во метрик.
+
+	RuntimeCollectorName = "runtime"  // Имя коллектора метрик пакета runtime.
+	UtilCollectorName    = "gopsutil" // Имя коллектора метрик пакета gopsutil.
 )
 
 // Константы поддерживаемых метрик:
@@ -56,7 +61,7 @@ const (
 	PollCount // total runtime
 	TotalMemory
 	FreeMemory
-	CPUutilization1
+	CPUCount
 )
 
 func supportName() [TotalMetric]string {
@@ -74,8 +79,8 @@ func supportName() [TotalMetric]string {
 		"PollCount",
 		// [util] uint64
 		"TotalMemory", "FreeMemory",
-		// int
-		"CPUutilization1",
+		// int, кол-во логических ядер; загрузка ядер - в коллекторе host
+		"CPUCount",
 	}
 }
 
@@ -91,34 +96,37 @@ var (
 	}
 
 	// Массив функций для чтения метрик из пакета runtime.
+	// Значения совпадают с полями runtime.MemStats.
 	arrFuncRuntimeRead = [28]func(*runtimeStats) float64{
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.Alloc) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.BuckHashSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.Frees) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.GCSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.HeapAlloc) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.HeapIdle) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.HeapInuse) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.HeapObjects) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.HeapReleased) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.HeapSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.LastGC) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.Lookups) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.MCacheInuse) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.MCacheSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.MSpanInuse) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.MSpanSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.Mallocs) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.NextGC) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.OtherSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.PauseTotalNs) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.StackInuse) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.StackSys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.Sys) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.TotalAlloc) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.NumForcedGC) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return float64(s.memStats.NumGC) },
-		func(s *runtimeStats) float64 { s.total.Add(1); return s.memStats.GCCPUFraction },
+		func(s *runtimeStats) float64 { return s.val(keyMemHeapObjects) },
+		func(s *runtimeStats) float64 { return s.val(keyMemBuckets) },
+		func(s *runtimeStats) float64 { return s.sum(keyHeapFreesObjects, keyHeapTinyAllocs) },
+		func(s *runtimeStats) float64 { return s.val(keyMemMetadataOther) },
+		func(s *runtimeStats) float64 { return s.val(keyMemHeapObjects) },
+		func(s *runtimeStats) float64 { return s.sum(keyMemHeapFree, keyMemHeapReleased) },
+		func(s *runtimeStats) float64 { return s.sum(keyMemHeapObjects, keyMemHeapUnused) },
+		func(s *runtimeStats) float64 { return s.val(keyHeapObjects) },
+		func(s *runtimeStats) float64 { return s.val(keyMemHeapReleased) },
+		func(s *runtimeStats) float64 {
+			return s.sum(keyMemHeapObjects, keyMemHeapUnused, keyMemHeapFree, keyMemHeapReleased)
+		},
+		func(s *runtimeStats) float64 { return float64(s.gcStats.LastGC.UnixNano()) },
+		func(_ *runtimeStats) float64 { return 0 }, // Lookups не учитывается рантаймом
+		func(s *runtimeStats) float64 { return s.val(keyMemMCacheInuse) },
+		func(s *runtimeStats) float64 { return s.sum(keyMemMCacheInuse, keyMemMCacheFree) },
+		func(s *runtimeStats) float64 { return s.val(keyMemMSpanInuse) },
+		func(s *runtimeStats) float64 { return s.sum(keyMemMSpanInuse, keyMemMSpanFree) },
+		func(s *runtimeStats) float64 { return s.sum(keyHeapAllocsObjects, keyHeapTinyAllocs) },
+		func(s *runtimeStats) float64 { return s.val(keyHeapGoal) },
+		func(s *runtimeStats) float64 { return s.val(keyMemOther) },
+		func(s *runtimeStats) float64 { return float64(s.gcStats.PauseTotal.Nanoseconds()) },
+		func(s *runtimeStats) float64 { return s.val(keyMemHeapStacks) },
+		func(s *runtimeStats) float64 { return s.sum(keyMemHeapStacks, keyMemOSStacks) },
+		func(s *runtimeStats) float64 { return s.val(keyMemTotal) },
+		func(s *runtimeStats) float64 { return s.val(keyHeapAllocsBytes) },
+		func(s *runtimeStats) float64 { return s.val(keyCyclesForced) },
+		func(s *runtimeStats) float64 { return s.val(keyCyclesTotal) },
+		func(s *runtimeStats) float64 { return s.gcCPUFraction() },
 		func(_ *runtimeStats) float64 { return rand.ExpFloat64() },
 	}
 )
@@ -127,6 +135,7 @@ var (
 type Stats struct {
 	rtStats   *runtimeStats
 	utilStats utilStats
+	mu        sync.Mutex // опрос runtime
 }
 
 func New() *Stats {
@@ -141,19 +150,54 @@ func (s *Stats) Init() error { return s.utilStats.Init() }
 
 // Возвращает срез метрик, прочитанных из пакета gopsutil.
 func (s *Stats) UtilList() []model.Metric {
-	return s.readList(TotalMemory, CPUutilization1)
+	return s.readList(TotalMemory, CPUCount)
 }
 
-// Возвращает срез метрик, прочитанных из пакета runtime.
+// Возвращает срез метрик, прочитанных из пакета runtime/metrics за один опрос:
+// метрики с именами полей runtime.MemStats, PollCount и метрики [runtimeStats.extList].
 func (s *Stats) RuntimeList() []model.Metric {
-	return s.readList(Alloc, PollCount)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rtStats.read()
+
+	list := s.readList(Alloc, PollCount)
+	ts := list[0].TS
+
+	for _, met := range s.rtStats.extList() {
+		met.TS = ts
+		list = append(list, met)
+	}
+
+	return list
 }
 
+// RuntimeCollector возвращает коллектор метрик пакета runtime с опросом раз в interval.
+func (s *Stats) RuntimeCollector(interval time.Duration) collector.Collector {
+	return collector.New(RuntimeCollectorName, interval,
+		func(context.Context) []model.Metric { return s.RuntimeList() },
+	)
+}
+
+// UtilCollector возвращает коллектор метрик пакета gopsutil с опросом раз в interval.
+func (s *Stats) UtilCollector(interval time.Duration) collector.Collector {
+	return collector.New(UtilCollectorName, interval,
+		func(context.Context) []model.Metric { return s.UtilList() },
+		collector.SetInit(func(context.Context) error { return s.Init() }),
+	)
+}
+
+// readList возвращает метрики от start до stop.
+// Всем метрикам списка задается время снятия ts - время чтения.
 func (s *Stats) readList(start, stop Name) []model.Metric {
 	list := make([]model.Metric, 0, stop-start)
+	now := time.Now().UTC()
 
 	for iName := start; iName <= stop; iName++ {
-		list = append(list, s.readMetric(iName))
+		met := s.readMetric(iName)
+		met.TS = now
+
+		list = append(list, met)
 	}
 
 	return list
@@ -162,35 +206,19 @@ func (s *Stats) readList(start, stop Name) []model.Metric {
 func (s *Stats) readMetric(metName Name) model.Metric {
 	switch {
 	case metName >= Alloc && metName <= RandomValue:
-		runtime.ReadMemStats(&s.rtStats.memStats)
-
 		val := arrFuncRuntimeRead[metName]
 		aval := val(s.rtStats)
 
 		return model.NewGaugeMetric(metName.String(), aval)
-	case metName >= TotalMemory && metName <= CPUutilization1:
+	case metName >= TotalMemory && metName <= CPUCount:
 		l := metName - totalRuntimeMetric
 		val := arrFuncUtilRead[l]
 		aval := val(&s.utilStats)
 
 		return model.NewGaugeMetric(metName.String(), aval)
 	default:
-		return model.NewCounterMetric(metName.String(), s.rtStats.total.Load())
-	}
-}
-
-// Статистика для runtime.
-type runtimeStats struct {
-	memStats runtime.MemStats
-	total    atomic.Int64
-}
-
-func newRuntimeStats() *runtimeStats {
-	var memStats runtime.MemStats
-
-	return &runtimeStats{
-		memStats: memStats,
-		total:    atomic.Int64{},
+		// прирост за опрос: хранилище агента накапливает counter
+		return model.NewCounterMetric(metName.String(), 1)
 	}
 }
 
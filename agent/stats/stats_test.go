@@ -1,8 +1,14 @@
 package stats
 
 import (
+	"context"
+	"math"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/AndreyVLZ/metrics/agent/collector"
+	"github.com/AndreyVLZ/metrics/internal/model"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,13 +20,77 @@ func TestStats(t *testing.T) {
 
 	rtList := stats.RuntimeList()
 	t.Run("len count arr", func(t *testing.T) {
-		assert.Equal(t, 29, len(rtList))
+		assert.Equal(t, 29+1+8+len(stats.rtStats.memKeys), len(rtList))
+	})
+
+	t.Run("names", func(t *testing.T) {
+		vals := make(map[string]model.Metric, len(rtList))
+		for _, met := range rtList {
+			vals[met.MName] = met
+		}
+
+		for iName := Alloc; iName <= PollCount; iName++ {
+			assert.Contains(t, vals, iName.String())
+		}
+
+		assert.Equal(t, model.TypeCountConst, vals[PollCount.String()].MType)
+		assert.Equal(t, *vals[Sys.String()].Val, *vals["MemTotal"].Val)
+		assert.Equal(t, *vals[HeapAlloc.String()].Val, *vals["MemHeapObjects"].Val)
+		assert.Positive(t, *vals["Goroutines"].Val)
+		assert.Contains(t, vals, "MemMetadataMcacheFree")
+		assert.Contains(t, vals, "SchedLatencyP99")
+		assert.Equal(t, "bytes", vals["MemOsStacks"].Unit)
+	})
+
+	t.Run("poll count", func(t *testing.T) {
+		for _, met := range stats.RuntimeList() {
+			if met.MName == PollCount.String() {
+				assert.Equal(t, int64(1), *met.Delta)
+			}
+		}
+	})
+
+	t.Run("gc pause", func(t *testing.T) {
+		runtime.GC()
+
+		for _, met := range stats.RuntimeList() {
+			if met.MName == "GCPauseMax" {
+				assert.Positive(t, *met.Val)
+			}
+		}
 	})
 
 	uList := stats.UtilList()
 	t.Run("len gauge arr", func(t *testing.T) {
 		assert.Equal(t, 3, len(uList))
 	})
+
+	t.Run("ts", func(t *testing.T) {
+		for _, met := range append(rtList, uList...) {
+			assert.False(t, met.TS.IsZero(), met.MName)
+		}
+	})
+}
+
+func TestCollectors(t *testing.T) {
+	ctx := context.Background()
+	stats := New()
+
+	rtCol := stats.RuntimeCollector(time.Second)
+	assert.Equal(t, RuntimeCollectorName, rtCol.Name())
+	assert.Equal(t, time.Second, rtCol.Interval())
+	assert.Len(t, rtCol.Collect(ctx), 29+1+8+len(stats.rtStats.memKeys))
+
+	uCol := stats.UtilCollector(2 * time.Second)
+	assert.Equal(t, UtilCollectorName, uCol.Name())
+	assert.Equal(t, 2*time.Second, uCol.Interval())
+
+	initer, ok := uCol.(collector.Initer)
+	if assert.True(t, ok) {
+		assert.NoError(t, initer.Init(ctx))
+	}
+
+	assert.Len(t, uCol.Collect(ctx), 3)
 }
 
 func TestSupportName(t *testing.T) {
@@ -56,7 +126,7 @@ func TestSupportName(t *testing.T) {
 		PollCount,
 		TotalMemory,
 		FreeMemory,
-		CPUutilization1,
+		CPUCount,
 	}
 
 	names := supportName()
@@ -65,3 +135,20 @@ func TestSupportName(t *testing.T) {
 		assert.Equal(t, met.String(), names[i])
 	}
 }
+
+func TestQuantile(t *testing.T) {
+	buckets := []float64{0, 1, 2, 3, math.Inf(1)}
+	counts := []uint64{5, 3, 1, 1}
+
+	assert.Equal(t, 1.0, quantile(buckets, counts, 10, 0.5))
+	assert.Equal(t, 2.0, quantile(buckets, counts, 10, 0.8))
+	assert.Equal(t, 3.0, quantile(buckets, counts, 10, 0.9))
+	assert.Equal(t, 3.0, quantile(buckets, counts, 10, 1)) // корзина до +Inf
+	assert.Equal(t, 0.0, quantile(buckets, make([]uint64, 4), 0, 0.5))
+}
+
+func TestMemClassName(t *testing.T) {
+	assert.Equal(t, "MemMetadataMcacheFree", memClassName("/memory/classes/metadata/mcache/free:bytes"))
+	assert.Equal(t, "MemOsStacks", memClassName("/memory/classes/os-stacks:bytes"))
+	assert.Equal(t, "MemTotal", memClassName("/memory/classes/total:bytes"))
+}
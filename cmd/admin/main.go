@@ -0,0 +1,328 @@
+// Выгрузка и загрузка всех метрик сервера.
+//
+//	admin export [-a addr] [-k key] [-crypto-key path] [-format jsonl|csv] [-o file]
+//	admin import [-a addr] [-k key] [-crypto-key path] [-format jsonl|csv] [-i file]
+//
+// Параметры:
+//   - адрес эндпоинта HTTP-сервера
+//     ["localhost:8080"] [-a]
+//   - ключ подписи запросов, как у сервера: сервер с ключом принимает
+//     запросы /admin только с подписью. Подпись покрывает метод, путь и время
+//     запроса, поэтому часы клиента и сервера должны совпадать с точностью до 5 минут
+//     [""] [-k]
+//   - путь до файла с публичным ключом для шифрования загрузки, как у агента.
+//     Загрузка шифруется одним блоком RSA: после сжатия она не должна быть больше
+//     размера ключа за вычетом 66 байт (около 450 байт для ключа 4096 бит),
+//     поэтому с шифрованием загружаются только небольшие выгрузки. Большая
+//     загрузка с -crypto-key отклоняется до отправки: ее нужно загружать
+//     на сервер без шифрования, например через защищенный канал
+//     [""] [-crypto-key]
+//   - формат выгрузки [jsonl|csv]
+//     ["jsonl"] [-format]
+//   - файл для выгрузки, по умолчанию stdout (export)
+//     [""] [-o]
+//   - файл для загрузки, по умолчанию stdin (import)
+//     [""] [-i]
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/dump"
+	"github.com/AndreyVLZ/metrics/pkg/crypto"
+	"github.com/AndreyVLZ/metrics/pkg/hash"
+)
+
+const (
+	addrDefault    = "localhost:8080"
+	exportPath     = "/admin/export"
+	importPath     = "/admin/import"
+	timeoutDefault = 5 * time.Minute
+	oaepOverhead   = 2*sha256.Size + 2 // Байты блока RSA-OAEP (SHA-256), недоступные для данных.
+)
+
+var (
+	errUsage     = errors.New("usage: admin export|import [flags]")
+	errSignature = errors.New("export signature not valid")
+	errTooLarge  = errors.New("import too large to encrypt")
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+}
+
+// run выполняет подкоманду args[0].
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	var (
+		addr          string
+		format        string
+		path          string
+		key           string
+		cryptoKeyPath string
+	)
+
+	cmd := args[0]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.StringVar(&addr, "a", addrDefault, "адрес эндпоинта HTTP-сервера")
+	fs.StringVar(&format, "format", string(dump.FormatJSONL), "формат выгрузки [jsonl|csv]")
+	fs.StringVar(&key, "k", "", "ключ подписи запросов")
+	fs.StringVar(&cryptoKeyPath, "crypto-key", "", "путь до файла с публичным ключом")
+
+	switch cmd {
+	case "export":
+		fs.StringVar(&path, "o", "", "файл для выгрузки, по умолчанию stdout")
+	case "import":
+		fs.StringVar(&path, "i", "", "файл для загрузки, по умолчанию stdin")
+	default:
+		return fmt.Errorf("%w: unknown command [%s]", errUsage, cmd)
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	dumpFormat, err := dump.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	cl := client{
+		http: &http.Client{Timeout: timeoutDefault},
+		key:  []byte(key),
+	}
+
+	if cryptoKeyPath != "" {
+		if cl.publicKey, err = crypto.RSAPublicKey(cryptoKeyPath); err != nil {
+			return fmt.Errorf("publicKey: %w", err)
+		}
+	}
+
+	if cmd == "export" {
+		return runExport(cl, buildURL(addr, exportPath, dumpFormat), path, stdout)
+	}
+
+	count, err := runImport(cl, buildURL(addr, importPath, dumpFormat), dumpFormat, path, stdin)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("imported: %d\n", count)
+
+	return nil
+}
+
+func buildURL(addr, path string, format dump.Format) string {
+	return (&url.URL{
+		Scheme:   "http",
+		Host:     addr,
+		Path:     path,
+		RawQuery: url.Values{"format": {string(format)}}.Encode(),
+	}).String()
+}
+
+// client клиент сервера. Запросы подписываются ключом key вместе
+// с методом, путем и временем запроса (заголовок HashTime), а тело запроса
+// сжимается и шифруется публичным ключом publicKey, как у агента.
+// Пустые key и publicKey - без подписи и шифрования.
+type client struct {
+	http      *http.Client
+	publicKey *rsa.PublicKey
+	key       []byte
+}
+
+// do выполняет запрос с телом body.
+func (cl client) do(method, reqURL, contentType string, body []byte) (*http.Response, error) {
+	header := make(http.Header)
+
+	if len(cl.key) > 0 {
+		u, err := url.Parse(reqURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse url: %w", err)
+		}
+
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		sum, err := hash.SHA256(hash.RequestMessage(method, u.RequestURI(), ts, body), cl.key)
+		if err != nil {
+			return nil, fmt.Errorf("hash: %w", err)
+		}
+
+		header.Set("HashSHA256", hex.EncodeToString(sum))
+		header.Set("HashTime", ts)
+	}
+
+	if len(body) > 0 {
+		var err error
+
+		if body, err = compress(body); err != nil {
+			return nil, err
+		}
+
+		header.Set("Content-Encoding", "gzip")
+		header.Set("Content-Type", contentType)
+
+		if cl.publicKey != nil {
+			if limit := cl.publicKey.Size() - oaepOverhead; len(body) > limit {
+				return nil, fmt.Errorf("%w: compressed %d > %d bytes, import without -crypto-key",
+					errTooLarge, len(body), limit)
+			}
+
+			if body, err = crypto.Encrypt(cl.publicKey, body); err != nil {
+				return nil, fmt.Errorf("encrypt len[%d]: %w", len(body), err)
+			}
+		}
+	}
+
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+
+	req.Header = header
+
+	resp, err := cl.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return resp, nil
+}
+
+// compress сжимает data gzip.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip write: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip close: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// runExport записывает выгрузку сервера в файл path или в stdout.
+// С ключом подписи проверяется подпись выгрузки из трейлера HashSHA256:
+// без нее выгрузка могла быть оборвана или изменена.
+func runExport(cl client, reqURL, path string, stdout io.Writer) error {
+	resp, err := cl.do(http.MethodGet, reqURL, "", nil)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	out := stdout
+
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("create file: %w", err)
+		}
+		defer file.Close()
+
+		out = file
+	}
+
+	var body io.Reader = resp.Body
+
+	mac := hash.New(cl.key)
+	if len(cl.key) > 0 {
+		body = io.TeeReader(resp.Body, mac)
+	}
+
+	if _, err := io.Copy(out, body); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+
+	if len(cl.key) == 0 {
+		return nil
+	}
+
+	// трейлер доступен после чтения всего тела
+	sum, err := hex.DecodeString(resp.Trailer.Get("HashSHA256"))
+	if err != nil || !hmac.Equal(sum, mac.Sum(nil)) {
+		return errSignature
+	}
+
+	return nil
+}
+
+// runImport отправляет на сервер файл path или stdin и возвращает кол-во загруженных метрик.
+func runImport(cl client, reqURL string, format dump.Format, path string, stdin io.Reader) (int, error) {
+	in := stdin
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, fmt.Errorf("open file: %w", err)
+		}
+		defer file.Close()
+
+		in = file
+	}
+
+	// тело читается целиком для подписи и шифрования
+	body, err := io.ReadAll(in)
+	if err != nil {
+		return 0, fmt.Errorf("read import: %w", err)
+	}
+
+	resp, err := cl.do(http.MethodPost, reqURL, format.ContentType(), body)
+	if err != nil {
+		return 0, fmt.Errorf("import: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return 0, fmt.Errorf("import: %w", err)
+	}
+
+	var res struct {
+		Imported int `json:"imported"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, fmt.Errorf("decode response: %w", err)
+	}
+
+	return res.Imported, nil
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+
+	return fmt.Errorf("status [%s]: %s", resp.Status, msg)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/AndreyVLZ/metrics/pkg/crypto"
+	shttp "github.com/AndreyVLZ/metrics/server/http"
+	m "github.com/AndreyVLZ/metrics/server/http/middleware"
+	"github.com/AndreyVLZ/metrics/server/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, mets ...model.Metric) *httptest.Server {
+	t.Helper()
+
+	return newSecureServer(t, "", nil, mets...)
+}
+
+// newSecureServer возвращает сервер, проверяющий подпись ключом key
+// и расшифровывающий запросы ключом privateKey, как server.Server.
+func newSecureServer(t *testing.T, key string, privateKey *rsa.PrivateKey, mets ...model.Metric) *httptest.Server {
+	t.Helper()
+
+	store := adapter.Ping(inmemory.New())
+	for _, met := range mets {
+		if _, err := store.Update(context.Background(), met); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := shttp.NewRoute(service.New(store), slog.Default(), shttp.SetAdminKey(key))
+	srv := httptest.NewServer(m.Decrypt(privateKey, m.Gzip(m.Hash(key, mux))))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func serverAddr(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Host
+}
+
+func TestExportImport(t *testing.T) {
+	for _, format := range []string{"jsonl", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			// сведения с временем изменения сохраняются при загрузке
+			counter := model.NewCounterMetric("PollCount", 5)
+			counter.Meta = model.Meta{Created: time.Unix(1, 0).UTC(), Updated: time.Unix(2, 0).UTC()}
+			gauge := model.NewGaugeMetric("Alloc", 1.5)
+			gauge.Meta = model.Meta{Created: time.Unix(1, 0).UTC(), Updated: time.Unix(2, 0).UTC(), Unit: "bytes"}
+
+			src := newTestServer(t, counter, gauge)
+			dst := newTestServer(t)
+			path := filepath.Join(t.TempDir(), "metrics."+format)
+
+			if err := run([]string{"export", "-a", serverAddr(t, src), "-format", format, "-o", path}, nil, nil); err != nil {
+				t.Fatalf("export: %v", err)
+			}
+
+			if err := run([]string{"import", "-a", serverAddr(t, dst), "-format", format, "-i", path}, nil, nil); err != nil {
+				t.Fatalf("import: %v", err)
+			}
+
+			var srcOut, dstOut bytes.Buffer
+
+			if err := run([]string{"export", "-a", serverAddr(t, src), "-format", format}, nil, &srcOut); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := run([]string{"export", "-a", serverAddr(t, dst), "-format", format}, nil, &dstOut); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.ElementsMatch(t, strings.Split(string(data), "\n"), strings.Split(srcOut.String(), "\n"))
+			assert.ElementsMatch(t, strings.Split(srcOut.String(), "\n"), strings.Split(dstOut.String(), "\n"))
+		})
+	}
+}
+
+func TestExportImportSecure(t *testing.T) {
+	const key = "secret"
+
+	dir := t.TempDir()
+	publicKeyPath := filepath.Join(dir, "public.pem")
+	privateKeyPath := filepath.Join(dir, "private.pem")
+
+	rsaKey, err := crypto.New(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeKey := func(path string, fnWrite func(io.Writer) error) {
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if err := fnWrite(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeKey(publicKeyPath, rsaKey.WritePublicKeyTo)
+	writeKey(privateKeyPath, rsaKey.WritePrivateKeyTo)
+
+	privateKey, err := crypto.RSAPrivateKey(privateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := newSecureServer(t, key, privateKey, model.NewCounterMetric("PollCount", 5))
+	dst := newSecureServer(t, key, privateKey)
+	path := filepath.Join(dir, "metrics.jsonl")
+
+	// без подписи сервер с ключом отклоняет запрос
+	assert.Error(t, run([]string{"export", "-a", serverAddr(t, src), "-o", path}, nil, nil))
+
+	secure := []string{"-k", key, "-crypto-key", publicKeyPath}
+
+	if err := run(append([]string{"export", "-a", serverAddr(t, src), "-o", path}, secure...), nil, nil); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	if err := run(append([]string{"import", "-a", serverAddr(t, dst), "-i", path}, secure...), nil, nil); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	var dstOut bytes.Buffer
+
+	if err := run(append([]string{"export", "-a", serverAddr(t, dst)}, secure...), nil, &dstOut); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, dstOut.String(), `"id":"PollCount"`)
+
+	// после сжатия загрузка больше блока RSA
+	var big strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&big, "{\"id\":\"Gauge%d\",\"type\":\"gauge\",\"value\":%d.%d}\n", i, i*7919, i*104729)
+	}
+
+	err = run(append([]string{"import", "-a", serverAddr(t, dst)}, secure...), strings.NewReader(big.String()), nil)
+	assert.ErrorIs(t, err, errTooLarge)
+}
+
+func TestExportSignatureErr(t *testing.T) {
+	// сервер без ключа не подписывает выгрузку
+	srv := newTestServer(t, model.NewCounterMetric("PollCount", 5))
+
+	err := run([]string{"export", "-a", serverAddr(t, srv), "-k", "secret"}, nil, &bytes.Buffer{})
+	assert.ErrorIs(t, err, errSignature)
+}
+
+func TestRunErr(t *testing.T) {
+	srv := newTestServer(t)
+
+	tc := []struct {
+		name  string
+		args  []string
+		stdin string
+	}{
+		{name: "no command"},
+		{name: "unknown command", args: []string{"backup"}},
+		{name: "bad format", args: []string{"export", "-format", "xml"}},
+		{name: "bad data", args: []string{"import", "-a", serverAddr(t, srv)}, stdin: "not a dump"},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			err := run(test.args, strings.NewReader(test.stdin), &bytes.Buffer{})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -16,6 +16,28 @@
 //     ["err"] [-lvl] [LVL]
 //   - частота отправки метрик на сервер
 //     [10] [-r] [REPORT_INTERVAL]
+//   - наблюдаемые процессы через запятую: [метка=][name:|pid:|pidfile:]значение
+//     [""] [-proc] [PROCESSES]
+//   - UDP адрес приема метрик StatsD
+//     [""] [-statsd] [STATSD_ADDR]
+//   - путь до unix datagram сокета приема метрик StatsD
+//     [""] [-statsd-socket] [STATSD_SOCKET]
+//   - адрес локального приема метрик приложений ('unix:<путь>' для unix сокета)
+//     [""] [-push] [PUSH_ADDR]
+//   - цели опроса метрик Prometheus через запятую: [метка=]url[@интервал]
+//     [""] [-scrape] [SCRAPE_TARGETS]
+//   - каталог очереди неотправленных пакетов (пусто - очередь в памяти)
+//     [""] [-queue-dir] [QUEUE_DIR]
+//   - наибольшее кол-во пакетов в очереди
+//     [1000] [-queue-size] [QUEUE_SIZE]
+//   - наибольшее кол-во метрик в пакете (0 - без ограничения), не больше -max-batch сервера
+//     [500] [-batch-size] [BATCH_SIZE]
+//   - идентификатор агента для лимитов сервера (сервер учитывает его в подписанных запросах)
+//     [имя хоста] [-id] [AGENT_ID]
+//   - кол-во повторов отправки при ошибке передачи (задержка растет от 1с до 30с)
+//     [3] [-retries] [RETRIES]
+//   - кол-во ответов 5xx на первый пакет очереди, после которых он удаляется (0 - без ограничения)
+//     [10] [-queue-retries] [QUEUE_RETRIES]
 package main
 
 import (
@@ -57,6 +79,17 @@ func main() {
 		configPath     = ""
 		key            = ""
 		cryptoKeyPath  = ""
+		processes      = ""
+		statsdAddr     = ""
+		statsdSocket   = ""
+		pushAddr       = ""
+		scrapeTargets  = ""
+		queueDir       = ""
+		queueSize      = config.QueueSizeDefault
+		retries        = config.RetriesDefault
+		queueRetries   = config.QueueRetriesDefault
+		batchSize      = config.BatchSizeDefault
+		agentID        = ""
 	)
 
 	parser.File(&configPath,
@@ -107,6 +140,72 @@ func main() {
 		env.String("LVL"),
 	)
 
+	parser.Value(&processes,
+		field.String("processes"),
+		flag.String("proc", "наблюдаемые процессы"),
+		env.String("PROCESSES"),
+	)
+
+	parser.Value(&statsdAddr,
+		field.String("statsd_addr"),
+		flag.String("statsd", "UDP адрес приема метрик StatsD"),
+		env.String("STATSD_ADDR"),
+	)
+
+	parser.Value(&statsdSocket,
+		field.String("statsd_socket"),
+		flag.String("statsd-socket", "путь до unix сокета приема метрик StatsD"),
+		env.String("STATSD_SOCKET"),
+	)
+
+	parser.Value(&pushAddr,
+		field.String("push_addr"),
+		flag.String("push", "адрес локального приема метрик приложений"),
+		env.String("PUSH_ADDR"),
+	)
+
+	parser.Value(&scrapeTargets,
+		field.String("scrape_targets"),
+		flag.String("scrape", "цели опроса метрик Prometheus"),
+		env.String("SCRAPE_TARGETS"),
+	)
+
+	parser.Value(&queueDir,
+		field.String("queue_dir"),
+		flag.String("queue-dir", "каталог очереди неотправленных пакетов"),
+		env.String("QUEUE_DIR"),
+	)
+
+	parser.Value(&queueSize,
+		field.Int("queue_size"),
+		flag.Int("queue-size", "наибольшее кол-во пакетов в очереди"),
+		env.Int("QUEUE_SIZE"),
+	)
+
+	parser.Value(&batchSize,
+		field.Int("batch_size"),
+		flag.Int("batch-size", "наибольшее кол-во метрик в пакете"),
+		env.Int("BATCH_SIZE"),
+	)
+
+	parser.Value(&agentID,
+		field.String("agent_id"),
+		flag.String("id", "идентификатор агента"),
+		env.String("AGENT_ID"),
+	)
+
+	parser.Value(&retries,
+		field.Int("retries"),
+		flag.Int("retries", "кол-во повторов отправки"),
+		env.Int("RETRIES"),
+	)
+
+	parser.Value(&queueRetries,
+		field.Int("queue_retries"),
+		flag.Int("queue-retries", "кол-во ответов 5xx на первый пакет очереди"),
+		env.Int("QUEUE_RETRIES"),
+	)
+
 	if err := parser.Parse(os.Args[1:]); err != nil {
 		log.Printf("err:%v\n", err)
 
@@ -122,6 +221,17 @@ func main() {
 		config.SetConfigPath(configPath),
 		config.SetCryptoKeyPath(cryptoKeyPath),
 		config.SetLogLevel(logLevel),
+		config.SetProcesses(processes),
+		config.SetStatsDAddr(statsdAddr),
+		config.SetStatsDSocket(statsdSocket),
+		config.SetPushAddr(pushAddr),
+		config.SetScrape(scrapeTargets),
+		config.SetQueueDir(queueDir),
+		config.SetQueueSize(queueSize),
+		config.SetBatchSize(batchSize),
+		config.SetAgentID(agentID),
+		config.SetRetries(retries),
+		config.SetQueueRetries(queueRetries),
 	)
 	if err != nil {
 		log.Printf("new config: %v\n", err)
@@ -0,0 +1,161 @@
+// Переносит все метрики из одного хранилища в другое и проверяет результат.
+// Хранилища задаются строками подключения сервера [mem://|file:///path|bolt:///path|postgres://...|redis://host:port/db].
+// Перенос идемпотентен, его можно повторять до и после переключения сервера на новое хранилище.
+// Параметры:
+//   - строка подключения хранилища-источника
+//     [""] [-from] [MIGRATE_FROM]
+//   - строка подключения хранилища-приемника
+//     [""] [-to] [MIGRATE_TO]
+//   - кол-во метрик в одной пачке записи в приемник
+//     [1000] [-batch] [MIGRATE_BATCH]
+//   - только рассчитать перенос: приемник открывается только для чтения,
+//     несуществующий приемник считается пустым
+//     [false] [-dry-run] [MIGRATE_DRY_RUN]
+//   - уровень логирования
+//     ["info"] [-lvl] [LVL]
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	_ "github.com/AndreyVLZ/metrics/internal/store" // встроенные драйверы хранилищ
+	"github.com/AndreyVLZ/metrics/internal/store/migrate"
+	mylog "github.com/AndreyVLZ/metrics/pkg/log"
+	"github.com/AndreyVLZ/metrics/pkg/parser"
+	"github.com/AndreyVLZ/metrics/pkg/parser/env"
+	"github.com/AndreyVLZ/metrics/pkg/parser/flag"
+	"github.com/AndreyVLZ/metrics/server/config"
+	"github.com/AndreyVLZ/metrics/server/driver"
+)
+
+var errURLEmpty = errors.New("storage url is empty")
+
+func main() {
+	var (
+		from      = ""
+		to        = ""
+		batchSize = migrate.BatchSizeDefault
+		dryRun    = false
+		logLevel  = mylog.LevelInfo
+	)
+
+	parser.Value(&from,
+		flag.String("from", "строка подключения хранилища-источника"),
+		env.String("MIGRATE_FROM"),
+	)
+
+	parser.Value(&to,
+		flag.String("to", "строка подключения хранилища-приемника"),
+		env.String("MIGRATE_TO"),
+	)
+
+	parser.Value(&batchSize,
+		flag.Int("batch", "кол-во метрик в одной пачке записи в приемник"),
+		env.Int("MIGRATE_BATCH"),
+	)
+
+	parser.Value(&dryRun,
+		flag.Bool("dry-run", "только рассчитать перенос, без записи в приемник"),
+		env.Bool("MIGRATE_DRY_RUN"),
+	)
+
+	parser.Value(&logLevel,
+		flag.String("lvl", "уровень логирования"),
+		env.String("LVL"),
+	)
+
+	if err := parser.Parse(os.Args[1:]); err != nil {
+		log.Printf("err:%v\n", err)
+
+		return
+	}
+
+	logger := mylog.New(mylog.SlogKey, logLevel)
+
+	report, err := run(context.Background(), from, to, migrate.Config{BatchSize: batchSize, DryRun: dryRun})
+	if err != nil {
+		logger.Error("migrate", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("migrate",
+		slog.Bool("dryRun", dryRun),
+		slog.Group("report",
+			slog.Int("total", report.Total),
+			slog.Int("created", report.Created),
+			slog.Int("updated", report.Updated),
+			slog.Int("unchanged", report.Unchanged),
+		),
+	)
+}
+
+// storageConfig параметры хранилищ, не задаваемые строкой подключения.
+// Файловое хранилище загружает сохраненные значения и пишет синхронно.
+// Источник открывается только для чтения: файлы источника,
+// возможно используемые сервером, не изменяются.
+func storageConfig(readOnly bool) config.StorageConfig {
+	cfg := config.Default().StorageConfig
+	cfg.IsRestore = true
+	cfg.StoreInt = 0
+	cfg.ReadOnly = readOnly
+
+	return cfg
+}
+
+// run открывает хранилища from и to и переносит метрики.
+// При cfg.DryRun приемник открывается только для чтения.
+func run(ctx context.Context, from, to string, cfg migrate.Config) (report migrate.Report, err error) {
+	if from == "" || to == "" {
+		return migrate.Report{}, errURLEmpty
+	}
+
+	src, err := start(ctx, from, true)
+	if err != nil {
+		return migrate.Report{}, fmt.Errorf("src: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, src.Stop(ctx))
+	}()
+
+	dst, err := startDst(ctx, to, cfg.DryRun)
+	if err != nil {
+		return migrate.Report{}, fmt.Errorf("dst: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, dst.Stop(ctx))
+	}()
+
+	return migrate.Run(ctx, cfg, src, dst)
+}
+
+// startDst открывает приемник. При dryRun приемник открывается только
+// для чтения, а несуществующий файл приемника считается пустым хранилищем:
+// файл создается только переносом.
+func startDst(ctx context.Context, dsn string, dryRun bool) (driver.Storage, error) {
+	storage, err := start(ctx, dsn, dryRun)
+	if dryRun && errors.Is(err, os.ErrNotExist) {
+		return start(ctx, "mem://", true)
+	}
+
+	return storage, err
+}
+
+func start(ctx context.Context, dsn string, readOnly bool) (driver.Storage, error) {
+	storage, err := driver.Open(dsn, storageConfig(readOnly))
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	if err := storage.Start(ctx); err != nil {
+		return nil, fmt.Errorf("start [%s]: %w", storage.Name(), err)
+	}
+
+	return storage, nil
+}
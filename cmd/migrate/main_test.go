@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/migrate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	from := "file://" + filepath.Join(dir, "metrics.json")
+	to := "bolt://" + filepath.Join(dir, "metrics.db")
+
+	src, err := start(ctx, from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mets := []model.Metric{
+		model.NewCounterMetric("PollCount", 5),
+		model.NewGaugeMetric("Alloc", 1.5),
+	}
+
+	if err := src.AddBatch(ctx, mets); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	srcFiles := readFiles(t, dir, "metrics.json")
+
+	// приемник не создается
+	report, err := run(ctx, from, to, migrate.Config{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, migrate.Report{Total: 2, Created: 2}, report)
+
+	_, err = os.Stat(filepath.Join(dir, "metrics.db"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	report, err = run(ctx, from, to, migrate.Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, migrate.Report{Total: 2, Created: 2}, report)
+
+	report, err = run(ctx, from, to, migrate.Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, migrate.Report{Total: 2, Unchanged: 2}, report)
+
+	// перенос рассчитывается по существующему приемнику
+	report, err = run(ctx, from, to, migrate.Config{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, migrate.Report{Total: 2, Unchanged: 2}, report)
+
+	dst, err := start(ctx, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Stop(ctx)
+
+	list, err := dst.List(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, mets, list)
+
+	// файлы источника не изменились
+	assert.Equal(t, srcFiles, readFiles(t, dir, "metrics.json"))
+}
+
+// readFiles возвращает содержимое файлов каталога dir с префиксом prefix.
+func readFiles(t *testing.T, dir, prefix string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string)
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[entry.Name()] = string(data)
+	}
+
+	return files
+}
+
+func TestRunErr(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := run(ctx, "", "mem://", migrate.Config{})
+	assert.ErrorIs(t, err, errURLEmpty)
+
+	_, err = run(ctx, "mem://", "unknown://", migrate.Config{})
+	assert.Error(t, err)
+}
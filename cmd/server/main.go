@@ -2,6 +2,12 @@
 // Параметры Сервера (задаются через [configPath] и/или [falg] и/или [env]):
 //   - адрес эндпоинта HTTP-сервера
 //     ["localhost:8080"] [-a] [ADDRESS]
+//   - путь до файла встраиваемой базы bbolt
+//     [""] [-b] [BOLT_PATH]
+//   - режим кэша в памяти перед хранилищем [through|behind]
+//     [""] [-cache] [CACHE_MODE]
+//   - интервал времени в секундах, по истечении которого изменения кэша записываются в хранилище (режим behind)
+//     [1] [-cache-flush] [CACHE_FLUSH_INTERVAL]
 //   - путь до файла конфигурации
 //     [""] [-c] [CONFIG]
 //   - путь до файла с приватным ключом
@@ -12,7 +18,32 @@
 //     [""] [-f] [FILE_STORAGE_PATH]
 //   - интервал времени в секундах, по истечении которого текущие показания сервера сохраняются на диск
 //     [300] [-i] [STORE_INTERVAL]
-//   - ключ
+//   - политика сброса журнала файлового хранилища на диск [always|interval|none]
+//     ["always"] [-fsync] [FILE_SYNC]
+//   - размер журнала файлового хранилища в байтах, после которого он сжимается в снимок
+//     [4194304] [-compact-size] [FILE_COMPACT_SIZE]
+//   - кол-во хранимых предыдущих поколений снимка файлового хранилища
+//     [3] [-snap-keep] [FILE_SNAPSHOT_KEEP]
+//   - строка подключения хранилища [mem://|file:///path|bolt:///path|postgres://...|redis://host:port/db],
+//     если задана, параметры -b, -d и -f для выбора хранилища не используются
+//     [""] [-s] [STORAGE]
+//   - выбор лидера среди реплик: фоновые задачи хранилища выполняются только на лидере
+//     [false] [-lease] [LEASE]
+//   - интервал времени в секундах для захвата и проверки аренды лидера
+//     [5] [-lease-int] [LEASE_INTERVAL]
+//   - политика обработки значений gauge, время снятия ts которых меньше сохраненного [accept|ignore|reject]
+//     ["accept"] [-stale] [STALE_POLICY]
+//   - время в секундах хранения ключей идемпотентности пакетов метрик
+//     [600] [-dedup-window] [DEDUP_WINDOW]
+//   - наибольшее кол-во метрик в хранилище, 0 - без ограничения
+//     [0] [-max-series] [MAX_SERIES]
+//   - наибольшее кол-во метрик, созданных одним агентом (заголовок X-Agent-ID подписанного -k запроса или адрес), 0 - без ограничения
+//     [0] [-max-agent-series] [MAX_AGENT_SERIES]
+//   - наибольшее кол-во метрик в одном пакете, 0 - без ограничения
+//     [0] [-max-batch] [MAX_BATCH]
+//   - ключ подписи; с ключом запросы /admin принимаются только с подписью
+//     метода, пути и времени запроса (заголовок HashTime), расходящегося
+//     с временем сервера не больше чем на 5 минут
 //     [""] [-k] [KEY]
 //   - уровень логирования
 //     ["err"] [-lvl] [LVL]
@@ -22,6 +53,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	_ "net/http/pprof"
@@ -57,9 +89,23 @@ func main() {
 		storeInterval = config.StoreIntervalDefault
 		storePath     = config.StorePathDefault
 		isRestore     = config.IsRestoreDefault
+		fileSync      = config.FileSyncDefault
+		compactSize   = config.CompactSizeDefault
+		snapshotKeep  = config.SnapshotKeepDefault
 		logLevel      = mylog.LevelErr
 		cryptoKeyPath = ""
+		storageURL    = ""
+		cacheMode     = ""
+		leaseOn       = false
+		leaseInt      = config.LeaseIntervalDefault
+		stalePolicy   = config.StalePolicyDefault
+		dedupWindow   = config.DedupWindowDefault
+		maxSeries     = 0
+		maxAgent      = 0
+		maxBatch      = 0
+		cacheFlushInt = config.CacheFlushIntDefault
 		connDB        = ""
+		boltPath      = ""
 		configPath    = ""
 		key           = ""
 	)
@@ -89,12 +135,102 @@ func main() {
 		env.String("FILE_STORAGE_PATH"),
 	)
 
+	parser.Value(&fileSync,
+		field.String("file_sync"),
+		flag.String("fsync", "политика сброса журнала файлового хранилища на диск [always|interval|none]"),
+		env.String("FILE_SYNC"),
+	)
+
+	parser.Value(&compactSize,
+		field.Int("compact_size"),
+		flag.Int("compact-size", "размер журнала файлового хранилища в байтах, после которого он сжимается в снимок"),
+		env.Int("FILE_COMPACT_SIZE"),
+	)
+
+	parser.Value(&snapshotKeep,
+		field.Int("snapshot_keep"),
+		flag.Int("snap-keep", "кол-во хранимых предыдущих поколений снимка файлового хранилища"),
+		env.Int("FILE_SNAPSHOT_KEEP"),
+	)
+
+	parser.Value(&storageURL,
+		field.String("storage"),
+		flag.String("s", "строка подключения хранилища [mem://|file:///path|bolt:///path|postgres://...|redis://host:port/db]"),
+		env.String("STORAGE"),
+	)
+
+	parser.Value(&cacheMode,
+		field.String("cache_mode"),
+		flag.String("cache", "режим кэша в памяти перед хранилищем [through|behind]"),
+		env.String("CACHE_MODE"),
+	)
+
+	parser.Value(&cacheFlushInt,
+		field.Duration("cache_flush_interval"),
+		convert.IntToDuration(time.Second,
+			flag.Int("cache-flush", "интервал времени в секундах, по истечении которого изменения кэша записываются в хранилище"),
+			env.Int("CACHE_FLUSH_INTERVAL"),
+		),
+	)
+
+	parser.Value(&leaseOn,
+		field.Bool("lease"),
+		flag.Bool("lease", "выбор лидера среди реплик: фоновые задачи хранилища выполняются только на лидере"),
+		env.Bool("LEASE"),
+	)
+
+	parser.Value(&leaseInt,
+		field.Duration("lease_interval"),
+		convert.IntToDuration(time.Second,
+			flag.Int("lease-int", "интервал времени в секундах для захвата и проверки аренды лидера"),
+			env.Int("LEASE_INTERVAL"),
+		),
+	)
+
+	parser.Value(&stalePolicy,
+		field.String("stale_policy"),
+		flag.String("stale", "политика обработки значений gauge, время снятия ts которых меньше сохраненного [accept|ignore|reject]"),
+		env.String("STALE_POLICY"),
+	)
+
+	parser.Value(&dedupWindow,
+		field.Duration("dedup_window"),
+		convert.IntToDuration(time.Second,
+			flag.Int("dedup-window", "время в секундах хранения ключей идемпотентности пакетов метрик"),
+			env.Int("DEDUP_WINDOW"),
+		),
+	)
+
+	parser.Value(&maxSeries,
+		field.Int("max_series"),
+		flag.Int("max-series", "наибольшее кол-во метрик в хранилище, 0 - без ограничения"),
+		env.Int("MAX_SERIES"),
+	)
+
+	parser.Value(&maxAgent,
+		field.Int("max_agent_series"),
+		flag.Int("max-agent-series", "наибольшее кол-во метрик, созданных одним агентом, 0 - без ограничения"),
+		env.Int("MAX_AGENT_SERIES"),
+	)
+
+	parser.Value(&maxBatch,
+		field.Int("max_batch"),
+		flag.Int("max-batch", "наибольшее кол-во метрик в одном пакете, 0 - без ограничения"),
+		env.Int("MAX_BATCH"),
+	)
+
 	parser.Value(&connDB,
 		field.String("database_dsn"),
 		flag.String("d", "строка с адресом подключения к БД"),
 		env.String("DATABASE_DSN"),
 	)
 
+	parser.Value(&boltPath,
+		field.String("bolt_path"),
+		flag.String("b", "путь до файла встраиваемой базы bbolt"),
+		env.String("BOLT_PATH"),
+	)
+
 	parser.Value(&isRestore,
 		field.Bool("restore"),
 		flag.Bool("r", "определяющее, загружать или нет ранее сохранённые значения из указанного файла при старте сервера"),
@@ -128,8 +264,22 @@ func main() {
 		config.SetStoreInt(storeInterval),
 		config.SetStorePath(storePath),
 		config.SetRestore(isRestore),
+		config.SetFileSync(fileSync),
+		config.SetCompactSize(compactSize),
+		config.SetSnapshotKeep(snapshotKeep),
 		config.SetCryptoKeyPath(cryptoKeyPath),
+		config.SetStorageURL(storageURL),
+		config.SetCacheMode(cacheMode),
+		config.SetCacheFlushInt(cacheFlushInt),
+		config.SetLease(leaseOn),
+		config.SetLeaseInt(leaseInt),
+		config.SetStalePolicy(stalePolicy),
+		config.SetDedupWindow(dedupWindow),
+		config.SetMaxSeries(maxSeries),
+		config.SetMaxAgentSeries(maxAgent),
+		config.SetMaxBatch(maxBatch),
 		config.SetDatabaseDNS(connDB),
+		config.SetBoltPath(boltPath),
 		config.SetConfigPath(configPath),
 		config.SetKey(key),
 		config.SetLogLevel(logLevel),
@@ -151,7 +301,10 @@ func main() {
 func runServer(cfg *config.Config, mlog *slog.Logger) error {
 	ctx := context.Background()
 
-	server := server.New(cfg, mlog)
+	server, err := server.New(cfg, mlog)
+	if err != nil {
+		return fmt.Errorf("new server: %w", err)
+	}
 
 	shutdown := shutdown.New(
 		adapter.NewShutdown(&server),
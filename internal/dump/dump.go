@@ -0,0 +1,345 @@
+// Потоковая выгрузка и загрузка метрик в версионированных форматах.
+//
+// JSON lines: первая строка - заголовок {"format":"metrics","version":2},
+// далее по одной метрике на строку в виде model.MetricJSON:
+//
+//	{"format":"metrics","version":2}
+//	{"delta":5,"id":"PollCount","type":"counter"}
+//	{"value":1.5,"created":"2024-01-02T03:04:05Z","updated":"2024-01-02T03:04:05Z","id":"Alloc","type":"gauge","unit":"bytes"}
+//
+// CSV: первая запись - заголовок 'metrics,2', вторая - имена колонок,
+// далее по одной метрике на запись. Пустое время - пустое поле:
+//
+//	metrics,2
+//	id,type,value,unit,help,source,created,updated,ts
+//	PollCount,counter,5,,,,,,
+//	Alloc,gauge,1.5,bytes,,,2024-01-02T03:04:05Z,2024-01-02T03:04:05Z,2024-01-02T03:04:04Z
+//
+// Версия 1 отличается только отсутствием сведений о метрике
+// (в CSV - колонки id,type,value) и читается декодером.
+package dump
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	VersionConst         = 2         // Текущая версия формата.
+	formatNameConst      = "metrics" // Имя формата в заголовке.
+	csvHeaderFieldsConst = 2         // Кол-во полей заголовка CSV.
+)
+
+// Format формат выгрузки.
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+)
+
+var (
+	ErrFormatNotSupport  = errors.New("format not support")
+	ErrDecode            = errors.New("decode") // Ошибка разбора входных данных.
+	errVersionNotSupport = errors.New("version not support")
+	errHeaderNotValid    = errors.New("header not valid")
+	errMetricNotValid    = errors.New("metric not valid")
+)
+
+// csvColumns имена колонок CSV. Версия 1 содержит только первые три колонки.
+var csvColumns = []string{"id", "type", "value", "unit", "help", "source", "created", "updated", "ts"}
+
+// csvColumnsV1 кол-во колонок CSV версии 1.
+const csvColumnsV1 = 3
+
+// ParseFormat возвращает формат из строки. Пустая строка - FormatJSONL.
+func ParseFormat(str string) (Format, error) {
+	switch format := Format(str); format {
+	case "":
+		return FormatJSONL, nil
+	case FormatJSONL, FormatCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: [%s]", ErrFormatNotSupport, str)
+	}
+}
+
+// ContentType возвращает Content-Type для формата.
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+}
+
+// header заголовок JSON lines.
+type header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// Encoder записывает метрики в поток.
+type Encoder interface {
+	Encode(met model.Metric) error
+	// Flush записывает буферизованные данные.
+	Flush() error
+}
+
+// NewEncoder записывает заголовок формата format в w и возвращает Encoder.
+func NewEncoder(w io.Writer, format Format) (Encoder, error) {
+	switch format {
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(header{Format: formatNameConst, Version: VersionConst}); err != nil {
+			return nil, fmt.Errorf("write header: %w", err)
+		}
+
+		return jsonEncoder{enc: enc}, nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+
+		if err := writer.Write([]string{formatNameConst, strconv.Itoa(VersionConst)}); err != nil {
+			return nil, fmt.Errorf("write header: %w", err)
+		}
+
+		if err := writer.Write(csvColumns); err != nil {
+			return nil, fmt.Errorf("write header: %w", err)
+		}
+
+		return csvEncoder{w: writer}, nil
+	default:
+		return nil, fmt.Errorf("%w: [%s]", ErrFormatNotSupport, format)
+	}
+}
+
+// Decoder читает метрики из потока. Decode возвращает io.EOF в конце потока.
+type Decoder interface {
+	Decode() (model.Metric, error)
+}
+
+// NewDecoder читает и проверяет заголовок формата format из r и возвращает Decoder.
+// Ошибки разбора данных оборачивают ErrDecode.
+func NewDecoder(r io.Reader, format Format) (Decoder, error) {
+	switch format {
+	case FormatJSONL:
+		var head header
+
+		dec := json.NewDecoder(r)
+		if err := dec.Decode(&head); err != nil {
+			return nil, fmt.Errorf("%w: read header: %w", ErrDecode, err)
+		}
+
+		if head.Format != formatNameConst {
+			return nil, fmt.Errorf("%w: %w: [%s]", ErrDecode, errHeaderNotValid, head.Format)
+		}
+
+		if err := checkVersion(head.Version); err != nil {
+			return nil, err
+		}
+
+		return &jsonDecoder{dec: dec}, nil
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+
+		head, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("%w: read header: %w", ErrDecode, err)
+		}
+
+		if len(head) != csvHeaderFieldsConst || head[0] != formatNameConst {
+			return nil, fmt.Errorf("%w: %w: %v", ErrDecode, errHeaderNotValid, head)
+		}
+
+		version, err := strconv.Atoi(head[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w: %w", ErrDecode, errHeaderNotValid, err)
+		}
+
+		if err := checkVersion(version); err != nil {
+			return nil, err
+		}
+
+		// имена колонок
+		if _, err := reader.Read(); err != nil {
+			return nil, fmt.Errorf("%w: read columns: %w", ErrDecode, err)
+		}
+
+		reader.FieldsPerRecord = len(csvColumns)
+		if version == 1 {
+			reader.FieldsPerRecord = csvColumnsV1
+		}
+
+		return &csvDecoder{r: reader}, nil
+	default:
+		return nil, fmt.Errorf("%w: [%s]", ErrFormatNotSupport, format)
+	}
+}
+
+func checkVersion(version int) error {
+	if version < 1 || version > VersionConst {
+		return fmt.Errorf("%w: %w: [%d]", ErrDecode, errVersionNotSupport, version)
+	}
+
+	return nil
+}
+
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (je jsonEncoder) Encode(met model.Metric) error {
+	return je.enc.Encode(model.BuildMetricJSON(met))
+}
+
+func (je jsonEncoder) Flush() error { return nil }
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (ce csvEncoder) Encode(met model.Metric) error {
+	return ce.w.Write([]string{
+		met.MName,
+		met.MType.String(),
+		model.BuildMetricJSON(met).String(),
+		met.Unit,
+		met.Help,
+		met.Source,
+		formatTime(met.Created),
+		formatTime(met.Updated),
+		formatTime(met.TS),
+	})
+}
+
+func (ce csvEncoder) Flush() error {
+	ce.w.Flush()
+
+	return ce.w.Error()
+}
+
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+func (jd *jsonDecoder) Decode() (model.Metric, error) {
+	var metJSON model.MetricJSON
+
+	if err := jd.dec.Decode(&metJSON); err != nil {
+		if errors.Is(err, io.EOF) {
+			return model.Metric{}, io.EOF
+		}
+
+		return model.Metric{}, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	info, err := model.ParseInfo(metJSON.ID, metJSON.MType)
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	met := model.NewMetric(info, model.Value{Delta: metJSON.Delta, Val: metJSON.Value})
+	if (info.MType == model.TypeCountConst && met.Delta == nil) ||
+		(info.MType == model.TypeGaugeConst && met.Val == nil) {
+		return model.Metric{}, fmt.Errorf("%w: %w: [%s]", ErrDecode, errMetricNotValid, info.MName)
+	}
+
+	if info.MType == model.TypeCountConst {
+		met.Val = nil
+	} else {
+		met.Delta = nil
+	}
+
+	met.Meta = metJSON.Meta()
+
+	return met, nil
+}
+
+type csvDecoder struct {
+	r *csv.Reader
+}
+
+func (cd *csvDecoder) Decode() (model.Metric, error) {
+	record, err := cd.r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return model.Metric{}, io.EOF
+		}
+
+		return model.Metric{}, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	info, err := model.ParseInfo(record[0], record[1])
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	met, err := parseCSVValue(info, record[2])
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w: %w: %w", ErrDecode, errMetricNotValid, err)
+	}
+
+	if len(record) == csvColumnsV1 {
+		return met, nil
+	}
+
+	met.Unit, met.Help, met.Source = record[3], record[4], record[5]
+
+	if met.Created, err = parseTime(record[6]); err != nil {
+		return model.Metric{}, fmt.Errorf("%w: %w: created: %w", ErrDecode, errMetricNotValid, err)
+	}
+
+	if met.Updated, err = parseTime(record[7]); err != nil {
+		return model.Metric{}, fmt.Errorf("%w: %w: updated: %w", ErrDecode, errMetricNotValid, err)
+	}
+
+	if met.TS, err = parseTime(record[8]); err != nil {
+		return model.Metric{}, fmt.Errorf("%w: %w: ts: %w", ErrDecode, errMetricNotValid, err)
+	}
+
+	return met, nil
+}
+
+func parseCSVValue(info model.Info, str string) (model.Metric, error) {
+	if info.MType == model.TypeCountConst {
+		delta, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return model.Metric{}, fmt.Errorf("%w", err)
+		}
+
+		return model.NewCounterMetric(info.MName, delta), nil
+	}
+
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w", err)
+	}
+
+	return model.NewGaugeMetric(info.MName, val), nil
+}
+
+// formatTime возвращает пустую строку для нулевого времени.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime возвращает нулевое время для пустой строки.
+func parseTime(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, str)
+}
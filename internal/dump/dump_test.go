@@ -0,0 +1,163 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeAll(t *testing.T, r io.Reader, format Format) ([]model.Metric, error) {
+	t.Helper()
+
+	dec, err := NewDecoder(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	arr := make([]model.Metric, 0)
+
+	for {
+		met, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			return arr, nil
+		}
+
+		if err != nil {
+			return arr, err
+		}
+
+		arr = append(arr, met)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	alloc := model.NewGaugeMetric("Alloc", 0.1+0.2)
+	alloc.Meta = model.Meta{
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Updated: time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+		TS:      time.Date(2024, 1, 2, 3, 4, 4, 0, time.UTC),
+		Unit:    "bytes",
+		Help:    "heap, \"allocated\" bytes",
+		Source:  "agent-1",
+	}
+
+	arr := []model.Metric{
+		model.NewCounterMetric("PollCount", 5),
+		alloc,
+		model.NewGaugeMetric("name,with \"quotes\"", -1e-300),
+	}
+
+	for _, format := range []Format{FormatJSONL, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			enc, err := NewEncoder(&buf, format)
+			if err != nil {
+				t.Fatalf("new encoder: %v\n", err)
+			}
+
+			for i := range arr {
+				if err := enc.Encode(arr[i]); err != nil {
+					t.Fatalf("encode: %v\n", err)
+				}
+			}
+
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush: %v\n", err)
+			}
+
+			list, err := decodeAll(t, &buf, format)
+			if assert.NoError(t, err) {
+				assert.Equal(t, arr, list)
+			}
+		})
+	}
+}
+
+func TestDecodeVersion1(t *testing.T) {
+	want := []model.Metric{
+		model.NewCounterMetric("PollCount", 5),
+		model.NewGaugeMetric("Alloc", 1.5),
+	}
+
+	tc := map[Format]string{
+		FormatJSONL: "{\"format\":\"metrics\",\"version\":1}\n{\"delta\":5,\"id\":\"PollCount\",\"type\":\"counter\"}\n{\"value\":1.5,\"id\":\"Alloc\",\"type\":\"gauge\"}\n",
+		FormatCSV:   "metrics,1\nid,type,value\nPollCount,counter,5\nAlloc,gauge,1.5\n",
+	}
+
+	for format, data := range tc {
+		t.Run(string(format), func(t *testing.T) {
+			list, err := decodeAll(t, strings.NewReader(data), format)
+			if assert.NoError(t, err) {
+				assert.Equal(t, want, list)
+			}
+		})
+	}
+}
+
+func TestDecodeErr(t *testing.T) {
+	type testCase struct {
+		name   string
+		format Format
+		data   string
+		err    error
+	}
+
+	tc := []testCase{
+		{name: "jsonl empty", format: FormatJSONL, data: "", err: ErrDecode},
+		{name: "jsonl header", format: FormatJSONL, data: `{"format":"other","version":1}`, err: errHeaderNotValid},
+		{name: "jsonl version", format: FormatJSONL, data: `{"format":"metrics","version":3}`, err: errVersionNotSupport},
+		{
+			name:   "jsonl type",
+			format: FormatJSONL,
+			data:   "{\"format\":\"metrics\",\"version\":1}\n{\"id\":\"A\",\"type\":\"hist\",\"value\":1}",
+			err:    model.ErrTypeNotSupport,
+		},
+		{
+			name:   "jsonl no value",
+			format: FormatJSONL,
+			data:   "{\"format\":\"metrics\",\"version\":1}\n{\"id\":\"A\",\"type\":\"gauge\",\"delta\":1}",
+			err:    errMetricNotValid,
+		},
+		{name: "csv header", format: FormatCSV, data: "id,type,value\n", err: errHeaderNotValid},
+		{name: "csv version", format: FormatCSV, data: "metrics,x\n", err: errHeaderNotValid},
+		{name: "csv fields", format: FormatCSV, data: "metrics,1\nid,type,value\nA,counter\n", err: ErrDecode},
+		{name: "csv value", format: FormatCSV, data: "metrics,1\nid,type,value\nA,counter,1.5\n", err: errMetricNotValid},
+		{
+			name:   "csv time",
+			format: FormatCSV,
+			data:   "metrics,2\nid,type,value,unit,help,source,created,updated,ts\nA,counter,1,,,,yesterday,,\n",
+			err:    errMetricNotValid,
+		},
+		{name: "format", format: "xml", data: "", err: ErrFormatNotSupport},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeAll(t, strings.NewReader(test.data), test.format)
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatJSONL, format)
+	}
+
+	format, err = ParseFormat("csv")
+	if assert.NoError(t, err) {
+		assert.Equal(t, FormatCSV, format)
+		assert.Equal(t, "text/csv", format.ContentType())
+	}
+
+	_, err = ParseFormat("xml")
+	assert.ErrorIs(t, err, ErrFormatNotSupport)
+}
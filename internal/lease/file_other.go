@@ -0,0 +1,18 @@
+//go:build !unix
+
+package lease
+
+import (
+	"context"
+	"errors"
+)
+
+// File аренда на блокировке файла. На этой платформе не поддерживается.
+type File struct{}
+
+func NewFile(_ string) *File { return &File{} }
+
+func (f *File) TryLock(_ context.Context) (bool, error) { return false, errors.ErrUnsupported }
+func (f *File) Check(_ context.Context) error           { return errors.ErrUnsupported }
+func (f *File) Unlock(_ context.Context) error          { return nil }
+func (f *File) Close() error                            { return nil }
@@ -0,0 +1,83 @@
+//go:build unix
+
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// File аренда на блокировке файла (flock).
+// Блокировку освобождает ОС при завершении процесса.
+type File struct {
+	file *os.File
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) TryLock(_ context.Context) (bool, error) {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return false, fmt.Errorf("open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		errClose := file.Close()
+
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, errClose
+		}
+
+		return false, errors.Join(fmt.Errorf("flock: %w", err), errClose)
+	}
+
+	f.file = file
+
+	return true, nil
+}
+
+// Check проверяет, что файл блокировки не удален и не подменен:
+// блокировка удаленного файла не мешает другой реплике создать новый.
+// При потере аренды блокировка снимается и файл закрывается.
+func (f *File) Check(_ context.Context) error {
+	if f.file == nil {
+		return ErrLost
+	}
+
+	held, err := f.file.Stat()
+	if err != nil {
+		return errors.Join(ErrLost, err, f.release())
+	}
+
+	current, err := os.Stat(f.path)
+	if err != nil || !os.SameFile(held, current) {
+		return errors.Join(ErrLost, err, f.release())
+	}
+
+	return nil
+}
+
+func (f *File) Unlock(_ context.Context) error {
+	if f.file == nil {
+		return nil
+	}
+
+	return f.release()
+}
+
+// release снимает блокировку и закрывает файл.
+func (f *File) release() error {
+	err := syscall.Flock(int(f.file.Fd()), syscall.LOCK_UN)
+	errClose := f.file.Close()
+	f.file = nil
+
+	return errors.Join(err, errClose)
+}
+
+func (f *File) Close() error { return nil }
@@ -0,0 +1,63 @@
+//go:build unix
+
+package lease
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.lock")
+
+	first := NewFile(path)
+	second := NewFile(path)
+
+	ok, err := first.TryLock(ctx)
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+	}
+
+	assert.NoError(t, first.Check(ctx))
+
+	t.Run("locked by other", func(t *testing.T) {
+		ok, err := second.TryLock(ctx)
+		if assert.NoError(t, err) {
+			assert.False(t, ok)
+		}
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		assert.NoError(t, first.Unlock(ctx))
+		assert.ErrorIs(t, first.Check(ctx), ErrLost)
+
+		ok, err := second.TryLock(ctx)
+		if assert.NoError(t, err) {
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("lock file removed", func(t *testing.T) {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.ErrorIs(t, second.Check(ctx), ErrLost)
+		assert.Nil(t, second.file)
+		assert.NoError(t, second.Unlock(ctx))
+
+		// аренда захватывается заново на новом файле
+		ok, err := second.TryLock(ctx)
+		if assert.NoError(t, err) {
+			assert.True(t, ok)
+		}
+
+		assert.NoError(t, second.Check(ctx))
+		assert.NoError(t, second.Unlock(ctx))
+	})
+}
@@ -0,0 +1,214 @@
+// Выбор лидера среди реплик сервера, работающих с общим хранилищем.
+// Лидером становится реплика, захватившая аренду (lease) через Locker:
+// advisory lock в postgres, блокировку файла для файлового хранилища
+// или локальную аренду для хранилищ одной реплики.
+// Elector запускает фоновые задачи, которые должны выполняться
+// в одном экземпляре, только пока реплика удерживает аренду.
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	NameConst       = "leader elector"
+	IntervalDefault = 5 * time.Second // Интервал попыток захвата и проверки аренды по умолчанию.
+)
+
+// ErrLost аренда потеряна.
+var ErrLost = errors.New("lease lost")
+
+// Locker захват аренды.
+type Locker interface {
+	// TryLock пытается захватить аренду без ожидания.
+	TryLock(ctx context.Context) (bool, error)
+	// Check проверяет, что захваченная аренда все еще удерживается.
+	Check(ctx context.Context) error
+	// Unlock освобождает захваченную аренду.
+	Unlock(ctx context.Context) error
+	// Close освобождает ресурсы.
+	Close() error
+}
+
+// Service фоновая задача, выполняемая только на лидере.
+// Задача должна допускать повторный запуск после остановки.
+type Service interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+type Config struct {
+	Interval time.Duration
+}
+
+// Elector захватывает аренду и, пока она удерживается,
+// выполняет задачи services.
+type Elector struct {
+	locker   Locker
+	log      *slog.Logger
+	services []Service
+	exit     chan struct{} // закрывается при завершении фонового цикла
+	stop     chan struct{} // закрывается при остановке
+	cfg      Config
+	isLeader bool
+	mu       sync.Mutex
+}
+
+func New(cfg Config, locker Locker, log *slog.Logger, services ...Service) *Elector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = IntervalDefault
+	}
+
+	return &Elector{
+		locker:   locker,
+		log:      log,
+		services: services,
+		exit:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		cfg:      cfg,
+	}
+}
+
+func (e *Elector) Name() string { return NameConst }
+
+// IsLeader возвращает true, если реплика удерживает аренду.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.isLeader
+}
+
+// Start выполняет первую попытку захвата аренды
+// и запускает фоновый цикл захвата и проверки.
+func (e *Elector) Start(ctx context.Context) error {
+	e.step(ctx)
+
+	go e.run(ctx)
+
+	return nil
+}
+
+// Stop останавливает задачи и освобождает аренду.
+func (e *Elector) Stop(ctx context.Context) error {
+	close(e.stop)
+	<-e.exit
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+
+	if e.isLeader {
+		errs = append(errs, e.stopServices(ctx))
+
+		if err := e.locker.Unlock(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unlock: %w", err))
+		}
+
+		e.isLeader = false
+	}
+
+	if err := e.locker.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close locker: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *Elector) run(ctx context.Context) {
+	defer close(e.exit)
+
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.step(ctx)
+		case <-ctx.Done():
+			return
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// step проверяет удерживаемую аренду либо пытается ее захватить.
+func (e *Elector) step(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.isLeader {
+		if err := e.locker.Check(ctx); err != nil {
+			e.log.WarnContext(ctx, "lease lost", slog.String("error", err.Error()))
+
+			if err := e.stopServices(ctx); err != nil {
+				e.log.ErrorContext(ctx, "stop services", slog.String("error", err.Error()))
+			}
+
+			e.isLeader = false
+		}
+
+		return
+	}
+
+	ok, err := e.locker.TryLock(ctx)
+	if err != nil {
+		e.log.ErrorContext(ctx, "try lock lease", slog.String("error", err.Error()))
+
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	if err := e.startServices(ctx); err != nil {
+		e.log.ErrorContext(ctx, "start services", slog.String("error", err.Error()))
+
+		if err := e.locker.Unlock(ctx); err != nil {
+			e.log.ErrorContext(ctx, "unlock lease", slog.String("error", err.Error()))
+		}
+
+		return
+	}
+
+	e.isLeader = true
+}
+
+// startServices запускает задачи. При ошибке запущенные задачи останавливаются.
+func (e *Elector) startServices(ctx context.Context) error {
+	for i := range e.services {
+		if err := e.services[i].Start(ctx); err != nil {
+			errStop := stopServices(ctx, e.services[:i])
+
+			return errors.Join(fmt.Errorf("service [%s]: %w", e.services[i].Name(), err), errStop)
+		}
+	}
+
+	return nil
+}
+
+func (e *Elector) stopServices(ctx context.Context) error {
+	return stopServices(ctx, e.services)
+}
+
+// stopServices останавливает задачи в обратном порядке.
+func stopServices(ctx context.Context, services []Service) error {
+	var errs []error
+
+	for i := len(services) - 1; i >= 0; i-- {
+		if err := services[i].Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("service [%s]: %w", services[i].Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,188 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLocker аренда, состоянием которой управляет тест.
+type fakeLocker struct {
+	errCheck error
+	mu       sync.Mutex
+	free     bool
+	locked   bool
+	unlocks  int
+	closed   bool
+}
+
+func (fl *fakeLocker) TryLock(_ context.Context) (bool, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	if !fl.free {
+		return false, nil
+	}
+
+	fl.locked = true
+
+	return true, nil
+}
+
+func (fl *fakeLocker) Check(_ context.Context) error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	return fl.errCheck
+}
+
+func (fl *fakeLocker) Unlock(_ context.Context) error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	fl.locked = false
+	fl.unlocks++
+
+	return nil
+}
+
+func (fl *fakeLocker) Close() error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	fl.closed = true
+
+	return nil
+}
+
+func (fl *fakeLocker) set(free bool, errCheck error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	fl.free = free
+	fl.errCheck = errCheck
+}
+
+// fakeService задача, считающая запуски и остановки.
+type fakeService struct {
+	errStart error
+	mu       sync.Mutex
+	running  bool
+	starts   int
+}
+
+func (fs *fakeService) Name() string { return "fake" }
+
+func (fs *fakeService) Start(_ context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.errStart != nil {
+		return fs.errStart
+	}
+
+	fs.running = true
+	fs.starts++
+
+	return nil
+}
+
+func (fs *fakeService) Stop(_ context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.running = false
+
+	return nil
+}
+
+func (fs *fakeService) isRunning() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.running
+}
+
+func TestElector(t *testing.T) {
+	ctx := context.Background()
+	locker := &fakeLocker{}
+	service := &fakeService{}
+
+	elector := New(Config{Interval: 10 * time.Millisecond}, locker, slog.Default(), service)
+	if err := elector.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	t.Run("follower", func(t *testing.T) {
+		time.Sleep(30 * time.Millisecond)
+		assert.False(t, elector.IsLeader())
+		assert.False(t, service.isRunning())
+	})
+
+	t.Run("elected", func(t *testing.T) {
+		locker.set(true, nil)
+
+		assert.Eventually(t, elector.IsLeader, time.Second, 5*time.Millisecond)
+		assert.True(t, service.isRunning())
+	})
+
+	t.Run("lost", func(t *testing.T) {
+		locker.set(false, ErrLost)
+
+		assert.Eventually(t, func() bool { return !elector.IsLeader() }, time.Second, 5*time.Millisecond)
+		assert.False(t, service.isRunning())
+	})
+
+	t.Run("reelected", func(t *testing.T) {
+		locker.set(true, nil)
+
+		assert.Eventually(t, elector.IsLeader, time.Second, 5*time.Millisecond)
+		assert.True(t, service.isRunning())
+		assert.Equal(t, 2, service.starts)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		assert.NoError(t, elector.Stop(ctx))
+		assert.False(t, service.isRunning())
+		assert.False(t, locker.locked)
+		assert.True(t, locker.closed)
+	})
+}
+
+func TestElectorStartServiceErr(t *testing.T) {
+	ctx := context.Background()
+	locker := &fakeLocker{free: true}
+	started := &fakeService{}
+	failed := &fakeService{errStart: errors.New("start err")}
+
+	elector := New(Config{Interval: time.Hour}, locker, slog.Default(), started, failed)
+	if err := elector.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	// аренда освобождается, запущенные задачи останавливаются
+	assert.False(t, elector.IsLeader())
+	assert.False(t, started.isRunning())
+	assert.False(t, locker.locked)
+
+	assert.NoError(t, elector.Stop(ctx))
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	service := &fakeService{}
+
+	elector := New(Config{}, Local{}, slog.Default(), service)
+	if err := elector.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	assert.True(t, elector.IsLeader())
+	assert.True(t, service.isRunning())
+	assert.NoError(t, elector.Stop(ctx))
+}
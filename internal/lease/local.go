@@ -0,0 +1,12 @@
+package lease
+
+import "context"
+
+// Local аренда для хранилищ, которые не разделяются между репликами:
+// реплика всегда является лидером.
+type Local struct{}
+
+func (Local) TryLock(_ context.Context) (bool, error) { return true, nil }
+func (Local) Check(_ context.Context) error           { return nil }
+func (Local) Unlock(_ context.Context) error          { return nil }
+func (Local) Close() error                            { return nil }
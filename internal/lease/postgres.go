@@ -0,0 +1,105 @@
+package lease
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// KeyDefault ключ advisory lock по умолчанию.
+const KeyDefault int64 = 0x6d657472696373 // "metrics"
+
+const (
+	tryLockSQL = "SELECT pg_try_advisory_lock($1)"
+	unlockSQL  = "SELECT pg_advisory_unlock($1)"
+)
+
+// Postgres аренда на сессионном advisory lock postgres.
+// Блокировка принадлежит сессии, поэтому для нее держится отдельное соединение.
+// При разрыве соединения postgres освобождает блокировку сам,
+// и Check возвращает ErrLost.
+type Postgres struct {
+	db   *sql.DB
+	conn *sql.Conn
+	dsn  string
+	key  int64
+}
+
+func NewPostgres(dsn string, key int64) *Postgres {
+	return &Postgres{dsn: dsn, key: key}
+}
+
+func (p *Postgres) TryLock(ctx context.Context) (bool, error) {
+	if p.db == nil {
+		database, err := sql.Open("postgres", p.dsn)
+		if err != nil {
+			return false, fmt.Errorf("openDB: %w", err)
+		}
+
+		p.db = database
+	}
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("conn: %w", err)
+	}
+
+	var ok bool
+
+	if err := conn.QueryRowContext(ctx, tryLockSQL, p.key).Scan(&ok); err != nil {
+		return false, errors.Join(fmt.Errorf("try lock: %w", err), conn.Close())
+	}
+
+	if !ok {
+		return false, conn.Close()
+	}
+
+	p.conn = conn
+
+	return true, nil
+}
+
+func (p *Postgres) Check(ctx context.Context) error {
+	if p.conn == nil {
+		return ErrLost
+	}
+
+	if err := p.conn.PingContext(ctx); err != nil {
+		// сессия завершена, блокировка освобождена postgres
+		errClose := p.conn.Close()
+		p.conn = nil
+
+		return errors.Join(ErrLost, err, errClose)
+	}
+
+	return nil
+}
+
+func (p *Postgres) Unlock(ctx context.Context) error {
+	if p.conn == nil {
+		return nil
+	}
+
+	var ok bool
+
+	err := p.conn.QueryRowContext(ctx, unlockSQL, p.key).Scan(&ok)
+	errClose := p.conn.Close()
+	p.conn = nil
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("unlock: %w", err), errClose)
+	}
+
+	return errClose
+}
+
+func (p *Postgres) Close() error {
+	if p.db == nil {
+		return nil
+	}
+
+	return p.db.Close()
+}
@@ -0,0 +1,47 @@
+package lease
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Тест запускается только при заданной переменной окружения
+// TEST_DATABASE_DSN со строкой подключения к тестовой базе.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	ctx := context.Background()
+
+	first := NewPostgres(dsn, KeyDefault)
+	defer first.Close()
+
+	second := NewPostgres(dsn, KeyDefault)
+	defer second.Close()
+
+	ok, err := first.TryLock(ctx)
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+	}
+
+	assert.NoError(t, first.Check(ctx))
+
+	ok, err = second.TryLock(ctx)
+	if assert.NoError(t, err) {
+		assert.False(t, ok)
+	}
+
+	assert.NoError(t, first.Unlock(ctx))
+
+	ok, err = second.TryLock(ctx)
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+	}
+
+	assert.NoError(t, second.Unlock(ctx))
+}
@@ -0,0 +1,87 @@
+package model
+
+import "time"
+
+// Meta необязательные сведения о метрике.
+// Теги json используются хранилищами, сохраняющими метрики в json.
+type Meta struct {
+	Created time.Time `json:"created"`          // время первого сохранения
+	Updated time.Time `json:"updated"`          // время последнего обновления
+	TS      time.Time `json:"ts"`               // время снятия значения источником
+	Unit    string    `json:"unit,omitempty"`   // единица измерения
+	Help    string    `json:"help,omitempty"`   // описание
+	Source  string    `json:"source,omitempty"` // источник последнего обновления
+}
+
+// IsZero возвращает true, если сведения не заданы.
+func (m Meta) IsZero() bool { return m == Meta{} }
+
+// MetaPtr возвращает nil, если сведения не заданы.
+// Используется для необязательного поля сведений при сохранении в json.
+func MetaPtr(meta Meta) *Meta {
+	if meta.IsZero() {
+		return nil
+	}
+
+	return &meta
+}
+
+// MetaVal возвращает сведения по указателю или пустые сведения для nil.
+func MetaVal(meta *Meta) Meta {
+	if meta == nil {
+		return Meta{}
+	}
+
+	return *meta
+}
+
+// Merge возвращает сведения m, дополненные newMeta:
+// Created сохраняется, если уже задано, остальные
+// непустые значения newMeta заменяют прежние.
+// TS заменяется без сравнения: устаревшие значения
+// отбрасываются до сохранения.
+func (m Meta) Merge(newMeta Meta) Meta {
+	if m.Created.IsZero() {
+		m.Created = newMeta.Created
+	}
+
+	if !newMeta.Updated.IsZero() {
+		m.Updated = newMeta.Updated
+	}
+
+	if !newMeta.TS.IsZero() {
+		m.TS = newMeta.TS
+	}
+
+	if newMeta.Unit != "" {
+		m.Unit = newMeta.Unit
+	}
+
+	if newMeta.Help != "" {
+		m.Help = newMeta.Help
+	}
+
+	if newMeta.Source != "" {
+		m.Source = newMeta.Source
+	}
+
+	return m
+}
+
+// timePtr возвращает nil для нулевого времени.
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// timeVal возвращает нулевое время для nil.
+func timeVal(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
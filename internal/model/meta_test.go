@@ -0,0 +1,44 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricMerge(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	met := NewCounterMetric("Counter-1", 1)
+	met.Meta = Meta{Created: created, Updated: created, Unit: "count", Help: "help"}
+
+	newMet := NewCounterMetric("Counter-1", 2)
+	newMet.Meta = Meta{Created: updated, Updated: updated, TS: updated, Source: "agent-1"}
+
+	if assert.NoError(t, met.Merge(newMet)) {
+		assert.Equal(t, int64(3), *met.Delta)
+		assert.Equal(t, Meta{Created: created, Updated: updated, TS: updated, Unit: "count", Help: "help", Source: "agent-1"}, met.Meta)
+	}
+
+	assert.Error(t, met.Merge(NewGaugeMetric("Counter-1", 1)))
+}
+
+func TestMetaPtr(t *testing.T) {
+	assert.Nil(t, MetaPtr(Meta{}))
+	assert.Equal(t, Meta{}, MetaVal(nil))
+
+	meta := Meta{Unit: "bytes"}
+	assert.Equal(t, meta, MetaVal(MetaPtr(meta)))
+}
+
+func TestMetricJSONMeta(t *testing.T) {
+	met := NewGaugeMetric("Alloc", 1)
+	met.Meta = Meta{Created: time.Unix(1, 0).UTC(), Unit: "bytes", Help: "help", Source: "agent-1"}
+
+	metJSON := BuildMetricJSON(met)
+
+	assert.Nil(t, metJSON.Updated)
+	assert.Equal(t, met.Meta, metJSON.Meta())
+}
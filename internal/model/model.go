@@ -4,21 +4,50 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Наибольшая длина имени и сведений метрики в символах,
+// которую принимают хранилища сервера (размер колонок postgres).
+const (
+	MaxNameLen   = 50
+	MaxUnitLen   = 20
+	MaxSourceLen = 100
 )
 
 var (
 	ErrNameEmpty      = errors.New("name empty")
 	ErrTypeNotSupport = errors.New("type not support")
+	ErrTooLong        = errors.New("too long")
 	errDeltaNil       = errors.New("delta is nil")
 	errValueNil       = errors.New("value is nil")
 )
 
 // MetricJSON структура метрики для http запросов и ответов.
 type MetricJSON struct {
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
+	Delta   *int64     `json:"delta,omitempty"`   // значение метрики в случае передачи counter
+	Value   *float64   `json:"value,omitempty"`   // значение метрики в случае передачи gauge
+	Created *time.Time `json:"created,omitempty"` // время первого сохранения
+	Updated *time.Time `json:"updated,omitempty"` // время последнего обновления
+	TS      *time.Time `json:"ts,omitempty"`      // время снятия значения источником
+	ID      string     `json:"id"`                // имя метрики
+	MType   string     `json:"type"`              // параметр, принимающий значение gauge или counter
+	Unit    string     `json:"unit,omitempty"`    // единица измерения
+	Help    string     `json:"help,omitempty"`    // описание
+	Source  string     `json:"source,omitempty"`  // источник последнего обновления
+}
+
+// Meta возвращает сведения о метрике.
+func (m MetricJSON) Meta() Meta {
+	return Meta{
+		Created: timeVal(m.Created),
+		Updated: timeVal(m.Updated),
+		TS:      timeVal(m.TS),
+		Unit:    m.Unit,
+		Help:    m.Help,
+		Source:  m.Source,
+	}
 }
 
 // String возвращает троковое представления значения метрики.
@@ -54,6 +83,28 @@ func ParseInfo(nameStr, typeStr string) (Info, error) {
 	return Info{MName: nameStr, MType: mType}, nil
 }
 
+// CheckLen возвращает ErrTooLong, если имя, единица измерения
+// или источник метрики длиннее допустимого.
+func CheckLen(met Metric) error {
+	fields := []struct {
+		name string
+		val  string
+		max  int
+	}{
+		{name: "name", val: met.MName, max: MaxNameLen},
+		{name: "unit", val: met.Unit, max: MaxUnitLen},
+		{name: "source", val: met.Source, max: MaxSourceLen},
+	}
+
+	for _, field := range fields {
+		if utf8.RuneCountInString(field.val) > field.max {
+			return fmt.Errorf("%w: %s longer than %d", ErrTooLong, field.name, field.max)
+		}
+	}
+
+	return nil
+}
+
 // Value хранит значения для метрики.
 type Value struct {
 	Delta *int64
@@ -61,9 +112,12 @@ type Value struct {
 }
 
 // updateDelta обновляет Delta новым значение newDelta.
+// Сумма сохраняется в новую переменную: старое значение Delta
+// могло быть передано наружу и не должно меняться.
 func (v *Value) updateDelta(newDelta *int64) error {
 	if newDelta != nil {
-		*v.Delta = *newDelta + *v.Delta
+		delta := *newDelta + *v.Delta
+		v.Delta = &delta
 
 		return nil
 	}
@@ -82,8 +136,9 @@ func (v *Value) updateValue(newValue *float64) error {
 	return errValueNil
 }
 
-// Metric хранит Info и Value метрики.
+// Metric хранит Info, Value и Meta метрики.
 type Metric struct {
+	Meta
 	Value
 	Info
 }
@@ -114,6 +169,18 @@ func (m *Metric) Update(newVal Value) error {
 	return ErrTypeNotSupport
 }
 
+// Merge обновляет метрику значением newMet и дополняет сведения о ней.
+// Ошибка если delta или value == nil.
+func (m *Metric) Merge(newMet Metric) error {
+	if err := m.Update(newMet.Value); err != nil {
+		return err
+	}
+
+	m.Meta = m.Meta.Merge(newMet.Meta)
+
+	return nil
+}
+
 // InfoStr хранит строки с именем и типом метрики.
 type InfoStr struct {
 	Name  string
@@ -129,10 +196,16 @@ type MetricStr struct {
 // BuildMetricJSON MetricJSON из структуры Metric.
 func BuildMetricJSON(met Metric) MetricJSON {
 	return MetricJSON{
-		ID:    met.MName,
-		MType: met.MType.String(),
-		Value: met.Val,
-		Delta: met.Delta,
+		ID:      met.MName,
+		MType:   met.MType.String(),
+		Value:   met.Val,
+		Delta:   met.Delta,
+		Created: timePtr(met.Created),
+		Updated: timePtr(met.Updated),
+		TS:      timePtr(met.TS),
+		Unit:    met.Unit,
+		Help:    met.Help,
+		Source:  met.Source,
 	}
 }
 
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,19 @@ func TestMetricUpdate(t *testing.T) {
 		}
 	})
 
+	t.Run("update counter copy", func(t *testing.T) {
+		var updVal int64 = 5
+
+		met := NewCounterMetric("Counter-1", 100)
+		// копия метрики, например в снимке, разделяет указатель Delta
+		saved := met
+
+		if assert.NoError(t, met.Update(Value{Delta: &updVal})) {
+			assert.Equal(t, int64(105), *met.Delta)
+			assert.Equal(t, int64(100), *saved.Delta)
+		}
+	})
+
 	t.Run("update gauge", func(t *testing.T) {
 		var (
 			initVal = 10.01
@@ -172,3 +186,22 @@ func BenchmarkMetricUpdateGauge(b *testing.B) {
 		met.Update(val)
 	}
 }
+
+func TestCheckLen(t *testing.T) {
+	met := NewGaugeMetric(strings.Repeat("n", MaxNameLen), 1)
+	met.Unit = strings.Repeat("ю", MaxUnitLen)
+	met.Source = strings.Repeat("s", MaxSourceLen)
+	assert.NoError(t, CheckLen(met))
+
+	long := met
+	long.MName += "n"
+	assert.ErrorIs(t, CheckLen(long), ErrTooLong)
+
+	long = met
+	long.Unit += "u"
+	assert.ErrorIs(t, CheckLen(long), ErrTooLong)
+
+	long = met
+	long.Source += "s"
+	assert.ErrorIs(t, CheckLen(long), ErrTooLong)
+}
@@ -0,0 +1,272 @@
+// Хранилище метрик во встраиваемой key-value базе bbolt.
+// Каждое изменение фиксируется отдельной транзакцией с fsync,
+// поэтому состояние переживает аварийное завершение процесса.
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"go.etcd.io/bbolt"
+)
+
+const NameConst = "bolt store"
+
+const openTimeout = time.Second // Таймаут ожидания блокировки файла базы.
+
+var (
+	errNotStarted     = errors.New("store not started")
+	errTypeNotSupport = errors.New("type not support")
+)
+
+// Config конфигурация хранилища.
+type Config struct {
+	Path     string
+	ReadOnly bool // Открыть базу только для чтения: изменения возвращают ошибку.
+}
+
+// boltMetric структура значения метрики для хранения в базе.
+type boltMetric struct {
+	Delta *int64      `json:"delta,omitempty"`
+	Val   *float64    `json:"value,omitempty"`
+	Meta  *model.Meta `json:"meta,omitempty"`
+}
+
+type Bolt struct {
+	db  *bbolt.DB
+	cfg Config
+}
+
+func New(cfg Config) *Bolt {
+	return &Bolt{cfg: cfg}
+}
+
+func (s *Bolt) Name() string { return NameConst }
+
+// Start открывает файл базы и создает бакеты для поддерживаемых типов.
+// При ReadOnly бакеты не создаются, а несуществующий файл базы - ошибка:
+// bbolt создал бы пустой файл и в режиме только для чтения.
+func (s *Bolt) Start(_ context.Context) error {
+	if s.cfg.ReadOnly {
+		if _, err := os.Stat(s.cfg.Path); err != nil {
+			return fmt.Errorf("open bolt [%s]: %w", s.cfg.Path, err)
+		}
+	}
+
+	database, err := bbolt.Open(s.cfg.Path, 0600, &bbolt.Options{Timeout: openTimeout, ReadOnly: s.cfg.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("open bolt [%s]: %w", s.cfg.Path, err)
+	}
+
+	if s.cfg.ReadOnly {
+		s.db = database
+
+		return nil
+	}
+
+	err = database.Update(func(tx *bbolt.Tx) error {
+		for mType := model.TypeCountConst; mType <= model.TypeGaugeConst; mType++ {
+			if _, err := tx.CreateBucketIfNotExists(bucketName(mType)); err != nil {
+				return fmt.Errorf("create bucket [%s]: %w", mType, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Join(err, database.Close())
+	}
+
+	s.db = database
+
+	return nil
+}
+
+func (s *Bolt) Stop(_ context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+func (s *Bolt) Ping() error {
+	if s.db == nil {
+		return errNotStarted
+	}
+
+	return nil
+}
+
+func (s *Bolt) Get(_ context.Context, mInfo model.Info) (model.Metric, error) {
+	var met model.Metric
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+
+		met, err = get(tx, mInfo)
+
+		return err
+	})
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w", err)
+	}
+
+	return met, nil
+}
+
+func (s *Bolt) Update(_ context.Context, met model.Metric) (model.Metric, error) {
+	var metDB model.Metric
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+
+		metDB, err = update(tx, met)
+
+		return err
+	})
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w", err)
+	}
+
+	return metDB, nil
+}
+
+// AddBatch добавляет срез метрик в одной транзакции.
+func (s *Bolt) AddBatch(_ context.Context, arr []model.Metric) error {
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		for i := range arr {
+			if _, err := update(tx, arr[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (s *Bolt) List(_ context.Context) ([]model.Metric, error) {
+	arr := make([]model.Metric, 0)
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for mType := model.TypeCountConst; mType <= model.TypeGaugeConst; mType++ {
+			bucket := tx.Bucket(bucketName(mType))
+			if bucket == nil { // база открыта только для чтения
+				continue
+			}
+
+			err := bucket.ForEach(func(key, data []byte) error {
+				met, err := buildMetric(model.Info{MName: string(key), MType: mType}, data)
+				if err != nil {
+					return err
+				}
+
+				arr = append(arr, met)
+
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("bucket [%s]: %w", mType, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return arr, nil
+}
+
+// Backup записывает в w согласованный снимок всей базы.
+// Снимок читается в отдельной транзакции на чтение
+// и не блокирует запись метрик.
+func (s *Bolt) Backup(_ context.Context, w io.Writer) error {
+	if s.db == nil {
+		return errNotStarted
+	}
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(w)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	return nil
+}
+
+// Получает метрику из бакета для её типа.
+func get(tx *bbolt.Tx, mInfo model.Info) (model.Metric, error) {
+	if mInfo.MType < model.TypeCountConst || mInfo.MType > model.TypeGaugeConst {
+		return model.Metric{}, errTypeNotSupport
+	}
+
+	bucket := tx.Bucket(bucketName(mInfo.MType))
+	if bucket == nil { // база открыта только для чтения
+		return model.Metric{}, serr.ErrNotFound
+	}
+
+	data := bucket.Get([]byte(mInfo.MName))
+	if data == nil {
+		return model.Metric{}, serr.ErrNotFound
+	}
+
+	return buildMetric(mInfo, data)
+}
+
+// Если метрика существует - обновляет её значение, иначе сохраняет новую.
+func update(tx *bbolt.Tx, met model.Metric) (model.Metric, error) {
+	metDB, err := get(tx, met.Info)
+	if err != nil {
+		if !errors.Is(err, serr.ErrNotFound) {
+			return model.Metric{}, fmt.Errorf("getErr: %w", err)
+		}
+
+		metDB = met
+	} else if err := metDB.Merge(met); err != nil {
+		return model.Metric{}, fmt.Errorf("updErr: %w", err)
+	}
+
+	data, err := json.Marshal(boltMetric{Delta: metDB.Delta, Val: metDB.Val, Meta: model.MetaPtr(metDB.Meta)})
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w", err)
+	}
+
+	if err := tx.Bucket(bucketName(metDB.MType)).Put([]byte(metDB.MName), data); err != nil {
+		return model.Metric{}, fmt.Errorf("put: %w", err)
+	}
+
+	return metDB, nil
+}
+
+func buildMetric(mInfo model.Info, data []byte) (model.Metric, error) {
+	var bm boltMetric
+
+	if err := json.Unmarshal(data, &bm); err != nil {
+		return model.Metric{}, fmt.Errorf("unmarshal [%s]: %w", mInfo.MName, err)
+	}
+
+	met := model.NewMetric(mInfo, model.Value{Delta: bm.Delta, Val: bm.Val})
+	met.Meta = model.MetaVal(bm.Meta)
+
+	return met, nil
+}
+
+// Возвращает имя бакета для типа метрики.
+func bucketName(mType model.Type) []byte { return []byte(mType.String()) }
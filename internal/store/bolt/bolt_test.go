@@ -0,0 +1,170 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/internal/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func startBolt(t *testing.T, path string) *Bolt {
+	t.Helper()
+
+	ctx := context.Background()
+	store := New(Config{Path: path})
+
+	if err := store.Start(ctx); err != nil {
+		t.Fatalf("start store: %v\n", err)
+	}
+
+	return store
+}
+
+func TestBolt(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	store := startBolt(t, path)
+
+	t.Run("ping", func(t *testing.T) {
+		assert.NoError(t, store.Ping())
+	})
+
+	t.Run("update counter", func(t *testing.T) {
+		_, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 100))
+		assert.NoError(t, err)
+
+		metDB, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 300))
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 400), metDB)
+		}
+	})
+
+	t.Run("update gauge", func(t *testing.T) {
+		_, err := store.Update(ctx, model.NewGaugeMetric("Gauge-1", 10.01))
+		assert.NoError(t, err)
+
+		metDB, err := store.Update(ctx, model.NewGaugeMetric("Gauge-1", 20.02))
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewGaugeMetric("Gauge-1", 20.02), metDB)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		arr := []model.Metric{
+			model.NewCounterMetric("Counter-1", 100),
+			model.NewGaugeMetric("Gauge-2", 30.03),
+		}
+
+		assert.NoError(t, store.AddBatch(ctx, arr))
+
+		list, err := store.List(ctx)
+		if assert.NoError(t, err) {
+			assert.ElementsMatch(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 500),
+					model.NewGaugeMetric("Gauge-1", 20.02),
+					model.NewGaugeMetric("Gauge-2", 30.03),
+				},
+				list,
+			)
+		}
+	})
+
+	t.Run("get not find", func(t *testing.T) {
+		_, err := store.Get(ctx, model.Info{MName: "Counter-2", MType: model.TypeCountConst})
+		assert.ErrorIs(t, err, serr.ErrNotFound)
+	})
+
+	t.Run("get type not support", func(t *testing.T) {
+		_, err := store.Get(ctx, model.Info{MName: "Counter-1", MType: model.Type(2)})
+		assert.ErrorIs(t, err, errTypeNotSupport)
+	})
+
+	t.Run("backup", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		if err := store.Backup(ctx, &buf); err != nil {
+			t.Fatalf("backup: %v\n", err)
+		}
+
+		backupPath := filepath.Join(t.TempDir(), "backup.db")
+		if err := os.WriteFile(backupPath, buf.Bytes(), 0600); err != nil {
+			t.Fatalf("write backup: %v\n", err)
+		}
+
+		backup := startBolt(t, backupPath)
+		defer backup.Stop(ctx)
+
+		metDB, err := backup.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 500), metDB)
+		}
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		assert.NoError(t, store.Stop(ctx))
+
+		store = startBolt(t, path)
+		defer store.Stop(ctx)
+
+		metDB, err := store.Get(ctx, model.Info{MName: "Gauge-2", MType: model.TypeGaugeConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewGaugeMetric("Gauge-2", 30.03), metDB)
+		}
+	})
+}
+
+func TestBoltPingNotStarted(t *testing.T) {
+	store := New(Config{Path: filepath.Join(t.TempDir(), "metrics.db")})
+	assert.ErrorIs(t, store.Ping(), errNotStarted)
+	assert.NoError(t, store.Stop(context.Background()))
+}
+
+func TestBoltReadOnly(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	// файл базы не создается
+	assert.ErrorIs(t, New(Config{Path: path, ReadOnly: true}).Start(ctx), os.ErrNotExist)
+
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	store := New(Config{Path: path})
+	if err := store.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	if err := store.AddBatch(ctx, []model.Metric{model.NewCounterMetric("Counter-1", 10)}); err != nil {
+		t.Fatalf("add batch: %v\n", err)
+	}
+
+	if err := store.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v\n", err)
+	}
+
+	readOnly := New(Config{Path: path, ReadOnly: true})
+	if err := readOnly.Start(ctx); err != nil {
+		t.Fatalf("start read-only: %v\n", err)
+	}
+	defer readOnly.Stop(ctx)
+
+	list, err := readOnly.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Metric{model.NewCounterMetric("Counter-1", 10)}, list)
+	assert.Error(t, readOnly.AddBatch(ctx, list))
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (storetest.Storage, func() storetest.Storage) {
+		cfg := Config{Path: filepath.Join(t.TempDir(), "metrics.db")}
+
+		return New(cfg), func() storetest.Storage { return New(cfg) }
+	})
+}
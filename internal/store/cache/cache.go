@@ -0,0 +1,443 @@
+// Кэш в памяти перед хранилищем backend.
+// При запуске все метрики backend загружаются в память (сверка состояния),
+// после чего чтения обслуживаются только из памяти.
+// Кэш предполагает, что он единственный пишет в backend.
+//
+// Гарантии сохранности задаются режимом записи:
+//   - ModeWriteThrough: изменение сначала сохраняется в backend,
+//     ответ возвращается после успешной записи;
+//   - ModeWriteBehind: изменение сохраняется в памяти и накапливается,
+//     накопленные изменения записываются в backend одним пакетом раз в FlushInt
+//     и при остановке. При сбое теряются изменения не более чем за FlushInt.
+//     Изменения, которые backend отклоняет (serr.ErrInvalid), отбрасываются,
+//     чтобы не задерживать запись остальных.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/lease"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+)
+
+const (
+	NameConst        = "cache store"
+	FlushIntDefault  = time.Second // Интервал записи накопленных изменений по умолчанию.
+	ModeWriteThrough = Mode("through")
+	ModeWriteBehind  = Mode("behind")
+)
+
+var errModeNotSupport = errors.New("cache mode not support")
+
+// Mode режим записи в backend.
+type Mode string
+
+// ParseMode возвращает режим записи из строки. Ошибка если режим не поддерживается.
+func ParseMode(str string) (Mode, error) {
+	switch mode := Mode(str); mode {
+	case ModeWriteThrough, ModeWriteBehind:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: [%s]", errModeNotSupport, str)
+	}
+}
+
+// backend хранилище за кэшем.
+type backend interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Ping() error
+	Get(ctx context.Context, mInfo model.Info) (model.Metric, error)
+	Update(ctx context.Context, met model.Metric) (model.Metric, error)
+	List(ctx context.Context) ([]model.Metric, error)
+	AddBatch(ctx context.Context, arr []model.Metric) error
+}
+
+// storage хранилище в памяти.
+type storage interface {
+	Get(ctx context.Context, mInfo model.Info) (model.Metric, error)
+	Update(ctx context.Context, met model.Metric) (model.Metric, error)
+	List(ctx context.Context) ([]model.Metric, error)
+	AddBatch(ctx context.Context, arr []model.Metric) error
+}
+
+// Интерфейс backend с поддержкой резервного копирования.
+type backuper interface {
+	Backup(ctx context.Context, w io.Writer) error
+}
+
+// Интерфейс backend с фоновыми задачами, которые запускает вызывающая сторона.
+type jobber interface {
+	Jobs() []lease.Service
+}
+
+// Интерфейс backend с однократным применением пакета по ключу идемпотентности.
+type onceBatcher interface {
+	AddBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error)
+}
+
+type Config struct {
+	Mode     Mode
+	FlushInt time.Duration
+	Log      *slog.Logger // nil - slog.Default()
+}
+
+type Cache struct {
+	backend backend
+	mem     storage
+	// pending изменения, еще не записанные в backend (ModeWriteBehind):
+	// для counter - сумма приращений, для gauge - последнее значение.
+	pending map[model.Info]model.Metric
+	exit    chan struct{} // закрывается при завершении фоновой записи, nil - запись не запущена
+	stop    chan struct{} // закрывается при остановке хранилища
+	cfg     Config
+	mu      sync.Mutex
+	flushMu sync.Mutex // упорядочивает записи накопленных изменений
+}
+
+func New(cfg Config, back backend, mem storage) *Cache {
+	if cfg.Mode == "" {
+		cfg.Mode = ModeWriteThrough
+	}
+
+	if cfg.FlushInt <= 0 {
+		cfg.FlushInt = FlushIntDefault
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = slog.Default()
+	}
+
+	return &Cache{
+		backend: back,
+		mem:     mem,
+		pending: make(map[model.Info]model.Metric),
+		stop:    make(chan struct{}),
+		cfg:     cfg,
+	}
+}
+
+func (c *Cache) Name() string { return NameConst }
+func (c *Cache) Ping() error  { return c.backend.Ping() }
+
+// Start запускает backend и загружает его метрики в память.
+func (c *Cache) Start(ctx context.Context) error {
+	if _, err := ParseMode(string(c.cfg.Mode)); err != nil {
+		return err
+	}
+
+	if err := c.backend.Start(ctx); err != nil {
+		return fmt.Errorf("backend Start: %w", err)
+	}
+
+	if err := c.reconcile(ctx); err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	if c.cfg.Mode == ModeWriteBehind {
+		c.exit = make(chan struct{})
+
+		go c.run(ctx)
+	}
+
+	return nil
+}
+
+// Stop записывает накопленные изменения и останавливает backend.
+// Если фоновая запись не запускалась, ее завершение не ожидается.
+func (c *Cache) Stop(ctx context.Context) error {
+	var errFlush error
+
+	if c.exit != nil {
+		close(c.stop)
+		<-c.exit
+
+		errFlush = c.flush(ctx)
+	}
+
+	if err := c.backend.Stop(ctx); err != nil {
+		return errors.Join(errFlush, fmt.Errorf("backend Stop: %w", err))
+	}
+
+	return errFlush
+}
+
+func (c *Cache) Get(ctx context.Context, mInfo model.Info) (model.Metric, error) {
+	return c.mem.Get(ctx, mInfo)
+}
+
+func (c *Cache) List(ctx context.Context) ([]model.Metric, error) {
+	return c.mem.List(ctx)
+}
+
+// Update изменяет метрику.
+// Изменения backend и памяти выполняются под одной блокировкой,
+// чтобы они применялись в одном порядке.
+func (c *Cache) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.Mode == ModeWriteBehind {
+		metDB, err := c.mem.Update(ctx, met)
+		if err != nil {
+			return model.Metric{}, fmt.Errorf("%w", err)
+		}
+
+		c.addPending(met)
+
+		return metDB, nil
+	}
+
+	metDB, err := c.backend.Update(ctx, met)
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("backend Update: %w", err)
+	}
+
+	if _, err := c.mem.Update(ctx, met); err != nil {
+		return model.Metric{}, fmt.Errorf("%w", err)
+	}
+
+	return metDB, nil
+}
+
+func (c *Cache) AddBatch(ctx context.Context, arr []model.Metric) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg.Mode == ModeWriteBehind {
+		if err := c.mem.AddBatch(ctx, arr); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		for i := range arr {
+			c.addPending(arr[i])
+		}
+
+		return nil
+	}
+
+	if err := c.backend.AddBatch(ctx, arr); err != nil {
+		return fmt.Errorf("backend AddBatch: %w", err)
+	}
+
+	if err := c.mem.AddBatch(ctx, arr); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+// AddBatchOnce передает однократное применение пакета backend
+// и при применении сохраняет пакет в памяти.
+// Поддерживается только в режиме ModeWriteThrough: в режиме ModeWriteBehind
+// пакет записывается в backend позже и без ключа.
+func (c *Cache) AddBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error) {
+	store, ok := c.backend.(onceBatcher)
+	if !ok || c.cfg.Mode != ModeWriteThrough {
+		return false, errors.ErrUnsupported
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	applied, err := store.AddBatchOnce(ctx, key, arr)
+	if err != nil {
+		return false, fmt.Errorf("backend AddBatchOnce: %w", err)
+	}
+
+	if !applied {
+		return false, nil
+	}
+
+	if err := c.mem.AddBatch(ctx, arr); err != nil {
+		return true, fmt.Errorf("%w", err)
+	}
+
+	return true, nil
+}
+
+// Backup записывает накопленные изменения и передает
+// резервное копирование backend.
+func (c *Cache) Backup(ctx context.Context, w io.Writer) error {
+	store, ok := c.backend.(backuper)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+
+	if err := c.flush(ctx); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return store.Backup(ctx, w)
+}
+
+// Jobs возвращает фоновые задачи backend, например сохранение снимка
+// файлового хранилища на лидере. Перед остановкой задачи накопленные
+// изменения записываются в backend, чтобы попасть в последнее сохранение.
+func (c *Cache) Jobs() []lease.Service {
+	store, ok := c.backend.(jobber)
+	if !ok {
+		return nil
+	}
+
+	jobs := store.Jobs()
+	list := make([]lease.Service, len(jobs))
+
+	for i := range jobs {
+		list[i] = &flushJob{Service: jobs[i], cache: c}
+	}
+
+	return list
+}
+
+// flushJob задача backend, перед остановкой которой
+// записываются накопленные изменения кэша.
+type flushJob struct {
+	lease.Service
+	cache *Cache
+}
+
+func (j *flushJob) Stop(ctx context.Context) error {
+	errFlush := j.cache.flush(ctx)
+
+	return errors.Join(errFlush, j.Service.Stop(ctx))
+}
+
+// reconcile загружает в память текущее состояние backend.
+func (c *Cache) reconcile(ctx context.Context) error {
+	arr, err := c.backend.List(ctx)
+	if err != nil {
+		return fmt.Errorf("backend List: %w", err)
+	}
+
+	if err := c.mem.AddBatch(ctx, arr); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) run(ctx context.Context) {
+	defer close(c.exit)
+
+	ticker := time.NewTicker(c.cfg.FlushInt)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.flush(ctx); err != nil {
+				c.cfg.Log.ErrorContext(ctx, "flush cache", slog.String("error", err.Error()))
+			}
+		case <-ctx.Done():
+			return
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// flush записывает накопленные изменения в backend одним пакетом.
+// Запись выполняется без блокировки кэша. Если backend отклонил пакет,
+// изменения записываются по одному, см. [Cache.writeEach]. При ошибке
+// незаписанные изменения возвращаются в накопленные и будут записаны
+// при следующей попытке.
+func (c *Cache) flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[model.Info]model.Metric)
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	arr := make([]model.Metric, 0, len(pending))
+	for _, met := range pending {
+		arr = append(arr, met)
+	}
+
+	err := c.backend.AddBatch(ctx, arr)
+	if errors.Is(err, serr.ErrInvalid) {
+		err = c.writeEach(ctx, pending)
+	}
+
+	if err != nil {
+		c.mu.Lock()
+		c.restorePending(pending)
+		c.mu.Unlock()
+
+		return fmt.Errorf("backend AddBatch: %w", err)
+	}
+
+	return nil
+}
+
+// writeEach записывает изменения pending в backend по одному и удаляет
+// из pending записанные. Отклоненные backend изменения удаляются из pending
+// без записи: повтор не поможет, а пакет с ними не был бы записан никогда.
+// Возвращает первую ошибку, при которой повтор возможен.
+func (c *Cache) writeEach(ctx context.Context, pending map[model.Info]model.Metric) error {
+	for mInfo, met := range pending {
+		err := c.backend.AddBatch(ctx, []model.Metric{met})
+		if err != nil && !errors.Is(err, serr.ErrInvalid) {
+			return err
+		}
+
+		if err != nil {
+			c.cfg.Log.ErrorContext(ctx, "drop cache change",
+				slog.String("name", mInfo.MName),
+				slog.String("type", mInfo.MType.String()),
+				slog.String("error", err.Error()),
+			)
+		}
+
+		delete(pending, mInfo)
+	}
+
+	return nil
+}
+
+// addPending добавляет изменение met к накопленным:
+// приращения counter складываются, gauge заменяется,
+// сведения о метрике дополняются.
+func (c *Cache) addPending(met model.Metric) {
+	prev, ok := c.pending[met.Info]
+	if !ok {
+		c.pending[met.Info] = met
+
+		return
+	}
+
+	if err := prev.Merge(met); err != nil {
+		c.pending[met.Info] = met
+
+		return
+	}
+
+	c.pending[met.Info] = prev
+}
+
+// restorePending возвращает в накопленные изменения, которые не удалось записать.
+// Изменения, накопленные после неудачной записи, применяются поверх них:
+// приращения counter складываются, для gauge сохраняется более новое значение.
+func (c *Cache) restorePending(failed map[model.Info]model.Metric) {
+	for mInfo, met := range failed {
+		newer, ok := c.pending[mInfo]
+		c.pending[mInfo] = met
+
+		if ok {
+			c.addPending(newer)
+		}
+	}
+}
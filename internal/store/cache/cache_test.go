@@ -0,0 +1,390 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/lease"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/bolt"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/internal/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// spyBackend хранилище в памяти, считающее обращения.
+type spyBackend struct {
+	adapter.PingAdapter
+	errBatch error
+	reject   string // имя метрики, пакеты с которой отклоняются
+	gets     atomic.Int64
+	updates  atomic.Int64
+	batches  atomic.Int64
+}
+
+func newSpyBackend() *spyBackend {
+	return &spyBackend{PingAdapter: adapter.Ping(inmemory.New())}
+}
+
+func (sb *spyBackend) Get(ctx context.Context, mInfo model.Info) (model.Metric, error) {
+	sb.gets.Add(1)
+
+	return sb.PingAdapter.Get(ctx, mInfo)
+}
+
+func (sb *spyBackend) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
+	sb.updates.Add(1)
+
+	return sb.PingAdapter.Update(ctx, met)
+}
+
+func (sb *spyBackend) AddBatch(ctx context.Context, arr []model.Metric) error {
+	if sb.errBatch != nil {
+		return sb.errBatch
+	}
+
+	for i := range arr {
+		if arr[i].MName == sb.reject {
+			return fmt.Errorf("%w: %s", serr.ErrInvalid, sb.reject)
+		}
+	}
+
+	sb.batches.Add(1)
+
+	return sb.PingAdapter.AddBatch(ctx, arr)
+}
+
+func TestCacheReconcile(t *testing.T) {
+	ctx := context.Background()
+	back := newSpyBackend()
+
+	if err := back.PingAdapter.AddBatch(ctx, []model.Metric{model.NewCounterMetric("Counter-1", 10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := New(Config{Mode: ModeWriteThrough}, back, inmemory.New())
+	if err := cache.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+	defer cache.Stop(ctx)
+
+	metDB, err := cache.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-1", 10), metDB)
+	}
+
+	metDB, err = cache.Update(ctx, model.NewCounterMetric("Counter-1", 5))
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-1", 15), metDB)
+	}
+
+	// чтения не обращаются к backend, запись сразу попадает в backend
+	assert.Equal(t, int64(0), back.gets.Load())
+	assert.Equal(t, int64(1), back.updates.Load())
+}
+
+func TestCacheWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	back := newSpyBackend()
+
+	cache := New(Config{Mode: ModeWriteBehind, FlushInt: time.Hour}, back, inmemory.New())
+	if err := cache.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Update(ctx, model.NewCounterMetric("Counter-1", 10)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+	}
+
+	err := cache.AddBatch(ctx, []model.Metric{
+		model.NewGaugeMetric("Gauge-1", 10.01),
+		model.NewGaugeMetric("Gauge-1", 20.02),
+	})
+	if err != nil {
+		t.Fatalf("addBatch: %v\n", err)
+	}
+
+	t.Run("pending", func(t *testing.T) {
+		assert.Equal(t, int64(0), back.updates.Load()+back.batches.Load())
+
+		metDB, err := cache.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 30), metDB)
+		}
+	})
+
+	t.Run("flush failed", func(t *testing.T) {
+		back.errBatch = errors.New("backend down")
+
+		assert.Error(t, cache.flush(ctx))
+
+		back.errBatch = nil
+
+		if _, err := cache.Update(ctx, model.NewCounterMetric("Counter-1", 5)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+	})
+
+	t.Run("flush on stop", func(t *testing.T) {
+		if err := cache.Stop(ctx); err != nil {
+			t.Fatalf("stop: %v\n", err)
+		}
+
+		assert.Equal(t, int64(1), back.batches.Load())
+
+		list, err := back.List(ctx)
+		if assert.NoError(t, err) {
+			assert.ElementsMatch(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 35),
+					model.NewGaugeMetric("Gauge-1", 20.02),
+				},
+				list,
+			)
+		}
+	})
+}
+
+func TestCacheFlushInterval(t *testing.T) {
+	ctx := context.Background()
+	back := newSpyBackend()
+
+	cache := New(Config{Mode: ModeWriteBehind, FlushInt: 20 * time.Millisecond}, back, inmemory.New())
+	if err := cache.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+	defer cache.Stop(ctx)
+
+	if _, err := cache.Update(ctx, model.NewGaugeMetric("Gauge-1", 10.01)); err != nil {
+		t.Fatalf("update: %v\n", err)
+	}
+
+	assert.Eventually(t, func() bool {
+		_, err := back.PingAdapter.Get(ctx, model.Info{MName: "Gauge-1", MType: model.TypeGaugeConst})
+
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCacheFlushRejected(t *testing.T) {
+	ctx := context.Background()
+	back := newSpyBackend()
+	back.reject = "Bad"
+
+	cache := New(Config{Mode: ModeWriteBehind, FlushInt: time.Hour}, back, inmemory.New())
+	if err := cache.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer cache.Stop(ctx)
+
+	err := cache.AddBatch(ctx, []model.Metric{
+		model.NewCounterMetric("Good", 1),
+		model.NewCounterMetric("Bad", 1),
+	})
+	if err != nil {
+		t.Fatalf("add batch: %v", err)
+	}
+
+	// отклоненное изменение отбрасывается, остальные записываются
+	assert.NoError(t, cache.flush(ctx))
+	assert.Empty(t, cache.pending)
+
+	_, err = back.PingAdapter.Get(ctx, model.Info{MName: "Good", MType: model.TypeCountConst})
+	assert.NoError(t, err)
+
+	_, err = back.PingAdapter.Get(ctx, model.Info{MName: "Bad", MType: model.TypeCountConst})
+	assert.ErrorIs(t, err, serr.ErrNotFound)
+}
+
+func TestCacheStopNotStarted(t *testing.T) {
+	cache := New(Config{Mode: ModeWriteBehind}, newSpyBackend(), inmemory.New())
+
+	done := make(chan error)
+	go func() { done <- cache.Stop(context.Background()) }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("stop not started cache hangs")
+	}
+}
+
+// jobBackend хранилище с фоновой задачей.
+type jobBackend struct {
+	*spyBackend
+	job *spyJob
+}
+
+func (jb *jobBackend) Jobs() []lease.Service { return []lease.Service{jb.job} }
+
+// spyJob задача, запоминающая кол-во пакетов backend при остановке.
+type spyJob struct {
+	back    *spyBackend
+	batches int64
+}
+
+func (sj *spyJob) Name() string                  { return "spy job" }
+func (sj *spyJob) Start(_ context.Context) error { return nil }
+
+func (sj *spyJob) Stop(_ context.Context) error {
+	sj.batches = sj.back.batches.Load()
+
+	return nil
+}
+
+func TestCacheJobs(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no jobs", func(t *testing.T) {
+		assert.Empty(t, New(Config{}, newSpyBackend(), inmemory.New()).Jobs())
+	})
+
+	t.Run("flush before job stop", func(t *testing.T) {
+		spy := newSpyBackend()
+		back := &jobBackend{spyBackend: spy, job: &spyJob{back: spy}}
+
+		cache := New(Config{Mode: ModeWriteBehind, FlushInt: time.Hour}, back, inmemory.New())
+		if err := cache.Start(ctx); err != nil {
+			t.Fatalf("start: %v\n", err)
+		}
+		defer cache.Stop(ctx)
+
+		jobs := cache.Jobs()
+		if !assert.Len(t, jobs, 1) {
+			return
+		}
+
+		if _, err := cache.Update(ctx, model.NewCounterMetric("Counter-1", 1)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+
+		assert.NoError(t, jobs[0].Stop(ctx))
+		assert.Equal(t, int64(1), back.job.batches)
+	})
+}
+
+func TestCacheBackup(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not support", func(t *testing.T) {
+		cache := New(Config{}, newSpyBackend(), inmemory.New())
+		assert.ErrorIs(t, cache.Backup(ctx, io.Discard), errors.ErrUnsupported)
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		back := bolt.New(bolt.Config{Path: filepath.Join(t.TempDir(), "metrics.db")})
+
+		cache := New(Config{Mode: ModeWriteBehind, FlushInt: time.Hour}, back, inmemory.New())
+		if err := cache.Start(ctx); err != nil {
+			t.Fatalf("start: %v\n", err)
+		}
+		defer cache.Stop(ctx)
+
+		if _, err := cache.Update(ctx, model.NewCounterMetric("Counter-1", 10)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+
+		// перед копированием накопленные изменения записываются в backend
+		assert.NoError(t, cache.Backup(ctx, &buf))
+		assert.NotZero(t, buf.Len())
+
+		metDB, err := back.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 10), metDB)
+		}
+	})
+}
+
+// onceBackend хранилище, применяющее пакет с ключом один раз.
+type onceBackend struct {
+	*spyBackend
+	keys map[string]struct{}
+}
+
+func (ob *onceBackend) AddBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error) {
+	if _, ok := ob.keys[key]; ok {
+		return false, nil
+	}
+
+	ob.keys[key] = struct{}{}
+
+	return true, ob.AddBatch(ctx, arr)
+}
+
+func TestCacheAddBatchOnce(t *testing.T) {
+	ctx := context.Background()
+	arr := []model.Metric{model.NewCounterMetric("PollCount", 5)}
+
+	t.Run("not support", func(t *testing.T) {
+		cache := New(Config{}, newSpyBackend(), inmemory.New())
+		_, err := cache.AddBatchOnce(ctx, "key-1", arr)
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+		back := &onceBackend{spyBackend: newSpyBackend(), keys: make(map[string]struct{})}
+		cache = New(Config{Mode: ModeWriteBehind}, back, inmemory.New())
+		_, err = cache.AddBatchOnce(ctx, "key-1", arr)
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+	})
+
+	t.Run("through", func(t *testing.T) {
+		back := &onceBackend{spyBackend: newSpyBackend(), keys: make(map[string]struct{})}
+
+		cache := New(Config{Mode: ModeWriteThrough}, back, inmemory.New())
+		if err := cache.Start(ctx); err != nil {
+			t.Fatalf("start: %v\n", err)
+		}
+		defer cache.Stop(ctx)
+
+		for _, want := range []bool{true, false} {
+			applied, err := cache.AddBatchOnce(ctx, "key-1", arr)
+			assert.NoError(t, err)
+			assert.Equal(t, want, applied)
+		}
+
+		metDB, err := cache.Get(ctx, arr[0].Info)
+		if assert.NoError(t, err) {
+			assert.Equal(t, arr[0], metDB)
+		}
+
+		assert.Equal(t, int64(1), back.batches.Load())
+	})
+}
+
+func TestCacheModeNotSupport(t *testing.T) {
+	_, err := ParseMode("around")
+	assert.ErrorIs(t, err, errModeNotSupport)
+
+	cache := New(Config{Mode: "around"}, newSpyBackend(), inmemory.New())
+	assert.ErrorIs(t, cache.Start(context.Background()), errModeNotSupport)
+}
+
+func TestConformance(t *testing.T) {
+	for _, mode := range []Mode{ModeWriteThrough, ModeWriteBehind} {
+		mode := mode
+
+		t.Run(string(mode), func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) (storetest.Storage, func() storetest.Storage) {
+				cfg := bolt.Config{Path: filepath.Join(t.TempDir(), "metrics.db")}
+				newCache := func() storetest.Storage {
+					return New(Config{Mode: mode, FlushInt: time.Hour}, bolt.New(cfg), inmemory.New())
+				}
+
+				return newCache(), newCache
+			})
+		})
+	}
+}
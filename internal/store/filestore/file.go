@@ -2,26 +2,77 @@ package filestore
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
 )
 
+// SyncPolicy политика сброса журнала на диск.
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // fsync после каждой записи.
+	SyncInterval SyncPolicy = "interval" // fsync не чаще одного раза в syncIntervalConst, несброшенные записи сбрасываются по таймеру.
+	SyncNone     SyncPolicy = "none"     // Сброс на диск остается на усмотрение ОС.
+)
+
+// ErrSyncPolicy политика не поддерживается.
+var ErrSyncPolicy = errors.New("sync policy not support")
+
+// ParseSyncPolicy возвращает политику из строки, пустая строка - SyncAlways.
+func ParseSyncPolicy(str string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(str); policy {
+	case "":
+		return SyncAlways, nil
+	case SyncAlways, SyncInterval, SyncNone:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: [%s]", ErrSyncPolicy, str)
+	}
+}
+
+const (
+	syncIntervalConst = time.Second // Интервал fsync для политики SyncInterval.
+	snapSuffixConst   = ".snap"     // Суффикс файла снимка.
+	tmpSuffixConst    = ".tmp"      // Суффикс временного файла.
+	crcLenConst       = 8           // Длина контрольной суммы записи в hex.
+)
+
+var (
+	errCorrupted = errors.New("wal corrupted")
+	errChecksum  = errors.New("checksum mismatch")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
 // Структура метрик для хранения в файле.
 type fileMetric struct {
-	Val    *float64   `json:"mVal,omitempty"`
-	Delta  *int64     `json:"mDelta,omitempty"`
-	NameID string     `json:"mName"`
-	TypeID model.Type `json:"mType"`
+	Val    *float64    `json:"mVal,omitempty"`
+	Delta  *int64      `json:"mDelta,omitempty"`
+	Meta   *model.Meta `json:"mMeta,omitempty"`
+	NameID string      `json:"mName"`
+	TypeID model.Type  `json:"mType"`
 }
 
 func (fm fileMetric) buildModelMetric() model.Metric {
-	return model.NewMetric(
+	met := model.NewMetric(
 		model.Info{MName: fm.NameID, MType: fm.TypeID},
 		model.Value{Delta: fm.Delta, Val: fm.Val},
 	)
+	met.Meta = model.MetaVal(fm.Meta)
+
+	return met
 }
 
 func buildFileMetric(met model.Metric) fileMetric {
@@ -30,160 +81,369 @@ func buildFileMetric(met model.Metric) fileMetric {
 		TypeID: met.MType,
 		Val:    met.Val,
 		Delta:  met.Delta,
+		Meta:   model.MetaPtr(met.Meta),
 	}
 }
 
+// File журнал упреждающей записи (WAL) метрик.
+// Каждая запись журнала - строка "<crc32> <json>" с текущим значением метрики.
+// Полное состояние периодически сохраняется в файл снимка,
+// после чего журнал усекается.
+// keep - кол-во хранимых предыдущих поколений снимка.
 type File struct {
-	producer *Producer
-	consumer *Consumer
-	filePath string
-}
-
-type Consumer struct {
 	file     *os.File
-	scanner  *bufio.Scanner
+	log      *slog.Logger
+	lastSync time.Time
+	done     chan struct{}
 	filePath string
+	policy   SyncPolicy
+	snap     snapshot
+	size     int64
+	interval time.Duration
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	dirty    bool // есть записи, не сброшенные на диск (SyncInterval)
 }
 
-func NewConsumer(filePath string) *Consumer {
-	return &Consumer{filePath: filePath}
+func NewFile(filePath string, policy SyncPolicy, keep int, log *slog.Logger) *File {
+	return &File{
+		log:      log,
+		filePath: filePath,
+		snap:     newSnapshot(filePath+snapSuffixConst, keep, log),
+		policy:   policy,
+		interval: syncIntervalConst,
+	}
 }
 
-func (c *Consumer) Open() error {
-	file, err := os.OpenFile(c.filePath, os.O_RDONLY|os.O_CREATE, 0666)
+// Open открывает журнал и восстанавливает его после сбоя:
+// недописанная последняя запись отбрасывается.
+func (f *File) Open() error {
+	file, err := os.OpenFile(f.filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	_, valid, err := readRecords(file)
+	if err != nil {
+		return errors.Join(fmt.Errorf("read wal: %w", err), file.Close())
+	}
+
+	info, err := file.Stat()
 	if err != nil {
-		return err
+		return errors.Join(err, file.Close())
+	}
+
+	if info.Size() != valid {
+		if err := file.Truncate(valid); err != nil {
+			return errors.Join(fmt.Errorf("truncate tail: %w", err), file.Close())
+		}
 	}
 
-	c.file = file
-	c.scanner = bufio.NewScanner(file)
+	f.file = file
+	f.size = valid
+	f.lastSync = time.Now()
+
+	if f.policy == SyncInterval {
+		f.done = make(chan struct{})
+		f.wg.Add(1)
+
+		go f.syncLoop()
+	}
 
 	return nil
 }
 
-func (c *Consumer) Scan() bool    { return c.scanner.Scan() }
-func (c *Consumer) Bytes() []byte { return c.scanner.Bytes() }
-func (c *Consumer) Err() error    { return c.scanner.Err() }
-func (c *Consumer) Close() error  { return c.file.Close() }
-
-type Producer struct {
-	file     *os.File
-	writer   *bufio.Writer
-	filePath string
+// syncLoop сбрасывает на диск записи, оставшиеся после последнего fsync:
+// без него при политике SyncInterval последние записи остаются
+// несброшенными до следующей записи.
+func (f *File) syncLoop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			if err := f.flush(); err != nil {
+				f.log.Error("sync wal", slog.String("error", err.Error()))
+			}
+		}
+	}
 }
 
-func NewProducer(filePath string) *Producer {
-	return &Producer{filePath: filePath}
+// flush сбрасывает журнал на диск, если есть несброшенные записи.
+func (f *File) flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.dirty {
+		return nil
+	}
+
+	return f.fsync()
 }
 
-func (p *Producer) Open() error {
-	file, err := os.OpenFile(p.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return err
+func (f *File) Close() error {
+	if f.done != nil {
+		close(f.done)
+		f.wg.Wait()
+		f.done = nil
 	}
 
-	p.file = file
-	p.writer = bufio.NewWriter(file)
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	return nil
+	if err := f.file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("sync: %w", err), f.file.Close())
+	}
+
+	return f.file.Close()
+}
+
+// Size возвращает размер журнала в байтах.
+func (f *File) Size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.size
 }
 
-func (p *Producer) Write(data []byte) error {
-	// записываем событие в буфер
-	if _, err := p.writer.Write(data); err != nil {
-		return err
+func (f *File) WriteMetric(met model.Metric) error {
+	return f.WriteBatch([]model.Metric{met})
+}
+
+// WriteBatch добавляет записи в журнал одной операцией записи.
+func (f *File) WriteBatch(arr []model.Metric) error {
+	var buf bytes.Buffer
+
+	for i := range arr {
+		if err := encodeRecord(&buf, arr[i]); err != nil {
+			return fmt.Errorf("%w", err)
+		}
 	}
 
-	// добавляем перенос строки
-	if err := p.writer.WriteByte('\n'); err != nil {
-		return err
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// недописанная запись усекается: иначе следующие записи окажутся
+	// после поврежденной и журнал не откроется
+	if _, err := f.file.Write(buf.Bytes()); err != nil {
+		return errors.Join(fmt.Errorf("write wal: %w", err), f.truncate(f.size))
 	}
 
-	return p.writer.Flush()
+	f.size += int64(buf.Len())
+
+	return f.sync()
 }
 
-func (p *Producer) Close() error { return p.file.Close() }
-func (p *Producer) Trunc() error { return p.file.Truncate(0) }
+// ReadBatch возвращает сохраненное состояние:
+// метрики из снимка, обновленные записями журнала.
+func (f *File) ReadBatch() ([]model.Metric, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-func NewFile(filePath string) *File {
-	return &File{
-		filePath: filePath,
-		consumer: NewConsumer(filePath),
-		producer: NewProducer(filePath),
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("%w", err)
 	}
+
+	return f.readState(f.file)
 }
 
-func (f *File) Open() error {
-	if err := f.consumer.Open(); err != nil {
-		return fmt.Errorf("%w", err)
+// Read возвращает сохраненное состояние без открытия журнала на запись:
+// файлы не изменяются, недописанная запись журнала пропускается.
+// Отсутствие журнала не является ошибкой.
+func (f *File) Read() ([]model.Metric, error) {
+	file, err := os.Open(f.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return f.readState(bytes.NewReader(nil))
 	}
 
-	if err := f.producer.Open(); err != nil {
-		return fmt.Errorf("%w", err)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
 	}
+	defer file.Close()
 
-	return nil
+	return f.readState(file)
 }
 
-func (f *File) Close() error {
-	if err := f.consumer.Close(); err != nil {
-		return fmt.Errorf("%w", err)
+// readState возвращает метрики из снимка, обновленные записями журнала wal.
+func (f *File) readState(wal io.Reader) ([]model.Metric, error) {
+	snap, err := f.snap.read()
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
 	}
 
-	if err := f.producer.Close(); err != nil {
-		return fmt.Errorf("%w", err)
+	records, _, err := readRecords(wal)
+	if err != nil {
+		return nil, fmt.Errorf("read wal: %w", err)
 	}
 
-	return nil
+	return lastWins(append(snap, records...)), nil
 }
 
-func (f *File) WriteMetric(met model.Metric) error {
-	data, err := json.Marshal(buildFileMetric(met))
-	if err != nil {
-		return fmt.Errorf("%w", err)
+// Compact сохраняет полное состояние arr в новое поколение снимка и усекает журнал.
+func (f *File) Compact(arr []model.Metric) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.snap.write(arr); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
 	}
 
-	if err := f.producer.Write(data); err != nil {
-		return fmt.Errorf("%w", err)
+	if err := f.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+
+	f.size = 0
+
+	return f.fsync()
+}
+
+// truncate усекает журнал до размера size.
+func (f *File) truncate(size int64) error {
+	if err := f.file.Truncate(size); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
 	}
 
 	return nil
 }
 
-func (f *File) WriteBatch(arr []model.Metric) error {
-	if err := f.producer.Trunc(); err != nil {
-		return fmt.Errorf("%w", err)
+// sync сбрасывает журнал на диск согласно политике.
+func (f *File) sync() error {
+	switch f.policy {
+	case SyncNone:
+		return nil
+	case SyncInterval:
+		if time.Since(f.lastSync) < f.interval {
+			f.dirty = true
+
+			return nil
+		}
 	}
 
-	for i := range arr {
-		if err := f.WriteMetric(arr[i]); err != nil {
-			return fmt.Errorf("%w", err)
+	return f.fsync()
+}
+
+// fsync сбрасывает журнал на диск.
+func (f *File) fsync() error {
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+
+	f.lastSync = time.Now()
+	f.dirty = false
+
+	return nil
+}
+
+// readRecords читает записи из r.
+// Возвращает прочитанные метрики и смещение конца последней целой записи.
+// Поврежденная запись в конце файла считается недописанной и пропускается,
+// поврежденная запись в середине - ошибка errCorrupted.
+func readRecords(r io.Reader) ([]model.Metric, int64, error) {
+	var (
+		valid  int64
+		broken bool
+	)
+
+	arr := make([]model.Metric, 0)
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if broken {
+				return nil, 0, fmt.Errorf("%w: offset %d", errCorrupted, valid)
+			}
+
+			fileMet, errDecode := decodeRecord(line)
+			if errDecode != nil || line[len(line)-1] != '\n' {
+				broken = true
+			} else {
+				arr = append(arr, fileMet.buildModelMetric())
+				valid += int64(len(line))
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return arr, valid, nil
+			}
+
+			return nil, 0, fmt.Errorf("%w", err)
 		}
 	}
+}
+
+// encodeRecord добавляет в buf запись журнала для метрики.
+func encodeRecord(buf *bytes.Buffer, met model.Metric) error {
+	data, err := json.Marshal(buildFileMetric(met))
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	var sum [4]byte
+
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(data, crcTable))
+
+	buf.WriteString(hex.EncodeToString(sum[:]))
+	buf.WriteByte(' ')
+	buf.Write(data)
+	buf.WriteByte('\n')
 
 	return nil
 }
 
-func (f *File) ReadBatch() ([]model.Metric, error) {
+// decodeRecord разбирает запись журнала.
+// Строки без контрольной суммы (формат до появления журнала) принимаются как есть.
+func decodeRecord(line []byte) (fileMetric, error) {
 	var fileMet fileMetric
 
-	arr := make([]model.Metric, 0)
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	data := line
 
-	for f.consumer.Scan() {
-		fileMet = fileMetric{}
-		data := f.consumer.Bytes()
+	if !bytes.HasPrefix(line, []byte{'{'}) {
+		if len(line) <= crcLenConst || line[crcLenConst] != ' ' {
+			return fileMetric{}, errChecksum
+		}
 
-		err := json.Unmarshal(data, &fileMet)
+		sum, err := hex.DecodeString(string(line[:crcLenConst]))
 		if err != nil {
-			return nil, fmt.Errorf("%w", err)
+			return fileMetric{}, errChecksum
 		}
 
-		arr = append(arr, fileMet.buildModelMetric())
+		data = line[crcLenConst+1:]
+
+		if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(sum) {
+			return fileMetric{}, errChecksum
+		}
 	}
 
-	if err := f.consumer.Err(); err != nil {
-		return nil, fmt.Errorf("%w", err)
+	if err := json.Unmarshal(data, &fileMet); err != nil {
+		return fileMetric{}, fmt.Errorf("%w", err)
+	}
+
+	return fileMet, nil
+}
+
+// lastWins оставляет для каждой метрики последнее записанное значение.
+func lastWins(arr []model.Metric) []model.Metric {
+	idx := make(map[model.Info]int, len(arr))
+	res := make([]model.Metric, 0, len(arr))
+
+	for i := range arr {
+		if j, ok := idx[arr[i].Info]; ok {
+			res[j] = arr[i]
+
+			continue
+		}
+
+		idx[arr[i].Info] = len(res)
+		res = append(res, arr[i])
 	}
 
-	return arr, nil
+	return res
 }
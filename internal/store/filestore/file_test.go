@@ -1,29 +1,36 @@
 package filestore
 
 import (
+	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/stretchr/testify/assert"
 )
 
-func TestFile(t *testing.T) {
-	fileName := "temp.json"
-
-	file := NewFile(fileName)
+func openFile(t *testing.T, path string) *File {
+	t.Helper()
 
+	file := NewFile(path, SyncAlways, 0, slog.Default())
 	if err := file.Open(); err != nil {
-		t.Errorf("file open err %v\n", err)
+		t.Fatalf("file open err %v\n", err)
 	}
 
+	return file
+}
+
+func TestFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "temp.json")
+
+	file := openFile(t, fileName)
+
 	t.Cleanup(func() {
 		if err := file.Close(); err != nil {
 			t.Errorf("err close file: %v\n", err)
 		}
-
-		if err := os.Remove(fileName); err != nil {
-			t.Errorf("err remove file: %v\n", err)
-		}
 	})
 
 	t.Run("write metric", func(t *testing.T) {
@@ -33,21 +40,187 @@ func TestFile(t *testing.T) {
 		}
 	})
 
-	var (
-		batch []model.Metric
-		err   error
-	)
+	t.Run("write batch", func(t *testing.T) {
+		batch := []model.Metric{
+			model.NewCounterMetric("Counter-1", 30),
+			model.NewGaugeMetric("Gauge-1", 10.01),
+		}
+
+		if err := file.WriteBatch(batch); err != nil {
+			t.Errorf("write batch err %v\n", err)
+		}
+	})
+
+	t.Run("read batch last wins", func(t *testing.T) {
+		batch, err := file.ReadBatch()
+		if assert.NoError(t, err) {
+			assert.Equal(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 30),
+					model.NewGaugeMetric("Gauge-1", 10.01),
+				},
+				batch,
+			)
+		}
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		snap := []model.Metric{
+			model.NewCounterMetric("Counter-1", 30),
+			model.NewGaugeMetric("Gauge-1", 10.01),
+		}
 
-	t.Run("read batch", func(t *testing.T) {
-		batch, err = file.ReadBatch()
+		if err := file.Compact(snap); err != nil {
+			t.Fatalf("compact err %v\n", err)
+		}
+
+		assert.Equal(t, int64(0), file.Size())
+
+		if err := file.WriteMetric(model.NewGaugeMetric("Gauge-1", 20.02)); err != nil {
+			t.Fatalf("write metric err %v\n", err)
+		}
+
+		batch, err := file.ReadBatch()
+		if assert.NoError(t, err) {
+			assert.Equal(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 30),
+					model.NewGaugeMetric("Gauge-1", 20.02),
+				},
+				batch,
+			)
+		}
+	})
+}
+
+func TestFileRecovery(t *testing.T) {
+	t.Run("truncated tail", func(t *testing.T) {
+		fileName := filepath.Join(t.TempDir(), "temp.json")
+
+		file := openFile(t, fileName)
+		if err := file.WriteMetric(model.NewCounterMetric("Counter-1", 10)); err != nil {
+			t.Fatalf("write metric err %v\n", err)
+		}
+
+		size := file.Size()
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("close err %v\n", err)
+		}
+
+		// имитация сбоя во время записи
+		torn, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
-			t.Errorf("read batch err %v\n", err)
+			t.Fatal(err)
+		}
+
+		if _, err := torn.WriteString(`0badc0de {"mName":"Coun`); err != nil {
+			t.Fatal(err)
+		}
+
+		torn.Close()
+
+		file = openFile(t, fileName)
+		defer file.Close()
+
+		assert.Equal(t, size, file.Size())
+
+		if err := file.WriteMetric(model.NewGaugeMetric("Gauge-1", 10.01)); err != nil {
+			t.Fatalf("write metric err %v\n", err)
+		}
+
+		batch, err := file.ReadBatch()
+		if assert.NoError(t, err) {
+			assert.Equal(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 10),
+					model.NewGaugeMetric("Gauge-1", 10.01),
+				},
+				batch,
+			)
 		}
 	})
 
-	t.Run("write batch", func(t *testing.T) {
-		if err := file.WriteBatch(batch); err != nil {
-			t.Errorf("write batch err %v\n", err)
+	t.Run("corrupted record", func(t *testing.T) {
+		fileName := filepath.Join(t.TempDir(), "temp.json")
+
+		data := "00000000 {\"mName\":\"Counter-1\",\"mType\":0,\"mDelta\":10}\n" +
+			"{\"mName\":\"Gauge-1\",\"mType\":1,\"mVal\":10.01}\n"
+
+		if err := os.WriteFile(fileName, []byte(data), 0666); err != nil {
+			t.Fatal(err)
 		}
+
+		file := NewFile(fileName, SyncAlways, 0, slog.Default())
+		assert.ErrorIs(t, file.Open(), errCorrupted)
 	})
+
+	t.Run("legacy records", func(t *testing.T) {
+		fileName := filepath.Join(t.TempDir(), "temp.json")
+
+		data := "{\"mName\":\"Counter-1\",\"mType\":0,\"mDelta\":10}\n" +
+			"{\"mName\":\"Gauge-1\",\"mType\":1,\"mVal\":10.01}\n"
+
+		if err := os.WriteFile(fileName, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		file := openFile(t, fileName)
+		defer file.Close()
+
+		batch, err := file.ReadBatch()
+		if assert.NoError(t, err) {
+			assert.Equal(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 10),
+					model.NewGaugeMetric("Gauge-1", 10.01),
+				},
+				batch,
+			)
+		}
+	})
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, str := range []string{"always", "interval", "none"} {
+		policy, err := ParseSyncPolicy(str)
+		if assert.NoError(t, err) {
+			assert.Equal(t, SyncPolicy(str), policy)
+		}
+	}
+
+	policy, err := ParseSyncPolicy("")
+	if assert.NoError(t, err) {
+		assert.Equal(t, SyncAlways, policy)
+	}
+
+	_, err = ParseSyncPolicy("sometimes")
+	assert.ErrorIs(t, err, ErrSyncPolicy)
+}
+
+func TestFileSyncInterval(t *testing.T) {
+	file := NewFile(filepath.Join(t.TempDir(), "temp.json"), SyncInterval, 0, slog.Default())
+	file.interval = 10 * time.Millisecond
+
+	if err := file.Open(); err != nil {
+		t.Fatalf("file open err %v\n", err)
+	}
+
+	t.Cleanup(func() {
+		if err := file.Close(); err != nil {
+			t.Errorf("err close file: %v\n", err)
+		}
+	})
+
+	if err := file.WriteMetric(model.NewCounterMetric("Counter-1", 10)); err != nil {
+		t.Fatalf("write metric err %v\n", err)
+	}
+
+	// запись сразу после Open не сбрасывается, ее сбрасывает таймер
+	assert.Eventually(t, func() bool {
+		file.mu.Lock()
+		defer file.mu.Unlock()
+
+		return !file.dirty
+	}, time.Second, file.interval)
 }
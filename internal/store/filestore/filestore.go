@@ -1,17 +1,36 @@
 // Реализация сохрениения метрик в файл синхронно либо по интервалу StoreInt для storage.
+// В синхронном режиме каждое изменение добавляется в журнал (WAL),
+// который сжимается в снимок при превышении CompactSize.
+// В режиме по интервалу в снимок сохраняется полное состояние storage.
+// Хранятся SnapshotKeep предыдущих поколений снимка: если текущий снимок
+// поврежден, состояние восстанавливается из предыдущего.
+//
+// При ExternalJob периодическое сохранение не запускается хранилищем:
+// задачу из Jobs запускает вызывающая сторона, например только на лидере
+// среди реплик.
+//
+// При ReadOnly сохраненное состояние только читается: файлы не изменяются,
+// в том числе при остановке, а изменения метрик возвращают ErrReadOnly.
 package filestore
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"github.com/AndreyVLZ/metrics/internal/lease"
 	"github.com/AndreyVLZ/metrics/internal/model"
 )
 
 const NameConst = "file store"
 
+const CompactSizeDefault int64 = 4 << 20 // Размер журнала по умолчанию, после которого он сжимается в снимок.
+
+// ErrReadOnly хранилище открыто только для чтения.
+var ErrReadOnly = errors.New("file store is read-only")
+
 type storage interface {
 	Get(ctx context.Context, mInfo model.Info) (model.Metric, error)
 	Update(ctx context.Context, met model.Metric) (model.Metric, error)
@@ -22,15 +41,24 @@ type storage interface {
 }
 
 type Config struct {
-	StorePath string
-	IsRestore bool
-	StoreInt  time.Duration
+	StorePath    string
+	SyncPolicy   SyncPolicy
+	IsRestore    bool
+	StoreInt     time.Duration
+	CompactSize  int64
+	SnapshotKeep int
+	ExternalJob  bool
+	ReadOnly     bool
+	Log          *slog.Logger // nil - slog.Default()
 }
 
 type iFile interface {
 	WriteMetric(met model.Metric) error
 	WriteBatch(arr []model.Metric) error
 	ReadBatch() ([]model.Metric, error)
+	Read() ([]model.Metric, error)
+	Compact(arr []model.Metric) error
+	Size() int64
 	Open() error
 	Close() error
 }
@@ -38,24 +66,49 @@ type iFile interface {
 type FileStore struct {
 	storage
 	file     iFile
-	exit     chan struct{}
+	job      *SnapshotJob
 	cfg      Config
 	isDeamon bool
 }
 
 func New(cfg Config, store storage) *FileStore {
-	return &FileStore{
+	if cfg.CompactSize <= 0 {
+		cfg.CompactSize = CompactSizeDefault
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = slog.Default()
+	}
+
+	fs := &FileStore{
 		cfg:      cfg,
-		file:     NewFile(cfg.StorePath),
+		file:     NewFile(cfg.StorePath, cfg.SyncPolicy, cfg.SnapshotKeep, cfg.Log),
 		storage:  store,
 		isDeamon: false,
-		exit:     make(chan struct{}),
 	}
+
+	fs.job = &SnapshotJob{fs: fs}
+
+	return fs
 }
 
-func (fs FileStore) Name() string { return NameConst }
+func (fs *FileStore) Name() string { return NameConst }
+func (fs *FileStore) Ping() error  { return nil }
+
+// Jobs возвращает задачи, которые запускает вызывающая сторона (ExternalJob).
+func (fs *FileStore) Jobs() []lease.Service {
+	if !fs.cfg.ExternalJob || fs.cfg.StoreInt == 0 {
+		return nil
+	}
+
+	return []lease.Service{fs.job}
+}
 
 func (fs *FileStore) Start(ctx context.Context) error {
+	if fs.cfg.ReadOnly {
+		return fs.startReadOnly(ctx)
+	}
+
 	if err := fs.file.Open(); err != nil {
 		return fmt.Errorf("file Open: %w", err)
 	}
@@ -73,10 +126,13 @@ func (fs *FileStore) Start(ctx context.Context) error {
 		if err := fs.storage.AddBatch(ctx, batch); err != nil {
 			return fmt.Errorf("%w", err)
 		}
+	} else if err := fs.file.Compact(nil); err != nil {
+		// сохраненное ранее состояние не используется
+		return fmt.Errorf("%w", err)
 	}
 
 	if fs.cfg.StoreInt == 0 {
-		fs.storage = newWrapStore(fs.file, fs.storage)
+		fs.storage = newWrapStore(fs.file, fs.storage, fs.cfg.CompactSize, fs.cfg.Log)
 
 		fmt.Printf("run as synchro\n")
 
@@ -84,20 +140,73 @@ func (fs *FileStore) Start(ctx context.Context) error {
 	}
 
 	fs.isDeamon = true
-	go fs.run(ctx)
 
 	fmt.Printf("run as deamon\n")
 
+	if fs.cfg.ExternalJob {
+		return nil
+	}
+
+	return fs.job.Start(ctx)
+}
+
+// startReadOnly загружает сохраненное состояние, не открывая журнал на запись.
+func (fs *FileStore) startReadOnly(ctx context.Context) error {
+	if err := fs.storage.Start(ctx); err != nil {
+		return fmt.Errorf("store Start: %w", err)
+	}
+
+	batch, err := fs.file.Read()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err := fs.storage.AddBatch(ctx, batch); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
 	return nil
 }
 
+// Update изменяет метрику. При ReadOnly - ErrReadOnly.
+func (fs *FileStore) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
+	if fs.cfg.ReadOnly {
+		return model.Metric{}, ErrReadOnly
+	}
+
+	return fs.storage.Update(ctx, met)
+}
+
+// AddBatch добавляет срез метрик. При ReadOnly - ErrReadOnly.
+func (fs *FileStore) AddBatch(ctx context.Context, arr []model.Metric) error {
+	if fs.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+
+	return fs.storage.AddBatch(ctx, arr)
+}
+
+// Stop сохраняет состояние и закрывает файл.
+// При ExternalJob последнее сохранение выполняет задача при остановке.
+// При ReadOnly файлы не изменяются.
 func (fs *FileStore) Stop(ctx context.Context) error {
-	if fs.isDeamon {
-		<-fs.exit
+	if fs.cfg.ReadOnly {
+		if err := fs.storage.Stop(ctx); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		return nil
 	}
 
-	if err := saved(ctx, fs.storage, fs.file); err != nil {
-		return fmt.Errorf("%w", err)
+	switch {
+	case !fs.isDeamon:
+		if err := saved(ctx, fs.storage, fs.file); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	case !fs.cfg.ExternalJob:
+		if err := fs.job.Stop(ctx); err != nil {
+			return fmt.Errorf("%w", err)
+		}
 	}
 
 	if err := fs.file.Close(); err != nil {
@@ -111,26 +220,55 @@ func (fs *FileStore) Stop(ctx context.Context) error {
 	return nil
 }
 
-func (fs *FileStore) run(ctx context.Context) {
+// SnapshotJob периодически сохраняет полное состояние хранилища в снимок.
+// При остановке состояние сохраняется последний раз.
+type SnapshotJob struct {
+	fs   *FileStore
+	exit chan struct{} // закрывается при завершении фонового сохранения
+	stop chan struct{} // закрывается при остановке задачи
+}
+
+func (job *SnapshotJob) Name() string { return "file snapshot" }
+
+func (job *SnapshotJob) Start(ctx context.Context) error {
+	job.exit = make(chan struct{})
+	job.stop = make(chan struct{})
+
+	go job.run(ctx)
+
+	return nil
+}
+
+func (job *SnapshotJob) Stop(ctx context.Context) error {
+	close(job.stop)
+	<-job.exit
+
+	return saved(ctx, job.fs.storage, job.fs.file)
+}
+
+func (job *SnapshotJob) run(ctx context.Context) {
+	defer close(job.exit)
+
 	for {
 		select {
-		case <-time.After(fs.cfg.StoreInt):
-			if err := saved(ctx, fs.storage, fs.file); err != nil {
-				log.Printf("err save metrics %v\n", err)
+		case <-time.After(job.fs.cfg.StoreInt):
+			if err := saved(ctx, job.fs.storage, job.fs.file); err != nil {
+				job.fs.cfg.Log.ErrorContext(ctx, "save metrics", slog.String("error", err.Error()))
 			}
 		case <-ctx.Done():
-			fs.exit <- struct{}{}
-
+			return
+		case <-job.stop:
 			return
 		}
 	}
 }
 
+// saved сохраняет полное состояние store в снимок и усекает журнал.
 func saved(ctx context.Context, store storage, file iFile) error {
 	batch, err := store.List(ctx)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	return file.WriteBatch(batch)
+	return file.Compact(batch)
 }
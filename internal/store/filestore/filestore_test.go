@@ -2,10 +2,17 @@ package filestore
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/AndreyVLZ/metrics/internal/store/storetest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,10 +67,25 @@ func (sf *spyFile) WriteBatch(arr []model.Metric) error {
 	return nil
 }
 
+func (sf *spyFile) Compact(arr []model.Metric) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	sf.arr = arr
+
+	return sf.err
+}
+
+func (sf *spyFile) Size() int64 { return 0 }
+
 func (sf *spyFile) ReadBatch() ([]model.Metric, error) {
 	return sf.arr, sf.err
 }
 
+func (sf *spyFile) Read() ([]model.Metric, error) {
+	return sf.arr, sf.err
+}
+
 func (sf *spyFile) Open() error {
 	return sf.err
 }
@@ -165,3 +187,169 @@ func TestFileStoreStop(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, wantArr, spyFile.arr)
 }
+
+func TestFileStoreRestore(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := Config{
+		StorePath:   filepath.Join(t.TempDir(), "testFileStore.json"),
+		IsRestore:   true,
+		StoreInt:    0,
+		SyncPolicy:  SyncAlways,
+		CompactSize: 256,
+	}
+
+	fileStore := New(cfg, inmemory.New())
+	if err := fileStore.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		arr := []model.Metric{
+			model.NewCounterMetric("Counter-1", 10),
+			model.NewGaugeMetric("Gauge-1", float64(i)),
+		}
+
+		if err := fileStore.AddBatch(ctx, arr); err != nil {
+			t.Fatalf("addBatch: %v\n", err)
+		}
+	}
+
+	// журнал сжимался в снимок при превышении CompactSize
+	assert.Less(t, fileStore.file.Size(), cfg.CompactSize)
+
+	if err := fileStore.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v\n", err)
+	}
+
+	fileStore = New(cfg, inmemory.New())
+	if err := fileStore.Start(ctx); err != nil {
+		t.Fatalf("restart: %v\n", err)
+	}
+	defer fileStore.Stop(ctx)
+
+	list, err := fileStore.List(ctx)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t,
+			[]model.Metric{
+				model.NewCounterMetric("Counter-1", 100),
+				model.NewGaugeMetric("Gauge-1", 9),
+			},
+			list,
+		)
+	}
+}
+
+func TestFileStoreReadOnly(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "testFileStore.json")
+
+	// живое хранилище: часть состояния в снимке, часть - в журнале
+	live := New(Config{StorePath: path, IsRestore: true}, inmemory.New())
+	if err := live.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	if err := live.AddBatch(ctx, []model.Metric{model.NewCounterMetric("Counter-1", 10)}); err != nil {
+		t.Fatalf("add batch: %v\n", err)
+	}
+
+	if err := live.file.Compact([]model.Metric{model.NewCounterMetric("Counter-1", 10)}); err != nil {
+		t.Fatalf("compact: %v\n", err)
+	}
+
+	if _, err := live.Update(ctx, model.NewGaugeMetric("Gauge-1", 1.5)); err != nil {
+		t.Fatalf("update: %v\n", err)
+	}
+
+	files := func() [2]string {
+		var res [2]string
+
+		for i, name := range []string{path, path + snapSuffixConst} {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatalf("read file: %v\n", err)
+			}
+
+			res[i] = string(data)
+		}
+
+		return res
+	}
+
+	before := files()
+
+	readOnly := New(Config{StorePath: path, ReadOnly: true}, inmemory.New())
+	if err := readOnly.Start(ctx); err != nil {
+		t.Fatalf("start read-only: %v\n", err)
+	}
+
+	list, err := readOnly.List(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []model.Metric{
+		model.NewCounterMetric("Counter-1", 10),
+		model.NewGaugeMetric("Gauge-1", 1.5),
+	}, list)
+
+	assert.ErrorIs(t, readOnly.AddBatch(ctx, list), ErrReadOnly)
+
+	_, err = readOnly.Update(ctx, model.NewGaugeMetric("Gauge-1", 2))
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	assert.NoError(t, readOnly.Stop(ctx))
+	assert.Equal(t, before, files())
+
+	assert.NoError(t, live.Stop(ctx))
+
+	t.Run("no files", func(t *testing.T) {
+		empty := New(Config{StorePath: filepath.Join(t.TempDir(), "none.json"), ReadOnly: true}, inmemory.New())
+		if assert.NoError(t, empty.Start(ctx)) {
+			list, err := empty.List(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, list)
+			assert.NoError(t, empty.Stop(ctx))
+		}
+	})
+}
+
+func TestConformance(t *testing.T) {
+	factory := func(storeInt time.Duration) storetest.Factory {
+		return func(t *testing.T) (storetest.Storage, func() storetest.Storage) {
+			cfg := Config{
+				StorePath:    filepath.Join(t.TempDir(), "testFileStore.json"),
+				IsRestore:    true,
+				StoreInt:     storeInt,
+				SyncPolicy:   SyncAlways,
+				CompactSize:  1024,
+				SnapshotKeep: 1,
+			}
+
+			return New(cfg, inmemory.New()), func() storetest.Storage { return New(cfg, inmemory.New()) }
+		}
+	}
+
+	t.Run("synchro", func(t *testing.T) { storetest.Run(t, factory(0)) })
+	t.Run("deamon", func(t *testing.T) { storetest.Run(t, factory(time.Hour)) })
+}
+
+// errFile журнал, запись в который завершается ошибкой.
+type errFile struct {
+	iFile
+	err error
+}
+
+func (ef errFile) WriteMetric(_ model.Metric) error  { return ef.err }
+func (ef errFile) WriteBatch(_ []model.Metric) error { return ef.err }
+func (ef errFile) Size() int64                       { return 0 }
+
+func TestWrapStoreFileErr(t *testing.T) {
+	ctx := context.Background()
+	errWrite := errors.New("write err")
+	ws := newWrapStore(errFile{err: errWrite}, inmemory.New(), CompactSizeDefault, slog.Default())
+
+	_, err := ws.Update(ctx, model.NewCounterMetric("Counter-1", 1))
+	assert.ErrorIs(t, err, errWrite)
+
+	err = ws.AddBatch(ctx, []model.Metric{model.NewGaugeMetric("Gauge-1", 1)})
+	assert.ErrorIs(t, err, errWrite)
+}
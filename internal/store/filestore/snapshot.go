@@ -0,0 +1,162 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+// snapshot файл снимка полного состояния и его предыдущие поколения.
+// Текущий снимок хранится в path, предыдущие - в path.1 ... path.keep
+// (чем больше номер, тем старше снимок).
+type snapshot struct {
+	log  *slog.Logger
+	path string
+	keep int
+}
+
+func newSnapshot(path string, keep int, log *slog.Logger) snapshot {
+	return snapshot{path: path, keep: keep, log: log}
+}
+
+// generation возвращает имя файла поколения n. Поколение 0 - текущий снимок.
+func (s snapshot) generation(n int) string {
+	if n == 0 {
+		return s.path
+	}
+
+	return s.path + "." + strconv.Itoa(n)
+}
+
+// write записывает снимок во временный файл и сбрасывает его на диск,
+// сдвигает предыдущие поколения и атомарно переименовывает временный файл
+// в текущий снимок. После переименования на диск сбрасывается директория,
+// чтобы переименование пережило сбой.
+func (s snapshot) write(arr []model.Metric) error {
+	var buf bytes.Buffer
+
+	for i := range arr {
+		if err := encodeRecord(&buf, arr[i]); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	tmpPath := s.path + tmpSuffixConst
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if _, err := buf.WriteTo(file); err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err := s.rotate(); err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return syncDir(filepath.Dir(s.path))
+}
+
+// rotate сдвигает поколения снимков на одно: самое старое удаляется.
+func (s snapshot) rotate() error {
+	for n := s.keep; n > 0; n-- {
+		err := os.Rename(s.generation(n-1), s.generation(n))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	return nil
+}
+
+// read читает самый свежий целый снимок.
+// Поврежденный снимок пропускается и читается предыдущее поколение.
+// Отсутствие снимков не является ошибкой.
+// Ошибка возвращается, если все существующие поколения повреждены.
+func (s snapshot) read() ([]model.Metric, error) {
+	var errs []error
+
+	for n := 0; n <= s.keep; n++ {
+		arr, err := readSnapshot(s.generation(n))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			errs = append(errs, fmt.Errorf("[%s]: %w", s.generation(n), err))
+
+			continue
+		}
+
+		if len(errs) > 0 {
+			s.log.Warn("snapshot rollback",
+				slog.String("path", s.generation(n)),
+				slog.String("error", errors.Join(errs...).Error()),
+			)
+		}
+
+		return arr, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// readSnapshot читает файл снимка.
+// Снимок пишется атомарно, поэтому любая поврежденная запись - ошибка.
+func readSnapshot(path string) ([]model.Metric, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer file.Close()
+
+	arr, valid, err := readRecords(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if info.Size() != valid {
+		return nil, fmt.Errorf("%w: snapshot offset %d", errCorrupted, valid)
+	}
+
+	return arr, nil
+}
+
+// syncDir сбрасывает на диск содержимое директории.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("sync dir: %w", err), file.Close())
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,174 @@
+package filestore
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotGenerations(t *testing.T) {
+	snap := newSnapshot(filepath.Join(t.TempDir(), "temp.json.snap"), 2, slog.Default())
+
+	for i := 1; i <= 4; i++ {
+		arr := []model.Metric{model.NewCounterMetric("Counter-1", int64(i))}
+		if err := snap.write(arr); err != nil {
+			t.Fatalf("write snapshot: %v\n", err)
+		}
+	}
+
+	t.Run("keep generations", func(t *testing.T) {
+		for n, want := range []int64{4, 3, 2} {
+			arr, err := readSnapshot(snap.generation(n))
+			if assert.NoError(t, err) {
+				assert.Equal(t, []model.Metric{model.NewCounterMetric("Counter-1", want)}, arr)
+			}
+		}
+
+		_, err := os.Stat(snap.generation(3))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = os.Stat(snap.path + tmpSuffixConst)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("rollback corrupted", func(t *testing.T) {
+		if err := os.WriteFile(snap.generation(0), []byte("broken\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		arr, err := snap.read()
+		if assert.NoError(t, err) {
+			assert.Equal(t, []model.Metric{model.NewCounterMetric("Counter-1", 3)}, arr)
+		}
+	})
+
+	t.Run("rollback missing", func(t *testing.T) {
+		// сбой между сдвигом поколений и переименованием нового снимка
+		if err := os.Remove(snap.generation(0)); err != nil {
+			t.Fatal(err)
+		}
+
+		arr, err := snap.read()
+		if assert.NoError(t, err) {
+			assert.Equal(t, []model.Metric{model.NewCounterMetric("Counter-1", 3)}, arr)
+		}
+	})
+
+	t.Run("all corrupted", func(t *testing.T) {
+		for n := 0; n <= snap.keep; n++ {
+			if err := os.WriteFile(snap.generation(n), []byte("broken\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err := snap.read()
+		assert.ErrorIs(t, err, errCorrupted)
+	})
+}
+
+func TestFileStoreDeamonSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := Config{
+		StorePath:    filepath.Join(t.TempDir(), "testFileStore.json"),
+		IsRestore:    true,
+		StoreInt:     50 * time.Millisecond,
+		SnapshotKeep: 2,
+	}
+
+	ctxRun, cancelRun := context.WithCancel(ctx)
+
+	fileStore := New(cfg, inmemory.New())
+	if err := fileStore.Start(ctxRun); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := fileStore.Update(ctx, model.NewCounterMetric("Counter-1", 10)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+
+		time.Sleep(2 * cfg.StoreInt)
+	}
+
+	cancelRun()
+
+	if err := fileStore.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v\n", err)
+	}
+
+	// в режиме по интервалу журнал не растет
+	info, err := os.Stat(cfg.StorePath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), info.Size())
+	}
+
+	fileStore = New(cfg, inmemory.New())
+	if err := fileStore.Start(ctx); err != nil {
+		t.Fatalf("restart: %v\n", err)
+	}
+
+	list, err := fileStore.List(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []model.Metric{model.NewCounterMetric("Counter-1", 30)}, list)
+	}
+}
+
+func TestFileStoreExternalJob(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := Config{
+		StorePath:   filepath.Join(t.TempDir(), "testFileStore.json"),
+		IsRestore:   true,
+		StoreInt:    20 * time.Millisecond,
+		ExternalJob: true,
+	}
+
+	fileStore := New(cfg, inmemory.New())
+	if err := fileStore.Start(ctx); err != nil {
+		t.Fatalf("start: %v\n", err)
+	}
+
+	if _, err := fileStore.Update(ctx, model.NewCounterMetric("Counter-1", 10)); err != nil {
+		t.Fatalf("update: %v\n", err)
+	}
+
+	jobs := fileStore.Jobs()
+	if !assert.Len(t, jobs, 1) {
+		return
+	}
+
+	// без запущенной задачи снимок не сохраняется
+	time.Sleep(3 * cfg.StoreInt)
+
+	_, err := os.Stat(fileStore.cfg.StorePath + snapSuffixConst)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// задача допускает повторный запуск
+	for i := 0; i < 2; i++ {
+		if err := jobs[0].Start(ctx); err != nil {
+			t.Fatalf("start job: %v\n", err)
+		}
+
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(fileStore.cfg.StorePath + snapSuffixConst)
+
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		assert.NoError(t, jobs[0].Stop(ctx))
+	}
+
+	if err := fileStore.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v\n", err)
+	}
+
+	assert.Nil(t, New(Config{StoreInt: time.Second}, inmemory.New()).Jobs())
+}
@@ -3,44 +3,87 @@ package filestore
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
 )
 
+// wrapStore синхронно записывает в журнал текущие значения изменённых метрик.
+// Изменение storage и запись в журнал выполняются под одной блокировкой,
+// чтобы порядок записей в журнале совпадал с порядком изменений.
 type wrapStore struct {
 	file iFile
 	storage
+	log         *slog.Logger
+	compactSize int64
+	mu          sync.Mutex
 }
 
-func newWrapStore(file iFile, s storage) *wrapStore {
+func newWrapStore(file iFile, s storage, compactSize int64, log *slog.Logger) *wrapStore {
 	return &wrapStore{
-		file:    file,
-		storage: s,
+		log:         log,
+		file:        file,
+		storage:     s,
+		compactSize: compactSize,
 	}
 }
 
 func (ws *wrapStore) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
 	metDB, err := ws.storage.Update(ctx, met)
 	if err != nil {
 		return model.Metric{}, fmt.Errorf("%w", err)
 	}
 
+	// без записи в журнал изменение не сохранено: клиент получает ошибку
 	if err := ws.file.WriteMetric(metDB); err != nil {
-		log.Printf("err write metric in file: %v\n", err)
+		return model.Metric{}, fmt.Errorf("write metric in file: %w", err)
 	}
 
+	ws.compact(ctx)
+
 	return metDB, nil
 }
 
 func (ws *wrapStore) AddBatch(ctx context.Context, arr []model.Metric) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
 	if err := ws.storage.AddBatch(ctx, arr); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	if err := ws.file.WriteBatch(arr); err != nil {
-		log.Printf("err writeBatch in file: %v\n", err)
+	// в журнал пишутся итоговые значения, а не переданные приращения
+	batch := make([]model.Metric, 0, len(arr))
+
+	for i := range arr {
+		metDB, err := ws.storage.Get(ctx, arr[i].Info)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		batch = append(batch, metDB)
+	}
+
+	if err := ws.file.WriteBatch(batch); err != nil {
+		return fmt.Errorf("writeBatch in file: %w", err)
 	}
 
+	ws.compact(ctx)
+
 	return nil
 }
+
+// compact сжимает журнал в снимок, если его размер превысил compactSize.
+func (ws *wrapStore) compact(ctx context.Context) {
+	if ws.file.Size() < ws.compactSize {
+		return
+	}
+
+	if err := saved(ctx, ws.storage, ws.file); err != nil {
+		ws.log.ErrorContext(ctx, "compact file", slog.String("error", err.Error()))
+	}
+}
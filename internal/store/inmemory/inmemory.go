@@ -2,16 +2,20 @@ package inmemory
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
 )
 
-const NameConst = "in memory"
-
-var errNotFind = errors.New("not find")
+const (
+	NameConst         = "in memory"
+	shardCountDefault = 32 // Кол-во шардов по умолчанию.
+	hashOffsetConst   = 2166136261
+	hashPrimeConst    = 16777619
+)
 
 type Storager interface {
 	Get(ctx context.Context, mInfo model.Info) (model.Metric, error)
@@ -20,39 +24,101 @@ type Storager interface {
 	AddBatch(ctx context.Context, arr []model.Metric) error
 }
 
+// shard часть хранилища со своей блокировкой.
+// snap - срез метрик шарда, собранный при последнем List.
+// Любая запись в шард сбрасывает snap, поэтому при редких записях
+// List не обходит map заново. Снимок может сохранить любой из читателей,
+// держащих блокировку на чтение, поэтому он хранится в atomic.Pointer.
+type shard struct {
+	store map[model.Info]model.Metric
+	snap  atomic.Pointer[[]model.Metric]
+	mu    sync.RWMutex
+}
+
+// MemStore хранилище метрик в памяти.
+// Метрики распределены по шардам по хэшу имени и типа,
+// поэтому писатели разных метрик не блокируют друг друга.
 type MemStore struct {
-	store map[model.Info]model.Value
-	mu    sync.Mutex
+	shards []shard
 }
 
 func New() *MemStore {
-	return &MemStore{
-		store: make(map[model.Info]model.Value),
+	return newWithShards(shardCountDefault)
+}
+
+// newWithShards возвращает хранилище с n шардами.
+func newWithShards(n int) *MemStore {
+	if n < 1 {
+		n = 1
 	}
+
+	shards := make([]shard, n)
+	for i := range shards {
+		shards[i].store = make(map[model.Info]model.Metric)
+	}
+
+	return &MemStore{shards: shards}
 }
 
 func (s *MemStore) Start(_ context.Context) error { return nil }
 func (s *MemStore) Stop(_ context.Context) error  { return nil }
 func (s *MemStore) Name() string                  { return NameConst }
 
+// List возвращает срез всех метрик.
+// Блокировка на чтение каждого шарда держится только на время получения
+// его снимка. Снимок согласован в пределах шарда.
 func (s *MemStore) List(_ context.Context) ([]model.Metric, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	snaps := make([][]model.Metric, len(s.shards))
+	total := 0
 
-	arr := make([]model.Metric, 0, len(s.store))
-	for mInfo, mVal := range s.store {
-		arr = append(arr, model.Metric{Info: mInfo, Value: mVal})
+	for i := range s.shards {
+		snaps[i] = s.shards[i].snapshot()
+		total += len(snaps[i])
+	}
+
+	arr := make([]model.Metric, 0, total)
+	for i := range snaps {
+		arr = append(arr, snaps[i]...)
 	}
 
 	return arr, nil
 }
 
+// AddBatch добавляет метрики пакета, блокируя шарды по одному:
+// метрики пакета упорядочиваются по шардам, и каждый шард блокируется один раз.
+// Порядок метрик внутри одного шарда сохраняется.
 func (s *MemStore) AddBatch(_ context.Context, arr []model.Metric) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if len(arr) == 0 {
+		return nil
+	}
+
+	// сортировка подсчетом номеров метрик по шардам
+	shardIdx := make([]int, len(arr))
+	start := make([]int, len(s.shards)+1)
+
+	for i := range arr {
+		shardIdx[i] = s.shardIndex(arr[i].Info)
+		start[shardIdx[i]+1]++
+	}
+
+	for i := 1; i < len(start); i++ {
+		start[i] += start[i-1]
+	}
+
+	order := make([]int, len(arr))
+	pos := append([]int(nil), start[:len(s.shards)]...)
 
 	for i := range arr {
-		if _, err := s.update(arr[i]); err != nil {
+		order[pos[shardIdx[i]]] = i
+		pos[shardIdx[i]]++
+	}
+
+	for idx := range s.shards {
+		if start[idx] == start[idx+1] {
+			continue
+		}
+
+		if err := s.shards[idx].updateBatch(arr, order[start[idx]:start[idx+1]]); err != nil {
 			return err
 		}
 	}
@@ -61,48 +127,103 @@ func (s *MemStore) AddBatch(_ context.Context, arr []model.Metric) error {
 }
 
 func (s *MemStore) Get(_ context.Context, mInfo model.Info) (model.Metric, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := &s.shards[s.shardIndex(mInfo)]
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
 
-	met, ok := s.get(mInfo)
+	met, ok := sh.get(mInfo)
 	if !ok {
-		return model.Metric{}, errNotFind
+		return model.Metric{}, serr.ErrNotFound
 	}
 
 	return met, nil
 }
 
 func (s *MemStore) Update(_ context.Context, met model.Metric) (model.Metric, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := &s.shards[s.shardIndex(met.Info)]
 
-	return s.update(met)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	return sh.update(met)
 }
 
-func (s *MemStore) get(mInfo model.Info) (model.Metric, bool) {
-	val, ok := s.store[mInfo]
-	if !ok {
-		return model.Metric{}, false
+// shardIndex возвращает номер шарда метрики (FNV-1a от имени и типа).
+func (s *MemStore) shardIndex(mInfo model.Info) int {
+	if len(s.shards) == 1 {
+		return 0
+	}
+
+	hash := uint32(hashOffsetConst)
+	for i := 0; i < len(mInfo.MName); i++ {
+		hash ^= uint32(mInfo.MName[i])
+		hash *= hashPrimeConst
+	}
+
+	hash ^= uint32(uint8(mInfo.MType))
+	hash *= hashPrimeConst
+
+	return int(hash % uint32(len(s.shards)))
+}
+
+// snapshot возвращает срез метрик шарда. Срез не изменяется после создания.
+// Снимок собирается и сохраняется под блокировкой на чтение:
+// писатель не может сбросить его, пока он не сохранен.
+func (sh *shard) snapshot() []model.Metric {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	if snap := sh.snap.Load(); snap != nil {
+		return *snap
+	}
+
+	snap := make([]model.Metric, 0, len(sh.store))
+	for _, met := range sh.store {
+		snap = append(snap, met)
 	}
 
-	return model.Metric{Info: mInfo, Value: val}, true
+	sh.snap.Store(&snap)
+
+	return snap
+}
+
+// updateBatch обновляет метрики arr с индексами idxs под одной блокировкой.
+func (sh *shard) updateBatch(arr []model.Metric, idxs []int) error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	for _, i := range idxs {
+		if _, err := sh.update(arr[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sh *shard) get(mInfo model.Info) (model.Metric, bool) {
+	met, ok := sh.store[mInfo]
+
+	return met, ok
 }
 
-func (s *MemStore) update(met model.Metric) (model.Metric, error) {
-	mDB, ok := s.get(met.Info)
+func (sh *shard) update(met model.Metric) (model.Metric, error) {
+	mDB, ok := sh.get(met.Info)
 	if !ok {
-		return s.set(met)
+		return sh.set(met)
 	}
 
-	if err := mDB.Update(met.Value); err != nil {
+	if err := mDB.Merge(met); err != nil {
 		return model.Metric{}, fmt.Errorf("%w", err)
 	}
 
-	return s.set(mDB)
+	return sh.set(mDB)
 }
 
-func (s *MemStore) set(met model.Metric) (model.Metric, error) {
-	s.store[met.Info] = met.Value
+func (sh *shard) set(met model.Metric) (model.Metric, error) {
+	sh.store[met.Info] = met
+	sh.snap.Store(nil)
 
 	return met, nil
 }
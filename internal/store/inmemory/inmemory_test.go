@@ -2,9 +2,15 @@ package inmemory
 
 import (
 	"context"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/internal/store/storetest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,12 +93,12 @@ func TestMemStore(t *testing.T) {
 		}
 	})
 
-	t.Run("get_errNotFind", func(t *testing.T) {
+	t.Run("get_serr.ErrNotFound", func(t *testing.T) {
 		mem := New()
 		info := model.Info{MName: "MOM", MType: model.TypeCountConst}
 
 		_, err := mem.Get(ctx, info)
-		assert.Equal(t, errNotFind, err)
+		assert.Equal(t, serr.ErrNotFound, err)
 	})
 }
 
@@ -150,3 +156,174 @@ func BenchmarkMemStoreList(b *testing.B) {
 		mem.List(ctx)
 	}
 }
+
+func TestMemStoreShards(t *testing.T) {
+	ctx := context.Background()
+	mem := New()
+
+	arr := make([]model.Metric, 0, 100)
+	for i := 0; i < 100; i++ {
+		arr = append(arr, model.NewCounterMetric("Counter-"+strconv.Itoa(i), 1))
+	}
+
+	if err := mem.AddBatch(ctx, arr); err != nil {
+		t.Fatalf("addBatch: %v\n", err)
+	}
+
+	t.Run("spread", func(t *testing.T) {
+		used := 0
+
+		for i := range mem.shards {
+			if len(mem.shards[i].store) > 0 {
+				used++
+			}
+		}
+
+		assert.Greater(t, used, 1)
+	})
+
+	t.Run("snapshot reset", func(t *testing.T) {
+		list, err := mem.List(ctx)
+		if assert.NoError(t, err) {
+			assert.ElementsMatch(t, arr, list)
+		}
+
+		if _, err := mem.Update(ctx, model.NewCounterMetric("Counter-1", 1)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+
+		list, err = mem.List(ctx)
+		if assert.NoError(t, err) {
+			assert.Contains(t, list, model.NewCounterMetric("Counter-1", 2))
+			assert.Len(t, list, len(arr))
+		}
+	})
+}
+
+func TestMemStoreListWhileWriting(t *testing.T) {
+	var wg sync.WaitGroup
+
+	ctx := context.Background()
+	mem := New()
+
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				mem.AddBatch(ctx, benchBatch(i%10))
+			}
+		}()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				mem.List(ctx)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	metDB, err := mem.Get(ctx, model.Info{MName: "Counter-0", MType: model.TypeCountConst})
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-0", 8*100), metDB)
+	}
+}
+
+// benchBatch возвращает пакет, похожий на пакет агента agent.
+func benchBatch(agent int) []model.Metric {
+	arr := make([]model.Metric, 0, 32)
+	arr = append(arr, model.NewCounterMetric("Counter-0", 1))
+
+	for i := 1; i < 32; i++ {
+		arr = append(arr, model.NewGaugeMetric("Gauge-"+strconv.Itoa(agent)+"-"+strconv.Itoa(i), float64(i)))
+	}
+
+	return arr
+}
+
+// benchmarkWriters1k измеряет пропускную способность AddBatch при 1000 одновременных писателях.
+// Каждый писатель отправляет пакеты своего агента.
+func benchmarkWriters1k(b *testing.B, mem *MemStore) {
+	const writers = 1000
+
+	var agent atomic.Int64
+
+	ctx := context.Background()
+
+	b.SetParallelism((writers + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		arr := benchBatch(int(agent.Add(1)))
+
+		for pb.Next() {
+			if err := mem.AddBatch(ctx, arr); err != nil {
+				b.Error(err)
+
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkMemStoreWriters1kOneShard(b *testing.B) {
+	benchmarkWriters1k(b, newWithShards(1))
+}
+
+func BenchmarkMemStoreWriters1kSharded(b *testing.B) {
+	benchmarkWriters1k(b, New())
+}
+
+// benchmarkListUnderWrites измеряет List при постоянной записи в хранилище.
+func benchmarkListUnderWrites(b *testing.B, mem *MemStore) {
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		mem.AddBatch(ctx, benchBatch(i))
+	}
+
+	var stopped atomic.Bool
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; !stopped.Load(); i++ {
+			mem.Update(ctx, model.NewGaugeMetric("Gauge-0-"+strconv.Itoa(i%32), float64(i)))
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mem.List(ctx)
+	}
+
+	b.StopTimer()
+	stopped.Store(true)
+	<-done
+}
+
+func BenchmarkMemStoreListUnderWritesOneShard(b *testing.B) {
+	benchmarkListUnderWrites(b, newWithShards(1))
+}
+
+func BenchmarkMemStoreListUnderWritesSharded(b *testing.B) {
+	benchmarkListUnderWrites(b, New())
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(_ *testing.T) (storetest.Storage, func() storetest.Storage) {
+		return New(), nil
+	})
+}
@@ -0,0 +1,177 @@
+// Перенос метрик из одного хранилища в другое.
+// Копирование идемпотентно: для counter в приемник записывается разница
+// между значениями источника и приемника, gauge перезаписываются,
+// совпадающие метрики пропускаются. Поэтому перенос можно повторять,
+// пока источник продолжает принимать данные, а после переключения
+// выполнить последний проход.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+const (
+	BatchSizeDefault    = 1000 // Размер пачки записи в приемник по умолчанию.
+	mismatchReportLimit = 10   // Кол-во имен расхождений в тексте ошибки.
+)
+
+// ErrMismatch значения в приемнике не совпадают с источником.
+var ErrMismatch = errors.New("storage mismatch")
+
+// storage хранилище источника и приемника.
+type storage interface {
+	List(ctx context.Context) ([]model.Metric, error)
+	AddBatch(ctx context.Context, arr []model.Metric) error
+}
+
+type Config struct {
+	BatchSize int
+	DryRun    bool // Только рассчитать перенос, без записи и проверки.
+}
+
+// Report итоги переноса.
+type Report struct {
+	Total     int // Кол-во метрик в источнике.
+	Created   int // Кол-во метрик, которых не было в приемнике.
+	Updated   int // Кол-во метрик, значения которых отличались.
+	Unchanged int // Кол-во метрик, значения которых совпадали.
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("total: %d, created: %d, updated: %d, unchanged: %d",
+		r.Total, r.Created, r.Updated, r.Unchanged)
+}
+
+// Run переносит метрики из src в dst и проверяет результат через Verify.
+// При cfg.DryRun возвращает только рассчитанный Report.
+func Run(ctx context.Context, cfg Config, src, dst storage) (Report, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = BatchSizeDefault
+	}
+
+	srcList, err := src.List(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("list src: %w", err)
+	}
+
+	dstList, err := dst.List(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("list dst: %w", err)
+	}
+
+	changes, report := plan(srcList, dstList)
+	if cfg.DryRun {
+		return report, nil
+	}
+
+	for start := 0; start < len(changes); start += cfg.BatchSize {
+		end := min(start+cfg.BatchSize, len(changes))
+
+		if err := dst.AddBatch(ctx, changes[start:end]); err != nil {
+			return report, fmt.Errorf("add batch [%d:%d]: %w", start, end, err)
+		}
+	}
+
+	if err := Verify(ctx, src, dst); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// Verify проверяет, что каждая метрика src есть в dst с тем же значением.
+// Метрики, которые есть только в dst, не считаются расхождением.
+func Verify(ctx context.Context, src, dst storage) error {
+	srcList, err := src.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list src: %w", err)
+	}
+
+	dstList, err := dst.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list dst: %w", err)
+	}
+
+	dstIndex := index(dstList)
+	mismatch := make([]string, 0)
+
+	for _, met := range srcList {
+		if dstMet, ok := dstIndex[met.Info]; !ok || !equal(met, dstMet) {
+			mismatch = append(mismatch, met.MType.String()+"/"+met.MName)
+		}
+	}
+
+	if len(mismatch) == 0 {
+		return nil
+	}
+
+	sort.Strings(mismatch)
+
+	total := len(mismatch)
+	if total > mismatchReportLimit {
+		mismatch = mismatch[:mismatchReportLimit]
+	}
+
+	return fmt.Errorf("%w: %d of %d metrics: %s", ErrMismatch, total, len(srcList), strings.Join(mismatch, ", "))
+}
+
+// plan возвращает метрики для записи в dst, после которой
+// значения dst совпадут с src, и итоги переноса.
+func plan(srcList, dstList []model.Metric) ([]model.Metric, Report) {
+	dstIndex := index(dstList)
+	changes := make([]model.Metric, 0, len(srcList))
+	report := Report{Total: len(srcList)}
+
+	for _, met := range srcList {
+		dstMet, ok := dstIndex[met.Info]
+
+		switch {
+		case !ok:
+			report.Created++
+
+			changes = append(changes, met)
+		case equal(met, dstMet):
+			report.Unchanged++
+		default:
+			report.Updated++
+
+			if met.MType == model.TypeCountConst {
+				// counter в хранилище накапливается, записывается разница
+				delta := model.NewCounterMetric(met.MName, *met.Delta-*dstMet.Delta)
+				delta.Meta = met.Meta
+				met = delta
+			}
+
+			changes = append(changes, met)
+		}
+	}
+
+	return changes, report
+}
+
+func index(list []model.Metric) map[model.Info]model.Metric {
+	idx := make(map[model.Info]model.Metric, len(list))
+	for _, met := range list {
+		idx[met.Info] = met
+	}
+
+	return idx
+}
+
+// equal сравнивает значения метрик одного типа.
+func equal(a, b model.Metric) bool {
+	switch a.MType {
+	case model.TypeCountConst:
+		return a.Delta != nil && b.Delta != nil && *a.Delta == *b.Delta
+	case model.TypeGaugeConst:
+		return a.Val != nil && b.Val != nil && *a.Val == *b.Val
+	default:
+		return false
+	}
+}
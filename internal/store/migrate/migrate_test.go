@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchStore считает вызовы AddBatch.
+type batchStore struct {
+	*inmemory.MemStore
+	err     error
+	batches int
+}
+
+func (bs *batchStore) AddBatch(ctx context.Context, arr []model.Metric) error {
+	if bs.err != nil {
+		return bs.err
+	}
+
+	bs.batches++
+
+	return bs.MemStore.AddBatch(ctx, arr)
+}
+
+func newStore(t *testing.T, mets ...model.Metric) *batchStore {
+	t.Helper()
+
+	store := &batchStore{MemStore: inmemory.New()}
+	if err := store.MemStore.AddBatch(context.Background(), mets); err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	src := newStore(t,
+		model.NewCounterMetric("Created", 5),
+		model.NewCounterMetric("Updated", 10),
+		model.NewCounterMetric("Unchanged", 3),
+		model.NewGaugeMetric("Gauge", 1.5),
+	)
+	dst := newStore(t,
+		model.NewCounterMetric("Updated", 4),
+		model.NewCounterMetric("Unchanged", 3),
+		model.NewGaugeMetric("Gauge", 2.5),
+		model.NewGaugeMetric("Extra", 1),
+	)
+
+	t.Run("dry run", func(t *testing.T) {
+		report, err := Run(ctx, Config{DryRun: true}, src, dst)
+		assert.NoError(t, err)
+		assert.Equal(t, Report{Total: 4, Created: 1, Updated: 2, Unchanged: 1}, report)
+		assert.Equal(t, 0, dst.batches)
+		assert.ErrorIs(t, Verify(ctx, src, dst), ErrMismatch)
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		report, err := Run(ctx, Config{}, src, dst)
+		assert.NoError(t, err)
+		assert.Equal(t, Report{Total: 4, Created: 1, Updated: 2, Unchanged: 1}, report)
+
+		met, err := dst.Get(ctx, model.Info{MName: "Updated", MType: model.TypeCountConst})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), *met.Delta)
+
+		met, err = dst.Get(ctx, model.Info{MName: "Extra", MType: model.TypeGaugeConst})
+		assert.NoError(t, err)
+		assert.Equal(t, float64(1), *met.Val)
+	})
+
+	t.Run("repeat", func(t *testing.T) {
+		batches := dst.batches
+
+		report, err := Run(ctx, Config{}, src, dst)
+		assert.NoError(t, err)
+		assert.Equal(t, Report{Total: 4, Unchanged: 4}, report)
+		assert.Equal(t, batches, dst.batches)
+	})
+}
+
+func TestPlanMeta(t *testing.T) {
+	meta := model.Meta{Unit: "ops", Help: "poll count", Source: "agent-1"}
+
+	srcMet := model.NewCounterMetric("PollCount", 10)
+	srcMet.Meta = meta
+
+	changes, report := plan(
+		[]model.Metric{srcMet},
+		[]model.Metric{model.NewCounterMetric("PollCount", 4)},
+	)
+
+	assert.Equal(t, Report{Total: 1, Updated: 1}, report)
+
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, int64(6), *changes[0].Delta)
+		assert.Equal(t, meta, changes[0].Meta)
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	mets := make([]model.Metric, 25)
+	for i := range mets {
+		mets[i] = model.NewCounterMetric("Counter-"+strconv.Itoa(i), int64(i))
+	}
+
+	src := newStore(t, mets...)
+	dst := newStore(t)
+
+	report, err := Run(context.Background(), Config{BatchSize: 10}, src, dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, report.Created)
+	assert.Equal(t, 3, dst.batches)
+}
+
+func TestRunErr(t *testing.T) {
+	errAdd := errors.New("add batch")
+	src := newStore(t, model.NewGaugeMetric("Gauge", 1))
+	dst := newStore(t)
+	dst.err = errAdd
+
+	_, err := Run(context.Background(), Config{}, src, dst)
+	assert.ErrorIs(t, err, errAdd)
+}
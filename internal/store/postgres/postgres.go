@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/AndreyVLZ/metrics/internal/model"
-	_ "github.com/lib/pq"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/server/config"
+	"github.com/lib/pq"
 )
 
 const (
@@ -16,17 +19,30 @@ const (
 )
 
 var (
-	errNotFind        = errors.New("not find")
-	errDeltaNotValid  = errors.New("delta not valid")
-	errValueNotValid  = errors.New("value not valid")
-	errTypeNotSupport = errors.New("type not support")
+	errDeltaNotValid  = fmt.Errorf("%w: delta not valid", serr.ErrInvalid)
+	errValueNotValid  = fmt.Errorf("%w: value not valid", serr.ErrInvalid)
+	errTypeNotSupport = fmt.Errorf("%w: type not support", serr.ErrInvalid)
 )
 
 const (
-	getSQL          = "SELECT type_id,mname,delta,val FROM metric WHERE type_id=$1 AND mname=$2"
-	setSQL          = "INSERT INTO metric (type_id,mname,delta,val) VALUES ($1,$2,$3,$4)"
-	updSQL          = "UPDATE metric SET delta=$3, val=$4 WHERE type_id=$1 AND mname=$2"
-	listSQL         = "SELECT type_id,mname,delta,val FROM metric"
+	columnsSQL = "type_id,mname,delta,val,unit,help,source,created_at,updated_at,ts"
+	getSQL     = "SELECT " + columnsSQL + " FROM metric WHERE type_id=$1 AND mname=$2"
+	insertSQL  = "INSERT INTO metric (" + columnsSQL + ") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)"
+	// metaSetSQL дополняет сведения о метрике: created_at не меняется,
+	// пустые значения не затирают сохраненные.
+	metaSetSQL = `unit=COALESCE(NULLIF(EXCLUDED.unit,''),metric.unit),
+help=COALESCE(NULLIF(EXCLUDED.help,''),metric.help),
+source=COALESCE(NULLIF(EXCLUDED.source,''),metric.source),
+created_at=COALESCE(metric.created_at,EXCLUDED.created_at),
+updated_at=COALESCE(EXCLUDED.updated_at,metric.updated_at),
+ts=COALESCE(EXCLUDED.ts,metric.ts)`
+	counterSQL = insertSQL + `
+ON CONFLICT (type_id,mname) DO UPDATE SET delta=metric.delta+EXCLUDED.delta,` + metaSetSQL + `
+RETURNING ` + columnsSQL
+	gaugeSQL = insertSQL + `
+ON CONFLICT (type_id,mname) DO UPDATE SET val=EXCLUDED.val,` + metaSetSQL + `
+RETURNING ` + columnsSQL
+	listSQL         = "SELECT " + columnsSQL + " FROM metric"
 	createTablesSQL = `
 CREATE TABLE mettype (
 	type_id integer,
@@ -39,16 +55,82 @@ CREATE TABLE metric (
 	mname varchar(50),
 	delta bigint,
 	val double precision,
+	unit varchar(20) NOT NULL DEFAULT '',
+	help text NOT NULL DEFAULT '',
+	source varchar(100) NOT NULL DEFAULT '',
+	created_at timestamptz,
+	updated_at timestamptz,
+	ts timestamptz,
 	PRIMARY KEY (type_id,mname),
 	UNIQUE(type_id,mname)
 );`
+	// addMetaColumnsSQL добавляет колонки сведений в таблицу, созданную до их появления.
+	addMetaColumnsSQL = `
+ALTER TABLE metric
+	ADD COLUMN IF NOT EXISTS unit varchar(20) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS help text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS source varchar(100) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS created_at timestamptz,
+	ADD COLUMN IF NOT EXISTS updated_at timestamptz,
+	ADD COLUMN IF NOT EXISTS ts timestamptz;`
+	// createKeysSQL таблица ключей идемпотентности примененных пакетов.
+	createKeysSQL = `
+CREATE TABLE IF NOT EXISTS idempotency_key (
+	key varchar(100) PRIMARY KEY,
+	created_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idempotency_key_created_at ON idempotency_key (created_at);`
+	insertKeySQL = "INSERT INTO idempotency_key (key,created_at) VALUES ($1,$2) ON CONFLICT (key) DO NOTHING"
+	purgeKeysSQL = "DELETE FROM idempotency_key WHERE created_at < $1"
 )
 
 // metricDB структура для сканирования из postgres.
 type metricDB struct {
-	Info  model.Info
-	Delta sql.NullInt64
-	Value sql.NullFloat64
+	Info    model.Info
+	Delta   sql.NullInt64
+	Value   sql.NullFloat64
+	Unit    string
+	Help    string
+	Source  string
+	Created sql.NullTime
+	Updated sql.NullTime
+	TS      sql.NullTime
+}
+
+// dest возвращает поля для сканирования колонок columnsSQL.
+func (m *metricDB) dest() []any {
+	return []any{
+		&m.Info.MType,
+		&m.Info.MName,
+		&m.Delta,
+		&m.Value,
+		&m.Unit,
+		&m.Help,
+		&m.Source,
+		&m.Created,
+		&m.Updated,
+		&m.TS,
+	}
+}
+
+// meta возвращает сведения о метрике.
+func (m metricDB) meta() model.Meta {
+	return model.Meta{
+		Created: nullTime(m.Created),
+		Updated: nullTime(m.Updated),
+		TS:      nullTime(m.TS),
+		Unit:    m.Unit,
+		Help:    m.Help,
+		Source:  m.Source,
+	}
+}
+
+func nullTime(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+
+	return t.Time.UTC()
 }
 
 // buildMetric возвращает модель метрики.
@@ -57,26 +139,34 @@ type metricDB struct {
 // value == nil,
 // тип не подерживается.
 func (m metricDB) buildMetric() (model.Metric, error) {
+	var met model.Metric
+
 	switch m.Info.MType {
 	case model.TypeCountConst:
 		if !m.Delta.Valid {
 			return model.Metric{}, errDeltaNotValid
 		}
 
-		return model.NewCounterMetric(m.Info.MName, m.Delta.Int64), nil
+		met = model.NewCounterMetric(m.Info.MName, m.Delta.Int64)
 	case model.TypeGaugeConst:
 		if !m.Value.Valid {
 			return model.Metric{}, errValueNotValid
 		}
 
-		return model.NewGaugeMetric(m.Info.MName, m.Value.Float64), nil
+		met = model.NewGaugeMetric(m.Info.MName, m.Value.Float64)
 	default:
 		return model.Metric{}, errTypeNotSupport
 	}
+
+	met.Meta = m.meta()
+
+	return met, nil
 }
 
 type Config struct {
-	ConnDB string
+	ConnDB      string
+	DedupWindow time.Duration // время хранения ключей идемпотентности
+	ReadOnly    bool          // не создавать таблицы: база только читается
 }
 
 type Postgres struct {
@@ -85,6 +175,10 @@ type Postgres struct {
 }
 
 func New(cfg Config) *Postgres {
+	if cfg.DedupWindow <= 0 {
+		cfg.DedupWindow = config.DedupWindowDefault
+	}
+
 	return &Postgres{cfg: cfg}
 }
 
@@ -100,6 +194,10 @@ func (s *Postgres) Start(ctx context.Context) error {
 
 	s.db = database
 
+	if s.cfg.ReadOnly {
+		return nil
+	}
+
 	if err := s.createTable(ctx); err != nil {
 		log.Printf("create tables err: %v\n", err)
 	}
@@ -126,14 +224,7 @@ func (s *Postgres) List(ctx context.Context) ([]model.Metric, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		dest := []any{
-			&metDB.Info.MType,
-			&metDB.Info.MName,
-			&metDB.Delta,
-			&metDB.Value,
-		}
-
-		if errScan := rows.Scan(dest...); errScan != nil {
+		if errScan := rows.Scan(metDB.dest()...); errScan != nil {
 			return nil, fmt.Errorf("row scan: %w", errScan)
 		}
 
@@ -176,55 +267,106 @@ func (s *Postgres) AddBatch(ctx context.Context, arr []model.Metric) error {
 	return nil
 }
 
-func (s *Postgres) Get(ctx context.Context, mInfo model.Info) (model.Metric, error) {
-	getStmt, err := s.db.PrepareContext(ctx, getSQL)
+// AddBatchOnce добавляет срез Metric в базу, если пакет с ключом key
+// еще не был применен. Ключ сохраняется в той же транзакции, что и метрики,
+// поэтому повтор пакета применяется ровно один раз.
+// Одновременный повтор ждет завершения транзакции первого пакета.
+// Ключи старше DedupWindow удаляются. Возвращает false, если пакет уже применен.
+func (s *Postgres) AddBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error) {
+	transaction, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return model.Metric{}, fmt.Errorf("prepare getSQL: %w", err)
+		return false, fmt.Errorf("%w", err)
 	}
 
-	return get(ctx, getStmt, mInfo)
+	applied, err := s.addBatchOnceTx(ctx, transaction, key, arr)
+	if err != nil || !applied {
+		if errRoll := transaction.Rollback(); errRoll != nil {
+			err = errors.Join(err, fmt.Errorf("txRollback: %w", errRoll))
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("%w", err)
+		}
+
+		return false, nil
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return false, fmt.Errorf("txCommit: %w", err)
+	}
+
+	return true, nil
 }
 
-func (s *Postgres) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
-	getStmt, err := s.db.PrepareContext(ctx, getSQL)
-	if err != nil {
-		return model.Metric{}, fmt.Errorf("prepare getSQL: %w", err)
+func (s *Postgres) addBatchOnceTx(ctx context.Context, tx *sql.Tx, key string, arr []model.Metric) (bool, error) {
+	now := time.Now().UTC()
+
+	if _, err := tx.ExecContext(ctx, purgeKeysSQL, now.Add(-s.cfg.DedupWindow)); err != nil {
+		return false, fmt.Errorf("purge keys: %w", err)
 	}
 
-	setStmt, err := s.db.PrepareContext(ctx, setSQL)
+	res, err := tx.ExecContext(ctx, insertKeySQL, key, now)
 	if err != nil {
-		return model.Metric{}, fmt.Errorf("prepare setSQL: %w", err)
+		return false, fmt.Errorf("insert key: %w", err)
 	}
 
-	updStmt, err := s.db.PrepareContext(ctx, updSQL)
+	inserted, err := res.RowsAffected()
 	if err != nil {
-		return model.Metric{}, fmt.Errorf("prepare updSQL: %w", err)
+		return false, fmt.Errorf("%w", err)
+	}
+
+	if inserted == 0 {
+		return false, nil
+	}
+
+	if err := s.addBatchTx(ctx, tx, arr); err != nil {
+		return false, err
 	}
 
-	return update(ctx, getStmt, setStmt, updStmt, met)
+	return true, nil
 }
 
-func (s *Postgres) addBatchTx(ctx context.Context, tx *sql.Tx, arr []model.Metric) error {
-	getStmt, err := tx.PrepareContext(ctx, getSQL)
+func (s *Postgres) Get(ctx context.Context, mInfo model.Info) (model.Metric, error) {
+	getStmt, err := s.db.PrepareContext(ctx, getSQL)
 	if err != nil {
-		return fmt.Errorf("prepare getSQL: %w", err)
+		return model.Metric{}, fmt.Errorf("prepare getSQL: %w", err)
 	}
 	defer getStmt.Close()
 
-	setStmt, err := tx.PrepareContext(ctx, setSQL)
+	return get(ctx, getStmt, mInfo)
+}
+
+func (s *Postgres) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
+	counterStmt, err := s.db.PrepareContext(ctx, counterSQL)
 	if err != nil {
-		return fmt.Errorf("preapare setSQL: %w", err)
+		return model.Metric{}, fmt.Errorf("prepare counterSQL: %w", err)
 	}
-	defer setStmt.Close()
+	defer counterStmt.Close()
 
-	updStmt, err := tx.PrepareContext(ctx, updSQL)
+	gaugeStmt, err := s.db.PrepareContext(ctx, gaugeSQL)
 	if err != nil {
-		return fmt.Errorf("prepare updSQL: %w", err)
+		return model.Metric{}, fmt.Errorf("prepare gaugeSQL: %w", err)
 	}
-	defer updStmt.Close()
+	defer gaugeStmt.Close()
+
+	return update(ctx, counterStmt, gaugeStmt, met)
+}
+
+func (s *Postgres) addBatchTx(ctx context.Context, tx *sql.Tx, arr []model.Metric) error {
+	counterStmt, err := tx.PrepareContext(ctx, counterSQL)
+	if err != nil {
+		return fmt.Errorf("prepare counterSQL: %w", err)
+	}
+	defer counterStmt.Close()
+
+	gaugeStmt, err := tx.PrepareContext(ctx, gaugeSQL)
+	if err != nil {
+		return fmt.Errorf("prepare gaugeSQL: %w", err)
+	}
+	defer gaugeStmt.Close()
 
 	for i := range arr {
-		if _, err := update(ctx, getStmt, setStmt, updStmt, arr[i]); err != nil {
+		if _, err := update(ctx, counterStmt, gaugeStmt, arr[i]); err != nil {
 			return fmt.Errorf("%w", err)
 		}
 	}
@@ -232,37 +374,71 @@ func (s *Postgres) addBatchTx(ctx context.Context, tx *sql.Tx, arr []model.Metri
 	return nil
 }
 
-// Вызывает подготовленный запрос на получение метрики,
-// если метрика существует в базе - обновляет метрику и вызывает поготовленный запрос на обновление метрики в базе,
-// иначе вызывает подготовленный запрос на сохранение новой метрики.
-func update(ctx context.Context, getStmt, setStmt, updStmt *sql.Stmt, met model.Metric) (model.Metric, error) {
-	metRes, err := get(ctx, getStmt, met.Info)
-	if err != nil {
-		if errors.Is(err, errNotFind) { // set
-			return upset(ctx, setStmt, met)
-		}
-
-		return model.Metric{}, fmt.Errorf("getErr: %w", err)
-	}
+// Классы ошибок postgres, вызванных значением метрики: повтор не поможет.
+const (
+	dataExceptionClass      pq.ErrorClass = "22" // например, строка длиннее колонки varchar
+	integrityViolationClass pq.ErrorClass = "23"
+)
 
-	// update && set
-	if err := metRes.Update(met.Value); err != nil {
-		return model.Metric{}, fmt.Errorf("updErr: %w", err)
+// rejected помечает ошибку значения метрики как serr.ErrInvalid.
+func rejected(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case dataExceptionClass, integrityViolationClass:
+			return fmt.Errorf("%w: %w", serr.ErrInvalid, err)
+		}
 	}
 
-	return upset(ctx, updStmt, metRes)
+	return err
 }
 
-func upset(ctx context.Context, upsetStmt *sql.Stmt, met model.Metric) (model.Metric, error) {
+// Вызывает подготовленный запрос на сохранение метрики.
+// Запрос атомарно добавляет новую метрику, либо для существующей
+// увеличивает counter на delta или заменяет значение gauge.
+func update(ctx context.Context, counterStmt, gaugeStmt *sql.Stmt, met model.Metric) (model.Metric, error) {
+	var (
+		metDB metricDB
+		stmt  *sql.Stmt
+	)
+
+	switch met.MType {
+	case model.TypeCountConst:
+		if met.Delta == nil {
+			return model.Metric{}, errDeltaNotValid
+		}
+
+		stmt = counterStmt
+	case model.TypeGaugeConst:
+		if met.Val == nil {
+			return model.Metric{}, errValueNotValid
+		}
+
+		stmt = gaugeStmt
+	default:
+		return model.Metric{}, errTypeNotSupport
+	}
+
 	args := []any{
 		met.MType,
 		met.MName,
 		met.Delta,
 		met.Val,
+		met.Unit,
+		met.Help,
+		met.Source,
+		sql.NullTime{Time: met.Created, Valid: !met.Created.IsZero()},
+		sql.NullTime{Time: met.Updated, Valid: !met.Updated.IsZero()},
+		sql.NullTime{Time: met.TS, Valid: !met.TS.IsZero()},
+	}
+
+	if err := stmt.QueryRowContext(ctx, args...).Scan(metDB.dest()...); err != nil {
+		return model.Metric{}, fmt.Errorf("upsetErr: %w", rejected(err))
 	}
 
-	if _, err := upsetStmt.ExecContext(ctx, args...); err != nil {
-		return model.Metric{}, fmt.Errorf("upsetErr: %w", err)
+	met, err := metDB.buildMetric()
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("%w", err)
 	}
 
 	return met, nil
@@ -276,16 +452,9 @@ func get(ctx context.Context, getStmt *sql.Stmt, mInfo model.Info) (model.Metric
 		mInfo.MName,
 	}
 
-	dest := []any{
-		&metDB.Info.MType,
-		&metDB.Info.MName,
-		&metDB.Delta,
-		&metDB.Value,
-	}
-
-	if err := getStmt.QueryRowContext(ctx, args...).Scan(dest...); err != nil {
+	if err := getStmt.QueryRowContext(ctx, args...).Scan(metDB.dest()...); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return model.Metric{}, errNotFind
+			return model.Metric{}, serr.ErrNotFound
 		}
 
 		return model.Metric{}, fmt.Errorf("%w", err)
@@ -301,12 +470,20 @@ func get(ctx context.Context, getStmt *sql.Stmt, mInfo model.Info) (model.Metric
 
 // Создает необходимые таблицы в базе.
 func (s *Postgres) createTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, createKeysSQL); err != nil {
+		return fmt.Errorf("create keys table: %w", err)
+	}
+
 	isExist, err := s.checkTable(ctx, "metric")
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
 	if isExist {
+		if _, err := s.db.ExecContext(ctx, addMetaColumnsSQL); err != nil {
+			return fmt.Errorf("add meta columns: %w", err)
+		}
+
 		return nil
 	}
 
@@ -0,0 +1,385 @@
+// Хранилище метрик в Redis, общее для нескольких реплик сервера.
+// Метрики каждого типа хранятся в отдельном хэше '<Prefix>:<тип>':
+// поле - имя метрики, значение - delta для counter и value для gauge.
+// Counter изменяется атомарно командой HINCRBY, gauge - HSET.
+// Сведения о метрике хранятся в хэше '<Prefix>:meta:<тип>:<имя>'
+// и изменяются в одной транзакции со значением.
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	NameConst     = "redis store"
+	PrefixDefault = "metrics" // Префикс ключей по умолчанию.
+)
+
+// Поля хэша сведений о метрике.
+const (
+	fieldCreated = "created"
+	fieldUpdated = "updated"
+	fieldTS      = "ts"
+	fieldUnit    = "unit"
+	fieldHelp    = "help"
+	fieldSource  = "source"
+)
+
+var (
+	errNotStarted     = errors.New("store not started")
+	errDeltaNotValid  = errors.New("delta not valid")
+	errValueNotValid  = errors.New("value not valid")
+	errTypeNotSupport = errors.New("type not support")
+)
+
+// Config конфигурация хранилища.
+// URL - строка подключения вида 'redis://[user:password@]host:port/db'.
+type Config struct {
+	URL    string
+	Prefix string
+}
+
+type Redis struct {
+	client *goredis.Client
+	cfg    Config
+}
+
+func New(cfg Config) *Redis {
+	if cfg.Prefix == "" {
+		cfg.Prefix = PrefixDefault
+	}
+
+	return &Redis{cfg: cfg}
+}
+
+func (s *Redis) Name() string { return NameConst }
+
+// Start подключается к Redis и проверяет соединение.
+func (s *Redis) Start(ctx context.Context) error {
+	opts, err := goredis.ParseURL(s.cfg.URL)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+
+	client := goredis.NewClient(opts)
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return errors.Join(fmt.Errorf("ping redis: %w", err), client.Close())
+	}
+
+	s.client = client
+
+	return nil
+}
+
+func (s *Redis) Stop(_ context.Context) error {
+	if s.client == nil {
+		return nil
+	}
+
+	return s.client.Close()
+}
+
+func (s *Redis) Ping() error {
+	if s.client == nil {
+		return errNotStarted
+	}
+
+	return s.client.Ping(context.Background()).Err()
+}
+
+func (s *Redis) Get(ctx context.Context, mInfo model.Info) (model.Metric, error) {
+	key, err := s.key(mInfo.MType)
+	if err != nil {
+		return model.Metric{}, err
+	}
+
+	var (
+		valCmd  *goredis.StringCmd
+		metaCmd *goredis.MapStringStringCmd
+	)
+
+	_, err = s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		valCmd = pipe.HGet(ctx, key, mInfo.MName)
+		metaCmd = pipe.HGetAll(ctx, s.metaKey(mInfo))
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return model.Metric{}, serr.ErrNotFound
+		}
+
+		return model.Metric{}, fmt.Errorf("hget: %w", err)
+	}
+
+	met, err := parseMetric(mInfo, valCmd.Val())
+	if err != nil {
+		return model.Metric{}, err
+	}
+
+	if met.Meta, err = parseMeta(metaCmd.Val()); err != nil {
+		return model.Metric{}, fmt.Errorf("meta [%s]: %w", mInfo.MName, err)
+	}
+
+	return met, nil
+}
+
+// Update увеличивает counter на delta или заменяет значение gauge
+// и дополняет сведения о метрике в одной транзакции MULTI/EXEC.
+func (s *Redis) Update(ctx context.Context, met model.Metric) (model.Metric, error) {
+	if err := s.validate(met); err != nil {
+		return model.Metric{}, err
+	}
+
+	key, _ := s.key(met.MType)
+	metaKey := s.metaKey(met.Info)
+
+	var (
+		deltaCmd *goredis.IntCmd
+		metaCmd  *goredis.MapStringStringCmd
+	)
+
+	_, err := s.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		if met.MType == model.TypeCountConst {
+			deltaCmd = pipe.HIncrBy(ctx, key, met.MName, *met.Delta)
+		} else {
+			pipe.HSet(ctx, key, met.MName, formatGauge(*met.Val))
+		}
+
+		setMeta(ctx, pipe, metaKey, met.Meta)
+		metaCmd = pipe.HGetAll(ctx, metaKey)
+
+		return nil
+	})
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("tx pipeline: %w", err)
+	}
+
+	var metDB model.Metric
+
+	if met.MType == model.TypeCountConst {
+		metDB = model.NewCounterMetric(met.MName, deltaCmd.Val())
+	} else {
+		metDB = model.NewGaugeMetric(met.MName, *met.Val)
+	}
+
+	if metDB.Meta, err = parseMeta(metaCmd.Val()); err != nil {
+		return model.Metric{}, fmt.Errorf("meta [%s]: %w", met.MName, err)
+	}
+
+	return metDB, nil
+}
+
+// AddBatch добавляет срез метрик одной транзакцией MULTI/EXEC,
+// команды отправляются одним пакетом.
+func (s *Redis) AddBatch(ctx context.Context, arr []model.Metric) error {
+	if len(arr) == 0 {
+		return nil
+	}
+
+	for i := range arr {
+		if err := s.validate(arr[i]); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i := range arr {
+			key, _ := s.key(arr[i].MType)
+
+			if arr[i].MType == model.TypeCountConst {
+				pipe.HIncrBy(ctx, key, arr[i].MName, *arr[i].Delta)
+			} else {
+				pipe.HSet(ctx, key, arr[i].MName, formatGauge(*arr[i].Val))
+			}
+
+			setMeta(ctx, pipe, s.metaKey(arr[i].Info), arr[i].Meta)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("tx pipeline: %w", err)
+	}
+
+	return nil
+}
+
+// List возвращает срез всех метрик.
+// Сведения о метриках читаются одним пакетом команд.
+func (s *Redis) List(ctx context.Context) ([]model.Metric, error) {
+	arr := make([]model.Metric, 0)
+
+	for mType := model.TypeCountConst; mType <= model.TypeGaugeConst; mType++ {
+		key, _ := s.key(mType)
+
+		fields, err := s.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("hgetall [%s]: %w", key, err)
+		}
+
+		for name, str := range fields {
+			met, err := parseMetric(model.Info{MName: name, MType: mType}, str)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, met)
+		}
+	}
+
+	if len(arr) == 0 {
+		return arr, nil
+	}
+
+	metaCmds := make([]*goredis.MapStringStringCmd, len(arr))
+
+	_, err := s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i := range arr {
+			metaCmds[i] = pipe.HGetAll(ctx, s.metaKey(arr[i].Info))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("hgetall meta: %w", err)
+	}
+
+	for i := range arr {
+		if arr[i].Meta, err = parseMeta(metaCmds[i].Val()); err != nil {
+			return nil, fmt.Errorf("meta [%s]: %w", arr[i].MName, err)
+		}
+	}
+
+	return arr, nil
+}
+
+// key возвращает ключ хэша для метрик типа mType.
+func (s *Redis) key(mType model.Type) (string, error) {
+	if mType < model.TypeCountConst || mType > model.TypeGaugeConst {
+		return "", errTypeNotSupport
+	}
+
+	return s.cfg.Prefix + ":" + mType.String(), nil
+}
+
+// metaKey возвращает ключ хэша сведений о метрике mInfo.
+func (s *Redis) metaKey(mInfo model.Info) string {
+	return s.cfg.Prefix + ":meta:" + mInfo.MType.String() + ":" + mInfo.MName
+}
+
+// validate проверяет тип и наличие значения метрики.
+func (s *Redis) validate(met model.Metric) error {
+	switch met.MType {
+	case model.TypeCountConst:
+		if met.Delta == nil {
+			return errDeltaNotValid
+		}
+	case model.TypeGaugeConst:
+		if met.Val == nil {
+			return errValueNotValid
+		}
+	default:
+		return errTypeNotSupport
+	}
+
+	return nil
+}
+
+// parseMetric возвращает метрику из строкового значения поля хэша.
+func parseMetric(mInfo model.Info, str string) (model.Metric, error) {
+	if mInfo.MType == model.TypeCountConst {
+		delta, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return model.Metric{}, fmt.Errorf("parse delta [%s]: %w", mInfo.MName, err)
+		}
+
+		return model.NewCounterMetric(mInfo.MName, delta), nil
+	}
+
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return model.Metric{}, fmt.Errorf("parse value [%s]: %w", mInfo.MName, err)
+	}
+
+	return model.NewGaugeMetric(mInfo.MName, val), nil
+}
+
+// formatGauge возвращает строку, из которой значение восстанавливается без потерь.
+func formatGauge(val float64) string {
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+// setMeta добавляет в pipe команды сохранения сведений meta в хэш key.
+// Время создания записывается только при отсутствии, пустые значения пропускаются.
+func setMeta(ctx context.Context, pipe goredis.Pipeliner, key string, meta model.Meta) {
+	if !meta.Created.IsZero() {
+		pipe.HSetNX(ctx, key, fieldCreated, meta.Created.Format(time.RFC3339Nano))
+	}
+
+	fields := make([]any, 0)
+
+	for _, field := range [...]struct {
+		name string
+		t    time.Time
+	}{
+		{fieldUpdated, meta.Updated},
+		{fieldTS, meta.TS},
+	} {
+		if !field.t.IsZero() {
+			fields = append(fields, field.name, field.t.Format(time.RFC3339Nano))
+		}
+	}
+
+	for _, field := range [...][2]string{
+		{fieldUnit, meta.Unit},
+		{fieldHelp, meta.Help},
+		{fieldSource, meta.Source},
+	} {
+		if field[1] != "" {
+			fields = append(fields, field[0], field[1])
+		}
+	}
+
+	if len(fields) > 0 {
+		pipe.HSet(ctx, key, fields...)
+	}
+}
+
+// parseMeta возвращает сведения о метрике из полей хэша.
+func parseMeta(fields map[string]string) (model.Meta, error) {
+	meta := model.Meta{
+		Unit:   fields[fieldUnit],
+		Help:   fields[fieldHelp],
+		Source: fields[fieldSource],
+	}
+
+	for name, dst := range map[string]*time.Time{
+		fieldCreated: &meta.Created,
+		fieldUpdated: &meta.Updated,
+		fieldTS:      &meta.TS,
+	} {
+		str, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return model.Meta{}, fmt.Errorf("parse %s: %w", name, err)
+		}
+
+		*dst = t
+	}
+
+	return meta, nil
+}
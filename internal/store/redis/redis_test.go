@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/internal/store/storetest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func startRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	store := New(Config{URL: "redis://" + server.Addr()})
+
+	if err := store.Start(context.Background()); err != nil {
+		t.Fatalf("start store: %v\n", err)
+	}
+
+	t.Cleanup(func() { store.Stop(context.Background()) })
+
+	return store, server
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	store, server := startRedis(t)
+
+	t.Run("ping", func(t *testing.T) {
+		assert.NoError(t, store.Ping())
+	})
+
+	t.Run("update counter", func(t *testing.T) {
+		_, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 100))
+		assert.NoError(t, err)
+
+		metDB, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 300))
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 400), metDB)
+		}
+
+		assert.Equal(t, "400", server.HGet("metrics:counter", "Counter-1"))
+	})
+
+	t.Run("update gauge", func(t *testing.T) {
+		metDB, err := store.Update(ctx, model.NewGaugeMetric("Gauge-1", 0.1+0.2))
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewGaugeMetric("Gauge-1", 0.1+0.2), metDB)
+		}
+
+		metDB, err = store.Get(ctx, metDB.Info)
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewGaugeMetric("Gauge-1", 0.1+0.2), metDB)
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		arr := []model.Metric{
+			model.NewCounterMetric("Counter-1", 100),
+			model.NewGaugeMetric("Gauge-2", 30.03),
+		}
+
+		assert.NoError(t, store.AddBatch(ctx, arr))
+
+		list, err := store.List(ctx)
+		if assert.NoError(t, err) {
+			assert.ElementsMatch(t,
+				[]model.Metric{
+					model.NewCounterMetric("Counter-1", 500),
+					model.NewGaugeMetric("Gauge-1", 0.1+0.2),
+					model.NewGaugeMetric("Gauge-2", 30.03),
+				},
+				list,
+			)
+		}
+	})
+
+	t.Run("batch not valid", func(t *testing.T) {
+		arr := []model.Metric{
+			model.NewCounterMetric("Counter-1", 100),
+			{Info: model.Info{MName: "Gauge-3", MType: model.TypeGaugeConst}},
+		}
+
+		assert.ErrorIs(t, store.AddBatch(ctx, arr), errValueNotValid)
+
+		// пакет не применяется частично
+		metDB, err := store.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 500), metDB)
+		}
+	})
+
+	t.Run("get not find", func(t *testing.T) {
+		_, err := store.Get(ctx, model.Info{MName: "Counter-2", MType: model.TypeCountConst})
+		assert.ErrorIs(t, err, serr.ErrNotFound)
+	})
+
+	t.Run("get type not support", func(t *testing.T) {
+		_, err := store.Get(ctx, model.Info{MName: "Counter-1", MType: model.Type(2)})
+		assert.ErrorIs(t, err, errTypeNotSupport)
+	})
+
+	t.Run("shared between replicas", func(t *testing.T) {
+		replica := New(Config{URL: "redis://" + server.Addr()})
+		if err := replica.Start(ctx); err != nil {
+			t.Fatalf("start replica: %v\n", err)
+		}
+		defer replica.Stop(ctx)
+
+		if _, err := replica.Update(ctx, model.NewCounterMetric("Counter-1", 1)); err != nil {
+			t.Fatalf("update: %v\n", err)
+		}
+
+		metDB, err := store.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, model.NewCounterMetric("Counter-1", 501), metDB)
+		}
+	})
+}
+
+func TestRedisNotStarted(t *testing.T) {
+	store := New(Config{URL: "redis://localhost:0"})
+	assert.ErrorIs(t, store.Ping(), errNotStarted)
+	assert.NoError(t, store.Stop(context.Background()))
+}
+
+func TestRedisStartErr(t *testing.T) {
+	store := New(Config{URL: "http://localhost"})
+	assert.Error(t, store.Start(context.Background()))
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) (storetest.Storage, func() storetest.Storage) {
+		cfg := Config{URL: "redis://" + miniredis.RunT(t).Addr()}
+
+		return New(cfg), func() storetest.Storage { return New(cfg) }
+	})
+}
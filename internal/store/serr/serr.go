@@ -0,0 +1,12 @@
+// Ошибки, общие для всех хранилищ метрик.
+package serr
+
+import "errors"
+
+var (
+	// ErrNotFound метрика не найдена в хранилище.
+	ErrNotFound = errors.New("not find")
+	// ErrInvalid метрика нарушает ограничения хранилища,
+	// например длину колонки: повтор запроса не поможет.
+	ErrInvalid = errors.New("metric rejected by store")
+)
@@ -1,61 +1,178 @@
 package store
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"strings"
 
-	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/lease"
 	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/bolt"
+	"github.com/AndreyVLZ/metrics/internal/store/cache"
 	"github.com/AndreyVLZ/metrics/internal/store/filestore"
 	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
 	"github.com/AndreyVLZ/metrics/internal/store/postgres"
+	"github.com/AndreyVLZ/metrics/internal/store/redis"
 	"github.com/AndreyVLZ/metrics/server/config"
+	"github.com/AndreyVLZ/metrics/server/driver"
 )
 
-type Storage interface {
-	Name() string
-	Start(ctx context.Context) error
-	Stop(ctx context.Context) error
-	Ping() error
-	Get(ctx context.Context, mInfo model.Info) (model.Metric, error)
-	Update(ctx context.Context, met model.Metric) (model.Metric, error)
-	List(ctx context.Context) ([]model.Metric, error)
-	AddBatch(ctx context.Context, arr []model.Metric) error
-}
+// Storage хранилище метрик, см. [driver.Storage].
+type Storage = driver.Storage
 
+// StorageType схема строки подключения встроенного хранилища.
 type StorageType string
 
 const (
-	StorageTypePostgres StorageType = "pg"
+	StorageTypePostgres StorageType = "postgres"
 	StorageTypeInFile   StorageType = "file"
+	StorageTypeBolt     StorageType = "bolt"
+	StorageTypeRedis    StorageType = "redis"
 	StorageTypeInMemory StorageType = "mem"
 )
 
-func New(cfg config.StorageConfig) Storage {
-	storeType := StorageTypeInMemory
+const schemeSepConst = "://"
+
+var errPathEmpty = errors.New("path is empty")
+
+// Регистрация встроенных хранилищ.
+func init() {
+	driver.Register(string(StorageTypeInMemory), newMem)
+	driver.Register(string(StorageTypeInFile), newFile)
+	driver.Register(string(StorageTypeBolt), newBolt)
+	driver.Register(string(StorageTypePostgres), newPostgres)
+	driver.Register("postgresql", newPostgres)
+	driver.Register(string(StorageTypeRedis), newRedis)
+	driver.Register("rediss", newRedis)
+}
+
+// New возвращает хранилище по конфигурации.
+// Если задан cfg.CacheMode, перед хранилищем ставится кэш в памяти.
+func New(cfg config.StorageConfig) (Storage, error) {
+	store, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CacheMode == "" {
+		return store, nil
+	}
+
+	mode, err := cache.ParseMode(cfg.CacheMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return cache.New(
+		cache.Config{
+			Mode:     mode,
+			FlushInt: cfg.CacheFlushInt,
+			Log:      cfg.Log,
+		}, store, inmemory.New()), nil
+}
+
+// open возвращает хранилище по конфигурации.
+func open(cfg config.StorageConfig) (Storage, error) {
+	if cfg.URL != "" {
+		return driver.Open(cfg.URL, cfg)
+	}
+
+	scheme, dsn := resolve(cfg)
+
+	return driver.OpenDriver(scheme, dsn, cfg)
+}
+
+// resolve возвращает схему и строку подключения хранилища.
+// Если задан cfg.URL, используется он.
+// Иначе хранилище выбирается по старым параметрам в порядке:
+// ConnDB, BoltPath, StorePath, хранилище в памяти.
+// ConnDB передается как есть, поэтому может быть и не в виде URL.
+func resolve(cfg config.StorageConfig) (string, string) {
+	if cfg.URL != "" {
+		scheme, _, _ := strings.Cut(cfg.URL, schemeSepConst)
 
-	if cfg.StorePath != "" {
-		storeType = StorageTypeInFile
+		return strings.ToLower(scheme), cfg.URL
 	}
 
-	if cfg.ConnDB != "" {
-		storeType = StorageTypePostgres
+	switch {
+	case cfg.ConnDB != "":
+		return string(StorageTypePostgres), cfg.ConnDB
+	case cfg.BoltPath != "":
+		return string(StorageTypeBolt), string(StorageTypeBolt) + schemeSepConst + cfg.BoltPath
+	case cfg.StorePath != "":
+		return string(StorageTypeInFile), string(StorageTypeInFile) + schemeSepConst + cfg.StorePath
+	default:
+		return string(StorageTypeInMemory), string(StorageTypeInMemory) + schemeSepConst
 	}
+}
 
-	switch storeType {
-	case StorageTypePostgres:
-		return postgres.New(postgres.Config{ConnDB: cfg.ConnDB})
-	case StorageTypeInFile:
-		filestore := filestore.New(
-			filestore.Config{
-				StorePath: cfg.StorePath,
-				IsRestore: cfg.IsRestore,
-				StoreInt:  cfg.StoreInt,
-			}, inmemory.New())
+// NewLocker возвращает аренду для выбора лидера среди реплик,
+// работающих с хранилищем из cfg: advisory lock для postgres,
+// блокировку файла '<путь>.lock' для файлового хранилища.
+// Остальные хранилища не разделяются между репликами
+// либо не поддерживают аренду, для них реплика всегда лидер.
+func NewLocker(cfg config.StorageConfig) lease.Locker {
+	scheme, dsn := resolve(cfg)
 
-		return adapter.Ping(filestore)
+	switch scheme {
+	case string(StorageTypePostgres), "postgresql":
+		return lease.NewPostgres(dsn, lease.KeyDefault)
+	case string(StorageTypeInFile):
+		return lease.NewFile(driver.PathFromDSN(dsn) + ".lock")
 	default:
-		inmem := inmemory.New()
+		return lease.Local{}
+	}
+}
+
+// newMem драйвер 'mem://'.
+func newMem(_ string, _ config.StorageConfig) (Storage, error) {
+	return adapter.Ping(inmemory.New()), nil
+}
+
+// newFile драйвер 'file:///path'.
+func newFile(dsn string, cfg config.StorageConfig) (Storage, error) {
+	path := driver.PathFromDSN(dsn)
+	if path == "" {
+		return nil, errPathEmpty
+	}
+
+	policy, err := filestore.ParseSyncPolicy(cfg.FileSync)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	filestore := filestore.New(
+		filestore.Config{
+			StorePath:    path,
+			IsRestore:    cfg.IsRestore,
+			StoreInt:     cfg.StoreInt,
+			SyncPolicy:   policy,
+			CompactSize:  cfg.CompactSize,
+			SnapshotKeep: cfg.SnapshotKeep,
+			ExternalJob:  cfg.Lease,
+			ReadOnly:     cfg.ReadOnly,
+			Log:          cfg.Log,
+		}, inmemory.New())
 
-		return adapter.Ping(inmem)
+	return filestore, nil
+}
+
+// newBolt драйвер 'bolt:///path'.
+func newBolt(dsn string, cfg config.StorageConfig) (Storage, error) {
+	path := driver.PathFromDSN(dsn)
+	if path == "" {
+		return nil, errPathEmpty
 	}
+
+	return bolt.New(bolt.Config{Path: path, ReadOnly: cfg.ReadOnly}), nil
+}
+
+// newPostgres драйвер 'postgres://...'. Строка подключения передается как есть.
+func newPostgres(dsn string, cfg config.StorageConfig) (Storage, error) {
+	return postgres.New(postgres.Config{ConnDB: dsn, DedupWindow: cfg.DedupWindow, ReadOnly: cfg.ReadOnly}), nil
+}
+
+// newRedis драйвер 'redis://host:port/db'. Строка подключения передается как есть.
+func newRedis(dsn string, _ config.StorageConfig) (Storage, error) {
+	return redis.New(redis.Config{URL: dsn}), nil
 }
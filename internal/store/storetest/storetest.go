@@ -0,0 +1,331 @@
+// Общий набор тестов, которому должна соответствовать любая реализация хранилища.
+//
+// Тесты хранилища вызывают Run с фабрикой, возвращающей новое пустое хранилище:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) (storetest.Storage, func() storetest.Storage) {
+//			return inmemory.New(), nil
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	concurrentWriters = 50 // Кол-во одновременных писателей.
+	concurrentUpdates = 20 // Кол-во обновлений на одного писателя.
+)
+
+// Storage интерфейс проверяемого хранилища.
+type Storage interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Get(ctx context.Context, mInfo model.Info) (model.Metric, error)
+	Update(ctx context.Context, met model.Metric) (model.Metric, error)
+	List(ctx context.Context) ([]model.Metric, error)
+	AddBatch(ctx context.Context, arr []model.Metric) error
+}
+
+// Factory возвращает новое пустое не запущенное хранилище и функцию reopen,
+// возвращающую хранилище над тем же сохраненным состоянием.
+// Для хранилищ, не сохраняющих состояние между перезапусками, reopen = nil.
+type Factory func(t *testing.T) (store Storage, reopen func() Storage)
+
+// Run запускает набор тестов для хранилищ, создаваемых newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Helper()
+
+	t.Run("counter accumulation", func(t *testing.T) { testCounter(t, newStore) })
+	t.Run("gauge overwrite", func(t *testing.T) { testGauge(t, newStore) })
+	t.Run("batch", func(t *testing.T) { testBatch(t, newStore) })
+	t.Run("not found", func(t *testing.T) { testNotFound(t, newStore) })
+	t.Run("concurrent updates", func(t *testing.T) { testConcurrent(t, newStore) })
+	t.Run("restart persistence", func(t *testing.T) { testRestart(t, newStore) })
+	t.Run("meta", func(t *testing.T) { testMeta(t, newStore) })
+}
+
+// start запускает хранилище и останавливает его по завершении теста.
+func start(t *testing.T, store Storage) Storage {
+	t.Helper()
+
+	ctx := context.Background()
+
+	if err := store.Start(ctx); err != nil {
+		t.Fatalf("start store: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := store.Stop(ctx); err != nil {
+			t.Errorf("stop store: %v", err)
+		}
+	})
+
+	return store
+}
+
+func testCounter(t *testing.T, newStore Factory) {
+	ctx := context.Background()
+	store, _ := newStore(t)
+	store = start(t, store)
+
+	metDB, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 100))
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-1", 100), metDB)
+	}
+
+	metDB, err = store.Update(ctx, model.NewCounterMetric("Counter-1", 300))
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-1", 400), metDB)
+	}
+
+	metDB, err = store.Get(ctx, metDB.Info)
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-1", 400), metDB)
+	}
+}
+
+func testGauge(t *testing.T, newStore Factory) {
+	ctx := context.Background()
+	store, _ := newStore(t)
+	store = start(t, store)
+
+	if _, err := store.Update(ctx, model.NewGaugeMetric("Gauge-1", 10.01)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	metDB, err := store.Update(ctx, model.NewGaugeMetric("Gauge-1", 20.02))
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewGaugeMetric("Gauge-1", 20.02), metDB)
+	}
+
+	metDB, err = store.Get(ctx, metDB.Info)
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewGaugeMetric("Gauge-1", 20.02), metDB)
+	}
+}
+
+func testBatch(t *testing.T, newStore Factory) {
+	ctx := context.Background()
+	store, _ := newStore(t)
+	store = start(t, store)
+
+	if _, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 5)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// метрики с одинаковым именем и разным типом - разные метрики,
+	// повторы counter в одном пакете складываются, для gauge побеждает последний
+	arr := []model.Metric{
+		model.NewCounterMetric("Counter-1", 10),
+		model.NewCounterMetric("Counter-1", 20),
+		model.NewGaugeMetric("Gauge-1", 10.01),
+		model.NewGaugeMetric("Gauge-1", 20.02),
+		model.NewGaugeMetric("Counter-1", 30.03),
+	}
+
+	if err := store.AddBatch(ctx, arr); err != nil {
+		t.Fatalf("addBatch: %v", err)
+	}
+
+	if err := store.AddBatch(ctx, []model.Metric{}); err != nil {
+		t.Fatalf("addBatch empty: %v", err)
+	}
+
+	list, err := store.List(ctx)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t,
+			[]model.Metric{
+				model.NewCounterMetric("Counter-1", 35),
+				model.NewGaugeMetric("Gauge-1", 20.02),
+				model.NewGaugeMetric("Counter-1", 30.03),
+			},
+			list,
+		)
+	}
+}
+
+func testNotFound(t *testing.T, newStore Factory) {
+	ctx := context.Background()
+	store, _ := newStore(t)
+	store = start(t, store)
+
+	if _, err := store.Update(ctx, model.NewCounterMetric("Metric-1", 10)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	_, err := store.Get(ctx, model.Info{MName: "Metric-2", MType: model.TypeCountConst})
+	assert.ErrorIs(t, err, serr.ErrNotFound)
+
+	// метрика с тем же именем, но другим типом
+	_, err = store.Get(ctx, model.Info{MName: "Metric-1", MType: model.TypeGaugeConst})
+	assert.ErrorIs(t, err, serr.ErrNotFound)
+
+	list, err := store.List(ctx)
+	if assert.NoError(t, err) {
+		assert.Len(t, list, 1)
+	}
+}
+
+func testConcurrent(t *testing.T, newStore Factory) {
+	var wg sync.WaitGroup
+
+	ctx := context.Background()
+	store, _ := newStore(t)
+	store = start(t, store)
+
+	for i := 0; i < concurrentWriters; i++ {
+		wg.Add(1)
+
+		go func(writer int) {
+			defer wg.Done()
+
+			for j := 0; j < concurrentUpdates; j++ {
+				var err error
+
+				if writer%2 == 0 {
+					_, err = store.Update(ctx, model.NewCounterMetric("Counter-1", 1))
+				} else {
+					err = store.AddBatch(ctx, []model.Metric{
+						model.NewCounterMetric("Counter-1", 1),
+						model.NewGaugeMetric("Gauge-1", float64(writer)),
+					})
+				}
+
+				if err != nil {
+					t.Errorf("writer [%d]: %v", writer, err)
+
+					return
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	metDB, err := store.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+	if assert.NoError(t, err) {
+		assert.Equal(t, model.NewCounterMetric("Counter-1", concurrentWriters*concurrentUpdates), metDB)
+	}
+}
+
+func testRestart(t *testing.T, newStore Factory) {
+	ctx := context.Background()
+
+	store, reopen := newStore(t)
+	if reopen == nil {
+		t.Skip("store does not persist state")
+	}
+
+	if err := store.Start(ctx); err != nil {
+		t.Fatalf("start store: %v", err)
+	}
+
+	arr := []model.Metric{
+		model.NewCounterMetric("Counter-1", 10),
+		model.NewGaugeMetric("Gauge-1", 10.01),
+	}
+
+	if err := store.AddBatch(ctx, arr); err != nil {
+		t.Fatalf("addBatch: %v", err)
+	}
+
+	if _, err := store.Update(ctx, model.NewCounterMetric("Counter-1", 20)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	if err := store.Stop(ctx); err != nil {
+		t.Fatalf("stop store: %v", err)
+	}
+
+	store = start(t, reopen())
+
+	list, err := store.List(ctx)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t,
+			[]model.Metric{
+				model.NewCounterMetric("Counter-1", 30),
+				model.NewGaugeMetric("Gauge-1", 10.01),
+			},
+			list,
+		)
+	}
+}
+
+// withMeta возвращает метрику met со сведениями meta.
+func withMeta(met model.Metric, meta model.Meta) model.Metric {
+	met.Meta = meta
+
+	return met
+}
+
+func testMeta(t *testing.T, newStore Factory) {
+	ctx := context.Background()
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	store, reopen := newStore(t)
+	if err := store.Start(ctx); err != nil {
+		t.Fatalf("start store: %v", err)
+	}
+
+	first := model.Meta{Created: created, Updated: created, TS: created, Unit: "bytes", Help: "heap bytes", Source: "agent-1"}
+
+	if _, err := store.Update(ctx, withMeta(model.NewGaugeMetric("Gauge-1", 1), first)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// время создания сохраняется, пустые сведения не затирают сохраненные
+	metDB, err := store.Update(ctx, withMeta(model.NewGaugeMetric("Gauge-1", 2),
+		model.Meta{Created: updated, Updated: updated, TS: updated, Source: "agent-2"}))
+	want := withMeta(model.NewGaugeMetric("Gauge-1", 2),
+		model.Meta{Created: created, Updated: updated, TS: updated, Unit: "bytes", Help: "heap bytes", Source: "agent-2"})
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, want, metDB)
+	}
+
+	batch := []model.Metric{
+		withMeta(model.NewCounterMetric("Counter-1", 1), model.Meta{Created: created, Updated: created, Unit: "count"}),
+		withMeta(model.NewCounterMetric("Counter-1", 2), model.Meta{Created: updated, Updated: updated}),
+		model.NewCounterMetric("Counter-2", 3),
+	}
+
+	if err := store.AddBatch(ctx, batch); err != nil {
+		t.Fatalf("addBatch: %v", err)
+	}
+
+	wantList := []model.Metric{
+		want,
+		withMeta(model.NewCounterMetric("Counter-1", 3), model.Meta{Created: created, Updated: updated, Unit: "count"}),
+		model.NewCounterMetric("Counter-2", 3),
+	}
+
+	list, err := store.List(ctx)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, wantList, list)
+	}
+
+	if err := store.Stop(ctx); err != nil {
+		t.Fatalf("stop store: %v", err)
+	}
+
+	if reopen == nil {
+		return
+	}
+
+	store = start(t, reopen())
+
+	list, err = store.List(ctx)
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, wantList, list)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 )
 
 // Хеширование data по ключу key.
@@ -19,6 +20,21 @@ func SHA256(data []byte, key []byte) ([]byte, error) {
 	return hash.Sum(nil), nil
 }
 
+// New возвращает хеш по ключу key для данных, записываемых частями:
+// сумма совпадает с SHA256 от всех записанных данных.
+func New(key []byte) hash.Hash {
+	return hmac.New(sha256.New, key)
+}
+
+// RequestMessage возвращает подписываемое сообщение запроса: метод,
+// путь с параметрами и время подписи ts перед телом body. Подпись такого
+// сообщения не подходит к другому запросу, в том числе с пустым телом.
+func RequestMessage(method, uri, ts string, body []byte) []byte {
+	head := method + " " + uri + "\n" + ts + "\n"
+
+	return append([]byte(head), body...)
+}
+
 // Проверяет хеш messageMACStr от message по ключу key.
 func ValidMAC(messageMACStr string, message, key []byte) (bool, error) {
 	expectedMAC, err := SHA256(message, key)
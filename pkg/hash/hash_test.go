@@ -7,6 +7,16 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+func TestRequestMessage(t *testing.T) {
+	msg := RequestMessage("GET", "/admin/export?format=csv", "1700000000", nil)
+	assert.Equal(t, "GET /admin/export?format=csv\n1700000000\n", string(msg))
+
+	// подпись зависит от метода, пути и времени даже при одном теле
+	assert.NotEqual(t, msg, RequestMessage("GET", "/admin/cardinality", "1700000000", nil))
+	assert.NotEqual(t, msg, RequestMessage("GET", "/admin/export?format=csv", "1700000001", nil))
+	assert.Equal(t, "POST /admin/import\n1\nbody", string(RequestMessage("POST", "/admin/import", "1", []byte("body"))))
+}
+
 func TestSHAok(t *testing.T) {
 	bKey := []byte("SECRET")
 	bData := []byte("test string")
@@ -13,6 +13,7 @@ import (
 var (
 	errContertToString = errors.New("convert to string")
 	errConvertToBool   = errors.New("convert to bool")
+	errConvertToInt    = errors.New("convert to int")
 )
 
 var myField *field
@@ -83,6 +84,25 @@ func (f *field) bool(fieldName string) func(*bool) error {
 	}
 }
 
+func (f *field) int(fieldName string) func(*int) error {
+	return func(valInt *int) error {
+		jsonVal, isExist := f.data[fieldName]
+		if !isExist {
+			return perr.ErrNotSet
+		}
+
+		// числа из json читаются как float64
+		jsonNum, isOK := jsonVal.(float64)
+		if !isOK || jsonNum != float64(int(jsonNum)) {
+			return errConvertToInt
+		}
+
+		*valInt = int(jsonNum)
+
+		return nil
+	}
+}
+
 func (f *field) string(fieldName string) func(*string) error {
 	return func(str *string) error {
 		jsonVal, isExist := f.data[fieldName]
@@ -114,6 +134,11 @@ func Bool(fieldName string) func(*bool) error {
 	return myField.bool(fieldName)
 }
 
+// Int Читает field как int. Возвращает функцию установки int-значения.
+func Int(fieldName string) func(*int) error {
+	return myField.int(fieldName)
+}
+
 // String Читает field как string. Возвращает функцию установки string-значения.
 func String(fieldName string) func(*string) error {
 	return myField.string(fieldName)
@@ -130,3 +130,45 @@ func TestString(t *testing.T) {
 		assert.Equal(t, perr.ErrNotSet, err)
 	})
 }
+
+func TestInt(t *testing.T) {
+	fieldName := "fName"
+
+	t.Run("ok", func(t *testing.T) {
+		t.Cleanup(func() {
+			clearData()
+		})
+
+		initData(fieldName, float64(1024))
+
+		var acVal int
+		if err := Int(fieldName)(&acVal); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, 1024, acVal)
+	})
+
+	t.Run("err not int", func(t *testing.T) {
+		t.Cleanup(func() {
+			clearData()
+		})
+
+		initData(fieldName, 10.5)
+
+		var acVal int
+		if err := Int(fieldName)(&acVal); err == nil {
+			t.Fatal("want err")
+		}
+	})
+
+	t.Run("err not set", func(t *testing.T) {
+		t.Cleanup(func() {
+			clearData()
+		})
+
+		var acVal int
+		err := Int(fieldName)(&acVal)
+		assert.Equal(t, perr.ErrNotSet, err)
+	})
+}
@@ -55,7 +55,10 @@ func ExampleShutdown_server() {
 		fmt.Println(err)
 	}
 
-	server := server.New(cfg, slog.Default())
+	server, err := server.New(cfg, slog.Default())
+	if err != nil {
+		fmt.Println(err)
+	}
 	shuwdown := shutdown.New(adapter.NewShutdown(&server), 2*time.Second)
 
 	signals := []os.Signal{
@@ -2,7 +2,9 @@ package config
 
 import (
 	"crypto/rsa"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/AndreyVLZ/metrics/pkg/crypto"
@@ -14,19 +16,48 @@ const (
 	StorePathDefault     string        = "/tmp/metrics-db.json" // Значение по умолчанию для имени файла, куда сохраняются текущие значения.
 	StoreIntervalDefault time.Duration = 300 * time.Second      // Значение по умолчанию для интервала времени в секундах, по истечении которого текущие показания сервера сохраняются на диск.
 	IsRestoreDefault     bool          = true                   // Значение по умолчанию для значения определяющее, загружать или нет ранее сохранённые значения из указанного файла при старте сервера.
+	FileSyncDefault      string        = "always"               // Значение по умолчанию для политики сброса журнала файлового хранилища на диск.
+	CompactSizeDefault   int           = 4 << 20                // Значение по умолчанию для размера журнала в байтах, после которого он сжимается в снимок.
+	SnapshotKeepDefault  int           = 3                      // Значение по умолчанию для кол-ва хранимых предыдущих поколений снимка.
+	CacheFlushIntDefault time.Duration = time.Second            // Значение по умолчанию для интервала записи накопленных изменений кэша в хранилище.
+	LeaseIntervalDefault time.Duration = 5 * time.Second        // Значение по умолчанию для интервала захвата и проверки аренды лидера.
+	StalePolicyDefault   string        = "accept"               // Значение по умолчанию для политики обработки устаревших значений gauge.
+	DedupWindowDefault   time.Duration = 10 * time.Minute       // Значение по умолчанию для времени хранения ключей идемпотентности пакетов.
 	LogLevelDefault      string        = log.LevelErr           // Значение по умолчанию для уровня логирования.
 	// CryptoKeyPathDefault string        = "/tmp/private.pem"     // Значение по умолчания для пути до файла с приватным ключом.
 )
 
+// ErrConfig неверное значение параметра.
+var ErrConfig = errors.New("config not valid")
+
 // FuncOpt Опции для конфига.
 type FuncOpt func(*Config)
 
 // StorageConfig конфигурация для хранилища.
 type StorageConfig struct {
-	ConnDB    string
-	StorePath string
-	IsRestore bool
-	StoreInt  time.Duration
+	URL           string
+	ConnDB        string
+	StorePath     string
+	BoltPath      string
+	FileSync      string
+	IsRestore     bool
+	StoreInt      time.Duration
+	CompactSize   int64
+	SnapshotKeep  int
+	CacheMode     string
+	CacheFlushInt time.Duration
+	Lease         bool
+	LeaseInt      time.Duration
+	DedupWindow   time.Duration
+	ReadOnly      bool         // Только чтение: хранилище не изменяется, в т.ч. не создаются таблицы (cmd/migrate).
+	Log           *slog.Logger // Логгер фоновых ошибок хранилища, nil - slog.Default().
+}
+
+// Limits ограничения кол-ва метрик, 0 - без ограничения.
+type Limits struct {
+	MaxSeries      int // всего метрик
+	MaxAgentSeries int // метрик, созданных одним агентом
+	MaxBatch       int // метрик в одном пакете
 }
 
 // Config Конфигурация для Агента.
@@ -37,17 +68,26 @@ type Config struct {
 	PrivateKey    *rsa.PrivateKey
 	LogLevel      string
 	ConfigPath    string
+	StalePolicy   string
+	Limits        Limits
 	StorageConfig
 }
 
 func Default() *Config {
 	return &Config{
-		Addr:     AddressDefault,
-		LogLevel: LogLevelDefault,
+		Addr:        AddressDefault,
+		LogLevel:    LogLevelDefault,
+		StalePolicy: StalePolicyDefault,
 		StorageConfig: StorageConfig{
-			StorePath: StorePathDefault,
-			StoreInt:  StoreIntervalDefault,
-			IsRestore: IsRestoreDefault,
+			StorePath:     StorePathDefault,
+			StoreInt:      StoreIntervalDefault,
+			IsRestore:     IsRestoreDefault,
+			FileSync:      FileSyncDefault,
+			CompactSize:   int64(CompactSizeDefault),
+			SnapshotKeep:  SnapshotKeepDefault,
+			CacheFlushInt: CacheFlushIntDefault,
+			LeaseInt:      LeaseIntervalDefault,
+			DedupWindow:   DedupWindowDefault,
 		},
 		//	CryptoKeyPath: CryptoKeyPathDefault,
 	}
@@ -71,6 +111,10 @@ func New(opts ...FuncOpt) (*Config, error) {
 		opts[i](cfg)
 	}
 
+	if cfg.SnapshotKeep < 0 {
+		return nil, fmt.Errorf("%w: snapshot keep %d", ErrConfig, cfg.SnapshotKeep)
+	}
+
 	// читаем приватный ключ из файла
 	if cfg.CryptoKeyPath == "" {
 		return cfg, nil
@@ -112,6 +156,13 @@ func SetRestore(b bool) FuncOpt {
 	}
 }
 
+// Установка строки подключения хранилища вида 'scheme://...' [mem|file|bolt|postgres|redis].
+func SetStorageURL(url string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.URL = url
+	}
+}
+
 // Установка строки с адресом подключения к БД.
 func SetDatabaseDNS(connDB string) FuncOpt {
 	return func(cfg *Config) {
@@ -119,6 +170,97 @@ func SetDatabaseDNS(connDB string) FuncOpt {
 	}
 }
 
+// Установка политики сброса журнала файлового хранилища на диск [always|interval|none].
+func SetFileSync(policy string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.FileSync = policy
+	}
+}
+
+// Установка размера журнала в байтах, после которого он сжимается в снимок.
+func SetCompactSize(size int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.CompactSize = int64(size)
+	}
+}
+
+// Установка кол-ва хранимых предыдущих поколений снимка файлового хранилища.
+func SetSnapshotKeep(keep int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.SnapshotKeep = keep
+	}
+}
+
+// Установка пути до файла встраиваемой базы bbolt.
+func SetBoltPath(path string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.BoltPath = path
+	}
+}
+
+// Установка режима кэша в памяти перед хранилищем [through|behind], пустая строка - без кэша.
+func SetCacheMode(mode string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.CacheMode = mode
+	}
+}
+
+// Установка интервала записи накопленных изменений кэша в хранилище (режим behind).
+func SetCacheFlushInt(interval time.Duration) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.CacheFlushInt = interval
+	}
+}
+
+// Установка выбора лидера среди реплик: фоновые задачи хранилища выполняются только на лидере.
+func SetLease(b bool) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.Lease = b
+	}
+}
+
+// Установка интервала захвата и проверки аренды лидера.
+func SetLeaseInt(interval time.Duration) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.LeaseInt = interval
+	}
+}
+
+// Установка времени хранения ключей идемпотентности пакетов метрик.
+func SetDedupWindow(window time.Duration) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StorageConfig.DedupWindow = window
+	}
+}
+
+// Установка наибольшего кол-ва метрик в хранилище.
+func SetMaxSeries(limit int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.Limits.MaxSeries = limit
+	}
+}
+
+// Установка наибольшего кол-ва метрик, созданных одним агентом.
+func SetMaxAgentSeries(limit int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.Limits.MaxAgentSeries = limit
+	}
+}
+
+// Установка наибольшего кол-ва метрик в одном пакете.
+func SetMaxBatch(limit int) FuncOpt {
+	return func(cfg *Config) {
+		cfg.Limits.MaxBatch = limit
+	}
+}
+
+// Установка политики обработки устаревших значений gauge [accept|ignore|reject].
+func SetStalePolicy(policy string) FuncOpt {
+	return func(cfg *Config) {
+		cfg.StalePolicy = policy
+	}
+}
+
 // Установка ключа.
 func SetKey(key string) FuncOpt {
 	return func(cfg *Config) {
@@ -1,6 +1,10 @@
 package config
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+)
 
 func TestNewConfig(t *testing.T) {
 	type testCase struct {
@@ -66,6 +70,41 @@ func TestNewConfig(t *testing.T) {
 				return cfg.CryptoKeyPath == ""
 			},
 		},
+		{
+			name:  "setStalePolicy",
+			fnOpt: SetStalePolicy("reject"),
+			fnCheck: func(cfg Config) bool {
+				return cfg.StalePolicy == "reject"
+			},
+		},
+		{
+			name:  "setDedupWindow",
+			fnOpt: SetDedupWindow(time.Minute),
+			fnCheck: func(cfg Config) bool {
+				return cfg.DedupWindow == time.Minute
+			},
+		},
+		{
+			name:  "setMaxSeries",
+			fnOpt: SetMaxSeries(100),
+			fnCheck: func(cfg Config) bool {
+				return cfg.Limits.MaxSeries == 100
+			},
+		},
+		{
+			name:  "setMaxAgentSeries",
+			fnOpt: SetMaxAgentSeries(10),
+			fnCheck: func(cfg Config) bool {
+				return cfg.Limits.MaxAgentSeries == 10
+			},
+		},
+		{
+			name:  "setMaxBatch",
+			fnOpt: SetMaxBatch(50),
+			fnCheck: func(cfg Config) bool {
+				return cfg.Limits.MaxBatch == 50
+			},
+		},
 		{
 			name:  "setLogLevel",
 			fnOpt: SetLogLevel("logLevel"),
@@ -88,3 +127,9 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestNewConfigSnapshotKeepErr(t *testing.T) {
+	if _, err := New(SetSnapshotKeep(-1)); !errors.Is(err, ErrConfig) {
+		t.Fatalf("want ErrConfig, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Реестр драйверов хранилищ метрик сервера.
+// Драйвер - фабрика хранилища для схемы строки подключения 'scheme://...'.
+// Встроенные драйверы регистрирует пакет internal/store, сторонние -
+// init пакета с реализацией, в том числе из другого модуля:
+//
+//	func init() {
+//		driver.Register("s3", func(dsn string, cfg config.StorageConfig) (driver.Storage, error) {
+//			return s3.New(dsn), nil
+//		})
+//	}
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/server/config"
+)
+
+const schemeSepConst = "://"
+
+var (
+	// ErrStorageURL строка подключения не в виде 'scheme://...'.
+	ErrStorageURL = errors.New("storage url not valid")
+	// ErrDriverNotFound драйвер схемы не зарегистрирован.
+	ErrDriverNotFound = errors.New("storage driver not registered")
+	// ErrNotFound хранилище возвращает из Get, если метрики нет.
+	ErrNotFound = serr.ErrNotFound
+)
+
+// Типы метрик для реализации хранилища вне модуля.
+type (
+	Info   = model.Info
+	Type   = model.Type
+	Value  = model.Value
+	Meta   = model.Meta
+	Metric = model.Metric
+)
+
+// Storage хранилище метрик.
+type Storage interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Ping() error
+	Get(ctx context.Context, mInfo Info) (Metric, error)
+	Update(ctx context.Context, met Metric) (Metric, error)
+	List(ctx context.Context) ([]Metric, error)
+	AddBatch(ctx context.Context, arr []Metric) error
+}
+
+// Factory создает хранилище по строке подключения dsn вида 'scheme://...'.
+// Остальные параметры хранилища берутся из cfg.
+type Factory func(dsn string, cfg config.StorageConfig) (Storage, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Factory)
+)
+
+// Register регистрирует фабрику хранилища для схемы name.
+// Паникует, если factory == nil или схема уже зарегистрирована.
+// Предназначена для вызова из init пакета с реализацией хранилища.
+func Register(name string, factory Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if factory == nil {
+		panic("driver: Register factory is nil")
+	}
+
+	name = strings.ToLower(name)
+
+	if _, dup := drivers[name]; dup {
+		panic("driver: Register called twice for driver " + name)
+	}
+
+	drivers[name] = factory
+}
+
+// Drivers возвращает отсортированный список зарегистрированных схем.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	list := make([]string, 0, len(drivers))
+	for name := range drivers {
+		list = append(list, name)
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+// Open создает хранилище зарегистрированным драйвером по схеме из dsn.
+func Open(dsn string, cfg config.StorageConfig) (Storage, error) {
+	scheme, _, ok := strings.Cut(dsn, schemeSepConst)
+	if !ok || scheme == "" {
+		return nil, fmt.Errorf("%w: [%s]", ErrStorageURL, dsn)
+	}
+
+	return OpenDriver(scheme, dsn, cfg)
+}
+
+// OpenDriver создает хранилище драйвером scheme.
+// Строка подключения dsn передается драйверу как есть.
+func OpenDriver(scheme, dsn string, cfg config.StorageConfig) (Storage, error) {
+	driversMu.RLock()
+	factory, ok := drivers[strings.ToLower(scheme)]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", ErrDriverNotFound, scheme)
+	}
+
+	store, err := factory(dsn, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("driver [%s]: %w", scheme, err)
+	}
+
+	return store, nil
+}
+
+// PathFromDSN возвращает путь из строки подключения вида 'scheme://path'.
+// Для 'file:///tmp/db' возвращает '/tmp/db', для 'file://db' - 'db'.
+func PathFromDSN(dsn string) string {
+	_, path, _ := strings.Cut(dsn, schemeSepConst)
+
+	return path
+}
@@ -0,0 +1,63 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/AndreyVLZ/metrics/server/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type customStore struct {
+	adapter.PingAdapter
+	dsn string
+}
+
+func (s customStore) Name() string { return "custom" }
+
+func TestRegister(t *testing.T) {
+	Register("custom", func(dsn string, _ config.StorageConfig) (Storage, error) {
+		return customStore{PingAdapter: adapter.Ping(inmemory.New()), dsn: dsn}, nil
+	})
+
+	assert.Contains(t, Drivers(), "custom")
+
+	store, err := Open("CUSTOM://some/where", config.StorageConfig{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "custom", store.Name())
+		assert.Equal(t, "CUSTOM://some/where", store.(customStore).dsn)
+
+		_, err = store.Update(context.Background(), model.NewCounterMetric("Counter-1", 1))
+		assert.NoError(t, err)
+
+		_, err = store.Get(context.Background(), Info{MName: "Counter-2", MType: model.TypeCountConst})
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+
+	t.Run("duplicate", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Register("CUSTOM", func(_ string, _ config.StorageConfig) (Storage, error) { return nil, nil })
+		})
+	})
+
+	t.Run("nil factory", func(t *testing.T) {
+		assert.Panics(t, func() { Register("nil", nil) })
+	})
+}
+
+func TestOpenErr(t *testing.T) {
+	_, err := Open("/tmp/metrics-db.json", config.StorageConfig{})
+	assert.ErrorIs(t, err, ErrStorageURL)
+
+	_, err = Open("mongodb://localhost", config.StorageConfig{})
+	assert.ErrorIs(t, err, ErrDriverNotFound)
+}
+
+func TestPathFromDSN(t *testing.T) {
+	assert.Equal(t, "/tmp/db", PathFromDSN("file:///tmp/db"))
+	assert.Equal(t, "db", PathFromDSN("bolt://db"))
+	assert.Equal(t, "", PathFromDSN("mem://"))
+}
@@ -27,7 +27,12 @@ func ExampleNew() {
 		log.Error("new config", "err", err)
 	}
 
-	srv := server.New(cfg, log)
+	srv, err := server.New(cfg, log)
+	if err != nil {
+		log.Error("new server", "err", err)
+
+		return
+	}
 
 	chErr := make(chan error)
 	go func() {
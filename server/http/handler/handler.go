@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -11,14 +12,23 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/AndreyVLZ/metrics/internal/dump"
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/server/service"
 )
 
 const (
-	ApplicationJSONConst = "application/json" // Константа для Content-Type app/json.
-	TextHTMLConst        = "text/html"        // Константа для Content-Type text/html.
+	ApplicationJSONConst = "application/json"         // Константа для Content-Type app/json.
+	TextHTMLConst        = "text/html"                // Константа для Content-Type text/html.
+	OctetStreamConst     = "application/octet-stream" // Константа для Content-Type бинарных данных.
+
+	IdempotencyKeyHeader = "Idempotency-Key"     // Заголовок с ключом идемпотентности пакета метрик.
+	ReplayedHeader       = "Idempotent-Replayed" // Заголовок ответа на повтор уже примененного пакета.
+	idempotencyKeyMaxLen = 100                   // Наибольшая длина ключа идемпотентности.
 )
 
+var errIdempotencyKey = errors.New("idempotency key too long")
+
 type srvUpdater interface {
 	Update(ctx context.Context, met model.MetricJSON) (model.MetricJSON, error)
 }
@@ -28,6 +38,10 @@ type srvBatch interface {
 	AddBatch(ctx context.Context, arr []model.MetricJSON) error
 }
 
+type srvBatchOnce interface {
+	AddBatchOnce(ctx context.Context, key string, arr []model.MetricJSON) (bool, error)
+}
+
 type srvGetter interface {
 	Get(ctx context.Context, info model.Info) (model.MetricJSON, error)
 }
@@ -36,6 +50,24 @@ type srvPing interface {
 	Ping() error
 }
 
+type srvBackup interface {
+	Backup(ctx context.Context, w io.Writer) error
+}
+
+type srvCardinality interface {
+	Cardinality(ctx context.Context) (service.Cardinality, error)
+}
+
+type srvDump interface {
+	Export(ctx context.Context, w io.Writer, format dump.Format) error
+	Import(ctx context.Context, r io.Reader, format dump.Format) (int, error)
+}
+
+// ImportResult ответ на импорт метрик.
+type ImportResult struct {
+	Imported int `json:"imported"`
+}
+
 // Обновление метрики. [POST-JSON].
 // Чтение Body, запись в ResponseWriter ответа от service.
 func PostJSONUpdateHandle(srv srvUpdater, log *slog.Logger) http.Handler {
@@ -51,7 +83,7 @@ func PostJSONUpdateHandle(srv srvUpdater, log *slog.Logger) http.Handler {
 		metDB, err := srv.Update(req.Context(), met)
 		if err != nil {
 			log.Error("postJsonUpdHandler", "update", err)
-			http.Error(rw, err.Error(), http.StatusBadRequest)
+			http.Error(rw, err.Error(), updateStatus(err))
 
 			return
 		}
@@ -82,7 +114,7 @@ func PostUpdateHandle(srv srvUpdater, log *slog.Logger, fn func(req *http.Reques
 		metDB, err := srv.Update(req.Context(), met)
 		if err != nil {
 			log.Error("postUpdateHandler", "update error", err)
-			http.Error(rw, err.Error(), http.StatusBadRequest)
+			http.Error(rw, err.Error(), updateStatus(err))
 
 			return
 		}
@@ -166,10 +198,19 @@ func PostValueHandle(srv srvGetter, log *slog.Logger) http.Handler {
 
 // Обновление списка метрик. [POST].
 // Чтение Body, запись в ResponseWriter ответа от service.
-func PostUpdatesHandler(srv srvBatch, log *slog.Logger) http.Handler {
+// Пакет с заголовком Idempotency-Key применяется один раз,
+// на повтор отвечает 200 с заголовком Idempotent-Replayed.
+func PostUpdatesHandler(srv srvBatchOnce, log *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		var list []model.MetricJSON
 
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if len(key) > idempotencyKeyMaxLen {
+			http.Error(rw, errIdempotencyKey.Error(), http.StatusBadRequest)
+
+			return
+		}
+
 		body := req.Body
 		defer body.Close()
 
@@ -180,16 +221,42 @@ func PostUpdatesHandler(srv srvBatch, log *slog.Logger) http.Handler {
 			return
 		}
 
-		if err := srv.AddBatch(req.Context(), list); err != nil {
+		applied, err := srv.AddBatchOnce(req.Context(), key, list)
+		if err != nil {
 			log.Error("postUpdatesHandler", "srvAddBatch error", err)
 
-			http.Error(rw, err.Error(), http.StatusBadRequest)
+			http.Error(rw, err.Error(), updateStatus(err))
 
 			return
 		}
+
+		if !applied {
+			log.Debug("postUpdatesHandler", "replayed", key)
+			rw.Header().Set(ReplayedHeader, "true")
+		}
 	})
 }
 
+// updateStatus возвращает код ответа для ошибки обновления метрик:
+// 400 для неверной метрики, в том числе отклоненной хранилищем, 409 для устаревшего значения,
+// 429 при превышении лимита кол-ва метрик, 413 для слишком большого пакета.
+// Прочие ошибки - ошибки хранилища, например недоступность БД: 500,
+// клиент может повторить запрос позже.
+func updateStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrStale):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrSeriesLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrBatchTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // Получение списка метрик. [GET].
 // Запись в ResponseWriter ответа от service.
 func ListHandle(srv srvBatch, tmpl *template.Template, log *slog.Logger) http.Handler {
@@ -233,6 +300,159 @@ func PingHandler(srv srvPing, log *slog.Logger) http.Handler {
 	})
 }
 
+// streamer ответ, который буферизуется middleware: Stream переключает
+// его в потоковую запись.
+type streamer interface {
+	Stream()
+}
+
+// stream переключает rw в потоковую запись, если rw буферизуется.
+func stream(rw http.ResponseWriter) {
+	if s, ok := rw.(streamer); ok {
+		s.Stream()
+	}
+}
+
+// abort обрывает соединение ответа, запись которого уже начата:
+// клиент получает ошибку чтения тела, а не ответ 200 с неполным телом.
+func abort() {
+	panic(http.ErrAbortHandler)
+}
+
+// Резервная копия хранилища. [GET].
+// Потоковая запись в ResponseWriter согласованного снимка хранилища.
+// Если ошибка возникла до начала записи снимка - отвечает кодом ошибки,
+// иначе соединение обрывается с неполным телом ответа.
+func BackupHandle(srv srvBackup, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		stream(rw)
+		rw.Header().Set("Content-Type", OctetStreamConst)
+		rw.Header().Set("Content-Disposition", `attachment; filename="metrics.db"`)
+
+		cw := &countWriter{w: rw}
+
+		if err := srv.Backup(req.Context(), cw); err != nil {
+			log.Error("backupHandler", "srvBackup error", err)
+
+			if cw.n > 0 {
+				abort()
+			}
+
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrBackupNotSupport) {
+				status = http.StatusNotImplemented
+			}
+
+			rw.Header().Del("Content-Disposition")
+			http.Error(rw, err.Error(), status)
+		}
+	})
+}
+
+// Выгрузка всех метрик. [GET].
+// Формат задается параметром запроса format [jsonl|csv], по умолчанию jsonl.
+// Если ошибка возникла до начала записи - отвечает кодом ошибки,
+// иначе соединение обрывается с неполным телом ответа.
+func ExportHandle(srv srvDump, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		format, err := dump.ParseFormat(req.URL.Query().Get("format"))
+		if err != nil {
+			log.Error("exportHandler", "parse format error", err)
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		stream(rw)
+		rw.Header().Set("Content-Type", format.ContentType())
+		rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="metrics.%s"`, format))
+
+		cw := &countWriter{w: rw}
+
+		if err := srv.Export(req.Context(), cw, format); err != nil {
+			log.Error("exportHandler", "srvExport error", err)
+
+			if cw.n > 0 {
+				abort()
+			}
+
+			rw.Header().Del("Content-Disposition")
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Загрузка метрик из Body. [POST].
+// Формат задается параметром запроса format [jsonl|csv], по умолчанию jsonl.
+// Отвечает кол-вом добавленных метрик.
+func ImportHandle(srv srvDump, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		defer req.Body.Close()
+
+		format, err := dump.ParseFormat(req.URL.Query().Get("format"))
+		if err != nil {
+			log.Error("importHandler", "parse format error", err)
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		count, err := srv.Import(req.Context(), req.Body, format)
+		if err != nil {
+			log.Error("importHandler", "srvImport error", err, "imported", count)
+
+			status := updateStatus(err)
+			if errors.Is(err, dump.ErrDecode) {
+				status = http.StatusBadRequest
+			}
+
+			http.Error(rw, fmt.Sprintf("imported %d: %v", count, err), status)
+
+			return
+		}
+
+		rw.Header().Set("Content-Type", ApplicationJSONConst)
+
+		if err := json.NewEncoder(rw).Encode(ImportResult{Imported: count}); err != nil {
+			log.Error("importHandler", "encode error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Текущее кол-во метрик по агентам и лимиты. [GET].
+func CardinalityHandle(srv srvCardinality, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		card, err := srv.Cardinality(req.Context())
+		if err != nil {
+			log.Error("cardinalityHandler", "srvCardinality error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		rw.Header().Set("Content-Type", ApplicationJSONConst)
+
+		if err := json.NewEncoder(rw).Encode(card); err != nil {
+			log.Error("cardinalityHandler", "encode error", err)
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// countWriter считает кол-во записанных байт.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
+
 // Чтение метрики из Body.
 func metricFromBoby(body io.ReadCloser) (model.MetricJSON, error) {
 	defer body.Close()
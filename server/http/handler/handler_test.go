@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
@@ -11,7 +12,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/AndreyVLZ/metrics/internal/dump"
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/server/service"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,6 +22,8 @@ type fakeSrv struct {
 	err        error
 	mJSON      model.MetricJSON
 	arrMetJSON []model.MetricJSON
+	replayed   bool
+	partial    bool // Backup и Export возвращают err после записи части данных
 }
 
 func (fsrv fakeSrv) Update(_ context.Context, met model.MetricJSON) (model.MetricJSON, error) {
@@ -53,6 +58,22 @@ func (fsrv fakeSrv) AddBatch(_ context.Context, arr []model.MetricJSON) error {
 	return nil
 }
 
+func (fsrv fakeSrv) AddBatchOnce(_ context.Context, _ string, arr []model.MetricJSON) (bool, error) {
+	if fsrv.err != nil {
+		return false, fsrv.err
+	}
+
+	return !fsrv.replayed, nil
+}
+
+func (fsrv fakeSrv) Cardinality(_ context.Context) (service.Cardinality, error) {
+	if fsrv.err != nil {
+		return service.Cardinality{}, fsrv.err
+	}
+
+	return service.Cardinality{Total: 2, Agents: map[string]int{"agent-1": 2}}, nil
+}
+
 func (fsrv fakeSrv) Ping() error {
 	if fsrv.err != nil {
 		return fsrv.err
@@ -61,6 +82,40 @@ func (fsrv fakeSrv) Ping() error {
 	return nil
 }
 
+func (fsrv fakeSrv) Backup(_ context.Context, w io.Writer) error {
+	if fsrv.err != nil && !fsrv.partial {
+		return fsrv.err
+	}
+
+	if _, err := io.WriteString(w, "backup"); err != nil {
+		return err
+	}
+
+	return fsrv.err
+}
+
+func (fsrv fakeSrv) Export(_ context.Context, w io.Writer, format dump.Format) error {
+	if fsrv.err != nil && !fsrv.partial {
+		return fsrv.err
+	}
+
+	if _, err := io.WriteString(w, "export "+string(format)); err != nil {
+		return err
+	}
+
+	return fsrv.err
+}
+
+func (fsrv fakeSrv) Import(_ context.Context, r io.Reader, _ dump.Format) (int, error) {
+	if fsrv.err != nil {
+		return 0, fsrv.err
+	}
+
+	data, err := io.ReadAll(r)
+
+	return len(strings.Split(string(data), "\n")), err
+}
+
 func TestPostJSONUpdateHandle(t *testing.T) {
 	type testCase struct {
 		body   io.Reader
@@ -103,10 +158,19 @@ func TestPostJSONUpdateHandle(t *testing.T) {
 			body: strings.NewReader(
 				`{"id":"a123","type":"counter","delta":100}`,
 			),
-			status: http.StatusBadRequest,
+			status: http.StatusInternalServerError,
 			header: ApplicationJSONConst,
 			srv:    fakeSrv{err: errors.New("srv error")},
 		},
+		{
+			name: "srv err stale",
+			body: strings.NewReader(
+				`{"id":"a123","type":"gauge","value":10,"ts":"2024-01-02T03:04:05Z"}`,
+			),
+			status: http.StatusConflict,
+			header: ApplicationJSONConst,
+			srv:    fakeSrv{err: fmt.Errorf("%w: a123", service.ErrStale)},
+		},
 	}
 
 	for _, test := range tc {
@@ -208,7 +272,7 @@ func TestPostUpdateHandle(t *testing.T) {
 					Val: "100",
 				}
 			},
-			status: http.StatusBadRequest,
+			status: http.StatusInternalServerError,
 			srv:    fakeSrv{err: errors.New("service error")},
 		},
 	}
@@ -500,10 +564,12 @@ func TestPostValueHandle(t *testing.T) {
 
 func TestPostUpdatesHandler(t *testing.T) {
 	type testCase struct {
-		body   io.Reader
-		srv    srvBatch
-		name   string
-		status int
+		body     io.Reader
+		srv      srvBatchOnce
+		name     string
+		key      string
+		replayed string
+		status   int
 	}
 
 	tc := []testCase{
@@ -516,6 +582,27 @@ func TestPostUpdatesHandler(t *testing.T) {
 			srv:    fakeSrv{},
 		},
 
+		{
+			name: "replayed",
+			body: strings.NewReader(
+				`[{"id":"PollCount","type":"counter","delta":100}]`,
+			),
+			key:      "key-1",
+			replayed: "true",
+			status:   http.StatusOK,
+			srv:      fakeSrv{replayed: true},
+		},
+
+		{
+			name: "err key too long",
+			body: strings.NewReader(
+				`[{"id":"PollCount","type":"counter","delta":100}]`,
+			),
+			key:    strings.Repeat("k", idempotencyKeyMaxLen+1),
+			status: http.StatusBadRequest,
+			srv:    fakeSrv{},
+		},
+
 		{
 			name:   "err not valid body",
 			body:   strings.NewReader("{{{"),
@@ -528,9 +615,45 @@ func TestPostUpdatesHandler(t *testing.T) {
 			body: strings.NewReader(
 				`[{"id":"PollCount","type":"counter","delta":100},{"id":"Alloc","type":"gauge","value":10.01}]`,
 			),
-			status: http.StatusBadRequest,
+			status: http.StatusInternalServerError,
 			srv:    fakeSrv{err: errors.New("srv custom err")},
 		},
+
+		{
+			name: "err srv invalid",
+			body: strings.NewReader(
+				`[{"id":"PollCount","type":"counter"}]`,
+			),
+			status: http.StatusBadRequest,
+			srv:    fakeSrv{err: fmt.Errorf("%w: delta is nil", service.ErrInvalid)},
+		},
+
+		{
+			name: "err srv stale",
+			body: strings.NewReader(
+				`[{"id":"Alloc","type":"gauge","value":10.01,"ts":"2024-01-02T03:04:05Z"}]`,
+			),
+			status: http.StatusConflict,
+			srv:    fakeSrv{err: fmt.Errorf("%w: Alloc", service.ErrStale)},
+		},
+
+		{
+			name: "err srv series limit",
+			body: strings.NewReader(
+				`[{"id":"PollCount","type":"counter","delta":100}]`,
+			),
+			status: http.StatusTooManyRequests,
+			srv:    fakeSrv{err: fmt.Errorf("%w: 2 > 1", service.ErrSeriesLimit)},
+		},
+
+		{
+			name: "err srv batch too large",
+			body: strings.NewReader(
+				`[{"id":"PollCount","type":"counter","delta":100}]`,
+			),
+			status: http.StatusRequestEntityTooLarge,
+			srv:    fakeSrv{err: fmt.Errorf("%w: 2 > 1", service.ErrBatchTooLarge)},
+		},
 	}
 
 	for _, test := range tc {
@@ -542,6 +665,7 @@ func TestPostUpdatesHandler(t *testing.T) {
 				http.MethodGet, "/value/",
 				test.body,
 			).WithContext(ctx)
+			req.Header.Set(IdempotencyKeyHeader, test.key)
 
 			h := PostUpdatesHandler(test.srv, log)
 			rw := httptest.NewRecorder()
@@ -556,6 +680,8 @@ func TestPostUpdatesHandler(t *testing.T) {
 			if res.StatusCode != http.StatusOK {
 				return
 			}
+
+			assert.Equal(t, test.replayed, res.Header.Get(ReplayedHeader))
 		})
 	}
 }
@@ -702,6 +828,275 @@ func TestPingHandler(t *testing.T) {
 	}
 }
 
+func TestBackupHandle(t *testing.T) {
+	type testCase struct {
+		srv    srvBackup
+		name   string
+		body   string
+		status int
+	}
+
+	tc := []testCase{
+		{
+			name:   "ok",
+			srv:    fakeSrv{},
+			status: http.StatusOK,
+			body:   "backup",
+		},
+		{
+			name:   "err not support",
+			srv:    fakeSrv{err: service.ErrBackupNotSupport},
+			status: http.StatusNotImplemented,
+		},
+		{
+			name:   "err",
+			srv:    fakeSrv{err: errors.New("err srv.Backup")},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/backup", http.NoBody)
+
+			h := BackupHandle(test.srv, slog.Default())
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			res := rw.Result()
+			defer res.Body.Close()
+
+			// проверяем код ответа
+			assert.Equal(t, test.status, res.StatusCode)
+
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("read body: %v\n", err)
+			}
+
+			assert.Equal(t, OctetStreamConst, res.Header.Get("Content-Type"))
+			assert.Equal(t, test.body, string(data))
+		})
+	}
+}
+
+func TestExportHandle(t *testing.T) {
+	type testCase struct {
+		srv         srvDump
+		name        string
+		query       string
+		body        string
+		contentType string
+		status      int
+	}
+
+	tc := []testCase{
+		{
+			name:        "default format",
+			srv:         fakeSrv{},
+			status:      http.StatusOK,
+			body:        "export jsonl",
+			contentType: "application/x-ndjson",
+		},
+		{
+			name:        "csv",
+			srv:         fakeSrv{},
+			query:       "?format=csv",
+			status:      http.StatusOK,
+			body:        "export csv",
+			contentType: "text/csv",
+		},
+		{
+			name:   "err format",
+			srv:    fakeSrv{},
+			query:  "?format=xml",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "err",
+			srv:    fakeSrv{err: errors.New("err srv.Export")},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/export"+test.query, http.NoBody)
+
+			h := ExportHandle(test.srv, slog.Default())
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			res := rw.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, test.status, res.StatusCode)
+
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("read body: %v\n", err)
+			}
+
+			assert.Equal(t, test.contentType, res.Header.Get("Content-Type"))
+			assert.Equal(t, test.body, string(data))
+		})
+	}
+}
+
+// Оборванная выгрузка не должна выглядеть для клиента полным ответом.
+func TestDumpHandlePartial(t *testing.T) {
+	srv := fakeSrv{err: errors.New("err read store"), partial: true}
+
+	tc := []struct {
+		name string
+		h    http.Handler
+	}{
+		{name: "backup", h: BackupHandle(srv, slog.Default())},
+		{name: "export", h: ExportHandle(srv, slog.Default())},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			ts := httptest.NewServer(test.h)
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL)
+			if err == nil {
+				defer res.Body.Close()
+
+				_, err = io.ReadAll(res.Body)
+			}
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestImportHandle(t *testing.T) {
+	type testCase struct {
+		srv    srvDump
+		name   string
+		query  string
+		body   string
+		status int
+	}
+
+	tc := []testCase{
+		{
+			name:   "ok",
+			srv:    fakeSrv{},
+			status: http.StatusOK,
+			body:   `{"imported":2}` + "\n",
+		},
+		{
+			name:   "err format",
+			srv:    fakeSrv{},
+			query:  "?format=xml",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "err decode",
+			srv:    fakeSrv{err: fmt.Errorf("%w: bad data", dump.ErrDecode)},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "err store",
+			srv:    fakeSrv{err: errors.New("err srv.Import")},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "err series limit",
+			srv:    fakeSrv{err: fmt.Errorf("%w: series 3 > 2", service.ErrSeriesLimit)},
+			status: http.StatusTooManyRequests,
+		},
+		{
+			name:   "err stale",
+			srv:    fakeSrv{err: fmt.Errorf("%w: [Alloc]", service.ErrStale)},
+			status: http.StatusConflict,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/import"+test.query, strings.NewReader("a\nb"))
+
+			h := ImportHandle(test.srv, slog.Default())
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			res := rw.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, test.status, res.StatusCode)
+
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("read body: %v\n", err)
+			}
+
+			assert.Equal(t, test.body, string(data))
+		})
+	}
+}
+
+func TestCardinalityHandle(t *testing.T) {
+	tc := []struct {
+		srv    srvCardinality
+		name   string
+		body   string
+		status int
+	}{
+		{
+			name:   "ok",
+			srv:    fakeSrv{},
+			status: http.StatusOK,
+			body:   `{"agents":{"agent-1":2},"limits":{"maxSeries":0,"maxAgentSeries":0,"maxBatch":0},"total":2}` + "\n",
+		},
+		{
+			name:   "err",
+			srv:    fakeSrv{err: errors.New("err srv.Cardinality")},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/cardinality", http.NoBody)
+
+			rw := httptest.NewRecorder()
+			CardinalityHandle(test.srv, slog.Default()).ServeHTTP(rw, req)
+
+			res := rw.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, test.status, res.StatusCode)
+
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("read body: %v\n", err)
+			}
+
+			assert.Equal(t, test.body, string(data))
+		})
+	}
+}
+
 func TestParseMetricJSON(t *testing.T) {
 	t.Run("parse counter ok", func(t *testing.T) {
 		var delta int64 = 10
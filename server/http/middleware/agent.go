@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/AndreyVLZ/metrics/server/service"
+)
+
+// AgentHeader заголовок с идентификатором агента.
+const AgentHeader = "X-Agent-ID"
+
+// Agent Middleware передает сервису идентификатор агента, приславшего метрики,
+// по которому считается лимит метрик агента.
+// Заголовок X-Agent-ID учитывается только у запросов с подписью, проверенной Hash:
+// иначе клиент мог бы обойти лимит, меняя заголовок. Без проверенной
+// подписи идентификатор агента - адрес клиента.
+func Agent() Middle {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			agent := req.Header.Get(AgentHeader)
+			if agent == "" || !signed(req) {
+				agent = remoteHost(req.RemoteAddr)
+			}
+
+			next.ServeHTTP(rw, req.WithContext(service.WithAgent(req.Context(), agent)))
+		})
+	}
+}
+
+// remoteHost возвращает адрес клиента без порта.
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
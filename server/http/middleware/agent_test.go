@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/pkg/hash"
+	"github.com/AndreyVLZ/metrics/server/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgent(t *testing.T) {
+	tc := []struct {
+		name   string
+		header string
+		signed bool
+		want   string
+	}{
+		{name: "signed header", header: "agent-1", signed: true, want: "agent-1"},
+		{name: "unsigned header", header: "agent-1", want: "192.0.2.1"},
+		{name: "remote addr", signed: true, want: "192.0.2.1"},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			var agent string
+
+			next := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				agent = service.AgentFrom(req.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", http.NoBody)
+			if test.header != "" {
+				req.Header.Set(AgentHeader, test.header)
+			}
+
+			if test.signed {
+				req = req.WithContext(context.WithValue(req.Context(), signedCtxKey{}, true))
+			}
+
+			Agent()(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, test.want, agent)
+		})
+	}
+}
+
+func TestAgentHash(t *testing.T) {
+	const key = "key"
+
+	body := []byte(`[]`)
+
+	sum, err := hash.SHA256(body, []byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		name string
+		sha  string
+		want string
+	}{
+		{name: "valid MAC", sha: hex.EncodeToString(sum), want: "agent-1"},
+		{name: "no MAC", want: "192.0.2.1"},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			var agent string
+
+			next := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+				agent = service.AgentFrom(req.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set(AgentHeader, "agent-1")
+
+			if test.sha != "" {
+				req.Header.Set("HashSHA256", test.sha)
+			}
+
+			Hash(key, Agent()(next)).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, test.want, agent)
+		})
+	}
+}
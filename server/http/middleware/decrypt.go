@@ -10,6 +10,7 @@ import (
 )
 
 // Decrypt Расшифровывает req.Body приватным ключом.
+// Пустое тело передается как есть.
 func Decrypt(privateKey *rsa.PrivateKey, next http.Handler) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		if privateKey == nil {
@@ -25,6 +26,14 @@ func Decrypt(privateKey *rsa.PrivateKey, next http.Handler) http.HandlerFunc {
 			return
 		}
 
+		// запрос без тела, например GET /admin/export
+		if len(bodyByte) == 0 {
+			req.Body = io.NopCloser(bytes.NewReader(bodyByte))
+			next.ServeHTTP(rw, req)
+
+			return
+		}
+
 		cipher, err := mycrypto.Decrypt(privateKey, bodyByte)
 		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
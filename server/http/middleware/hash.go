@@ -2,40 +2,151 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
+	stdhash "hash"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/AndreyVLZ/metrics/pkg/hash"
 )
 
+const (
+	// hashHeader заголовок подписи тела, в потоковом ответе - трейлер.
+	hashHeader = "HashSHA256"
+	// hashTimeHeader заголовок времени подписи запроса (unix, секунды).
+	// С ним подпись покрывает метод, путь и время запроса, см. [hash.RequestMessage].
+	hashTimeHeader = "HashTime"
+	// signMaxAge наибольшее расхождение времени подписи запроса и сервера.
+	signMaxAge = 5 * time.Minute
+)
+
+type (
+	signedCtxKey        struct{}
+	signedRequestCtxKey struct{}
+)
+
+// signed возвращает true, если подпись тела запроса проверена Hash.
+func signed(req *http.Request) bool {
+	ok, _ := req.Context().Value(signedCtxKey{}).(bool)
+
+	return ok
+}
+
+// signedRequest возвращает true, если Hash проверил подпись запроса
+// со временем подписи не старше signMaxAge.
+func signedRequest(req *http.Request) bool {
+	ok, _ := req.Context().Value(signedRequestCtxKey{}).(bool)
+
+	return ok
+}
+
+// Signed Middleware пропускает только запросы с подписью ключом key, проверенной Hash,
+// которая покрывает метод, путь и время запроса (заголовок HashTime):
+// подпись только тела GET-запроса была бы одинаковой для всех запросов
+// и подходила бы к любому из них. Повтор запроса возможен только в пределах signMaxAge.
+// Запрос без такой подписи отклоняется ответом 401. Пустой key - без проверки.
+func Signed(key string) Middle {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if key != "" && !signedRequest(req) {
+				http.Error(rw, "request not signed", http.StatusUnauthorized)
+
+				return
+			}
+
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// hashWriter буферизует ответ, чтобы передать его подпись в заголовке.
+// Потоковый ответ (см. [hashWriter.Stream]) не буферизуется.
 type hashWriter struct {
 	rw     http.ResponseWriter
 	buf    *bytes.Buffer
+	mac    stdhash.Hash // подпись потокового ответа, nil - ответ буферизуется
+	key    []byte
 	status int
+	sent   bool // заголовки потокового ответа отправлены
 }
 
-func newHashWriter(rw http.ResponseWriter) *hashWriter {
+func newHashWriter(rw http.ResponseWriter, key []byte) *hashWriter {
 	buf := bytes.NewBuffer([]byte{})
 
 	return &hashWriter{
 		rw:     rw,
 		buf:    buf,
+		key:    key,
 		status: http.StatusOK,
 	}
 }
 
+// Stream переключает ответ в потоковую запись: тело передается клиенту
+// по мере записи, а подпись - трейлером HashSHA256 после тела.
+// Вызывается обработчиком до записи ответа, например при выгрузке
+// всего хранилища, которая не должна целиком храниться в памяти.
+func (hw *hashWriter) Stream() {
+	if hw.mac == nil {
+		hw.mac = hash.New(hw.key)
+	}
+}
+
 func (hw *hashWriter) Header() http.Header {
 	return hw.rw.Header()
 }
 
 func (hw *hashWriter) WriteHeader(statusCode int) {
 	hw.status = statusCode
+
+	if hw.mac != nil && !hw.sent {
+		hw.sent = true
+
+		// трейлер объявляется до заголовков: иначе короткий ответ
+		// передается с Content-Length и без трейлера
+		if statusCode < 300 {
+			hw.rw.Header().Set("Trailer", hashHeader)
+		}
+
+		hw.rw.WriteHeader(statusCode)
+	}
 }
 
 func (hw *hashWriter) Write(p []byte) (int, error) {
-	return hw.buf.Write(p)
+	if hw.mac == nil {
+		return hw.buf.Write(p)
+	}
+
+	hw.WriteHeader(hw.status)
+	_, _ = hw.mac.Write(p)
+
+	return hw.rw.Write(p)
+}
+
+// finish передает подпись потокового ответа трейлером.
+// Если обработчик оборвал ответ, трейлер не передается.
+func (hw *hashWriter) finish() {
+	hw.WriteHeader(hw.status)
+
+	if hw.status < 300 {
+		hw.rw.Header().Set(hashHeader, hex.EncodeToString(hw.mac.Sum(nil)))
+	}
+}
+
+// fresh возвращает true, если время подписи ts отличается от now
+// не больше чем на signMaxAge.
+func fresh(ts string, now time.Time) bool {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := now.Sub(time.Unix(sec, 0))
+
+	return age <= signMaxAge && age >= -signMaxAge
 }
 
 // Хеширование данных.
@@ -50,8 +161,10 @@ func Hash(key string, next http.Handler) http.HandlerFunc {
 		}
 
 		// Если установлен Header проверяем MAC
-		sha := req.Header.Get("HashSHA256")
+		sha := req.Header.Get(hashHeader)
 		if sha != "" {
+			ts := req.Header.Get(hashTimeHeader)
+
 			bodyByte, err := io.ReadAll(req.Body)
 			if err != nil {
 				http.Error(rw, err.Error(), http.StatusInternalServerError)
@@ -61,23 +174,41 @@ func Hash(key string, next http.Handler) http.HandlerFunc {
 
 			req.Body = io.NopCloser(bytes.NewReader(bodyByte))
 
-			if isValid, err := hash.ValidMAC(sha, bodyByte, []byte(key)); err != nil || !isValid {
+			message := bodyByte
+			if ts != "" {
+				message = hash.RequestMessage(req.Method, req.URL.RequestURI(), ts, bodyByte)
+			}
+
+			if isValid, err := hash.ValidMAC(sha, message, []byte(key)); err != nil || !isValid {
 				http.Error(rw, "internal errpr", http.StatusInternalServerError)
 
 				return
 			}
+
+			ctx := context.WithValue(req.Context(), signedCtxKey{}, true)
+			if ts != "" && fresh(ts, time.Now()) {
+				ctx = context.WithValue(ctx, signedRequestCtxKey{}, true)
+			}
+
+			req = req.WithContext(ctx)
 		}
 
-		hw := newHashWriter(rw)
+		hw := newHashWriter(rw, []byte(key))
 
 		// передаём управление хендлеру
 		next.ServeHTTP(hw, req)
 
+		if hw.mac != nil {
+			hw.finish()
+
+			return
+		}
+
 		// Вычисляет хеш и передавает его в HTTP-заголовке
 		if hw.buf.Len() > 0 && hw.status < 300 {
 			sum, err := hash.SHA256(hw.buf.Bytes(), []byte(key))
 			if err == nil {
-				hw.Header().Set("HashSHA256", hex.EncodeToString(sum))
+				hw.Header().Set(hashHeader, hex.EncodeToString(sum))
 			}
 		}
 
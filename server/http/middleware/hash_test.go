@@ -2,10 +2,13 @@ package middleware
 
 import (
 	"encoding/hex"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/AndreyVLZ/metrics/pkg/hash"
 	"github.com/stretchr/testify/assert"
@@ -81,3 +84,143 @@ func TestHash(t *testing.T) {
 		})
 	}
 }
+
+func TestSigned(t *testing.T) {
+	const secret = "SECRET-KEY"
+
+	testBody := "TEST STRING"
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*signMaxAge).Unix(), 10)
+
+	sign := func(message []byte) string {
+		sum, err := hash.SHA256(message, []byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return hex.EncodeToString(sum)
+	}
+
+	tc := []struct {
+		name       string
+		key        string
+		sha        string
+		ts         string
+		statusCode int
+	}{
+		{
+			name:       "signed",
+			key:        secret,
+			sha:        sign(hash.RequestMessage(http.MethodPost, "/admin/import", now, []byte(testBody))),
+			ts:         now,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "body signed only",
+			key:        secret,
+			sha:        sign([]byte(testBody)),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "stale",
+			key:        secret,
+			sha:        sign(hash.RequestMessage(http.MethodPost, "/admin/import", stale, []byte(testBody))),
+			ts:         stale,
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "signed other path",
+			key:        secret,
+			sha:        sign(hash.RequestMessage(http.MethodPost, "/admin/export", now, []byte(testBody))),
+			ts:         now,
+			statusCode: http.StatusInternalServerError,
+		},
+		{name: "not signed", key: secret, statusCode: http.StatusUnauthorized},
+		{name: "key empty", statusCode: http.StatusOK},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(testBody))
+			if test.sha != "" {
+				req.Header.Set("HashSHA256", test.sha)
+			}
+
+			if test.ts != "" {
+				req.Header.Set("HashTime", test.ts)
+			}
+
+			next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			ht := httptest.NewRecorder()
+			Hash(test.key, Signed(test.key)(next)).ServeHTTP(ht, req)
+
+			res := ht.Result()
+			if err := res.Body.Close(); err != nil {
+				t.Error(err)
+			}
+
+			assert.Equal(t, test.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestHashStream(t *testing.T) {
+	const (
+		secret   = "SECRET-KEY"
+		testBody = "stream data"
+	)
+
+	tc := []struct {
+		name       string
+		statusCode int
+		trailer    bool
+	}{
+		{name: "ok", statusCode: http.StatusOK, trailer: true},
+		{name: "err", statusCode: http.StatusInternalServerError},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				rw.(interface{ Stream() }).Stream()
+				rw.WriteHeader(test.statusCode)
+
+				if _, err := rw.Write([]byte(testBody)); err != nil {
+					t.Error(err)
+				}
+			})
+
+			ts := httptest.NewServer(Hash(secret, next))
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			data, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, test.statusCode, res.StatusCode)
+			assert.Equal(t, testBody, string(data))
+			assert.Empty(t, res.Header.Get("HashSHA256"))
+
+			sha := res.Trailer.Get("HashSHA256")
+			if !test.trailer {
+				assert.Empty(t, sha)
+
+				return
+			}
+
+			isValid, err := hash.ValidMAC(sha, data, []byte(secret))
+			assert.NoError(t, err)
+			assert.True(t, isValid)
+		})
+	}
+}
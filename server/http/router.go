@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
 
+	"github.com/AndreyVLZ/metrics/internal/dump"
 	"github.com/AndreyVLZ/metrics/internal/model"
 	"github.com/AndreyVLZ/metrics/server/http/handler"
 	m "github.com/AndreyVLZ/metrics/server/http/middleware"
+	svc "github.com/AndreyVLZ/metrics/server/service"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -24,7 +27,10 @@ const tpls = `{{define "List"}}
 <body>
 	<ol type="1">
 	{{ range . }}
-		<li><strong>{{ .ID }}</strong>[{{.MType}}]:{{.String}}</li>
+		<li><strong>{{ .ID }}</strong>[{{.MType}}]:{{.String}}{{ with .Unit }} {{ . }}{{ end }}
+		{{- with .Help }}<br><em>{{ . }}</em>{{ end }}
+		{{- with .Updated }}<br><small>updated: {{ .Format "2006-01-02 15:04:05 MST" }}{{ end }}
+		{{- with .Source }} source: {{ . }}{{ end }}{{ if .Updated }}</small>{{ end }}</li>
 	{{ end }}
 	</ol>
 </body>
@@ -37,14 +43,41 @@ type service interface {
 	Get(ctx context.Context, metInfo model.Info) (model.MetricJSON, error)
 	List(ctx context.Context) ([]model.MetricJSON, error)
 	AddBatch(ctx context.Context, arr []model.MetricJSON) error
+	AddBatchOnce(ctx context.Context, key string, arr []model.MetricJSON) (bool, error)
+	Backup(ctx context.Context, w io.Writer) error
+	Export(ctx context.Context, w io.Writer, format dump.Format) error
+	Import(ctx context.Context, r io.Reader, format dump.Format) (int, error)
+	Cardinality(ctx context.Context) (svc.Cardinality, error)
 }
 
-func NewRoute(srv service, log *slog.Logger) http.Handler {
-	return initChiRouter(srv, log)
+// routeConfig параметры роутера.
+type routeConfig struct {
+	adminKey string // ключ подписи запросов /admin
+}
+
+// FuncOpt опции роутера.
+type FuncOpt func(*routeConfig)
+
+// SetAdminKey устанавливает ключ, подписью которым должны быть
+// подписаны запросы /admin. Подпись проверяется middleware Hash.
+func SetAdminKey(key string) FuncOpt {
+	return func(cfg *routeConfig) {
+		cfg.adminKey = key
+	}
+}
+
+func NewRoute(srv service, log *slog.Logger, opts ...FuncOpt) http.Handler {
+	var cfg routeConfig
+
+	for i := range opts {
+		opts[i](&cfg)
+	}
+
+	return initChiRouter(srv, log, cfg)
 }
 
 // Инициализация chi роутера.
-func initChiRouter(srv service, log *slog.Logger) *chi.Mux {
+func initChiRouter(srv service, log *slog.Logger, cfg routeConfig) *chi.Mux {
 	const (
 		typeChiConst  = "typeStr"
 		nameChiConst  = "name"
@@ -69,10 +102,18 @@ func initChiRouter(srv service, log *slog.Logger) *chi.Mux {
 	route.Route("/", func(r chi.Router) {
 		r.Get("/", handler.ListHandle(srv, tmpl, log).ServeHTTP)
 		r.Get("/ping", handler.PingHandler(srv, log).ServeHTTP)
-		r.Post("/updates/",
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(m.Signed(cfg.adminKey))
+			r.Get("/backup", handler.BackupHandle(srv, log).ServeHTTP)
+			r.Get("/export", handler.ExportHandle(srv, log).ServeHTTP)
+			r.Post("/import", handler.ImportHandle(srv, log).ServeHTTP)
+			r.Get("/cardinality", handler.CardinalityHandle(srv, log).ServeHTTP)
+		})
+		r.With(m.Agent()).Post("/updates/",
 			m.AppJSON()(handler.PostUpdatesHandler(srv, log)).ServeHTTP,
 		)
 		r.Route("/update", func(r chi.Router) {
+			r.Use(m.Agent())
 			r.Post("/",
 				m.AppJSON()(handler.PostJSONUpdateHandle(srv, log)).ServeHTTP,
 			)
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	srv "github.com/AndreyVLZ/metrics/server/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPage(t *testing.T) {
+	ctx := context.Background()
+	store := adapter.Ping(inmemory.New())
+
+	alloc := model.NewGaugeMetric("Alloc", 123456)
+	alloc.Meta = model.Meta{
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Updated: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Unit:    "bytes",
+		Help:    "heap bytes",
+		Source:  "agent-1",
+	}
+
+	for _, met := range []model.Metric{alloc, model.NewCounterMetric("PollCount", 5)} {
+		if _, err := store.Update(ctx, met); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rw := httptest.NewRecorder()
+	NewRoute(srv.New(store), slog.Default()).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	res := rw.Result()
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := string(data)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, page, "<strong>Alloc</strong>[gauge]:123456 bytes<br><em>heap bytes</em>")
+	assert.Contains(t, page, "<small>updated: 2024-01-02 03:04:05 UTC source: agent-1</small>")
+	assert.Contains(t, page, "<strong>PollCount</strong>[counter]:5</li>")
+}
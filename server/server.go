@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/AndreyVLZ/metrics/internal/lease"
 	"github.com/AndreyVLZ/metrics/internal/store"
 	"github.com/AndreyVLZ/metrics/server/config"
 	api "github.com/AndreyVLZ/metrics/server/http"
@@ -26,6 +27,11 @@ type IService interface {
 	Stop(ctx context.Context) error
 }
 
+// Интерфейс хранилища с фоновыми задачами, которые выполняются только на лидере.
+type jobber interface {
+	Jobs() []lease.Service
+}
+
 // Сервер.
 type Server struct {
 	api      iAPI
@@ -35,11 +41,51 @@ type Server struct {
 }
 
 // New Возвращает Сервер с конфигом.
-func New(cfg *config.Config, log *slog.Logger) Server {
-	store := store.New(cfg.StorageConfig)
+// Возвращает ошибку, если хранилище не удалось создать по конфигурации.
+func New(cfg *config.Config, log *slog.Logger) (Server, error) {
+	stalePolicy, err := service.ParseStalePolicy(cfg.StalePolicy)
+	if err != nil {
+		return Server{}, fmt.Errorf("%w", err)
+	}
+
+	storeCfg := cfg.StorageConfig
+	storeCfg.Log = log
+
+	storage, err := store.New(storeCfg)
+	if err != nil {
+		return Server{}, fmt.Errorf("new store: %w", err)
+	}
+
+	services := []IService{storage}
+
+	// фоновые задачи хранилища запускаются только на лидере
+	if cfg.Lease {
+		var jobs []lease.Service
 
-	srv := service.New(store)
-	mux := api.NewRoute(srv, log)
+		if st, ok := storage.(jobber); ok {
+			jobs = st.Jobs()
+		}
+
+		elector := lease.New(
+			lease.Config{Interval: cfg.LeaseInt},
+			store.NewLocker(cfg.StorageConfig),
+			log,
+			jobs...,
+		)
+
+		services = append(services, elector)
+	}
+
+	srv := service.New(storage,
+		service.SetStalePolicy(stalePolicy),
+		service.SetDedupWindow(cfg.DedupWindow),
+		service.SetLimits(service.Limits{
+			MaxSeries:      cfg.Limits.MaxSeries,
+			MaxAgentSeries: cfg.Limits.MaxAgentSeries,
+			MaxBatch:       cfg.Limits.MaxBatch,
+		}),
+	)
+	mux := api.NewRoute(srv, log, api.SetAdminKey(cfg.Key))
 	handler := m.Logging(log,
 		m.Decrypt(cfg.PrivateKey,
 			m.Gzip(
@@ -60,9 +106,9 @@ func New(cfg *config.Config, log *slog.Logger) Server {
 	return Server{
 		cfg:      cfg,
 		api:      httpServer,
-		services: []IService{store},
+		services: services,
 		log:      log,
-	}
+	}, nil
 }
 
 // Start Запуск сервера.
@@ -70,6 +116,8 @@ func (srv *Server) Start(ctx context.Context) error {
 	srv.log.DebugContext(ctx, "start server",
 		slog.String("addr", srv.cfg.Addr),
 		slog.Group("flags",
+			slog.String("storage", srv.cfg.URL),
+			slog.Bool("lease", srv.cfg.Lease),
 			slog.String("storeInterval", srv.cfg.StoreInt.String()),
 			slog.String("storePath", srv.cfg.StorePath),
 			slog.Bool("restore", srv.cfg.IsRestore),
@@ -92,13 +140,14 @@ func (srv *Server) Start(ctx context.Context) error {
 }
 
 // Stop Остановка сервера.
+// Сервисы останавливаются в порядке, обратном запуску.
 func (srv *Server) Stop(ctx context.Context) error {
 	errs := make([]error, 0, len(srv.services)+1)
 	if err := srv.api.Stop(ctx); err != nil {
 		errs = append(errs, err)
 	}
 
-	for i := range srv.services {
+	for i := len(srv.services) - 1; i >= 0; i-- {
 		if err := srv.services[i].Stop(ctx); err != nil {
 			errs = append(errs, fmt.Errorf("service [%s] err: %w", srv.services[i].Name(), err))
 		} else {
@@ -2,11 +2,16 @@ package server
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/AndreyVLZ/metrics/internal/lease"
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store"
 	"github.com/AndreyVLZ/metrics/pkg/log"
 	"github.com/AndreyVLZ/metrics/server/config"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestServerStartStop(t *testing.T) {
@@ -34,7 +39,10 @@ func TestServerStartStop(t *testing.T) {
 		t.Errorf("new config: %v\n", err)
 	}
 
-	srv := New(cfg, log)
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("new server: %v\n", err)
+	}
 
 	t.Cleanup(func() {
 		if err := srv.Stop(ctxStopTimeout); err != nil {
@@ -57,3 +65,141 @@ func TestServerStartStop(t *testing.T) {
 		t.Errorf("start server err: %v\n", err)
 	}
 }
+
+func TestServerNewStorageURL(t *testing.T) {
+	log := log.New(log.SlogKey, log.LevelErr)
+
+	cfg, err := config.New(
+		config.SetStorageURL("unknown://"),
+	)
+
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	if _, err := New(cfg, log); err == nil {
+		t.Errorf("expected error for unknown storage driver\n")
+	}
+}
+
+func TestServerNewStalePolicy(t *testing.T) {
+	log := log.New(log.SlogKey, log.LevelErr)
+
+	cfg, err := config.New(
+		config.SetStorageURL("mem://"),
+		config.SetStalePolicy("drop"),
+	)
+
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	if _, err := New(cfg, log); err == nil {
+		t.Errorf("expected error for unknown stale policy\n")
+	}
+}
+
+func TestServerLease(t *testing.T) {
+	ctx := context.Background()
+	log := log.New(log.SlogKey, log.LevelErr)
+	storePath := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	newServer := func(addr string) Server {
+		cfg, err := config.New(
+			config.SetAddr(addr),
+			config.SetStorePath(storePath),
+			config.SetStoreInt(time.Second),
+			config.SetLease(true),
+		)
+		if err != nil {
+			t.Fatalf("new config: %v\n", err)
+		}
+
+		srv, err := New(cfg, log)
+		if err != nil {
+			t.Fatalf("new server: %v\n", err)
+		}
+
+		return srv
+	}
+
+	srv := newServer("localhost:0")
+	if assert.Len(t, srv.services, 2) {
+		assert.Equal(t, lease.NameConst, srv.services[1].Name())
+	}
+
+	// запуск сервисов без http-сервера
+	for i := range srv.services {
+		if err := srv.services[i].Start(ctx); err != nil {
+			t.Fatalf("start service: %v\n", err)
+		}
+	}
+
+	assert.True(t, srv.services[1].(*lease.Elector).IsLeader())
+
+	// вторая реплика над тем же файлом не становится лидером
+	replica := newServer("localhost:0")
+	if err := replica.services[1].Start(ctx); err != nil {
+		t.Fatalf("start replica elector: %v\n", err)
+	}
+
+	assert.False(t, replica.services[1].(*lease.Elector).IsLeader())
+	assert.NoError(t, replica.services[1].Stop(ctx))
+
+	for i := len(srv.services) - 1; i >= 0; i-- {
+		assert.NoError(t, srv.services[i].Stop(ctx))
+	}
+}
+
+// Снимок файлового хранилища за кэшем сохраняет лидер.
+func TestServerLeaseCache(t *testing.T) {
+	ctx := context.Background()
+	log := log.New(log.SlogKey, log.LevelErr)
+	storePath := filepath.Join(t.TempDir(), "metrics-db.json")
+
+	cfg, err := config.New(
+		config.SetStorePath(storePath),
+		config.SetStoreInt(time.Hour),
+		config.SetCacheMode("behind"),
+		config.SetCacheFlushInt(time.Hour),
+		config.SetLease(true),
+	)
+	if err != nil {
+		t.Fatalf("new config: %v\n", err)
+	}
+
+	srv, err := New(cfg, log)
+	if err != nil {
+		t.Fatalf("new server: %v\n", err)
+	}
+
+	for i := range srv.services {
+		if err := srv.services[i].Start(ctx); err != nil {
+			t.Fatalf("start service: %v\n", err)
+		}
+	}
+
+	storage := srv.services[0].(store.Storage)
+	if _, err := storage.Update(ctx, model.NewCounterMetric("Counter-1", 3)); err != nil {
+		t.Fatalf("update: %v\n", err)
+	}
+
+	for i := len(srv.services) - 1; i >= 0; i-- {
+		assert.NoError(t, srv.services[i].Stop(ctx))
+	}
+
+	restored, err := store.New(config.StorageConfig{StorePath: storePath, IsRestore: true})
+	if err != nil {
+		t.Fatalf("new store: %v\n", err)
+	}
+
+	if err := restored.Start(ctx); err != nil {
+		t.Fatalf("start store: %v\n", err)
+	}
+	defer restored.Stop(ctx)
+
+	met, err := restored.Get(ctx, model.Info{MName: "Counter-1", MType: model.TypeCountConst})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), *met.Delta)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Наибольшее кол-во хранимых ключей.
+const dedupCapDefault = 100_000
+
+// dedupEntry состояние запроса с ключом идемпотентности.
+// done закрывается по завершении запроса, applied - запрос выполнен успешно.
+type dedupEntry struct {
+	done    chan struct{}
+	expire  time.Time
+	key     string
+	applied bool
+}
+
+// dedup ключи идемпотентности выполненных запросов в памяти.
+// Ключ хранится window после выполнения запроса, но не больше capacity ключей:
+// при переполнении вытесняются самые старые.
+// Повтор запроса, пока первый выполняется, ждет его завершения.
+// Ключи выполняющихся запросов не вытесняются и не учитываются в capacity:
+// в очередь вытеснения ключ попадает по завершении запроса, поэтому
+// она упорядочена по времени устаревания.
+type dedup struct {
+	now      func() time.Time
+	keys     map[string]*dedupEntry
+	order    *list.List // *dedupEntry выполненных запросов в порядке завершения
+	window   time.Duration
+	capacity int
+	mu       sync.Mutex
+}
+
+func newDedup(window time.Duration, capacity int, now func() time.Time) *dedup {
+	return &dedup{
+		now:      now,
+		keys:     make(map[string]*dedupEntry),
+		order:    list.New(),
+		window:   window,
+		capacity: capacity,
+	}
+}
+
+// do выполняет fn, если запрос с ключом key еще не был выполнен успешно.
+// Возвращает false, если запрос уже выполнен, и fn не вызывалась.
+// Если fn вернула ошибку, ключ освобождается и запрос можно повторить.
+func (d *dedup) do(ctx context.Context, key string, fn func() error) (bool, error) {
+	for {
+		entry, isNew := d.reserve(key)
+		if isNew {
+			err := fn()
+			d.finish(entry, err == nil)
+
+			return err == nil, err
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+
+		if entry.applied {
+			return false, nil
+		}
+		// первый запрос завершился ошибкой, ключ освобожден
+	}
+}
+
+// reserve возвращает запись ключа key.
+// isNew - запись создана и вызывающий должен выполнить запрос.
+func (d *dedup) reserve(key string) (entry *dedupEntry, isNew bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.evict()
+
+	if entry, ok := d.keys[key]; ok {
+		return entry, false
+	}
+
+	entry = &dedupEntry{key: key, done: make(chan struct{})}
+	d.keys[key] = entry
+
+	return entry, true
+}
+
+// finish завершает запрос записи entry.
+// Ключ успешного запроса ставится в очередь вытеснения, неуспешного - удаляется.
+func (d *dedup) finish(entry *dedupEntry, applied bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry.applied = applied
+
+	if applied {
+		entry.expire = d.now().Add(d.window)
+		d.order.PushBack(entry)
+		d.evict()
+	} else if d.keys[entry.key] == entry {
+		delete(d.keys, entry.key)
+	}
+
+	close(entry.done)
+}
+
+// evict удаляет устаревшие ключи и самые старые ключи сверх capacity.
+func (d *dedup) evict() {
+	now := d.now()
+
+	for elem := d.order.Front(); elem != nil; elem = d.order.Front() {
+		entry := elem.Value.(*dedupEntry)
+		if d.order.Len() <= d.capacity && now.Before(entry.expire) {
+			break
+		}
+
+		d.order.Remove(elem)
+		delete(d.keys, entry.key)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	ctx := context.Background()
+	now := stampNow
+	clock := func() time.Time { return now }
+	calls := 0
+	fn := func() error {
+		calls++
+
+		return nil
+	}
+
+	t.Run("window", func(t *testing.T) {
+		calls = 0
+		dd := newDedup(time.Minute, 10, clock)
+
+		for _, want := range []bool{true, false} {
+			applied, err := dd.do(ctx, "key-1", fn)
+			assert.NoError(t, err)
+			assert.Equal(t, want, applied)
+		}
+
+		// после окна ключ забыт
+		now = now.Add(2 * time.Minute)
+
+		applied, err := dd.do(ctx, "key-1", fn)
+		assert.NoError(t, err)
+		assert.True(t, applied)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("capacity", func(t *testing.T) {
+		calls = 0
+		dd := newDedup(time.Minute, 2, clock)
+
+		for _, key := range []string{"key-1", "key-2", "key-3", "key-1"} {
+			_, err := dd.do(ctx, key, fn)
+			assert.NoError(t, err)
+		}
+
+		// key-1 вытеснен key-3
+		assert.Equal(t, 4, calls)
+		assert.Equal(t, 2, dd.order.Len())
+	})
+
+	t.Run("err releases key", func(t *testing.T) {
+		dd := newDedup(time.Minute, 10, clock)
+		errFn := errors.New("store err")
+
+		applied, err := dd.do(ctx, "key-1", func() error { return errFn })
+		assert.ErrorIs(t, err, errFn)
+		assert.False(t, applied)
+
+		applied, err = dd.do(ctx, "key-1", func() error { return nil })
+		assert.NoError(t, err)
+		assert.True(t, applied)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			applies int
+		)
+
+		dd := newDedup(time.Minute, 10, clock)
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			applied, _ := dd.do(ctx, "key-1", func() error {
+				close(started)
+				<-release
+
+				return nil
+			})
+
+			mu.Lock()
+			if applied {
+				applies++
+			}
+			mu.Unlock()
+		}()
+
+		<-started
+
+		// повтор, пока первый запрос выполняется, ждет его завершения
+		done := make(chan bool)
+
+		go func() {
+			applied, _ := dd.do(ctx, "key-1", fn)
+			done <- applied
+		}()
+
+		close(release)
+		wg.Wait()
+
+		assert.False(t, <-done)
+		assert.Equal(t, 1, applies)
+	})
+
+	t.Run("in flight not evicted", func(t *testing.T) {
+		calls = 0
+		dd := newDedup(time.Minute, 1, clock)
+
+		// долгий запрос выполняется
+		entry, isNew := dd.reserve("key-1")
+		assert.True(t, isNew)
+
+		for _, key := range []string{"key-2", "key-3"} {
+			_, err := dd.do(ctx, key, fn)
+			assert.NoError(t, err)
+		}
+
+		// ключ выполняющегося запроса не вытеснен по capacity
+		_, isNew = dd.reserve("key-1")
+		assert.False(t, isNew)
+
+		// и не мешает вытеснению устаревших ключей
+		now = now.Add(2 * time.Minute)
+		dd.mu.Lock()
+		dd.evict()
+		dd.mu.Unlock()
+		assert.Equal(t, 0, dd.order.Len())
+		assert.Len(t, dd.keys, 1)
+
+		dd.finish(entry, true)
+		assert.Equal(t, 1, dd.order.Len())
+
+		applied, err := dd.do(ctx, "key-1", fn)
+		assert.NoError(t, err)
+		assert.False(t, applied)
+	})
+
+	t.Run("ctx done", func(t *testing.T) {
+		dd := newDedup(time.Minute, 10, clock)
+		entry, _ := dd.reserve("key-1")
+		defer dd.finish(entry, true)
+
+		ctxCancel, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := dd.do(ctxCancel, "key-1", fn)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
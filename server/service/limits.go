@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+)
+
+var (
+	// ErrBatchTooLarge в пакете больше метрик, чем Limits.MaxBatch.
+	ErrBatchTooLarge = errors.New("batch too large")
+	// ErrSeriesLimit новые метрики превышают Limits.MaxSeries или Limits.MaxAgentSeries.
+	ErrSeriesLimit = errors.New("series limit exceeded")
+)
+
+// Limits ограничения кол-ва метрик. Нулевое значение - без ограничения.
+type Limits struct {
+	MaxSeries      int `json:"maxSeries"`      // всего метрик в хранилище
+	MaxAgentSeries int `json:"maxAgentSeries"` // метрик, созданных одним агентом
+	MaxBatch       int `json:"maxBatch"`       // метрик в одном пакете
+}
+
+// Cardinality текущее кол-во метрик.
+type Cardinality struct {
+	Agents map[string]int `json:"agents"` // кол-во метрик по агентам, создавшим их
+	Limits Limits         `json:"limits"`
+	Total  int            `json:"total"`
+}
+
+// Имена gauge с текущим кол-вом метрик, см. [Cardinality.Metrics].
+const (
+	SeriesGaugeConst      = "ServerSeries"       // всего метрик
+	AgentSeriesGaugeConst = "ServerAgentSeries_" // префикс имени: метрик агента
+)
+
+// Metrics возвращает кол-во метрик в виде gauge:
+// ServerSeries - всего и ServerAgentSeries_<агент> - по агентам.
+// Gauge не сохраняются в хранилище и не учитываются в лимитах.
+// Источник gauge агента - сам агент. Время обновления - now.
+func (c Cardinality) Metrics(now time.Time) []model.Metric {
+	agents := make([]string, 0, len(c.Agents))
+	for agent := range c.Agents {
+		// метрики без источника учитываются только в общем кол-ве
+		if agent != "" {
+			agents = append(agents, agent)
+		}
+	}
+
+	sort.Strings(agents)
+
+	arr := make([]model.Metric, 0, len(agents)+1)
+	arr = append(arr, cardinalityGauge(SeriesGaugeConst, c.Total, "", now))
+
+	for _, agent := range agents {
+		arr = append(arr, cardinalityGauge(AgentSeriesGaugeConst+gaugeName(agent), c.Agents[agent], agent, now))
+	}
+
+	return arr
+}
+
+// cardinalityGauge возвращает gauge кол-ва метрик.
+func cardinalityGauge(name string, count int, agent string, now time.Time) model.Metric {
+	met := model.NewGaugeMetric(name, float64(count))
+	met.Meta = model.Meta{Created: now, Updated: now, Help: "series count", Source: agent}
+
+	return met
+}
+
+// gaugeName заменяет в идентификаторе агента символы кроме [A-Za-z0-9_] на '_':
+// имя gauge используется в пути запроса /value/gauge/<имя>.
+func gaugeName(agent string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, agent)
+}
+
+// isCardinalityGauge возвращает true для имени gauge кол-ва метрик.
+func isCardinalityGauge(info model.Info) bool {
+	return info.MType == model.TypeGaugeConst &&
+		(info.MName == SeriesGaugeConst || strings.HasPrefix(info.MName, AgentSeriesGaugeConst))
+}
+
+type agentCtxKey struct{}
+
+// WithAgent возвращает контекст с идентификатором агента, приславшего метрики.
+// Новые метрики учитываются в лимите этого агента.
+func WithAgent(ctx context.Context, agent string) context.Context {
+	return context.WithValue(ctx, agentCtxKey{}, agent)
+}
+
+// AgentFrom возвращает идентификатор агента из контекста.
+func AgentFrom(ctx context.Context) string {
+	agent, _ := ctx.Value(agentCtxKey{}).(string)
+
+	return agent
+}
+
+// limiter учет метрик для проверки лимитов.
+// Метрики хранилища загружаются при первой проверке, агентом,
+// создавшим метрику, считается ее источник Source.
+// Учет ведется в памяти реплики: метрики, созданные другими
+// репликами после загрузки, не учитываются.
+type limiter struct {
+	series map[model.Info]string // агент, создавший метрику
+	agents map[string]int        // кол-во метрик агента
+	limits Limits
+	loaded bool
+	mu     sync.Mutex
+}
+
+func newLimiter(limits Limits) *limiter {
+	return &limiter{
+		series: make(map[model.Info]string),
+		agents: make(map[string]int),
+		limits: limits,
+	}
+}
+
+// enabled возвращает true, если заданы лимиты кол-ва метрик.
+func (l *limiter) enabled() bool {
+	return l.limits.MaxSeries > 0 || l.limits.MaxAgentSeries > 0
+}
+
+// checkBatch проверяет размер пакета.
+func (l *limiter) checkBatch(size int) error {
+	if l.limits.MaxBatch > 0 && size > l.limits.MaxBatch {
+		return fmt.Errorf("%w: %d > %d", ErrBatchTooLarge, size, l.limits.MaxBatch)
+	}
+
+	return nil
+}
+
+// reserve проверяет лимиты для новых метрик arr агента agent
+// и учитывает их. Возвращает учтенные метрики: если их не удалось
+// сохранить, учет отменяется release.
+// Без agent (загрузка выгрузки) лимит агента не проверяется,
+// а метрики учитываются по их источнику Source.
+func (l *limiter) reserve(ctx context.Context, store store, agent string, arr []model.Metric) ([]model.Info, error) {
+	if !l.enabled() {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(ctx, store); err != nil {
+		return nil, err
+	}
+
+	added := make([]model.Info, 0)
+	owners := make(map[model.Info]string)
+
+	for i := range arr {
+		info := arr[i].Info
+		if _, ok := l.series[info]; ok {
+			continue
+		}
+
+		if _, ok := owners[info]; ok {
+			continue
+		}
+
+		owners[info] = agent
+		if agent == "" {
+			owners[info] = arr[i].Source
+		}
+
+		added = append(added, info)
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if total := len(l.series) + len(added); l.limits.MaxSeries > 0 && total > l.limits.MaxSeries {
+		return nil, fmt.Errorf("%w: series %d > %d", ErrSeriesLimit, total, l.limits.MaxSeries)
+	}
+
+	total := l.agents[agent] + len(added)
+	if agent != "" && l.limits.MaxAgentSeries > 0 && total > l.limits.MaxAgentSeries {
+		return nil, fmt.Errorf("%w: agent [%s] series %d > %d", ErrSeriesLimit, agent, total, l.limits.MaxAgentSeries)
+	}
+
+	for _, info := range added {
+		l.series[info] = owners[info]
+		l.agents[owners[info]]++
+	}
+
+	return added, nil
+}
+
+// release отменяет учет метрик added.
+func (l *limiter) release(added []model.Info) {
+	if len(added) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, info := range added {
+		owner := l.series[info]
+		delete(l.series, info)
+
+		if l.agents[owner]--; l.agents[owner] <= 0 {
+			delete(l.agents, owner)
+		}
+	}
+}
+
+// cardinality возвращает текущее кол-во учтенных метрик.
+// Без лимитов метрики не учитываются и считаются по хранилищу.
+func (l *limiter) cardinality(ctx context.Context, store store) (Cardinality, error) {
+	if !l.enabled() {
+		arr, err := store.List(ctx)
+		if err != nil {
+			return Cardinality{}, fmt.Errorf("store.List: %w", err)
+		}
+
+		return l.count(arr), nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.load(ctx, store); err != nil {
+		return Cardinality{}, err
+	}
+
+	agents := make(map[string]int, len(l.agents))
+	for agent, count := range l.agents {
+		agents[agent] = count
+	}
+
+	return Cardinality{Total: len(l.series), Agents: agents, Limits: l.limits}, nil
+}
+
+// count возвращает кол-во метрик arr по агентам, создавшим их.
+func (l *limiter) count(arr []model.Metric) Cardinality {
+	agents := make(map[string]int)
+	for i := range arr {
+		agents[arr[i].Source]++
+	}
+
+	return Cardinality{Total: len(arr), Agents: agents, Limits: l.limits}
+}
+
+// load загружает метрики хранилища, если они еще не загружены.
+// Вызывается под l.mu.
+func (l *limiter) load(ctx context.Context, store store) error {
+	if l.loaded {
+		return nil
+	}
+
+	arr, err := store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("store.List: %w", err)
+	}
+
+	for i := range arr {
+		l.series[arr[i].Info] = arr[i].Source
+		l.agents[arr[i].Source]++
+	}
+
+	l.loaded = true
+
+	return nil
+}
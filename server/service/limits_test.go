@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/stretchr/testify/assert"
+)
+
+// counters возвращает пакет counter с именами prefix-0..prefix-(n-1).
+func counters(prefix string, n int) []model.MetricJSON {
+	list := make([]model.MetricJSON, n)
+
+	for i := range list {
+		delta := int64(1)
+		list[i] = model.MetricJSON{ID: prefix + "-" + strconv.Itoa(i), MType: "counter", Delta: &delta}
+	}
+
+	return list
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	ctxA := WithAgent(ctx, "agent-a")
+	ctxB := WithAgent(ctx, "agent-b")
+
+	t.Run("max batch", func(t *testing.T) {
+		srv := New(adapter.Ping(inmemory.New()), SetLimits(Limits{MaxBatch: 2}))
+
+		assert.NoError(t, srv.AddBatch(ctxA, counters("A", 2)))
+		assert.ErrorIs(t, srv.AddBatch(ctxA, counters("A", 3)), ErrBatchTooLarge)
+
+		_, err := srv.AddBatchOnce(ctxA, "key-1", counters("A", 3))
+		assert.ErrorIs(t, err, ErrBatchTooLarge)
+	})
+
+	t.Run("max agent series", func(t *testing.T) {
+		srv := New(adapter.Ping(inmemory.New()), SetLimits(Limits{MaxAgentSeries: 3}))
+
+		assert.NoError(t, srv.AddBatch(ctxA, counters("A", 3)))
+		// существующие метрики не считаются новыми
+		assert.NoError(t, srv.AddBatch(ctxA, counters("A", 3)))
+		assert.ErrorIs(t, srv.AddBatch(ctxA, counters("A", 4)), ErrSeriesLimit)
+
+		_, err := srv.Update(ctxA, counters("B", 1)[0])
+		assert.ErrorIs(t, err, ErrSeriesLimit)
+
+		// у другого агента свой лимит
+		assert.NoError(t, srv.AddBatch(ctxB, counters("B", 3)))
+
+		card, err := srv.Cardinality(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 6, card.Total)
+			assert.Equal(t, map[string]int{"agent-a": 3, "agent-b": 3}, card.Agents)
+		}
+
+		// источник новой метрики - агент
+		metJSON, err := srv.Get(ctx, model.Info{MName: "B-0", MType: model.TypeCountConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "agent-b", metJSON.Source)
+		}
+	})
+
+	t.Run("max series", func(t *testing.T) {
+		store := adapter.Ping(inmemory.New())
+		if _, err := store.Update(ctx, model.NewCounterMetric("Old", 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		srv := New(store, SetLimits(Limits{MaxSeries: 3}))
+
+		// метрики хранилища учитываются
+		assert.ErrorIs(t, srv.AddBatch(ctxA, counters("A", 3)), ErrSeriesLimit)
+		assert.NoError(t, srv.AddBatch(ctxA, counters("A", 2)))
+		assert.ErrorIs(t, srv.AddBatch(ctxB, counters("B", 1)), ErrSeriesLimit)
+	})
+
+	t.Run("release on store err", func(t *testing.T) {
+		store := &fakeStore{}
+		srv := New(store, SetLimits(Limits{MaxSeries: 2}))
+
+		store.err = errors.New("batch err")
+		assert.Error(t, srv.AddBatch(ctxA, counters("A", 2)))
+
+		store.err = nil
+		assert.NoError(t, srv.AddBatch(ctxA, counters("A", 2)))
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		srv := New(adapter.Ping(inmemory.New()))
+
+		assert.NoError(t, srv.AddBatch(ctxA, counters("A", 100)))
+
+		card, err := srv.Cardinality(ctx)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 100, card.Total)
+			assert.Equal(t, map[string]int{"agent-a": 100}, card.Agents)
+		}
+	})
+}
+
+func TestCardinalityGauges(t *testing.T) {
+	ctx := context.Background()
+
+	for _, limits := range []Limits{{}, {MaxSeries: 10}} {
+		srv := New(adapter.Ping(inmemory.New()), SetLimits(limits))
+
+		assert.NoError(t, srv.AddBatch(WithAgent(ctx, "10.0.0.1"), counters("A", 2)))
+		assert.NoError(t, srv.AddBatch(WithAgent(ctx, "host-b"), counters("B", 1)))
+
+		list, err := srv.List(ctx)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		gauges := make(map[string]float64)
+		for _, met := range list {
+			if met.MType == "gauge" {
+				gauges[met.ID] = *met.Value
+			}
+		}
+
+		assert.Equal(t, map[string]float64{
+			"ServerSeries":               3,
+			"ServerAgentSeries_10_0_0_1": 2,
+			"ServerAgentSeries_host_b":   1,
+		}, gauges, "limits %+v", limits)
+
+		metJSON, err := srv.Get(ctx, model.Info{MName: "ServerAgentSeries_host_b", MType: model.TypeGaugeConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1.0, *metJSON.Value)
+			assert.Equal(t, "host-b", metJSON.Source)
+		}
+
+		_, err = srv.Get(ctx, model.Info{MName: "ServerAgentSeries_none", MType: model.TypeGaugeConst})
+		assert.ErrorIs(t, err, serr.ErrNotFound)
+	}
+}
@@ -3,11 +3,52 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"time"
 
+	"github.com/AndreyVLZ/metrics/internal/dump"
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
+	"github.com/AndreyVLZ/metrics/server/config"
 )
 
+// Кол-во метрик в одном пакете при импорте.
+const importBatchSize = 1000
+
+var (
+	// ErrBackupNotSupport хранилище не поддерживает резервное копирование.
+	ErrBackupNotSupport = errors.New("backup not support")
+	// ErrInvalid метрика запроса не прошла проверку.
+	ErrInvalid = errors.New("metric not valid")
+	// ErrStale значение gauge старше сохраненного (политика StaleReject).
+	ErrStale = errors.New("stale sample")
+	// ErrStalePolicy политика не поддерживается.
+	ErrStalePolicy = errors.New("stale policy not support")
+)
+
+// StalePolicy политика обработки устаревших значений gauge:
+// значений, время снятия ts которых меньше сохраненного.
+// Значения без ts и counter не проверяются.
+type StalePolicy string
+
+const (
+	StaleAccept StalePolicy = "accept" // Сохранять устаревшие значения.
+	StaleIgnore StalePolicy = "ignore" // Пропускать устаревшие значения без ошибки.
+	StaleReject StalePolicy = "reject" // Отклонять запрос с устаревшими значениями.
+)
+
+// ParseStalePolicy возвращает политику из строки.
+func ParseStalePolicy(str string) (StalePolicy, error) {
+	switch policy := StalePolicy(str); policy {
+	case StaleAccept, StaleIgnore, StaleReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: [%s]", ErrStalePolicy, str)
+	}
+}
+
 // Интерфейс хранилища.
 type store interface {
 	Ping() error
@@ -17,62 +58,209 @@ type store interface {
 	AddBatch(ctx context.Context, arr []model.Metric) error
 }
 
+// Интерфейс хранилища, применяющего пакет с ключом идемпотентности один раз.
+// Возвращает errors.ErrUnsupported, если обертка над хранилищем не может этого сделать.
+type onceBatcher interface {
+	AddBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error)
+}
+
+// Интерфейс хранилища с поддержкой резервного копирования.
+type backuper interface {
+	Backup(ctx context.Context, w io.Writer) error
+}
+
 // Сервис.
+// Время создания и обновления метрик проставляется по часам now.
+// Ключи идемпотентности пакетов хранятся в dedup, если хранилище
+// не сохраняет их само. Кол-во метрик ограничивается limits.
 type Service struct {
-	store store
+	store  store
+	now    func() time.Time
+	dedup  *dedup
+	limits *limiter
+	stale  StalePolicy
+}
+
+// FuncOpt опции сервиса.
+type FuncOpt func(*Service)
+
+// SetStalePolicy устанавливает политику обработки устаревших значений gauge.
+func SetStalePolicy(policy StalePolicy) FuncOpt {
+	return func(srv *Service) {
+		srv.stale = policy
+	}
+}
+
+// SetDedupWindow устанавливает время хранения ключей идемпотентности пакетов.
+func SetDedupWindow(window time.Duration) FuncOpt {
+	return func(srv *Service) {
+		if window > 0 {
+			srv.dedup.window = window
+		}
+	}
 }
 
-func New(store store) Service {
-	return Service{
-		store: store,
+// SetLimits устанавливает ограничения кол-ва метрик.
+func SetLimits(limits Limits) FuncOpt {
+	return func(srv *Service) {
+		srv.limits = newLimiter(limits)
 	}
 }
 
+func New(store store, opts ...FuncOpt) Service {
+	srv := Service{
+		store:  store,
+		now:    time.Now,
+		dedup:  newDedup(config.DedupWindowDefault, dedupCapDefault, time.Now),
+		limits: newLimiter(Limits{}),
+		stale:  StaleAccept,
+	}
+
+	for i := range opts {
+		opts[i](&srv)
+	}
+
+	return srv
+}
+
 // Ping.
 func (srv Service) Ping() error { return srv.store.Ping() }
 
 // Добавление списка метрик.
 func (srv Service) AddBatch(ctx context.Context, list []model.MetricJSON) error {
-	arr, err := buildArrMetric(list)
+	arr, err := srv.buildBatch(ctx, list)
 	if err != nil {
-		return fmt.Errorf("buildArrMetric: %w", err)
+		return err
+	}
+
+	return srv.write(ctx, arr, func() error {
+		if err := srv.store.AddBatch(ctx, arr); err != nil {
+			return fmt.Errorf("store.AddBatch: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// AddBatchOnce добавляет список метрик, если пакет с ключом key еще не был применен.
+// Повтор пакета с тем же ключом в течение окна хранения ключа не меняет метрики,
+// поэтому повторная отправка не удваивает counter.
+// Ключ сохраняется хранилищем вместе с пакетом, если оно это поддерживает,
+// иначе - в памяти сервиса, и тогда не разделяется между репликами.
+// Возвращает false, если пакет уже применен. Пустой key - обычное добавление.
+func (srv Service) AddBatchOnce(ctx context.Context, key string, list []model.MetricJSON) (bool, error) {
+	if key == "" {
+		return true, srv.AddBatch(ctx, list)
 	}
 
-	if err := srv.store.AddBatch(ctx, arr); err != nil {
-		return fmt.Errorf("store.AddBatch: %w", err)
+	arr, err := srv.buildBatch(ctx, list)
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	applied := false
+	err = srv.write(ctx, arr, func() error {
+		applied, err = srv.addBatchOnce(ctx, key, arr)
+
+		return err
+	})
+
+	return applied, err
+}
+
+// addBatchOnce сохраняет пакет с ключом key хранилищем,
+// если оно поддерживает ключи, иначе - с ключом в dedup.
+func (srv Service) addBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error) {
+	if store, ok := srv.store.(onceBatcher); ok {
+		applied, err := store.AddBatchOnce(ctx, key, arr)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			if err != nil {
+				return false, fmt.Errorf("store.AddBatchOnce: %w", err)
+			}
+
+			return applied, nil
+		}
+	}
+
+	applied, err := srv.dedup.do(ctx, key, func() error { return srv.store.AddBatch(ctx, arr) })
+	if err != nil {
+		return false, fmt.Errorf("store.AddBatch: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Cardinality возвращает текущее кол-во метрик и лимиты.
+func (srv Service) Cardinality(ctx context.Context) (Cardinality, error) {
+	return srv.limits.cardinality(ctx, srv.store)
 }
 
 // Список метрик.
+// В конце списка - gauge текущего кол-ва метрик, см. [Cardinality.Metrics].
 func (srv Service) List(ctx context.Context) ([]model.MetricJSON, error) {
 	list, err := srv.store.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("store.List: %w", err)
 	}
 
-	return model.BuildArrMetricJSON(list), nil
+	card := srv.limits.count(list)
+	if srv.limits.enabled() {
+		if card, err = srv.Cardinality(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return model.BuildArrMetricJSON(append(list, card.Metrics(srv.stamp())...)), nil
 }
 
 // Обновление метрики.
 func (srv Service) Update(ctx context.Context, metJSON model.MetricJSON) (model.MetricJSON, error) {
-	met, err := parseMetric(metJSON)
+	met, err := parseMetric(metJSON, srv.stamp())
+	if err != nil {
+		return model.MetricJSON{}, fmt.Errorf("%w: parseMetric: %w", ErrInvalid, err)
+	}
+
+	batch := []model.Metric{met}
+	if err := withSource(AgentFrom(ctx), batch); err != nil {
+		return model.MetricJSON{}, err
+	}
+
+	met = batch[0]
+
+	arr, err := srv.dropStale(ctx, batch)
 	if err != nil {
-		return model.MetricJSON{}, fmt.Errorf("parseMetric: %w", err)
+		return model.MetricJSON{}, err
 	}
 
-	metDB, err := srv.store.Update(ctx, met)
+	// устаревшее значение пропущено, возвращается сохраненное
+	if len(arr) == 0 {
+		return srv.Get(ctx, met.Info)
+	}
+
+	var metDB model.Metric
+
+	err = srv.write(ctx, arr, func() error {
+		if metDB, err = srv.store.Update(ctx, met); err != nil {
+			return fmt.Errorf("store.Update: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return model.MetricJSON{}, fmt.Errorf("store.Update: %w", err)
+		return model.MetricJSON{}, err
 	}
 
 	return model.BuildMetricJSON(metDB), nil
 }
 
 // Получение метрики.
+// Gauge текущего кол-ва метрик возвращается, если в хранилище нет метрики с тем же именем.
 func (srv Service) Get(ctx context.Context, metInfo model.Info) (model.MetricJSON, error) {
 	metDB, err := srv.store.Get(ctx, metInfo)
+	if errors.Is(err, serr.ErrNotFound) && isCardinalityGauge(metInfo) {
+		return srv.cardinalityGauge(ctx, metInfo, err)
+	}
+
 	if err != nil {
 		return model.MetricJSON{}, fmt.Errorf("store.Get: %w", err)
 	}
@@ -80,14 +268,296 @@ func (srv Service) Get(ctx context.Context, metInfo model.Info) (model.MetricJSO
 	return model.BuildMetricJSON(metDB), nil
 }
 
-// Возвращает массив MetricJSON из массива Metric.
-func buildArrMetric(arr []model.MetricJSON) ([]model.Metric, error) {
+// cardinalityGauge возвращает gauge кол-ва метрик metInfo.
+// Если такого gauge нет, возвращает ошибку хранилища errNotFound.
+func (srv Service) cardinalityGauge(ctx context.Context, metInfo model.Info, errNotFound error) (model.MetricJSON, error) {
+	card, err := srv.Cardinality(ctx)
+	if err != nil {
+		return model.MetricJSON{}, err
+	}
+
+	for _, met := range card.Metrics(srv.stamp()) {
+		if met.Info == metInfo {
+			return model.BuildMetricJSON(met), nil
+		}
+	}
+
+	return model.MetricJSON{}, fmt.Errorf("store.Get: %w", errNotFound)
+}
+
+// Запись резервной копии хранилища в w.
+// Возвращает ErrBackupNotSupport, если хранилище не умеет делать копию.
+func (srv Service) Backup(ctx context.Context, w io.Writer) error {
+	store, ok := srv.store.(backuper)
+	if !ok {
+		return ErrBackupNotSupport
+	}
+
+	if err := store.Backup(ctx, w); err != nil {
+		// обертка над хранилищем без резервного копирования
+		if errors.Is(err, errors.ErrUnsupported) {
+			return ErrBackupNotSupport
+		}
+
+		return fmt.Errorf("store.Backup: %w", err)
+	}
+
+	return nil
+}
+
+// Export выгружает все метрики хранилища в w в формате format.
+func (srv Service) Export(ctx context.Context, w io.Writer, format dump.Format) error {
+	arr, err := srv.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("store.List: %w", err)
+	}
+
+	enc, err := dump.NewEncoder(w, format)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	for i := range arr {
+		if err := enc.Encode(arr[i]); err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	}
+
+	return enc.Flush()
+}
+
+// Import загружает метрики из r в формате format и добавляет их в хранилище
+// пакетами по importBatchSize. Возвращает кол-во добавленных метрик.
+// Время создания и обновления из выгрузки сохраняется, незаданное - проставляется.
+// Как и для обновлений, проверяются лимиты кол-ва метрик (кроме лимита агента
+// и размера пакета) и устаревшие значения gauge по политике сервиса.
+// При ошибке пакеты, добавленные до нее, остаются в хранилище.
+// Counter складываются с существующими значениями,
+// поэтому для переноса состояния импорт выполняется в пустое хранилище.
+func (srv Service) Import(ctx context.Context, r io.Reader, format dump.Format) (int, error) {
+	dec, err := dump.NewDecoder(r, format)
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+
+	count := 0
+	now := srv.stamp()
+	batch := make([]model.Metric, 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		arr, err := srv.dropStale(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		batch = batch[:0]
+
+		if len(arr) == 0 {
+			return nil
+		}
+
+		err = srv.write(ctx, arr, func() error {
+			if err := srv.store.AddBatch(ctx, arr); err != nil {
+				return fmt.Errorf("store.AddBatch: %w", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		count += len(arr)
+
+		return nil
+	}
+
+	for {
+		met, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return count, fmt.Errorf("%w", err)
+		}
+
+		if met.Created.IsZero() {
+			met.Created = now
+		}
+
+		if met.Updated.IsZero() {
+			met.Updated = now
+		}
+
+		batch = append(batch, met)
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// buildBatch возвращает метрики пакета list без устаревших значений gauge.
+// Источник метрик без Source - агент из ctx.
+// Возвращает ErrBatchTooLarge, если пакет больше Limits.MaxBatch.
+func (srv Service) buildBatch(ctx context.Context, list []model.MetricJSON) ([]model.Metric, error) {
+	if err := srv.limits.checkBatch(len(list)); err != nil {
+		return nil, err
+	}
+
+	arr, err := buildArrMetric(list, srv.stamp())
+	if err != nil {
+		return nil, fmt.Errorf("buildArrMetric: %w", err)
+	}
+
+	if err := withSource(AgentFrom(ctx), arr); err != nil {
+		return nil, err
+	}
+
+	return srv.dropStale(ctx, arr)
+}
+
+// withSource задает источник agent метрикам arr без Source и проверяет
+// длину имени и сведений метрик, см. [model.CheckLen]. Проверка выполняется
+// после задания источника: идентификатор агента тоже ограничен по длине.
+// Возвращает ErrInvalid для слишком длинной метрики.
+func withSource(agent string, arr []model.Metric) error {
+	for i := range arr {
+		if arr[i].Source == "" {
+			arr[i].Source = agent
+		}
+
+		if err := model.CheckLen(arr[i]); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalid, arr[i].MName, err)
+		}
+	}
+
+	return nil
+}
+
+// write проверяет лимиты кол-ва метрик для arr и сохраняет их fnWrite.
+// Если сохранить не удалось, новые метрики arr не учитываются в лимитах.
+// Метрика, отклоненная хранилищем (serr.ErrInvalid), - ErrInvalid.
+func (srv Service) write(ctx context.Context, arr []model.Metric, fnWrite func() error) error {
+	agent := AgentFrom(ctx)
+
+	added, err := srv.limits.reserve(ctx, srv.store, agent, arr)
+	if err != nil {
+		return err
+	}
+
+	if err := fnWrite(); err != nil {
+		srv.limits.release(added)
+
+		if errors.Is(err, serr.ErrInvalid) {
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// dropStale возвращает метрики arr без устаревших значений gauge.
+// Значение устарело, если его ts меньше ts сохраненного значения
+// или значения той же метрики, идущего раньше в arr.
+// При политике StaleReject возвращает ErrStale.
+// При политике StaleAccept (по умолчанию) хранилище не читается.
+// Проверка не атомарна с записью: одновременные значения одной метрики
+// от разных запросов могут быть сохранены не по порядку ts.
+func (srv Service) dropStale(ctx context.Context, arr []model.Metric) ([]model.Metric, error) {
+	if srv.stale == StaleAccept {
+		return arr, nil
+	}
+
+	last, err := srv.storedTS(ctx, arr)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]model.Metric, 0, len(arr))
+
+	for _, met := range arr {
+		if !hasTS(met) {
+			res = append(res, met)
+
+			continue
+		}
+
+		lastTS := last[met.Info]
+
+		if met.TS.Before(lastTS) {
+			if srv.stale == StaleReject {
+				return nil, fmt.Errorf("%w: [%s] ts %s before %s",
+					ErrStale, met.MName, met.TS.Format(time.RFC3339Nano), lastTS.Format(time.RFC3339Nano))
+			}
+
+			continue
+		}
+
+		last[met.Info] = met.TS
+		res = append(res, met)
+	}
+
+	return res, nil
+}
+
+// storedTS возвращает ts сохраненных значений gauge с ts из arr.
+// Читаются только метрики пакета, каждая - Get хранилища: чтение всего
+// хранилища List стоило бы больше любого пакета.
+func (srv Service) storedTS(ctx context.Context, arr []model.Metric) (map[model.Info]time.Time, error) {
+	last := make(map[model.Info]time.Time)
+
+	for i := range arr {
+		if !hasTS(arr[i]) {
+			continue
+		}
+
+		if _, ok := last[arr[i].Info]; ok {
+			continue
+		}
+
+		metDB, err := srv.store.Get(ctx, arr[i].Info)
+		if err != nil && !errors.Is(err, serr.ErrNotFound) {
+			return nil, fmt.Errorf("store.Get: %w", err)
+		}
+
+		last[arr[i].Info] = metDB.TS
+	}
+
+	return last, nil
+}
+
+// hasTS возвращает true для значения gauge с ts.
+func hasTS(met model.Metric) bool {
+	return met.MType == model.TypeGaugeConst && !met.TS.IsZero()
+}
+
+// stamp возвращает время изменения метрик.
+func (srv Service) stamp() time.Time { return srv.now().UTC() }
+
+// Возвращает массив Metric из массива MetricJSON.
+func buildArrMetric(arr []model.MetricJSON, now time.Time) ([]model.Metric, error) {
 	res := make([]model.Metric, len(arr))
 
 	for i := range arr {
-		met, err := parseMetric(arr[i])
+		met, err := parseMetric(arr[i], now)
 		if err != nil {
-			return nil, fmt.Errorf("parseMetric: %w", err)
+			return nil, fmt.Errorf("%w: parseMetric: %w", ErrInvalid, err)
 		}
 
 		res[i] = met
@@ -96,7 +566,10 @@ func buildArrMetric(arr []model.MetricJSON) ([]model.Metric, error) {
 	return res, nil
 }
 
-func parseMetric(met model.MetricJSON) (model.Metric, error) {
+// parseMetric возвращает метрику со сведениями из met.
+// Время создания и обновления задается now: хранилище сохранит
+// время создания только для новой метрики.
+func parseMetric(met model.MetricJSON, now time.Time) (model.Metric, error) {
 	var val model.Value
 
 	info, err := model.ParseInfo(met.ID, met.MType)
@@ -113,5 +586,9 @@ func parseMetric(met model.MetricJSON) (model.Metric, error) {
 		return model.Metric{}, model.ErrTypeNotSupport
 	}
 
-	return model.Metric{Info: info, Value: val}, nil
+	meta := met.Meta()
+	meta.Created = now
+	meta.Updated = now
+
+	return model.Metric{Info: info, Value: val, Meta: meta}, nil
 }
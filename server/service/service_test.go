@@ -1,11 +1,21 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/AndreyVLZ/metrics/internal/dump"
 	"github.com/AndreyVLZ/metrics/internal/model"
+	"github.com/AndreyVLZ/metrics/internal/store/adapter"
+	"github.com/AndreyVLZ/metrics/internal/store/inmemory"
+	"github.com/AndreyVLZ/metrics/internal/store/serr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -97,9 +107,80 @@ func TestAddBatch(t *testing.T) {
 		store := fakeStore{}
 		srv := New(&store)
 		err := srv.AddBatch(ctx, list)
-		if err == nil {
-			t.Error("want err")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("addBatch err meta too long", func(t *testing.T) {
+		var delta int64 = 100
+		list := []model.MetricJSON{
+			{
+				ID:     "PollCount",
+				MType:  "counter",
+				Delta:  &delta,
+				Unit:   strings.Repeat("ю", model.MaxUnitLen),
+				Source: strings.Repeat("s", model.MaxSourceLen+1),
+			},
+		}
+		store := fakeStore{}
+		srv := New(&store)
+		err := srv.AddBatch(ctx, list)
+		assert.ErrorIs(t, err, ErrInvalid)
+		assert.ErrorIs(t, err, model.ErrTooLong)
+	})
+
+	t.Run("addBatch err name too long", func(t *testing.T) {
+		var delta int64 = 100
+		list := []model.MetricJSON{
+			{ID: strings.Repeat("n", model.MaxNameLen+1), MType: "counter", Delta: &delta},
+		}
+		store := fakeStore{}
+		srv := New(&store)
+		err := srv.AddBatch(ctx, list)
+		assert.ErrorIs(t, err, ErrInvalid)
+		assert.ErrorIs(t, err, model.ErrTooLong)
+	})
+
+	t.Run("addBatch err agent too long", func(t *testing.T) {
+		var delta int64 = 100
+		list := []model.MetricJSON{
+			{ID: "PollCount", MType: "counter", Delta: &delta},
+		}
+		store := fakeStore{}
+		srv := New(&store)
+		err := srv.AddBatch(WithAgent(ctx, strings.Repeat("a", model.MaxSourceLen+1)), list)
+		assert.ErrorIs(t, err, ErrInvalid)
+		assert.ErrorIs(t, err, model.ErrTooLong)
+	})
+
+	t.Run("addBatch err store rejected", func(t *testing.T) {
+		var delta int64 = 100
+		list := []model.MetricJSON{
+			{
+				ID:    "PollCount",
+				MType: "counter",
+				Delta: &delta,
+			},
+		}
+		store := fakeStore{err: fmt.Errorf("%w: value too long", serr.ErrInvalid)}
+		srv := New(&store)
+		err := srv.AddBatch(ctx, list)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("addBatch err store", func(t *testing.T) {
+		var delta int64 = 100
+		list := []model.MetricJSON{
+			{
+				ID:    "PollCount",
+				MType: "counter",
+				Delta: &delta,
+			},
 		}
+		store := fakeStore{err: errors.New("store err")}
+		srv := New(&store)
+		err := srv.AddBatch(ctx, list)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrInvalid)
 	})
 }
 
@@ -119,8 +200,12 @@ func TestList(t *testing.T) {
 		}}
 		srv := New(&store)
 		list, err := srv.List(ctx)
-		assert.NoError(t, err)
-		assert.Equal(t, want, list)
+		if assert.NoError(t, err) && assert.Len(t, list, 2) {
+			assert.Equal(t, want, list[:1])
+			// gauge кол-ва метрик
+			assert.Equal(t, SeriesGaugeConst, list[1].ID)
+			assert.Equal(t, 1.0, *list[1].Value)
+		}
 	})
 
 	t.Run("list err", func(t *testing.T) {
@@ -231,14 +316,70 @@ func TestGet(t *testing.T) {
 	})
 }
 
+type fakeBackupStore struct {
+	fakeStore
+}
+
+func (fbs *fakeBackupStore) Backup(_ context.Context, w io.Writer) error {
+	if fbs.err != nil {
+		return fbs.err
+	}
+
+	_, err := io.WriteString(w, "backup")
+
+	return err
+}
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("backup ok", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		srv := New(&fakeBackupStore{})
+		err := srv.Backup(ctx, &buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "backup", buf.String())
+	})
+
+	t.Run("backup err store", func(t *testing.T) {
+		srv := New(&fakeBackupStore{fakeStore{err: errors.New("err")}})
+		err := srv.Backup(ctx, io.Discard)
+		assert.Error(t, err)
+	})
+
+	t.Run("backup not support", func(t *testing.T) {
+		srv := New(&fakeStore{})
+		err := srv.Backup(ctx, io.Discard)
+		assert.ErrorIs(t, err, ErrBackupNotSupport)
+	})
+
+	t.Run("backup unsupported by wrapped store", func(t *testing.T) {
+		srv := New(&fakeBackupStore{fakeStore{err: errors.ErrUnsupported}})
+		err := srv.Backup(ctx, io.Discard)
+		assert.ErrorIs(t, err, ErrBackupNotSupport)
+	})
+}
+
+// stampNow время изменения метрик в тестах.
+var stampNow = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// stamped возвращает метрику met со временем создания и обновления stampNow.
+func stamped(met model.Metric) model.Metric {
+	met.Created = stampNow
+	met.Updated = stampNow
+
+	return met
+}
+
 func TestParseMetric(t *testing.T) {
 	t.Run("parse counter ok", func(t *testing.T) {
 		var delta int64 = 10
 		metJSON := model.MetricJSON{ID: "Counter-1", MType: "counter", Delta: &delta}
 
-		wanMet := model.NewCounterMetric("Counter-1", delta)
+		wanMet := stamped(model.NewCounterMetric("Counter-1", delta))
 
-		met, err := parseMetric(metJSON)
+		met, err := parseMetric(metJSON, stampNow)
 
 		assert.NoError(t, err)
 		assert.Equal(t, wanMet, met)
@@ -248,9 +389,29 @@ func TestParseMetric(t *testing.T) {
 		var val = 10.01
 		metJSON := model.MetricJSON{ID: "Gauge-1", MType: "gauge", Value: &val}
 
-		wanMet := model.NewGaugeMetric("Gauge-1", val)
+		wanMet := stamped(model.NewGaugeMetric("Gauge-1", val))
+
+		met, err := parseMetric(metJSON, stampNow)
+
+		assert.NoError(t, err)
+		assert.Equal(t, wanMet, met)
+	})
+
+	t.Run("parse meta", func(t *testing.T) {
+		var (
+			val     = 10.01
+			created = stampNow.Add(-time.Hour)
+		)
 
-		met, err := parseMetric(metJSON)
+		metJSON := model.MetricJSON{
+			ID: "Alloc", MType: "gauge", Value: &val,
+			Unit: "bytes", Help: "heap bytes", Source: "agent-1", Created: &created,
+		}
+
+		wanMet := model.NewGaugeMetric("Alloc", val)
+		wanMet.Meta = model.Meta{Created: stampNow, Updated: stampNow, Unit: "bytes", Help: "heap bytes", Source: "agent-1"}
+
+		met, err := parseMetric(metJSON, stampNow)
 
 		assert.NoError(t, err)
 		assert.Equal(t, wanMet, met)
@@ -259,7 +420,7 @@ func TestParseMetric(t *testing.T) {
 	t.Run("parse err parseInfo ok", func(t *testing.T) {
 		var delta int64 = 10
 		metJSON := model.MetricJSON{ID: "", MType: "counter", Delta: &delta}
-		_, err := parseMetric(metJSON)
+		_, err := parseMetric(metJSON, stampNow)
 		if err == nil {
 			t.Error("want err")
 		}
@@ -277,11 +438,11 @@ func TestBuildArrMetric(t *testing.T) {
 		}
 
 		wantArr := []model.Metric{
-			model.NewCounterMetric("Counter-1", 10),
-			model.NewGaugeMetric("Gauge-1", 10.01),
+			stamped(model.NewCounterMetric("Counter-1", 10)),
+			stamped(model.NewGaugeMetric("Gauge-1", 10.01)),
 		}
 
-		arr, err := buildArrMetric(arrMetJSON)
+		arr, err := buildArrMetric(arrMetJSON, stampNow)
 		assert.NoError(t, err)
 		assert.Equal(t, wantArr, arr)
 	})
@@ -295,9 +456,366 @@ func TestBuildArrMetric(t *testing.T) {
 			{ID: "", MType: "gauge", Value: &val},
 		}
 
-		_, err := buildArrMetric(arrMetJSON)
+		_, err := buildArrMetric(arrMetJSON, stampNow)
 		if err == nil {
 			t.Error("want err")
 		}
 	})
 }
+
+func TestUpdateMeta(t *testing.T) {
+	ctx := context.Background()
+	now := stampNow
+	srv := New(adapter.Ping(inmemory.New()))
+	srv.now = func() time.Time { return now }
+
+	val := 1.5
+
+	metJSON, err := srv.Update(ctx, model.MetricJSON{ID: "Alloc", MType: "gauge", Value: &val, Unit: "bytes"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, stampNow, *metJSON.Created)
+		assert.Equal(t, stampNow, *metJSON.Updated)
+	}
+
+	now = stampNow.Add(time.Minute)
+
+	metJSON, err = srv.Update(ctx, model.MetricJSON{ID: "Alloc", MType: "gauge", Value: &val, Source: "agent-1"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, stampNow, *metJSON.Created)
+		assert.Equal(t, now, *metJSON.Updated)
+		assert.Equal(t, "bytes", metJSON.Unit)
+		assert.Equal(t, "agent-1", metJSON.Source)
+	}
+
+	// источник из контекста проверяется после задания
+	_, err = srv.Update(WithAgent(ctx, strings.Repeat("a", model.MaxSourceLen+1)),
+		model.MetricJSON{ID: "Alloc", MType: "gauge", Value: &val})
+	assert.ErrorIs(t, err, ErrInvalid)
+	assert.ErrorIs(t, err, model.ErrTooLong)
+}
+
+// gaugeTS возвращает значение gauge со временем снятия ts.
+func gaugeTS(val float64, ts time.Time) model.MetricJSON {
+	return model.MetricJSON{ID: "Gauge-1", MType: "gauge", Value: &val, TS: &ts}
+}
+
+func TestStalePolicy(t *testing.T) {
+	ctx := context.Background()
+	older := stampNow.Add(-time.Minute)
+	newer := stampNow.Add(time.Minute)
+
+	newSrv := func(t *testing.T, policy StalePolicy) Service {
+		t.Helper()
+
+		srv := New(adapter.Ping(inmemory.New()), SetStalePolicy(policy))
+		if _, err := srv.Update(ctx, gaugeTS(1, stampNow)); err != nil {
+			t.Fatal(err)
+		}
+
+		return srv
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		srv := newSrv(t, StaleIgnore)
+
+		metJSON, err := srv.Update(ctx, gaugeTS(2, older))
+		if assert.NoError(t, err) {
+			assert.Equal(t, float64(1), *metJSON.Value)
+			assert.Equal(t, stampNow, *metJSON.TS)
+		}
+
+		// в пакете пропускаются значения старше сохраненного и предыдущего в пакете
+		err = srv.AddBatch(ctx, []model.MetricJSON{gaugeTS(3, newer), gaugeTS(4, older), gaugeTS(5, stampNow)})
+		assert.NoError(t, err)
+
+		metJSON, err = srv.Get(ctx, model.Info{MName: "Gauge-1", MType: model.TypeGaugeConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, float64(3), *metJSON.Value)
+			assert.Equal(t, newer, *metJSON.TS)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		srv := newSrv(t, StaleReject)
+
+		_, err := srv.Update(ctx, gaugeTS(2, older))
+		assert.ErrorIs(t, err, ErrStale)
+
+		err = srv.AddBatch(ctx, []model.MetricJSON{gaugeTS(3, newer), gaugeTS(4, older)})
+		assert.ErrorIs(t, err, ErrStale)
+
+		// пакет с устаревшим значением не сохраняется целиком
+		metJSON, err := srv.Get(ctx, model.Info{MName: "Gauge-1", MType: model.TypeGaugeConst})
+		if assert.NoError(t, err) {
+			assert.Equal(t, float64(1), *metJSON.Value)
+		}
+
+		// значения без ts не проверяются
+		val := 6.0
+		metJSON, err = srv.Update(ctx, model.MetricJSON{ID: "Gauge-1", MType: "gauge", Value: &val})
+		if assert.NoError(t, err) {
+			assert.Equal(t, val, *metJSON.Value)
+		}
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		srv := newSrv(t, StaleAccept)
+
+		metJSON, err := srv.Update(ctx, gaugeTS(2, older))
+		if assert.NoError(t, err) {
+			assert.Equal(t, float64(2), *metJSON.Value)
+			assert.Equal(t, older, *metJSON.TS)
+		}
+	})
+
+	t.Run("store err", func(t *testing.T) {
+		srv := New(&fakeStore{err: errors.New("get err")}, SetStalePolicy(StaleIgnore))
+
+		_, err := srv.Update(ctx, gaugeTS(1, stampNow))
+		assert.Error(t, err)
+
+		err = srv.AddBatch(ctx, []model.MetricJSON{gaugeTS(1, stampNow), gaugeTS(2, newer)})
+		assert.Error(t, err)
+	})
+
+	t.Run("store reads", func(t *testing.T) {
+		batch := []model.MetricJSON{gaugeTS(2, newer), gaugeTS(3, older), gaugeTS(4, stampNow)}
+		batch[1].ID = "Gauge-2"
+
+		// по умолчанию хранилище не читается
+		store := &readStore{PingAdapter: adapter.Ping(inmemory.New())}
+		assert.NoError(t, New(store).AddBatch(ctx, batch))
+		assert.Equal(t, 0, store.gets+store.lists)
+
+		// читаются только метрики пакета, каждая один раз
+		store = &readStore{PingAdapter: adapter.Ping(inmemory.New())}
+		assert.NoError(t, New(store, SetStalePolicy(StaleIgnore)).AddBatch(ctx, batch))
+		assert.Equal(t, 2, store.gets)
+		assert.Equal(t, 0, store.lists)
+	})
+}
+
+// readStore хранилище в памяти, считающее чтения.
+type readStore struct {
+	adapter.PingAdapter
+	gets  int
+	lists int
+}
+
+func (rs *readStore) Get(ctx context.Context, info model.Info) (model.Metric, error) {
+	rs.gets++
+
+	return rs.PingAdapter.Get(ctx, info)
+}
+
+func (rs *readStore) List(ctx context.Context) ([]model.Metric, error) {
+	rs.lists++
+
+	return rs.PingAdapter.List(ctx)
+}
+
+// onceStore хранилище, само сохраняющее ключи пакетов.
+type onceStore struct {
+	adapter.PingAdapter
+	keys map[string]struct{}
+	err  error
+}
+
+func (st *onceStore) AddBatchOnce(ctx context.Context, key string, arr []model.Metric) (bool, error) {
+	if st.err != nil {
+		return false, st.err
+	}
+
+	if _, ok := st.keys[key]; ok {
+		return false, nil
+	}
+
+	st.keys[key] = struct{}{}
+
+	return true, st.AddBatch(ctx, arr)
+}
+
+func TestAddBatchOnce(t *testing.T) {
+	ctx := context.Background()
+	delta := int64(5)
+	list := []model.MetricJSON{{ID: "PollCount", MType: "counter", Delta: &delta}}
+	info := model.Info{MName: "PollCount", MType: model.TypeCountConst}
+
+	check := func(t *testing.T, srv Service, key string, want int64) {
+		t.Helper()
+
+		for _, wantApplied := range []bool{true, false} {
+			applied, err := srv.AddBatchOnce(ctx, key, list)
+			assert.NoError(t, err)
+			assert.Equal(t, wantApplied, applied)
+		}
+
+		metJSON, err := srv.Get(ctx, info)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, *metJSON.Delta)
+		}
+	}
+
+	t.Run("dedup in service", func(t *testing.T) {
+		srv := New(adapter.Ping(inmemory.New()))
+
+		// повтор пакета не удваивает counter
+		check(t, srv, "key-1", 5)
+		check(t, srv, "key-2", 10)
+	})
+
+	t.Run("dedup in store", func(t *testing.T) {
+		store := &onceStore{PingAdapter: adapter.Ping(inmemory.New()), keys: make(map[string]struct{})}
+		srv := New(store)
+
+		check(t, srv, "key-1", 5)
+		assert.Contains(t, store.keys, "key-1")
+		assert.Empty(t, srv.dedup.keys)
+	})
+
+	t.Run("store unsupported", func(t *testing.T) {
+		store := &onceStore{PingAdapter: adapter.Ping(inmemory.New()), err: errors.ErrUnsupported}
+
+		check(t, New(store), "key-1", 5)
+	})
+
+	t.Run("empty key", func(t *testing.T) {
+		srv := New(adapter.Ping(inmemory.New()))
+
+		for i := 0; i < 2; i++ {
+			applied, err := srv.AddBatchOnce(ctx, "", list)
+			assert.NoError(t, err)
+			assert.True(t, applied)
+		}
+	})
+
+	t.Run("store err", func(t *testing.T) {
+		srv := New(&fakeStore{err: errors.New("batch err")})
+
+		_, err := srv.AddBatchOnce(ctx, "key-1", list)
+		assert.Error(t, err)
+
+		// ключ неуспешного пакета освобожден
+		assert.Empty(t, srv.dedup.keys)
+	})
+}
+
+func TestParseStalePolicy(t *testing.T) {
+	policy, err := ParseStalePolicy("reject")
+	if assert.NoError(t, err) {
+		assert.Equal(t, StaleReject, policy)
+	}
+
+	_, err = ParseStalePolicy("drop")
+	assert.ErrorIs(t, err, ErrStalePolicy)
+}
+
+// batchStore хранилище в памяти, считающее вызовы AddBatch.
+type batchStore struct {
+	adapter.PingAdapter
+	batches int
+}
+
+func (bs *batchStore) AddBatch(ctx context.Context, arr []model.Metric) error {
+	bs.batches++
+
+	return bs.PingAdapter.AddBatch(ctx, arr)
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	src := adapter.Ping(inmemory.New())
+	for i := 0; i < 2*importBatchSize+1; i++ {
+		if _, err := src.Update(ctx, stamped(model.NewCounterMetric("Counter-"+strconv.Itoa(i), int64(i)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gauge := stamped(model.NewGaugeMetric("Gauge-1", 10.01))
+	gauge.Unit = "bytes"
+
+	if _, err := src.Update(ctx, gauge); err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := src.List(ctx)
+
+	for _, format := range []dump.Format{dump.FormatJSONL, dump.FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			if err := New(src).Export(ctx, &buf, format); err != nil {
+				t.Fatalf("export: %v\n", err)
+			}
+
+			dst := &batchStore{PingAdapter: adapter.Ping(inmemory.New())}
+
+			count, err := New(dst).Import(ctx, &buf, format)
+			if assert.NoError(t, err) {
+				assert.Equal(t, len(want), count)
+				assert.Equal(t, 3, dst.batches)
+			}
+
+			list, err := dst.List(ctx)
+			if assert.NoError(t, err) {
+				assert.ElementsMatch(t, want, list)
+			}
+		})
+	}
+
+	t.Run("import decode err", func(t *testing.T) {
+		dst := &batchStore{PingAdapter: adapter.Ping(inmemory.New())}
+		data := "{\"format\":\"metrics\",\"version\":1}\n{\"id\":\"A\",\"type\":\"counter\",\"delta\":1}\n{"
+
+		count, err := New(dst).Import(ctx, strings.NewReader(data), dump.FormatJSONL)
+		assert.ErrorIs(t, err, dump.ErrDecode)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("import limits", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		if err := New(src).Export(ctx, &buf, dump.FormatJSONL); err != nil {
+			t.Fatalf("export: %v\n", err)
+		}
+
+		dst := adapter.Ping(inmemory.New())
+
+		count, err := New(dst, SetLimits(Limits{MaxSeries: importBatchSize})).Import(ctx, &buf, dump.FormatJSONL)
+		assert.ErrorIs(t, err, ErrSeriesLimit)
+		assert.Equal(t, importBatchSize, count)
+	})
+
+	t.Run("import stale", func(t *testing.T) {
+		stored := stamped(model.NewGaugeMetric("Gauge-1", 10))
+		stored.TS = stampNow
+
+		dst := adapter.Ping(inmemory.New())
+		if _, err := dst.Update(ctx, stored); err != nil {
+			t.Fatal(err)
+		}
+
+		older := stored
+		older.TS = stampNow.Add(-time.Second)
+
+		var buf bytes.Buffer
+
+		enc, err := dump.NewEncoder(&buf, dump.FormatJSONL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(older); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = New(dst, SetStalePolicy(StaleReject)).Import(ctx, &buf, dump.FormatJSONL)
+		assert.ErrorIs(t, err, ErrStale)
+	})
+
+	t.Run("export store err", func(t *testing.T) {
+		err := New(&fakeStore{err: errors.New("err")}).Export(ctx, io.Discard, dump.FormatJSONL)
+		assert.Error(t, err)
+	})
+}